@@ -1,11 +1,16 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -31,9 +36,13 @@ var (
 	jsonOutput bool
 
 	// Authentication flags
-	cookie    string
-	userAgent string
-	refer     string
+	cookie        string
+	cookieJarSave bool
+	userAgent     string
+	refer         string
+	// cookieFile is the cookie file given by --cookie, cookieHeader is the Cookie header given by --cookie
+	cookieFile   string
+	cookieHeader string
 
 	// Download options
 	playlist       bool
@@ -44,6 +53,27 @@ var (
 	outputName     string
 	fileNameLength uint
 	caption        bool
+	live           bool
+	liveDuration   time.Duration
+	archivePath    string
+	outputFormat   string
+	writeInfoJSON  bool
+	loadInfoJSON   string
+	writeThumbnail bool
+	// the opened --download-archive and the parsed --output
+	archive        *downloader.Archive
+	outputTemplate *downloader.OutputTemplate
+
+	// Post-processing options
+	extractAudio   bool
+	audioFormat    string
+	audioQuality   string
+	audioExtractor *downloader.ExtractAudio
+	remuxVideo     string
+	embedSubs      bool
+	embedThumbnail bool
+	embedMetadata  bool
+	execCommand    string
 
 	// Range options
 	start uint
@@ -51,10 +81,26 @@ var (
 	items string
 
 	// Performance options
-	multiThread bool
-	retry       uint
-	chunkSize   uint
-	thread      uint
+	multiThread       bool
+	retry             uint
+	retryDelay        time.Duration
+	retryMaxDelay     time.Duration
+	retryHosts        []string
+	timeout           time.Duration
+	connectTimeout    time.Duration
+	proxy             string
+	chunkSize         uint
+	thread            uint
+	useFFmpeg         bool
+	backend           string
+	limitRate         string
+	limitRateSchedule string
+	// the limiter of --limit-rate and --limit-rate-schedule shared by the downloads
+	limiter *utils.RateLimiter
+	// the parsed --retry-host
+	hostRetry map[string]request.RetryPolicy
+	// the client of the requests of the extractors and the downloader
+	client *request.Client
 
 	// Aria2 options
 	aria2       bool
@@ -121,18 +167,36 @@ func addFlags(cmd *cobra.Command) {
 
 	// Authentication flags
 	cmd.PersistentFlags().StringVarP(&cookie, "cookie", "c", "", "Cookie")
+	cmd.PersistentFlags().BoolVar(&cookieJarSave, "cookie-jar-save", false, "Write the cookies set by the servers back to the cookies.txt file given by --cookie")
 	cmd.PersistentFlags().StringVarP(&userAgent, "user-agent", "u", "", "Use specified User-Agent")
 	cmd.PersistentFlags().StringVarP(&refer, "refer", "r", "", "Use specified Referrer")
 
 	// Download options
 	cmd.PersistentFlags().BoolVarP(&playlist, "playlist", "p", false, "Download playlist")
-	cmd.PersistentFlags().StringVarP(&streamFormat, "stream-format", "f", "", "Select specific stream to download")
+	cmd.PersistentFlags().StringVarP(&streamFormat, "stream-format", "f", "", "Select a stream by ID or a selector like best[height<=1080]/best")
 	cmd.PersistentFlags().BoolVar(&audioOnly, "audio-only", false, "Download audio only at best quality")
 	cmd.PersistentFlags().StringVarP(&file, "file", "F", "", "URLs file path")
 	cmd.PersistentFlags().StringVarP(&outputPath, "output-path", "o", "", "Specify the output path")
 	cmd.PersistentFlags().StringVarP(&outputName, "output-name", "O", "", "Specify the output file name")
+	cmd.PersistentFlags().StringVar(&outputFormat, "output", "", "Output file path template, eg: \"{extractor}/{playlist_index:03d} - {title} [{id}].{ext}\"")
 	cmd.PersistentFlags().UintVar(&fileNameLength, "file-name-length", 255, "The maximum length of a file name, 0 means unlimited")
 	cmd.PersistentFlags().BoolVarP(&caption, "caption", "C", false, "Download captions")
+	cmd.PersistentFlags().BoolVar(&live, "live", false, "Record live streams until they end, --live-duration elapses or Ctrl+C is pressed")
+	cmd.PersistentFlags().DurationVar(&liveDuration, "live-duration", 0, "Stop recording live streams after the duration, eg: 1h30m")
+	cmd.PersistentFlags().StringVar(&archivePath, "download-archive", "", "Skip the items recorded in the archive file and record the downloaded ones in it")
+	cmd.PersistentFlags().BoolVar(&writeInfoJSON, "write-info-json", false, "Write the extracted data, the stream and the file paths of each item to a .info.json file beside it")
+	cmd.PersistentFlags().StringVar(&loadInfoJSON, "load-info-json", "", "Download the item of a .info.json file written by --write-info-json without extracting it again")
+	cmd.PersistentFlags().BoolVar(&writeThumbnail, "write-thumbnail", false, "Write the thumbnail of each item to an image file beside it")
+
+	// Post-processing options
+	cmd.PersistentFlags().BoolVarP(&extractAudio, "extract-audio", "x", false, "Extract the audio of the best audio stream, or of the smallest stream if there is none (requires ffmpeg)")
+	cmd.PersistentFlags().StringVar(&audioFormat, "audio-format", "best", "The format of --extract-audio: best, mp3, m4a, opus or flac, best keeps the audio as is")
+	cmd.PersistentFlags().StringVar(&audioQuality, "audio-quality", "5", "The quality of --extract-audio from 0 (best) to 10 (worst), or a bitrate like 128K")
+	cmd.PersistentFlags().StringVar(&remuxVideo, "remux-video", "", "Remux the downloaded file into another container without re-encoding, eg: mkv (requires ffmpeg)")
+	cmd.PersistentFlags().BoolVar(&embedSubs, "embed-subs", false, "Download the subtitles and embed them into MP4 and MKV files (requires ffmpeg)")
+	cmd.PersistentFlags().BoolVar(&embedThumbnail, "embed-thumbnail", false, "Embed the thumbnail as the cover art of MP4 and MP3 files")
+	cmd.PersistentFlags().BoolVar(&embedMetadata, "embed-metadata", false, "Embed the title, uploader, upload date, description and URL into MP4 and MP3 files")
+	cmd.PersistentFlags().StringVar(&execCommand, "exec", "", "Run a command after each item is downloaded, {} is replaced with the file path, eg: \"mv {} /videos\"")
 
 	// Range options
 	cmd.PersistentFlags().UintVar(&start, "start", 1, "Define the starting item of a playlist or a file input")
@@ -142,11 +206,21 @@ func addFlags(cmd *cobra.Command) {
 	// Performance options
 	cmd.PersistentFlags().BoolVarP(&multiThread, "multi-thread", "m", false, "Multiple threads to download single video")
 	cmd.PersistentFlags().UintVar(&retry, "retry", 10, "How many times to retry when the download failed")
+	cmd.PersistentFlags().DurationVar(&retryDelay, "retry-delay", time.Second, "The delay before the first retry, it's doubled for each retry")
+	cmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", time.Minute, "The maximum delay before a retry, including the delay asked by Retry-After")
+	cmd.PersistentFlags().StringArrayVar(&retryHosts, "retry-host", nil, "The retry policy of a host and its subdomains, eg: example.com=5,2s,30s (attempts, delay, max delay), can be repeated")
+	cmd.PersistentFlags().DurationVar(&timeout, "timeout", 15*time.Minute, "The timeout of a request including reading its body")
+	cmd.PersistentFlags().DurationVar(&connectTimeout, "connect-timeout", 10*time.Second, "The timeout of connecting to a server and of the TLS handshake")
+	cmd.PersistentFlags().StringVar(&proxy, "proxy", "", "Use the HTTP/SOCKS5 proxy, eg: socks5://127.0.0.1:1080, the proxy of HTTP_PROXY and HTTPS_PROXY is used by default")
 	cmd.PersistentFlags().UintVar(&chunkSize, "chunk-size", 0, "HTTP chunk size for downloading (in MB)")
 	cmd.PersistentFlags().UintVarP(&thread, "thread", "n", 10, "The number of download thread (only works for multiple-parts video)")
+	cmd.PersistentFlags().StringVar(&limitRate, "limit-rate", "", "Maximum download rate in bytes per second shared by all threads, eg: 500K, 2M")
+	cmd.PersistentFlags().StringVar(&limitRateSchedule, "limit-rate-schedule", "", "Download rates by the time of the day, eg: 23:00-07:00=0,09:00-18:00=1M (0 means unlimited)")
+	cmd.PersistentFlags().BoolVar(&useFFmpeg, "ffmpeg", false, "Merge parts with ffmpeg instead of the built-in remuxer and muxer")
+	cmd.PersistentFlags().StringVar(&backend, "backend", "native", "The downloader of the parts: "+strings.Join(downloader.BackendNames(), ", "))
 
 	// Aria2 options
-	cmd.PersistentFlags().BoolVar(&aria2, "aria2", false, "Use Aria2 RPC to download")
+	cmd.PersistentFlags().BoolVar(&aria2, "aria2", false, "Use Aria2 RPC to download, the same as --backend aria2rpc")
 	cmd.PersistentFlags().StringVar(&aria2Token, "aria2-token", "", "Aria2 RPC Token")
 	cmd.PersistentFlags().StringVar(&aria2Addr, "aria2-addr", "localhost:6800", "Aria2 Address")
 	cmd.PersistentFlags().StringVar(&aria2Method, "aria2-method", "http", "Aria2 Method")
@@ -191,7 +265,7 @@ func runDownload(cmd *cobra.Command, args []string) error {
 	// Add command line arguments
 	urls = append(urls, args...)
 
-	if len(urls) < 1 {
+	if len(urls) < 1 && loadInfoJSON == "" {
 		return fmt.Errorf("no URLs provided")
 	}
 
@@ -204,24 +278,110 @@ func runDownload(cmd *cobra.Command, args []string) error {
 			if err != nil {
 				return fmt.Errorf("failed to read cookie file: %w", err)
 			}
+			cookieFile = finalCookie
 			finalCookie = strings.TrimSpace(string(data))
 		}
 	}
+	if cookieJarSave && cookieFile == "" {
+		return fmt.Errorf("--cookie-jar-save requires a cookie file given by --cookie")
+	}
+	fileCookies, err := request.ParseCookieFile(strings.NewReader(finalCookie))
+	if err != nil {
+		return fmt.Errorf("failed to parse cookie file: %w", err)
+	}
+	if len(fileCookies) == 0 {
+		// the cookies of a header are only sent to the sites of the URLs
+		cookieHeader = finalCookie
+	}
+
+	// Handle the download rate
+	var rate int64
+	if limitRate != "" {
+		if rate, err = utils.ParseRate(limitRate); err != nil {
+			return err
+		}
+	}
+	rules, err := utils.ParseRateSchedule(limitRateSchedule)
+	if err != nil {
+		return err
+	}
+	limiter = utils.NewRateLimiter(rate)
+	limiter.SetSchedule(rules)
+
+	// Handle the retry policies
+	if hostRetry, err = request.ParseHostRetry(retryHosts); err != nil {
+		return err
+	}
+
+	// Handle the output template
+	if outputFormat != "" {
+		if outputTemplate, err = downloader.ParseOutputTemplate(outputFormat); err != nil {
+			return err
+		}
+	}
+
+	// Handle the download backend
+	if aria2 && !cmd.Flags().Changed("backend") {
+		backend = "aria2rpc"
+	}
+	if !slices.Contains(downloader.BackendNames(), backend) {
+		return fmt.Errorf("unknown backend %q, it should be one of %s", backend, strings.Join(downloader.BackendNames(), ", "))
+	}
 
-	// Set request options
-	request.SetOptions(request.Options{
-		RetryTimes: int(retry),
-		Cookie:     finalCookie,
-		UserAgent:  userAgent,
-		Refer:      refer,
-		Debug:      debug,
-		Silent:     silent,
+	// Handle the audio extraction
+	if extractAudio {
+		if audioExtractor, err = downloader.NewExtractAudio(audioFormat, audioQuality); err != nil {
+			return err
+		}
+	}
+
+	// Handle the download archive
+	if archivePath != "" {
+		if archive, err = downloader.OpenArchive(archivePath); err != nil {
+			return err
+		}
+	}
+
+	// Create the client of the requests
+	client = request.NewClient(request.Options{
+		RetryTimes:     int(retry),
+		UserAgent:      userAgent,
+		Refer:          refer,
+		Debug:          debug,
+		Silent:         silent,
+		Proxy:          proxy,
+		Timeout:        timeout,
+		ConnectTimeout: connectTimeout,
+		Retry:          request.RetryPolicy{MinDelay: retryDelay, MaxDelay: retryMaxDelay},
+		HostRetry:      hostRetry,
 	})
+	// the cookies of a cookies.txt file are only sent to their domains
+	client.Jar().Add(fileCookies)
+
+	ctx := cmd.Context()
+	if live || liveDuration > 0 {
+		// Ctrl+C stops the recording and what has been recorded is merged, a second one exits
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		context.AfterFunc(ctx, stop)
+	}
 
 	// Download each URL
 	var hasError bool
+	if loadInfoJSON != "" {
+		if err := downloadInfoJSON(ctx, loadInfoJSON); err != nil {
+			fmt.Fprintf(
+				color.Output,
+				"Downloading %s error:\n",
+				color.CyanString("%s", loadInfoJSON),
+			)
+			fmt.Printf("%+v\n", err)
+			hasError = true
+		}
+	}
 	for _, videoURL := range urls {
-		if err := downloadURL(videoURL); err != nil {
+		if err := downloadURL(ctx, videoURL); err != nil {
 			fmt.Fprintf(
 				color.Output,
 				"Downloading %s error:\n",
@@ -232,6 +392,12 @@ func runDownload(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if cookieJarSave {
+		if err := saveCookies(cookieFile); err != nil {
+			return fmt.Errorf("failed to save the cookies: %w", err)
+		}
+	}
+
 	if hasError {
 		return fmt.Errorf("some downloads failed")
 	}
@@ -239,9 +405,48 @@ func runDownload(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// extractorsArchive returns the download archive used to skip the items before extracting them.
+func extractorsArchive() extractors.Archive {
+	// a nil *downloader.Archive isn't a nil extractors.Archive
+	if archive == nil {
+		return nil
+	}
+	return archive
+}
+
+// saveCookies writes the cookies of the client to the cookie file, the file is replaced once it's written.
+func saveCookies(path string) error {
+	tempPath := path + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = client.Jar().Save(file); err != nil {
+		file.Close()        // nolint
+		os.Remove(tempPath) // nolint
+		return err
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(tempPath) // nolint
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// setCookieHeader adds the cookies of the Cookie header to the site of the URL.
+func setCookieHeader(u string) error {
+	if cookieHeader == "" {
+		return nil
+	}
+	return client.Jar().SetHeader(u, cookieHeader)
+}
+
 // downloadURL downloads a single URL
-func downloadURL(videoURL string) error {
-	data, err := extractors.Extract(videoURL, extractors.Options{
+func downloadURL(ctx context.Context, videoURL string) error {
+	if err := setCookieHeader(extractors.ResolveURL(videoURL)); err != nil {
+		return err
+	}
+	data, err := extractors.ExtractContext(ctx, videoURL, extractors.Options{
 		Playlist:         playlist,
 		Items:            items,
 		ItemStart:        int(start),
@@ -252,11 +457,58 @@ func downloadURL(videoURL string) error {
 		YoukuCcode:       youkuCcode,
 		YoukuCkey:        youkuCkey,
 		YoukuPassword:    youkuPassword,
+		Archive:          extractorsArchive(),
+		Client:           client,
 	})
 	if err != nil {
 		return err
 	}
 
+	return downloadData(ctx, data, streamFormat)
+}
+
+// downloadInfoJSON downloads the item of an info JSON file, its requested stream is downloaded unless -f is given.
+func downloadInfoJSON(ctx context.Context, path string) error {
+	infoJSON, err := downloader.ReadInfoJSON(path)
+	if err != nil {
+		return err
+	}
+	if err = setCookieHeader(infoJSON.Data.URL); err != nil {
+		return err
+	}
+	stream := streamFormat
+	if stream == "" && infoJSON.RequestedStream != nil {
+		stream = infoJSON.RequestedStream.ID
+	}
+	return downloadData(ctx, []*extractors.Data{infoJSON.Data}, stream)
+}
+
+// postProcessors returns the post-processors of the flags, the file is converted before anything is embedded into it,
+// the audio is extracted rather than remuxed if both are given.
+func postProcessors() []downloader.PostProcessor {
+	var processors []downloader.PostProcessor
+	if audioExtractor != nil {
+		processors = append(processors, audioExtractor)
+	} else if remuxVideo != "" {
+		processors = append(processors, downloader.ConvertContainer{Format: remuxVideo})
+	}
+	if embedSubs {
+		processors = append(processors, downloader.EmbedSubtitles{})
+	}
+	if embedThumbnail {
+		processors = append(processors, downloader.EmbedThumbnail{Client: client})
+	}
+	if embedMetadata {
+		processors = append(processors, downloader.EmbedMetadata{})
+	}
+	if execCommand != "" {
+		processors = append(processors, downloader.Exec{Command: execCommand})
+	}
+	return processors
+}
+
+// downloadData prints or downloads the extracted items with the stream selector
+func downloadData(ctx context.Context, data []*extractors.Data, stream string) error {
 	if jsonOutput {
 		e := json.NewEncoder(os.Stdout)
 		e.SetIndent("", "\t")
@@ -270,17 +522,29 @@ func downloadURL(videoURL string) error {
 	defaultDownloader := downloader.New(downloader.Options{
 		Silent:         silent,
 		InfoOnly:       info,
-		Stream:         streamFormat,
+		Client:         client,
+		Stream:         stream,
 		AudioOnly:      audioOnly,
+		ExtractAudio:   extractAudio,
 		Refer:          refer,
 		OutputPath:     outputPath,
 		OutputName:     outputName,
+		OutputTemplate: outputTemplate,
 		FileNameLength: int(fileNameLength),
-		Caption:        caption,
+		Caption:        caption || embedSubs,
+		Archive:        archive,
+		WriteInfoJSON:  writeInfoJSON,
+		WriteThumbnail: writeThumbnail,
+		PostProcessors: postProcessors(),
+		Live:           live || liveDuration > 0,
+		LiveDuration:   liveDuration,
 		MultiThread:    multiThread,
 		ThreadNumber:   int(thread),
 		RetryTimes:     int(retry),
 		ChunkSizeMB:    int(chunkSize),
+		UseFFmpeg:      useFFmpeg,
+		Backend:        backend,
+		Limiter:        limiter,
 		UseAria2RPC:    aria2,
 		Aria2Token:     aria2Token,
 		Aria2Method:    aria2Method,
@@ -289,11 +553,17 @@ func downloadURL(videoURL string) error {
 
 	var errors []error
 	for _, item := range data {
+		if item.Err == extractors.ErrArchived {
+			if !silent {
+				fmt.Printf("%s: %s is already in the download archive, skipping\n", item.URL, item.ArchiveKey())
+			}
+			continue
+		}
 		if item.Err != nil {
 			errors = append(errors, item.Err)
 			continue
 		}
-		if err = defaultDownloader.Download(item); err != nil {
+		if err := defaultDownloader.DownloadContext(ctx, item); err != nil {
 			slog.Error("Failed to download item", "url", item.URL, "error", err)
 			errors = append(errors, err)
 		}
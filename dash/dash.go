@@ -0,0 +1,500 @@
+package dash
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/request"
+)
+
+// Track is a representation resolved against its period and adaptation set.
+type Track struct {
+	ID string
+	// video or audio
+	Kind      string
+	MimeType  string
+	Codecs    string
+	Lang      string
+	Width     int
+	Height    int
+	FrameRate float64
+	Bandwidth int64
+	// Duration of the track in seconds
+	Duration float64
+	// Size is the exact size of the track if it's known, or estimated by the bandwidth
+	Size  int64
+	Parts []*extractors.Part
+}
+
+// Load fetches and parses the manifest of the given URL with the client, a nil client is the default client.
+func Load(client *request.Client, uri string, headers map[string]string) (*MPD, error) {
+	return LoadContext(context.Background(), client, uri, headers)
+}
+
+// LoadContext is like Load but the request is canceled with ctx.
+func LoadContext(ctx context.Context, client *request.Client, uri string, headers map[string]string) (*MPD, error) {
+	if uri == "" {
+		return nil, errors.New("url is null")
+	}
+	content, err := client.GetWithContext(ctx, uri, "", headers)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return Parse(content, uri)
+}
+
+// Streams fetches the manifest of the given URL and turns it into streams.
+func Streams(client *request.Client, uri string, headers map[string]string) (map[string]*extractors.Stream, error) {
+	return StreamsContext(context.Background(), client, uri, headers)
+}
+
+// StreamsContext is like Streams but the requests are canceled with ctx.
+func StreamsContext(ctx context.Context, client *request.Client, uri string, headers map[string]string) (map[string]*extractors.Stream, error) {
+	mpd, err := LoadContext(ctx, client, uri, headers)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := mpd.StreamsContext(ctx, client, headers)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		for _, stream := range streams {
+			for _, part := range stream.Parts {
+				part.Headers = headers
+			}
+		}
+	}
+	return streams, nil
+}
+
+// Streams turns the manifest into streams, the client and the headers are used to fetch the segment indexes.
+// Each video track is paired with the audio track of the highest bandwidth,
+// and each audio track becomes an audio only stream as well.
+func (m *MPD) Streams(client *request.Client, headers map[string]string) (map[string]*extractors.Stream, error) {
+	return m.StreamsContext(context.Background(), client, headers)
+}
+
+// StreamsContext is like Streams but the requests are canceled with ctx.
+func (m *MPD) StreamsContext(ctx context.Context, client *request.Client, headers map[string]string) (map[string]*extractors.Stream, error) {
+	tracks, err := m.TracksContext(ctx, client, headers)
+	if err != nil {
+		return nil, err
+	}
+	var videos, audios []*Track
+	for _, t := range tracks {
+		switch t.Kind {
+		case "video":
+			videos = append(videos, t)
+		case "audio":
+			audios = append(audios, t)
+		}
+	}
+	sort.SliceStable(audios, func(i, j int) bool { return audios[i].Bandwidth > audios[j].Bandwidth })
+
+	streams := make(map[string]*extractors.Stream, len(videos)+len(audios))
+	for _, v := range videos {
+		stream := &extractors.Stream{
+			ID:      v.StreamID(),
+			Quality: v.Quality(),
+			Parts:   v.Parts,
+			Size:    v.Size,
+			Ext:     v.Ext(),
+		}
+		if len(audios) > 0 {
+			a := audios[0]
+			stream.Parts = append(append([]*extractors.Part{}, v.Parts...), a.Parts...)
+			stream.Size += a.Size
+			stream.Quality += " + " + a.Quality()
+			stream.NeedMux = true
+		}
+		stream.ID = extractors.UniqueStreamID(streams, stream.ID, v.Codecs)
+		streams[stream.ID] = stream
+	}
+	for _, a := range audios {
+		id := extractors.UniqueStreamID(streams, a.StreamID(), a.Codecs)
+		streams[id] = &extractors.Stream{
+			ID:      id,
+			Quality: a.Quality(),
+			Parts:   a.Parts,
+			Size:    a.Size,
+			Ext:     a.Ext(),
+		}
+	}
+	if len(streams) == 0 {
+		return nil, errors.New("no audio or video tracks in the mpd manifest")
+	}
+	return streams, nil
+}
+
+// Tracks resolves all representations of the manifest,
+// the parts of the representations with the same ID in different periods are concatenated.
+func (m *MPD) Tracks(client *request.Client, headers map[string]string) ([]*Track, error) {
+	return m.TracksContext(context.Background(), client, headers)
+}
+
+// TracksContext is like Tracks but the requests are canceled with ctx.
+func (m *MPD) TracksContext(ctx context.Context, client *request.Client, headers map[string]string) ([]*Track, error) {
+	if m.Type == "dynamic" {
+		return nil, errors.New("live mpd manifests are not supported")
+	}
+	total, err := parseDuration(m.MediaPresentationDuration)
+	if err != nil {
+		return nil, err
+	}
+	base := resolveURL(m.base, m.BaseURL)
+
+	var tracks []*Track
+	byID := make(map[string]*Track)
+	for i, period := range m.Periods {
+		duration, err := m.periodDuration(i, total)
+		if err != nil {
+			return nil, err
+		}
+		periodBase := resolveURL(base, period.BaseURL)
+		for _, set := range period.AdaptationSets {
+			setBase := resolveURL(periodBase, set.BaseURL)
+			for _, rep := range set.Representations {
+				t := newTrack(set, rep, duration)
+				if t.Kind == "" {
+					continue
+				}
+				parts, size, err := representationParts(
+					ctx, resolveURL(setBase, rep.BaseURL), rep,
+					first(rep.Template, set.Template, period.Template),
+					first(rep.SegmentList, set.SegmentList, period.SegmentList),
+					first(rep.SegmentBase, set.SegmentBase, period.SegmentBase),
+					duration, client, headers,
+				)
+				if err != nil {
+					return nil, errors.WithMessagef(err, "representation %s", rep.ID)
+				}
+				for _, part := range parts {
+					part.Ext = t.Ext()
+					part.Track = t.Kind
+				}
+				t.Parts = parts
+				if size > 0 {
+					t.Size = size
+				} else {
+					t.Size = int64(float64(t.Bandwidth) / 8 * duration)
+				}
+
+				if prev, ok := byID[t.ID]; ok && t.ID != "" {
+					prev.Parts = append(prev.Parts, t.Parts...)
+					prev.Size += t.Size
+					prev.Duration += t.Duration
+					continue
+				}
+				byID[t.ID] = t
+				tracks = append(tracks, t)
+			}
+		}
+	}
+	return tracks, nil
+}
+
+// periodDuration returns the duration of the i-th period in seconds.
+func (m *MPD) periodDuration(i int, total float64) (float64, error) {
+	period := m.Periods[i]
+	if period.Duration != "" {
+		return parseDuration(period.Duration)
+	}
+	start, err := parseDuration(period.Start)
+	if err != nil {
+		return 0, err
+	}
+	if i+1 < len(m.Periods) && m.Periods[i+1].Start != "" {
+		next, err := parseDuration(m.Periods[i+1].Start)
+		if err != nil {
+			return 0, err
+		}
+		return next - start, nil
+	}
+	return total - start, nil
+}
+
+func newTrack(set *AdaptationSet, rep *Representation, duration float64) *Track {
+	t := &Track{
+		ID:        rep.ID,
+		MimeType:  first(rep.MimeType, set.MimeType),
+		Codecs:    first(rep.Codecs, set.Codecs),
+		Lang:      set.Lang,
+		Width:     rep.Width,
+		Height:    rep.Height,
+		Bandwidth: rep.Bandwidth,
+		Duration:  duration,
+	}
+	if t.Width == 0 && t.Height == 0 {
+		t.Width, t.Height = set.Width, set.Height
+	}
+	t.FrameRate = parseFrameRate(first(rep.FrameRate, set.FrameRate))
+
+	kind := set.ContentType
+	if kind == "" {
+		kind, _, _ = strings.Cut(t.MimeType, "/")
+	}
+	switch kind {
+	case "video", "audio":
+		t.Kind = kind
+	}
+	return t
+}
+
+// StreamID returns an identifier of the track that is stable across extractions, eg: 1080p-5000k, audio-en-128k
+func (t *Track) StreamID() string {
+	kbps := t.Bandwidth / 1000
+	if t.Kind == "audio" {
+		if t.Lang != "" {
+			return fmt.Sprintf("audio-%s-%dk", t.Lang, kbps)
+		}
+		return fmt.Sprintf("audio-%dk", kbps)
+	}
+	if t.Height > 0 {
+		return fmt.Sprintf("%dp-%dk", t.Height, kbps)
+	}
+	return fmt.Sprintf("%dk", kbps)
+}
+
+// Quality returns a human readable description of the track, eg: 1920x1080 5000 kbps avc1.640028
+func (t *Track) Quality() string {
+	var quality []string
+	if t.Width > 0 && t.Height > 0 {
+		quality = append(quality, fmt.Sprintf("%dx%d", t.Width, t.Height))
+	}
+	if t.Bandwidth > 0 {
+		quality = append(quality, fmt.Sprintf("%d kbps", t.Bandwidth/1000))
+	}
+	if t.Codecs != "" {
+		quality = append(quality, t.Codecs)
+	}
+	return strings.Join(quality, " ")
+}
+
+// Ext returns the file extension of the track.
+func (t *Track) Ext() string {
+	switch t.MimeType {
+	case "video/webm", "audio/webm":
+		return "webm"
+	case "audio/mp4":
+		return "m4a"
+	}
+	return "mp4"
+}
+
+// representationParts returns the parts of a representation and their total size if it is known.
+func representationParts(
+	ctx context.Context, base *url.URL, rep *Representation, template *SegmentTemplate, list *SegmentList, segmentBase *SegmentBase,
+	duration float64, client *request.Client, headers map[string]string,
+) ([]*extractors.Part, int64, error) {
+	switch {
+	case template != nil:
+		parts, err := templateParts(base, rep, template, duration)
+		return parts, 0, err
+	case list != nil:
+		return listParts(base, list)
+	case segmentBase != nil && segmentBase.IndexRange != "":
+		size, err := indexedSize(ctx, client, base.String(), segmentBase.IndexRange, headers)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []*extractors.Part{{URL: base.String(), Size: size}}, size, nil
+	}
+	// the whole resource is a single segment
+	return []*extractors.Part{{URL: base.String()}}, 0, nil
+}
+
+func templateParts(base *url.URL, rep *Representation, template *SegmentTemplate, duration float64) ([]*extractors.Part, error) {
+	timescale := template.Timescale
+	if timescale == 0 {
+		timescale = 1
+	}
+	number := uint64(1)
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+
+	var parts []*extractors.Part
+	if template.Initialization != "" {
+		u := expandTemplate(template.Initialization, rep, 0, 0)
+		parts = append(parts, &extractors.Part{URL: resolveURL(base, u).String()})
+	}
+	if template.Media == "" {
+		return nil, errors.New("invalid mpd manifest: segment template without media")
+	}
+
+	if template.Timeline != nil {
+		var time uint64
+		for i, s := range template.Timeline.S {
+			if s.T != nil {
+				time = *s.T
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// repeat until the start of the next S element or the end of the period
+				end := uint64(duration * float64(timescale))
+				if i+1 < len(template.Timeline.S) && template.Timeline.S[i+1].T != nil {
+					end = *template.Timeline.S[i+1].T
+				}
+				if s.D == 0 || end <= time {
+					return nil, errors.New("invalid mpd manifest: bad segment timeline")
+				}
+				repeat = int64((end-time+s.D-1)/s.D) - 1
+			}
+			for r := int64(0); r <= repeat; r++ {
+				u := expandTemplate(template.Media, rep, number, time)
+				parts = append(parts, &extractors.Part{URL: resolveURL(base, u).String()})
+				number++
+				time += s.D
+			}
+		}
+		return parts, nil
+	}
+
+	if template.Duration == 0 || duration <= 0 {
+		return nil, errors.New("invalid mpd manifest: unknown number of segments")
+	}
+	count := int(math.Ceil(duration * float64(timescale) / float64(template.Duration)))
+	for i := 0; i < count; i++ {
+		u := expandTemplate(template.Media, rep, number, uint64(i)*template.Duration)
+		parts = append(parts, &extractors.Part{URL: resolveURL(base, u).String()})
+		number++
+	}
+	return parts, nil
+}
+
+func listParts(base *url.URL, list *SegmentList) ([]*extractors.Part, int64, error) {
+	var (
+		parts []*extractors.Part
+		size  int64
+		known = true
+	)
+	add := func(uri, byteRange string) error {
+		part := &extractors.Part{URL: base.String()}
+		if uri != "" {
+			part.URL = resolveURL(base, uri).String()
+		}
+		if byteRange == "" {
+			known = false
+		} else {
+			offset, length, err := parseRange(byteRange)
+			if err != nil {
+				return err
+			}
+			part.Range = &extractors.ByteRange{Offset: offset, Length: length}
+			part.Size = length
+			size += length
+		}
+		parts = append(parts, part)
+		return nil
+	}
+	if list.Initialization != nil {
+		if err := add(list.Initialization.SourceURL, list.Initialization.Range); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, s := range list.SegmentURLs {
+		if err := add(s.Media, s.MediaRange); err != nil {
+			return nil, 0, err
+		}
+	}
+	if !known {
+		size = 0
+	}
+	return parts, size, nil
+}
+
+// indexedSize returns the size of a single segment resource by its segment index.
+func indexedSize(ctx context.Context, client *request.Client, uri, indexRange string, headers map[string]string) (int64, error) {
+	offset, length, err := parseRange(indexRange)
+	if err != nil {
+		return 0, err
+	}
+	rangeHeaders := map[string]string{
+		"Range": fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+	}
+	for k, v := range headers {
+		rangeHeaders[k] = v
+	}
+	data, err := client.GetByteWithContext(ctx, uri, "", rangeHeaders)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	size, err := sidxSize(data)
+	if err != nil {
+		return 0, err
+	}
+	return offset + length + size, nil
+}
+
+var reTemplate = regexp.MustCompile(`\$(?:(RepresentationID|Number|Time|Bandwidth)(?:%0(\d+)d)?)?\$`)
+
+// expandTemplate replaces the identifiers of a segment template, eg: $RepresentationID$, $Number%05d$
+func expandTemplate(template string, rep *Representation, number, time uint64) string {
+	return reTemplate.ReplaceAllStringFunc(template, func(s string) string {
+		matches := reTemplate.FindStringSubmatch(s)
+		var value string
+		switch matches[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			value = strconv.FormatUint(number, 10)
+		case "Time":
+			value = strconv.FormatUint(time, 10)
+		case "Bandwidth":
+			value = strconv.FormatInt(rep.Bandwidth, 10)
+		}
+		if width, _ := strconv.Atoi(matches[2]); len(value) < width {
+			value = strings.Repeat("0", width-len(value)) + value
+		}
+		return value
+	})
+}
+
+// parseFrameRate parses a frame rate like 30 or 30000/1001.
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, _ := strconv.ParseFloat(num, 64)
+	if !ok {
+		return n
+	}
+	d, _ := strconv.ParseFloat(den, 64)
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func resolveURL(base *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return base
+	}
+	return base.ResolveReference(u)
+}
+
+// first returns the first non-zero value, it's used to inherit the attributes and elements of the parent.
+func first[T comparable](values ...T) T {
+	var zero T
+	for _, v := range values {
+		if v != zero {
+			return v
+		}
+	}
+	return zero
+}
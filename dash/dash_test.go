@@ -0,0 +1,190 @@
+package dash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const templateManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT10S">
+  <Period>
+    <AdaptationSet mimeType="video/mp4" codecs="avc1.640028">
+      <SegmentTemplate timescale="1000" duration="4000" startNumber="1"
+        initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s"/>
+      <Representation id="v1080" bandwidth="5000000" width="1920" height="1080" frameRate="30000/1001"/>
+      <Representation id="v360" bandwidth="800000" width="640" height="360"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4" lang="en">
+      <Representation id="a128" bandwidth="128000" codecs="mp4a.40.2">
+        <SegmentTemplate timescale="48000" initialization="audio/init.mp4" media="audio/$Time$.m4s">
+          <SegmentTimeline>
+            <S t="0" d="96000" r="2"/>
+            <S d="48000"/>
+          </SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+      <Representation id="a64" bandwidth="64000" codecs="mp4a.40.5">
+        <BaseURL>audio-64.mp4</BaseURL>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestStreamsSegmentTemplate(t *testing.T) {
+	mpd, err := Parse(templateManifest, "https://example.com/video/manifest.mpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams, err := mpd.Streams(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 4 {
+		t.Fatalf("got %d streams, want 4: %v", len(streams), streams)
+	}
+
+	hd, ok := streams["1080p-5000k"]
+	if !ok {
+		t.Fatalf("stream 1080p-5000k not found in %v", streams)
+	}
+	if !hd.NeedMux || hd.Ext != "mp4" {
+		t.Errorf("unexpected stream %+v", hd)
+	}
+	// 1 init + 3 video segments, 1 init + 4 audio segments of the best audio track
+	if len(hd.Parts) != 9 {
+		t.Fatalf("got %d parts, want 9", len(hd.Parts))
+	}
+	wantURLs := []string{
+		"https://example.com/video/v1080/init.mp4",
+		"https://example.com/video/v1080/seg-001.m4s",
+		"https://example.com/video/v1080/seg-002.m4s",
+		"https://example.com/video/v1080/seg-003.m4s",
+		"https://example.com/video/audio/init.mp4",
+		"https://example.com/video/audio/0.m4s",
+		"https://example.com/video/audio/96000.m4s",
+		"https://example.com/video/audio/192000.m4s",
+		"https://example.com/video/audio/288000.m4s",
+	}
+	for i, part := range hd.Parts {
+		if part.URL != wantURLs[i] {
+			t.Errorf("part %d URL = %s, want %s", i, part.URL, wantURLs[i])
+		}
+	}
+	if hd.Parts[0].Track != "video" || hd.Parts[0].Ext != "mp4" || hd.Parts[8].Track != "audio" || hd.Parts[8].Ext != "m4a" {
+		t.Errorf("unexpected tracks %+v %+v", hd.Parts[0], hd.Parts[8])
+	}
+	if hd.Size != (5000000+128000)/8*10 {
+		t.Errorf("Size = %d", hd.Size)
+	}
+
+	audio, ok := streams["audio-en-64k"]
+	if !ok || audio.NeedMux || audio.Ext != "m4a" || len(audio.Parts) != 1 ||
+		audio.Parts[0].URL != "https://example.com/video/audio-64.mp4" {
+		t.Errorf("unexpected audio stream %+v", audio)
+	}
+}
+
+func TestStreamsSegmentList(t *testing.T) {
+	manifest := `<MPD mediaPresentationDuration="PT8S">
+  <BaseURL>https://cdn.example.com/</BaseURL>
+  <Period>
+    <AdaptationSet contentType="video" mimeType="video/webm">
+      <Representation id="1" bandwidth="1000000" height="720">
+        <BaseURL>720.webm</BaseURL>
+        <SegmentList>
+          <Initialization range="0-99"/>
+          <SegmentURL mediaRange="100-1099"/>
+          <SegmentURL mediaRange="1100-1599"/>
+        </SegmentList>
+      </Representation>
+      <Representation id="2" bandwidth="1000000" height="720" codecs="hvc1.1.6.L93.B0">
+        <BaseURL>720-hevc.webm</BaseURL>
+        <SegmentList>
+          <SegmentURL mediaRange="0-999"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+	mpd, err := Parse(manifest, "https://example.com/manifest.mpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams, err := mpd.Streams(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := streams["720p-1000k"]
+	if stream == nil || stream.NeedMux || stream.Ext != "webm" || stream.Size != 1600 || len(stream.Parts) != 3 {
+		t.Fatalf("unexpected stream %+v", stream)
+	}
+	if p := stream.Parts[2]; p.URL != "https://cdn.example.com/720.webm" || p.Range.Offset != 1100 || p.Size != 500 {
+		t.Errorf("unexpected part %+v", p)
+	}
+	// the representation of another codec with the same height and bitrate is kept
+	if hevc := streams["720p-1000k-hvc1"]; hevc == nil || hevc.ID != "720p-1000k-hvc1" ||
+		hevc.Parts[0].URL != "https://cdn.example.com/720-hevc.webm" {
+		t.Errorf("unexpected streams %v", streams)
+	}
+}
+
+// sidx returns a version 0 segment index box referencing the given sizes.
+func sidx(firstOffset uint32, sizes ...uint32) []byte {
+	box := make([]byte, 32+12*len(sizes))
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	copy(box[4:], "sidx")
+	binary.BigEndian.PutUint32(box[24:], firstOffset)
+	binary.BigEndian.PutUint16(box[30:], uint16(len(sizes)))
+	for i, size := range sizes {
+		binary.BigEndian.PutUint32(box[32+12*i:], size)
+	}
+	return box
+}
+
+func TestStreamsSegmentBase(t *testing.T) {
+	index := sidx(10, 1000, 2000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.mpd":
+			fmt.Fprintf(w, `<MPD mediaPresentationDuration="PT4S"><Period><AdaptationSet mimeType="video/mp4">
+<Representation id="1" bandwidth="2000000" height="480"><BaseURL>480.mp4</BaseURL>
+<SegmentBase indexRange="700-%d"><Initialization range="0-699"/></SegmentBase></Representation>
+</AdaptationSet></Period></MPD>`, 700+len(index)-1)
+		case "/480.mp4":
+			if r.Header.Get("Range") != fmt.Sprintf("bytes=700-%d", 700+len(index)-1) {
+				http.Error(w, "unexpected range", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(index) // nolint
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	streams, err := Streams(nil, server.URL+"/manifest.mpd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := streams["480p-2000k"]
+	if stream == nil || len(stream.Parts) != 1 {
+		t.Fatalf("unexpected streams %v", streams)
+	}
+	want := int64(700 + len(index) + 10 + 1000 + 2000)
+	if stream.Size != want || stream.Parts[0].Size != want || !strings.HasSuffix(stream.Parts[0].URL, "/480.mp4") {
+		t.Errorf("unexpected stream %+v, want size %d", stream.Parts[0], want)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	rep := &Representation{ID: "v1", Bandwidth: 500}
+	got := expandTemplate("$RepresentationID$/$Bandwidth$/$Number%05d$-$Time$$$.m4s", rep, 42, 9000)
+	if want := "v1/500/00042-9000$.m4s"; got != want {
+		t.Errorf("expandTemplate() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package dash
+
+import (
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MPD is the root element of a DASH manifest.
+type MPD struct {
+	// eg: static, dynamic
+	Type                      string    `xml:"type,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr"`
+	BaseURL                   string    `xml:"BaseURL"`
+	Periods                   []*Period `xml:"Period"`
+
+	// base is the URL the manifest is fetched from
+	base *url.URL
+}
+
+// Period is a part of the presentation in time.
+type Period struct {
+	ID             string           `xml:"id,attr"`
+	Start          string           `xml:"start,attr"`
+	Duration       string           `xml:"duration,attr"`
+	BaseURL        string           `xml:"BaseURL"`
+	SegmentBase    *SegmentBase     `xml:"SegmentBase"`
+	SegmentList    *SegmentList     `xml:"SegmentList"`
+	Template       *SegmentTemplate `xml:"SegmentTemplate"`
+	AdaptationSets []*AdaptationSet `xml:"AdaptationSet"`
+}
+
+// AdaptationSet is a set of interchangeable representations of the same content,
+// the attributes are inherited by its representations.
+type AdaptationSet struct {
+	ID              string            `xml:"id,attr"`
+	ContentType     string            `xml:"contentType,attr"`
+	MimeType        string            `xml:"mimeType,attr"`
+	Codecs          string            `xml:"codecs,attr"`
+	Lang            string            `xml:"lang,attr"`
+	Width           int               `xml:"width,attr"`
+	Height          int               `xml:"height,attr"`
+	FrameRate       string            `xml:"frameRate,attr"`
+	BaseURL         string            `xml:"BaseURL"`
+	SegmentBase     *SegmentBase      `xml:"SegmentBase"`
+	SegmentList     *SegmentList      `xml:"SegmentList"`
+	Template        *SegmentTemplate  `xml:"SegmentTemplate"`
+	Representations []*Representation `xml:"Representation"`
+}
+
+// Representation is a single encoded version of the content.
+type Representation struct {
+	ID                string           `xml:"id,attr"`
+	Bandwidth         int64            `xml:"bandwidth,attr"`
+	MimeType          string           `xml:"mimeType,attr"`
+	Codecs            string           `xml:"codecs,attr"`
+	Width             int              `xml:"width,attr"`
+	Height            int              `xml:"height,attr"`
+	FrameRate         string           `xml:"frameRate,attr"`
+	AudioSamplingRate string           `xml:"audioSamplingRate,attr"`
+	BaseURL           string           `xml:"BaseURL"`
+	SegmentBase       *SegmentBase     `xml:"SegmentBase"`
+	SegmentList       *SegmentList     `xml:"SegmentList"`
+	Template          *SegmentTemplate `xml:"SegmentTemplate"`
+}
+
+// URL is a reference to a resource or a byte range of it, eg: Initialization.
+type URL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+// SegmentBase describes a single segment resource, indexRange points to its segment index (sidx box).
+type SegmentBase struct {
+	Timescale      uint64 `xml:"timescale,attr"`
+	IndexRange     string `xml:"indexRange,attr"`
+	Initialization *URL   `xml:"Initialization"`
+}
+
+// SegmentURL is a media segment of a SegmentList.
+type SegmentURL struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr"`
+}
+
+// SegmentList lists the URLs of all media segments.
+type SegmentList struct {
+	Timescale      uint64        `xml:"timescale,attr"`
+	Duration       uint64        `xml:"duration,attr"`
+	Initialization *URL          `xml:"Initialization"`
+	SegmentURLs    []*SegmentURL `xml:"SegmentURL"`
+}
+
+// SegmentTemplate generates the URLs of the media segments from a template, eg: $RepresentationID$/$Number$.m4s
+type SegmentTemplate struct {
+	Timescale      uint64           `xml:"timescale,attr"`
+	Duration       uint64           `xml:"duration,attr"`
+	StartNumber    *uint64          `xml:"startNumber,attr"`
+	Media          string           `xml:"media,attr"`
+	Initialization string           `xml:"initialization,attr"`
+	Timeline       *SegmentTimeline `xml:"SegmentTimeline"`
+}
+
+// SegmentTimeline lists the times and durations of the segments of a SegmentTemplate.
+type SegmentTimeline struct {
+	S []*TimelineSegment `xml:"S"`
+}
+
+// TimelineSegment is a run of segments with the same duration, R is the number of repeats.
+type TimelineSegment struct {
+	T *uint64 `xml:"t,attr"`
+	D uint64  `xml:"d,attr"`
+	R int64   `xml:"r,attr"`
+}
+
+// Parse parses an MPD document, relative URLs are resolved against baseURL.
+func Parse(content, baseURL string) (*MPD, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	mpd := &MPD{base: base}
+	if err := xml.Unmarshal([]byte(content), mpd); err != nil {
+		return nil, errors.Wrap(err, "invalid mpd manifest")
+	}
+	if len(mpd.Periods) == 0 {
+		return nil, errors.New("invalid mpd manifest: no periods")
+	}
+	return mpd, nil
+}
+
+var reDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseDuration parses an ISO 8601 duration like PT1H2M3.5S into seconds.
+func parseDuration(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	matches := reDuration.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, errors.Errorf("invalid mpd manifest: bad duration %s", s)
+	}
+	var seconds float64
+	for i, unit := range []float64{24 * 3600, 3600, 60, 1} {
+		if matches[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		seconds += v * unit
+	}
+	return seconds, nil
+}
+
+// parseRange parses a byte range like 0-719 into offset and length.
+func parseRange(s string) (int64, int64, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, errors.Errorf("invalid mpd manifest: bad byte range %s", s)
+	}
+	first, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid mpd manifest: bad byte range %s", s)
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || last < first {
+		return 0, 0, errors.Errorf("invalid mpd manifest: bad byte range %s", s)
+	}
+	return first, last - first + 1, nil
+}
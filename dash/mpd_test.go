@@ -0,0 +1,48 @@
+package dash
+
+import (
+	"testing"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"PT1H2M3.5S", 3723.5},
+		{"PT30S", 30},
+		{"P1DT1M", 86460},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %f, want %f", tt.in, got, tt.want)
+		}
+	}
+	if _, err := parseDuration("1 hour"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	offset, length, err := parseRange("720-1719")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 720 || length != 1000 {
+		t.Errorf("parseRange() = %d, %d", offset, length)
+	}
+	if _, _, err := parseRange("10-5"); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse("<html></html>", "https://example.com/manifest.mpd"); err == nil {
+		t.Error("expected an error for a non-mpd document")
+	}
+}
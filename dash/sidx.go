@@ -0,0 +1,58 @@
+package dash
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// sidxSize returns the number of bytes referenced by a segment index box,
+// counted from the first byte after the box.
+func sidxSize(data []byte) (int64, error) {
+	if len(data) < 8 {
+		return 0, errors.New("invalid sidx box: too short")
+	}
+	boxSize := int(binary.BigEndian.Uint32(data))
+	if string(data[4:8]) != "sidx" {
+		return 0, errors.Errorf("invalid sidx box: unexpected box type %q", data[4:8])
+	}
+	if boxSize > len(data) || boxSize < 12 {
+		return 0, errors.New("invalid sidx box: truncated")
+	}
+	data = data[8:boxSize]
+
+	version := data[0]
+	// version, flags, reference_ID and timescale
+	pos := 12
+	var firstOffset uint64
+	if version == 0 {
+		if len(data) < pos+8 {
+			return 0, errors.New("invalid sidx box: truncated")
+		}
+		firstOffset = uint64(binary.BigEndian.Uint32(data[pos+4:]))
+		pos += 8
+	} else {
+		if len(data) < pos+16 {
+			return 0, errors.New("invalid sidx box: truncated")
+		}
+		firstOffset = binary.BigEndian.Uint64(data[pos+8:])
+		pos += 16
+	}
+	if len(data) < pos+4 {
+		return 0, errors.New("invalid sidx box: truncated")
+	}
+	// reserved
+	count := int(binary.BigEndian.Uint16(data[pos+2:]))
+	pos += 4
+	if len(data) < pos+count*12 {
+		return 0, errors.New("invalid sidx box: truncated")
+	}
+
+	size := int64(firstOffset)
+	for i := 0; i < count; i++ {
+		// the first bit is reference_type, the others are referenced_size
+		size += int64(binary.BigEndian.Uint32(data[pos:]) & 0x7fffffff)
+		pos += 12
+	}
+	return size, nil
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Archive is a download archive file, each line is the key of a downloaded item, eg: bilibili:BV1GJ411x7h7
+type Archive struct {
+	mu   sync.Mutex
+	path string
+	keys map[string]struct{}
+}
+
+// OpenArchive loads the download archive of the path, the file is created when the first item is added.
+func OpenArchive(path string) (*Archive, error) {
+	archive := &Archive{
+		path: path,
+		keys: make(map[string]struct{}),
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return archive, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close() // nolint
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			archive.keys[key] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the download archive %s", path)
+	}
+	return archive, nil
+}
+
+// Has reports whether the key is in the archive.
+func (a *Archive) Has(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.keys[key]
+	return ok
+}
+
+// Add appends the key to the archive file.
+func (a *Archive) Add(key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.keys[key]; ok {
+		return nil
+	}
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = file.WriteString(key + "\n"); err != nil {
+		file.Close() // nolint
+		return errors.WithStack(err)
+	}
+	if err = file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	a.keys[key] = struct{}{}
+	return nil
+}
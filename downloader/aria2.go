@@ -0,0 +1,316 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// aria2PollInterval is the interval of polling the status of the aria2 downloads
+var aria2PollInterval = time.Second
+
+// aria2Client calls the JSON-RPC methods of aria2.
+type aria2Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+type aria2Response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *aria2Error     `json:"error"`
+}
+
+// aria2Error is the error of a method, it's a fault in the results of system.multicall.
+type aria2Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *aria2Error) Error() string {
+	return fmt.Sprintf("aria2 error %d: %s", e.Code, e.Message)
+}
+
+// aria2Call is a method call of system.multicall.
+type aria2Call struct {
+	MethodName string        `json:"methodName"`
+	Params     []interface{} `json:"params"`
+}
+
+// aria2Status is the result of aria2.tellStatus.
+type aria2Status struct {
+	GID             string `json:"gid"`
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+// aria2StatusKeys are the keys of aria2.tellStatus, the other keys aren't returned
+var aria2StatusKeys = []string{"gid", "status", "totalLength", "completedLength", "errorCode", "errorMessage"}
+
+func newAria2Client(option Options) *aria2Client {
+	return &aria2Client{
+		url:    fmt.Sprintf("%s://%s/jsonrpc", option.Aria2Method, option.Aria2Addr),
+		token:  option.Aria2Token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// call calls a method with the params as is, the secret isn't added.
+func (c *aria2Client) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(Aria2RPCData{
+		JSONRPC: "2.0",
+		ID:      "lux",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close() // nolint
+
+	var response aria2Response
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrapf(err, "invalid response of %s, HTTP %d", method, res.StatusCode)
+	}
+	if response.Error != nil {
+		return errors.WithStack(response.Error)
+	}
+	return errors.WithStack(json.Unmarshal(response.Result, result))
+}
+
+// multicall calls the method once for each params in a system.multicall, the secret is added to the params.
+// The results of the failed calls are nil, the error is the first fault.
+func (c *aria2Client) multicall(ctx context.Context, method string, params [][]interface{}) ([]json.RawMessage, error) {
+	calls := make([]aria2Call, len(params))
+	for i, p := range params {
+		calls[i] = aria2Call{MethodName: method, Params: append([]interface{}{"token:" + c.token}, p...)}
+	}
+	var values []json.RawMessage
+	if err := c.call(ctx, "system.multicall", []interface{}{calls}, &values); err != nil {
+		return nil, err
+	}
+	if len(values) != len(calls) {
+		return nil, errors.Errorf("got %d results of system.multicall, want %d", len(values), len(calls))
+	}
+
+	results := make([]json.RawMessage, len(values))
+	var firstErr error
+	for i, value := range values {
+		// a result is wrapped in an array, a fault is a struct
+		var result []json.RawMessage
+		if json.Unmarshal(value, &result) == nil && len(result) == 1 {
+			results[i] = result[0]
+			continue
+		}
+		fault := &aria2Error{}
+		if err := json.Unmarshal(value, fault); err != nil {
+			fault.Message = string(value)
+		}
+		if firstErr == nil {
+			firstErr = errors.WithMessage(fault, method)
+		}
+	}
+	return results, firstErr
+}
+
+// aria2DefaultConcurrency is the default of max-concurrent-downloads of aria2
+const aria2DefaultConcurrency = 5
+
+// concurrency returns the number of the downloads aria2 runs at the same time, the others are waiting.
+func (c *aria2Client) concurrency(ctx context.Context) int {
+	results, err := c.multicall(ctx, "aria2.getGlobalOption", [][]interface{}{{}})
+	if err != nil {
+		return aria2DefaultConcurrency
+	}
+	var options map[string]string
+	if json.Unmarshal(results[0], &options) != nil {
+		return aria2DefaultConcurrency
+	}
+	n, err := strconv.Atoi(options["max-concurrent-downloads"])
+	if err != nil || n <= 0 {
+		return aria2DefaultConcurrency
+	}
+	return n
+}
+
+// remove removes the downloads, the errors are ignored since they may be stopped already.
+func (c *aria2Client) remove(gids []string) {
+	params := make([][]interface{}, len(gids))
+	for i, gid := range gids {
+		params[i] = []interface{}{gid}
+	}
+	// the context of the download may be canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.multicall(ctx, "aria2.forceRemove", params) // nolint
+}
+
+// aria2Part is a part downloaded by aria2.
+type aria2Part struct {
+	part      *PartDownload
+	gid       string
+	completed int64
+}
+
+// aria2RPCBackend downloads the parts with aria2 RPC, aria2 must write to the same file system.
+type aria2RPCBackend struct {
+	client *aria2Client
+	// split is the number of connections of each download, 0 means the default of aria2
+	split int
+	// rate is the maximum download rate in bytes per second shared by the parts, 0 means unlimited
+	rate int64
+}
+
+func newAria2RPCBackend(option Options) Backend {
+	backend := &aria2RPCBackend{client: newAria2Client(option), rate: option.LimitRate}
+	if option.MultiThread {
+		backend.split = option.ThreadNumber
+	}
+	return backend
+}
+
+// Download adds the downloads of the parts in a system.multicall and polls their status until they are complete.
+func (b *aria2RPCBackend) Download(ctx context.Context, parts []*PartDownload, progress BackendProgress) error {
+	if hasByteRanges(parts) {
+		return errors.WithStack(ErrByteRangeUnsupported)
+	}
+	// the rate is shared by the downloads aria2 runs at the same time, not by the waiting ones
+	var rate int64
+	if b.rate > 0 {
+		rate = partRate(b.rate, min(len(parts), b.client.concurrency(ctx)))
+	}
+	aria2Parts := make([]*aria2Part, len(parts))
+	params := make([][]interface{}, len(parts))
+	for i, part := range parts {
+		absPath, err := filepath.Abs(part.Path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		options := &Aria2Input{
+			Dir:    filepath.Dir(absPath),
+			Out:    filepath.Base(absPath),
+			Header: headerLines(part.Header),
+			// the parts are merged from their paths, a renamed download would leave a stale file there
+			AllowOverwrite:   "true",
+			AutoFileRenaming: "false",
+		}
+		if b.split > 0 {
+			options.Split = strconv.Itoa(b.split)
+		}
+		if rate > 0 {
+			options.MaxDownloadLimit = strconv.FormatInt(rate, 10)
+		}
+		aria2Parts[i] = &aria2Part{part: part}
+		params[i] = []interface{}{[]string{part.URL}, options}
+		progress.Started(part, part.Part.Size)
+	}
+	return b.wait(ctx, aria2Parts, params, progress)
+}
+
+// wait adds the downloads of the parts and reports their progress until they are complete.
+func (b *aria2RPCBackend) wait(ctx context.Context, parts []*aria2Part, params [][]interface{}, progress BackendProgress) error {
+	client := b.client
+	gids, err := client.multicall(ctx, "aria2.addUri", params)
+	var added []string
+	for i, gid := range gids {
+		if gid != nil {
+			json.Unmarshal(gid, &parts[i].gid) // nolint
+			added = append(added, parts[i].gid)
+		}
+	}
+	if err != nil {
+		client.remove(added)
+		for _, p := range parts {
+			progress.Done(p.part, err)
+		}
+		return err
+	}
+
+	// stop removes the downloads which are still active, they fail with err
+	stop := func(active []*aria2Part, err error) error {
+		gids := make([]string, len(active))
+		for i, p := range active {
+			gids[i] = p.gid
+			progress.Done(p.part, err)
+		}
+		client.remove(gids)
+		return err
+	}
+	ticker := time.NewTicker(aria2PollInterval)
+	defer ticker.Stop()
+	active := parts
+	for len(active) > 0 {
+		select {
+		case <-ctx.Done():
+			return stop(active, errors.WithStack(ctx.Err()))
+		case <-ticker.C:
+		}
+
+		params := make([][]interface{}, len(active))
+		for i, p := range active {
+			params[i] = []interface{}{p.gid, aria2StatusKeys}
+		}
+		results, err := client.multicall(ctx, "aria2.tellStatus", params)
+		if err != nil {
+			if ctx.Err() != nil {
+				// removed in the next loop
+				continue
+			}
+			return stop(active, err)
+		}
+		statuses := make([]aria2Status, len(active))
+		for i, result := range results {
+			if err = json.Unmarshal(result, &statuses[i]); err != nil {
+				return stop(active, errors.WithStack(err))
+			}
+		}
+		var (
+			next      []*aria2Part
+			failedErr error
+		)
+		for i, status := range statuses {
+			p := active[i]
+			if completed, _ := strconv.ParseInt(status.CompletedLength, 10, 64); completed > p.completed {
+				progress.Written(p.part, completed-p.completed)
+				p.completed = completed
+			}
+			switch status.Status {
+			case "complete":
+				progress.Done(p.part, nil)
+			case "error", "removed":
+				err = errors.Errorf("aria2 failed to download %s: %s (%s)", p.part.URL, status.ErrorMessage, status.ErrorCode)
+				progress.Done(p.part, err)
+				if failedErr == nil {
+					failedErr = err
+				}
+			default:
+				next = append(next, p)
+			}
+		}
+		if failedErr != nil {
+			// the other downloads are useless without the failed part
+			return stop(next, failedErr)
+		}
+		active = next
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+// fakeAria2 writes the files of aria2.addUri and completes them after two polls.
+type fakeAria2 struct {
+	lock    sync.Mutex
+	options map[string]map[string]interface{}
+	polls   map[string]int
+	// fail fails the downloads of the URL
+	fail string
+	// faultStatus fails the calls of aria2.tellStatus
+	faultStatus bool
+	// concurrency is max-concurrent-downloads, empty means the default of aria2
+	concurrency string
+	removed     []string
+}
+
+func (f *fakeAria2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string `json:"method"`
+		// the method calls are the only param
+		Params [1][]struct {
+			MethodName string            `json:"methodName"`
+			Params     []json.RawMessage `json:"params"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "system.multicall" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var results []interface{}
+	for _, call := range req.Params[0] {
+		var token, gid string
+		json.Unmarshal(call.Params[0], &token) // nolint
+		if token != "token:secret" {
+			results = append(results, map[string]interface{}{"code": 1, "message": "Unauthorized"})
+			continue
+		}
+		switch call.MethodName {
+		case "aria2.addUri":
+			var uris []string
+			var options map[string]interface{}
+			json.Unmarshal(call.Params[1], &uris)    // nolint
+			json.Unmarshal(call.Params[2], &options) // nolint
+			gid = uris[0]
+			f.options[gid] = options
+			results = append(results, []string{gid})
+		case "aria2.tellStatus":
+			if f.faultStatus {
+				results = append(results, map[string]interface{}{"code": 1, "message": "Internal error"})
+				continue
+			}
+			json.Unmarshal(call.Params[1], &gid) // nolint
+			f.polls[gid]++
+			status := map[string]string{"gid": gid, "status": "active", "completedLength": "5"}
+			if gid == f.fail {
+				status["status"], status["errorCode"], status["errorMessage"] = "error", "3", "Resource not found"
+			} else if f.polls[gid] > 1 {
+				options := f.options[gid]
+				path := filepath.Join(options["dir"].(string), options["out"].(string))
+				os.WriteFile(path, []byte(gid), 0644) // nolint
+				status["status"], status["completedLength"] = "complete", "10"
+			}
+			results = append(results, []interface{}{status})
+		case "aria2.getGlobalOption":
+			concurrency := f.concurrency
+			if concurrency == "" {
+				concurrency = "5"
+			}
+			results = append(results, []interface{}{map[string]string{"max-concurrent-downloads": concurrency}})
+		case "aria2.forceRemove":
+			json.Unmarshal(call.Params[1], &gid) // nolint
+			f.removed = append(f.removed, gid)
+			results = append(results, []string{gid})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": "lux", "jsonrpc": "2.0", "result": results}) // nolint
+}
+
+func TestAria2(t *testing.T) {
+	aria2PollInterval = time.Millisecond
+	defer func() { aria2PollInterval = time.Second }()
+	fake := &fakeAria2{options: make(map[string]map[string]interface{}), polls: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title: "aria2",
+		Type:  extractors.DataTypeImage,
+		URL:   "https://example.com/page",
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID: "default",
+				Parts: []*extractors.Part{
+					{URL: "https://example.com/0.jpg", Size: 10, Ext: "jpg", Headers: map[string]string{"Origin": "https://example.com"}},
+					{URL: "https://example.com/1.jpg", Size: 10, Ext: "jpg"},
+				},
+				Size: 20,
+			},
+		},
+	}
+	option := Options{
+		OutputPath:   dir,
+		Silent:       true,
+		MultiThread:  true,
+		ThreadNumber: 4,
+		UseAria2RPC:  true,
+		Aria2Token:   "secret",
+		Aria2Method:  "http",
+		Aria2Addr:    strings.TrimPrefix(server.URL, "http://"),
+		LimitRate:    1000,
+	}
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		url := fmt.Sprintf("https://example.com/%d.jpg", i)
+		if content, _ := os.ReadFile(filepath.Join(dir, fmt.Sprintf("aria2[%d].jpg", i))); string(content) != url {
+			t.Errorf("part %d isn't downloaded, got %q", i, content)
+		}
+		options := fake.options[url]
+		absDir, _ := filepath.Abs(dir)
+		// the rate is shared by the parts
+		if options["dir"] != absDir || options["split"] != "4" || options["max-download-limit"] != "500" ||
+			options["allow-overwrite"] != "true" || options["auto-file-renaming"] != "false" {
+			t.Errorf("unexpected options %v", options)
+		}
+	}
+	headers := fmt.Sprint(fake.options["https://example.com/0.jpg"]["header"])
+	if !strings.Contains(headers, "Referer: https://example.com/page") || !strings.Contains(headers, "Origin: https://example.com") {
+		t.Errorf("the headers aren't forwarded: %s", headers)
+	}
+
+	// the other downloads are removed if one fails
+	fake.fail = "https://example.com/1.jpg"
+	fake.polls = make(map[string]int)
+	data.Title = "failed"
+	err := New(option).Download(data)
+	if err == nil || !strings.Contains(err.Error(), "Resource not found") {
+		t.Fatalf("Download() error = %v, want the aria2 error", err)
+	}
+	if len(fake.removed) != 1 || fake.removed[0] != "https://example.com/0.jpg" {
+		t.Errorf("unexpected removed downloads %v", fake.removed)
+	}
+
+	// the downloads are removed if their status can't be polled
+	fake.fail, fake.faultStatus, fake.removed = "", true, nil
+	data.Title = "fault"
+	if err = New(option).Download(data); err == nil || !strings.Contains(err.Error(), "Internal error") {
+		t.Fatalf("Download() error = %v, want the aria2 fault", err)
+	}
+	if len(fake.removed) != 2 {
+		t.Errorf("unexpected removed downloads %v", fake.removed)
+	}
+	fake.faultStatus = false
+
+	// the rate is shared by the downloads aria2 runs at the same time
+	fake.concurrency = "1"
+	data.Title = "concurrency"
+	if err = New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	if limit := fake.options["https://example.com/1.jpg"]["max-download-limit"]; limit != "1000" {
+		t.Errorf("max-download-limit = %v, want 1000", limit)
+	}
+
+	option.Aria2Token = "wrong"
+	data.Title = "unauthorized"
+	if err = New(option).Download(data); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Download() error = %v, want the aria2 fault", err)
+	}
+}
@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/utils"
+)
+
+// audioFormat is a format of the extracted audio.
+type audioFormat struct {
+	// codec is the family of the codec, see codecFamily
+	codec   string
+	encoder string
+}
+
+// audioFormats are the formats of --audio-format by their extensions
+var audioFormats = map[string]audioFormat{
+	"mp3":  {codec: "mp3", encoder: "libmp3lame"},
+	"m4a":  {codec: "aac", encoder: "aac"},
+	"opus": {codec: "opus", encoder: "libopus"},
+	"flac": {codec: "flac", encoder: "flac"},
+}
+
+// audioExtsByCodec are the extensions of the audio kept as is by the best format
+var audioExtsByCodec = map[string]string{
+	"mp3":    "mp3",
+	"aac":    "m4a",
+	"opus":   "opus",
+	"flac":   "flac",
+	"vorbis": "ogg",
+}
+
+// ExtractAudio strips the video of the downloaded file with ffmpeg,
+// the audio is transcoded unless its codec is the codec of the format.
+type ExtractAudio struct {
+	format string
+	// quality is the VBR quality from 0 (best) to 10 (worst), bitrate overrides it
+	quality int
+	bitrate string
+}
+
+// NewExtractAudio returns an ExtractAudio of the format and the quality.
+// The format is best, mp3, m4a, opus or flac, the best format keeps the audio as is if its codec is known.
+// The quality is a VBR quality from 0 (best) to 10 (worst), or a bitrate like 128K, empty means 5.
+func NewExtractAudio(format, quality string) (*ExtractAudio, error) {
+	format = strings.ToLower(format)
+	if _, ok := audioFormats[format]; !ok && format != "best" && format != "" {
+		return nil, errors.Errorf("unknown audio format %q, it should be best, mp3, m4a, opus or flac", format)
+	}
+	e := &ExtractAudio{format: format, quality: 5}
+	switch {
+	case quality == "":
+	case strings.HasSuffix(strings.ToUpper(quality), "K"):
+		if _, err := strconv.ParseUint(quality[:len(quality)-1], 10, 32); err != nil {
+			return nil, errors.Errorf("invalid audio bitrate %q", quality)
+		}
+		e.bitrate = strings.ToLower(quality)
+	default:
+		q, err := strconv.Atoi(quality)
+		if err != nil || q < 0 || q > 10 {
+			return nil, errors.Errorf("invalid audio quality %q, it should be from 0 to 10 or a bitrate like 128K", quality)
+		}
+		e.quality = q
+	}
+	return e, nil
+}
+
+// Process extracts the audio, the original file is removed.
+func (e *ExtractAudio) Process(ctx context.Context, info *InfoJSON) error {
+	var codec string
+	if info.RequestedStream != nil {
+		codec = codecFamily(newStreamInfo(info.RequestedStream).acodec)
+	}
+	output, args := e.command(info.Filepath, codec)
+	if args == nil {
+		return nil
+	}
+	if output == info.Filepath {
+		return ffmpegReplace(ctx, info.Filepath, args...)
+	}
+	if err := utils.RunFFmpeg(ctx, append(append([]string{"-y"}, args...), output)...); err != nil {
+		os.Remove(output) // nolint
+		return err
+	}
+	os.Remove(info.Filepath) // nolint
+	info.Filepath = output
+	return nil
+}
+
+// command returns the path of the audio file and the arguments of ffmpeg without the output,
+// the arguments are nil if the file is kept as is.
+// codec is the codec family of the audio of the file, empty if it's unknown.
+func (e *ExtractAudio) command(path, codec string) (string, []string) {
+	ext, target := e.format, audioFormats[e.format]
+	if e.format == "best" || e.format == "" {
+		if ext = audioExtsByCodec[codec]; ext != "" {
+			target = audioFormat{codec: codec}
+		} else {
+			// the codec is unknown, it's transcoded to AAC
+			ext, target = "m4a", audioFormats["m4a"]
+		}
+	}
+	output := strings.TrimSuffix(path, filepath.Ext(path)) + "." + ext
+
+	args := []string{"-i", path, "-vn", "-map", "0:a:0"}
+	if codec == target.codec {
+		if output == path {
+			// the file is already an audio file of the format
+			return path, nil
+		}
+		return output, append(args, "-c:a", "copy")
+	}
+	args = append(args, "-c:a", target.encoder)
+	switch {
+	case target.codec == "flac":
+		// lossless
+	case e.bitrate != "":
+		args = append(args, "-b:a", e.bitrate)
+	case target.codec == "mp3":
+		// the VBR quality of LAME is from 0 to 9
+		args = append(args, "-q:a", strconv.Itoa(min(e.quality, 9)))
+	default:
+		// from 256k to 64k
+		args = append(args, "-b:a", strconv.Itoa(256-e.quality*192/10)+"k")
+	}
+	return output, args
+}
@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewExtractAudio(t *testing.T) {
+	for _, tt := range []struct{ format, quality string }{{"best", ""}, {"MP3", "0"}, {"m4a", "128K"}, {"opus", "10"}} {
+		if _, err := NewExtractAudio(tt.format, tt.quality); err != nil {
+			t.Errorf("NewExtractAudio(%q, %q) error: %v", tt.format, tt.quality, err)
+		}
+	}
+	for _, tt := range []struct{ format, quality string }{{"wav", ""}, {"mp3", "11"}, {"mp3", "high"}, {"mp3", "K"}} {
+		if _, err := NewExtractAudio(tt.format, tt.quality); err == nil {
+			t.Errorf("NewExtractAudio(%q, %q) should fail", tt.format, tt.quality)
+		}
+	}
+}
+
+func TestExtractAudioCommand(t *testing.T) {
+	tests := []struct {
+		format, quality string
+		path, codec     string
+		output          string
+		args            []string
+	}{
+		{"mp3", "", "a.mp4", "aac", "a.mp3", []string{"-i", "a.mp4", "-vn", "-map", "0:a:0", "-c:a", "libmp3lame", "-q:a", "5"}},
+		{"mp3", "10", "a.mp4", "", "a.mp3", []string{"-i", "a.mp4", "-vn", "-map", "0:a:0", "-c:a", "libmp3lame", "-q:a", "9"}},
+		{"m4a", "", "a.mp4", "aac", "a.m4a", []string{"-i", "a.mp4", "-vn", "-map", "0:a:0", "-c:a", "copy"}},
+		{"opus", "0", "a.webm", "aac", "a.opus", []string{"-i", "a.webm", "-vn", "-map", "0:a:0", "-c:a", "libopus", "-b:a", "256k"}},
+		{"m4a", "96K", "a.webm", "opus", "a.m4a", []string{"-i", "a.webm", "-vn", "-map", "0:a:0", "-c:a", "aac", "-b:a", "96k"}},
+		{"flac", "96K", "a.mp4", "aac", "a.flac", []string{"-i", "a.mp4", "-vn", "-map", "0:a:0", "-c:a", "flac"}},
+		{"best", "", "a.webm", "opus", "a.opus", []string{"-i", "a.webm", "-vn", "-map", "0:a:0", "-c:a", "copy"}},
+		// the unknown codecs are transcoded to AAC
+		{"best", "", "a.flv", "", "a.m4a", []string{"-i", "a.flv", "-vn", "-map", "0:a:0", "-c:a", "aac", "-b:a", "160k"}},
+		// the audio file is kept as is
+		{"best", "", "a.m4a", "aac", "a.m4a", nil},
+		{"mp3", "", "a.mp3", "mp3", "a.mp3", nil},
+	}
+	for _, tt := range tests {
+		e, err := NewExtractAudio(tt.format, tt.quality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, args := e.command(tt.path, tt.codec)
+		if output != tt.output || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s %s of %s (%s): got %s %q, want %s %q", tt.format, tt.quality, tt.path, tt.codec, output, args, tt.output, tt.args)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package downloader
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
+)
+
+// ErrByteRangeUnsupported is returned by a Backend which can't download byte ranges of files,
+// the parts are downloaded by the native backend instead.
+var ErrByteRangeUnsupported = errors.New("byte ranges are not supported")
+
+// Backend downloads the parts of a stream, the downloaded files are merged and post-processed by the Downloader.
+// The downloads of a backend are limited to the LimitRate of the options it's created with.
+type Backend interface {
+	// Download downloads the parts to their paths, it returns ErrByteRangeUnsupported before downloading anything
+	// if a part has a byte range that can't be downloaded.
+	// The parts of the files that exist and are complete are not passed, the encrypted parts are decrypted after it returns.
+	Download(ctx context.Context, parts []*PartDownload, progress BackendProgress) error
+}
+
+// PartDownload is a part of a stream to download.
+type PartDownload struct {
+	Part *extractors.Part
+	URL  string
+	// Header is the complete header of the request, including the referer, the cookie and the user agent
+	Header http.Header
+	// Range is the byte range of the file of URL, nil means the whole file
+	Range *extractors.ByteRange
+	// Path is the destination of the part
+	Path string
+}
+
+// BackendProgress receives the progress of the parts downloaded by a Backend.
+type BackendProgress interface {
+	Started(part *PartDownload, size int64)
+	// Written reports the n bytes of the part written since the last call
+	Written(part *PartDownload, n int64)
+	Retry(part *PartDownload, attempt int, err error)
+	Done(part *PartDownload, err error)
+}
+
+// partProgress reports the progress of a Backend as the events of the item.
+type partProgress struct {
+	progress *itemProgress
+}
+
+func (p partProgress) Started(part *PartDownload, size int64) {
+	p.progress.partStarted(part.Part, 0, size)
+}
+
+func (p partProgress) Written(part *PartDownload, n int64) {
+	p.progress.bytesWritten(part.Part, 0, n)
+}
+
+func (p partProgress) Retry(part *PartDownload, attempt int, err error) {
+	p.progress.retry(part.Part, 0, attempt, err)
+}
+
+func (p partProgress) Done(part *PartDownload, err error) {
+	p.progress.partDone(part.Part, 0, err)
+}
+
+var (
+	backendsLock sync.RWMutex
+	// backends are the constructors of the backends by name, except the native backend
+	backends = map[string]func(option Options) Backend{
+		"aria2rpc": newAria2RPCBackend,
+		"aria2c":   newAria2cBackend,
+		"curl":     newCurlBackend,
+		"wget":     newWgetBackend,
+	}
+)
+
+// RegisterBackend registers a backend constructor by name, it replaces the backend of the same name.
+// The native backend can't be replaced.
+func RegisterBackend(name string, newBackend func(option Options) Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[name] = newBackend
+}
+
+// BackendNames returns the sorted names of the backends.
+func BackendNames() []string {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	names := []string{"native"}
+	for name := range backends {
+		if name != "native" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backendName returns the name of the backend of the options.
+func (downloader *Downloader) backendName() string {
+	switch {
+	case downloader.option.Backend != "":
+		return downloader.option.Backend
+	case downloader.option.UseAria2RPC:
+		return "aria2rpc"
+	}
+	return "native"
+}
+
+// backend returns the backend of the options.
+func (downloader *Downloader) backend() (Backend, error) {
+	name := downloader.backendName()
+	if name == "native" {
+		return nativeBackend{downloader}, nil
+	}
+	backendsLock.RLock()
+	newBackend, ok := backends[name]
+	backendsLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown download backend %q", name)
+	}
+	option := downloader.option
+	if downloader.limiter.Scheduled() {
+		return nil, errors.Errorf("the %s backend can't change the download rate by the time of the day, use the native backend", name)
+	}
+	// the rate may be changed by SetLimitRate
+	option.LimitRate = downloader.limiter.Rate()
+	return newBackend(option), nil
+}
+
+// partRate returns the rate in bytes per second of each of the n concurrent downloads sharing the rate, 0 means unlimited.
+func partRate(rate int64, n int) int64 {
+	if rate <= 0 {
+		return 0
+	}
+	return max(rate/int64(max(n, 1)), 1)
+}
+
+// downloadParts downloads the parts with the backend of the options.
+func (downloader *Downloader) downloadParts(ctx context.Context, parts []*PartDownload, refer string) error {
+	backend, err := downloader.backend()
+	if err != nil {
+		return err
+	}
+	progress := partProgress{downloader.progress}
+	if native, ok := backend.(nativeBackend); ok {
+		// the native backend skips and decrypts the parts itself
+		return native.Download(ctx, parts, progress)
+	}
+
+	pending := make([]*PartDownload, 0, len(parts))
+	for _, part := range parts {
+		if size, exists, _ := utils.FileSize(part.Path); exists && size != 0 && size == part.Part.Size {
+			progress.Started(part, size)
+			progress.Written(part, size)
+			progress.Done(part, nil)
+			continue
+		}
+		pending = append(pending, part)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if err = backend.Download(ctx, pending, progress); err != nil {
+		if !errors.Is(err, ErrByteRangeUnsupported) {
+			return err
+		}
+		slog.Warn("The backend can't download byte ranges of files, downloading them with the native backend", "backend", downloader.backendName())
+		return nativeBackend{downloader}.Download(ctx, pending, progress)
+	}
+	for _, part := range pending {
+		if part.Part.Key == nil {
+			continue
+		}
+		if err = downloader.decrypt(ctx, part.Part, refer, part.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasByteRanges reports whether some parts are byte ranges of files.
+func hasByteRanges(parts []*PartDownload) bool {
+	for _, part := range parts {
+		if part.Range != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// headerLines returns the header as sorted "Key: Value" lines for the external downloaders.
+func headerLines(header http.Header) []string {
+	var lines []string
+	for key, values := range header {
+		if key == "Accept-Encoding" {
+			// the external downloaders save the compressed body as is
+			continue
+		}
+		for _, value := range values {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// nativeBackend downloads the parts with the built-in HTTP client, it supports resuming and multi-threaded downloads.
+type nativeBackend struct {
+	downloader *Downloader
+}
+
+// Download downloads ThreadNumber parts at a time, each part is split into ThreadNumber ranges with MultiThread.
+func (b nativeBackend) Download(ctx context.Context, parts []*PartDownload, progress BackendProgress) error {
+	downloader := b.downloader
+	wgp := utils.NewWaitGroupPool(downloader.option.ThreadNumber)
+	errs := make([]error, 0)
+	lock := sync.Mutex{}
+	for _, part := range parts {
+		lock.Lock()
+		failed := len(errs) > 0
+		lock.Unlock()
+		if failed || ctx.Err() != nil {
+			break
+		}
+
+		wgp.Add()
+		go func(part *PartDownload) {
+			defer wgp.Done()
+			progress.Started(part, part.Part.Size)
+			refer := part.Header.Get("Referer")
+			var err error
+			if downloader.option.MultiThread {
+				err = downloader.multiThreadSave(ctx, part.Part, refer, part.Path)
+			} else {
+				err = downloader.save(ctx, part.Part, refer, part.Path)
+			}
+			progress.Done(part, err)
+			if err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(part)
+	}
+	wgp.Wait()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return errors.WithStack(ctx.Err())
+}
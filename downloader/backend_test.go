@@ -0,0 +1,289 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/request"
+	"github.com/hydrz/lux/utils"
+)
+
+// fakeBackend writes the URLs of the parts to their paths.
+type fakeBackend struct {
+	parts []*PartDownload
+}
+
+func (b *fakeBackend) Download(_ context.Context, parts []*PartDownload, progress BackendProgress) error {
+	if hasByteRanges(parts) {
+		return ErrByteRangeUnsupported
+	}
+	for _, part := range parts {
+		progress.Started(part, part.Part.Size)
+		if err := os.WriteFile(part.Path, []byte(part.URL), 0644); err != nil {
+			return err
+		}
+		progress.Written(part, int64(len(part.URL)))
+		progress.Done(part, nil)
+		b.parts = append(b.parts, part)
+	}
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	content := []byte("0123456789")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	backend := &fakeBackend{}
+	RegisterBackend("fake", func(Options) Backend { return backend })
+	defer func() {
+		backendsLock.Lock()
+		delete(backends, "fake")
+		backendsLock.Unlock()
+	}()
+
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title: "backend",
+		Type:  extractors.DataTypeImage,
+		URL:   "https://example.com/page",
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID: "default",
+				Parts: []*extractors.Part{
+					{URL: "https://example.com/0.jpg", Size: 25, Ext: "jpg", Headers: map[string]string{"Origin": "https://example.com"}},
+					{URL: "https://example.com/1.jpg", Size: 25, Ext: "jpg"},
+				},
+			},
+		},
+	}
+	option := Options{
+		OutputPath:   dir,
+		Silent:       true,
+		ThreadNumber: 1,
+		RetryTimes:   1,
+		Backend:      "fake",
+		Client:       request.NewClient(request.Options{RetryTimes: 1, UserAgent: "lux"}),
+	}
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(backend.parts))
+	}
+	part := backend.parts[0]
+	if part.URL != "https://example.com/0.jpg" || part.Path != filepath.Join(dir, "backend[0].jpg") || part.Range != nil {
+		t.Errorf("unexpected part %+v", part)
+	}
+	if part.Header.Get("Referer") != "https://example.com/page" || part.Header.Get("Origin") != "https://example.com" ||
+		part.Header.Get("User-Agent") != "lux" {
+		t.Errorf("unexpected header %v", part.Header)
+	}
+
+	// the complete files are skipped
+	backend.parts = nil
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.parts) != 0 {
+		t.Errorf("the complete parts are downloaded again: %v", backend.parts)
+	}
+
+	// the byte ranges are downloaded by the native backend
+	data.Title = "ranges"
+	data.Streams["default"].Parts = []*extractors.Part{
+		{URL: server.URL, Size: 3, Ext: "jpg", Range: &extractors.ByteRange{Offset: 2, Length: 3}},
+		{URL: server.URL, Size: 4, Ext: "jpg", Range: &extractors.ByteRange{Offset: 6, Length: 4}},
+	}
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"234", "6789"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, fmt.Sprintf("ranges[%d].jpg", i))); string(got) != want {
+			t.Errorf("part %d = %q, want %q", i, got, want)
+		}
+	}
+
+	option.LimitRateSchedule = []utils.RateRule{{Start: 0, End: time.Hour, Rate: 1}}
+	data.Title = "schedule"
+	if err := New(option).Download(data); err == nil || !strings.Contains(err.Error(), "time of the day") {
+		t.Errorf("Download() error = %v, want an error of the rate schedule", err)
+	}
+	option.LimitRateSchedule = nil
+	// the schedule of a shared limiter too
+	option.Limiter = utils.NewRateLimiter(0)
+	option.Limiter.SetSchedule([]utils.RateRule{{Start: 0, End: time.Hour, Rate: 1}})
+	if err := New(option).Download(data); err == nil || !strings.Contains(err.Error(), "time of the day") {
+		t.Errorf("Download() error = %v, want an error of the rate schedule", err)
+	}
+	option.Limiter = nil
+
+	option.Backend = "unknown"
+	data.Title = "unknown"
+	if err := New(option).Download(data); err == nil || !strings.Contains(err.Error(), "unknown download backend") {
+		t.Errorf("Download() error = %v, want an unknown backend error", err)
+	}
+}
+
+func TestCommandBackends(t *testing.T) {
+	commandPollInterval = time.Millisecond
+	defer func() { commandPollInterval = 500 * time.Millisecond }()
+	content := []byte("0123456789")
+	var forbidden atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://example.com/page" || r.Header.Get("Origin") != "https://example.com" {
+			forbidden.Add(1)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, name := range []string{"curl", "wget"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := exec.LookPath(name); err != nil {
+				t.Skipf("%s is not installed", name)
+			}
+			dir := t.TempDir()
+			part := &extractors.Part{URL: server.URL, Size: 10, Ext: "jpg", Headers: map[string]string{"Origin": "https://example.com"}}
+			if name == "curl" {
+				part.Size, part.Range = 4, &extractors.ByteRange{Offset: 3, Length: 4}
+			}
+			data := &extractors.Data{
+				Title:   name,
+				Type:    extractors.DataTypeImage,
+				URL:     "https://example.com/page",
+				Streams: map[string]*extractors.Stream{"default": {ID: "default", Parts: []*extractors.Part{part}}},
+			}
+			var written int64
+			option := Options{
+				OutputPath:   dir,
+				Silent:       true,
+				ThreadNumber: 1,
+				RetryTimes:   1,
+				Backend:      name,
+				Progress: ProgressReporterFunc(func(event *ProgressEvent) {
+					written += event.Bytes
+				}),
+			}
+			if err := New(option).Download(data); err != nil {
+				t.Fatal(err)
+			}
+			want := string(content)
+			if part.Range != nil {
+				want = "3456"
+			}
+			if got, _ := os.ReadFile(filepath.Join(dir, name+".jpg")); string(got) != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if written != int64(len(want)) {
+				t.Errorf("%d bytes are reported, want %d", written, len(want))
+			}
+
+			part.Headers = nil
+			data.Title = "forbidden"
+			option.RetryTimes = 3
+			forbidden.Store(0)
+			var statusError *request.StatusError
+			if err := New(option).Download(data); !errors.As(err, &statusError) || statusError.StatusCode != http.StatusForbidden {
+				t.Errorf("Download() error = %v, want a 403 status error", err)
+			}
+			// a permanent error isn't retried
+			if n := forbidden.Load(); n != 1 {
+				t.Errorf("the 403 response is requested %d times, want 1", n)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "forbidden.jpg"+DOWNLOAD_FILE_EXT)); !os.IsNotExist(err) {
+				t.Error("the temporary file of the failed download isn't removed")
+			}
+		})
+	}
+}
+
+func TestCommandBackendArgs(t *testing.T) {
+	part := &PartDownload{
+		URL:    "https://example.com/a.mp4",
+		Header: http.Header{"Cookie": {`session="secret"`}, "Referer": {"https://example.com/"}},
+		Path:   "/tmp/a.mp4",
+	}
+	for _, tt := range []struct {
+		name, rate, input string
+	}{
+		{"curl", "--limit-rate 500", "header = \"Cookie: session=\\\"secret\\\"\"\nheader = \"Referer: https://example.com/\"\n"},
+		{"wget", "--limit-rate 500", "header = Cookie: session=\"secret\"\nheader = Referer: https://example.com/\n"},
+		{"aria2c", "--max-download-limit 500", "https://example.com/a.mp4\n header=Cookie: session=\"secret\"\n header=Referer: https://example.com/\n"},
+	} {
+		// the rate is shared by the threads
+		b := backends[tt.name](Options{LimitRate: 1000, ThreadNumber: 2}).(*commandBackend)
+		args, input := b.args(part, part.Path)
+		if strings.Contains(strings.Join(args, " "), "secret") {
+			t.Errorf("the cookie is in the arguments of %s: %q", tt.name, args)
+		}
+		if !strings.Contains(strings.Join(args, " "), tt.rate) {
+			t.Errorf("the arguments of %s %q don't have %q", tt.name, args, tt.rate)
+		}
+		if input != tt.input {
+			t.Errorf("the input of %s is %q, want %q", tt.name, input, tt.input)
+		}
+	}
+}
+
+func TestLiveBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the segments of the audio playlist are named a0.ts and a1.ts
+		prefix := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/live"), ".m3u8")
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1,\n%[1]s0.ts\n#EXTINF:1,\n%[1]s1.ts\n#EXT-X-ENDLIST\n", prefix) // nolint
+	}))
+	defer server.Close()
+
+	backend := &fakeBackend{}
+	RegisterBackend("fake", func(Options) Backend { return backend })
+	defer func() {
+		backendsLock.Lock()
+		delete(backends, "fake")
+		backendsLock.Unlock()
+	}()
+
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title: "live",
+		Type:  extractors.DataTypeImage,
+		URL:   "https://example.com/page",
+		Streams: map[string]*extractors.Stream{
+			"default": {ID: "default", Playlist: server.URL + "/live.m3u8", AudioPlaylist: server.URL + "/livea.m3u8", Live: true},
+		},
+	}
+	option := Options{OutputPath: dir, Silent: true, ThreadNumber: 1, Live: true, Backend: "fake"}
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	// the segments of the separate audio are recorded as the audio track
+	if len(backend.parts) != 4 {
+		t.Fatalf("%d segments are downloaded by the backend, want 4", len(backend.parts))
+	}
+	for i, want := range []string{"0.ts", "1.ts", "a0.ts", "a1.ts"} {
+		part := backend.parts[i]
+		track := "video"
+		if i >= 2 {
+			track = "audio"
+		}
+		if part.URL != server.URL+"/"+want || part.Part.Track != track {
+			t.Errorf("segment %d is %s of the %s track, want %s of the %s track", i, part.URL, part.Part.Track, want, track)
+		}
+	}
+}
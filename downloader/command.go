@@ -0,0 +1,302 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/request"
+	"github.com/hydrz/lux/utils"
+)
+
+// commandPollInterval is the interval of reporting the size of the files written by the external downloaders
+var commandPollInterval = 500 * time.Millisecond
+
+// commandBackend downloads each part by running an external downloader, eg: curl.
+// The part is written to a temporary file which is renamed when the command succeeds.
+type commandBackend struct {
+	program string
+	// args returns the arguments to download the part to the path and the input of the command.
+	// The headers are passed in the input, the arguments can be seen by the other users of the system.
+	args func(part *PartDownload, path string) (args []string, input string)
+	// inputFlag is the option the input is read with, from the standard input if stdin is set, or from a temporary file
+	inputFlag string
+	stdin     bool
+	// httpStatus returns the HTTP status code of a command which exited with the code and the standard error,
+	// 0 if it didn't fail with an HTTP error
+	httpStatus func(exitCode int, stderr string) int
+	// ranges reports whether the program can download byte ranges
+	ranges  bool
+	threads int
+	retries int
+	client  *request.Client
+}
+
+func newCommandBackend(option Options, program string, ranges bool, args func(part *PartDownload, path string) ([]string, string)) *commandBackend {
+	return &commandBackend{
+		program: program,
+		args:    args,
+		ranges:  ranges,
+		threads: option.ThreadNumber,
+		retries: option.RetryTimes,
+		client:  option.Client,
+	}
+}
+
+func newCurlBackend(option Options) Backend {
+	rate := partRate(option.LimitRate, option.ThreadNumber)
+	b := newCommandBackend(option, "curl", true, func(part *PartDownload, path string) ([]string, string) {
+		args := []string{"--silent", "--show-error", "--fail", "--location", "--output", path}
+		if rate > 0 {
+			args = append(args, "--limit-rate", strconv.FormatInt(rate, 10))
+		}
+		if part.Range != nil {
+			args = append(args, "--range", fmt.Sprintf("%d-%d", part.Range.Offset, part.Range.Offset+part.Range.Length-1))
+		}
+		var input strings.Builder
+		for _, line := range headerLines(part.Header) {
+			fmt.Fprintf(&input, "header = %s\n", curlQuote(line))
+		}
+		return append(args, part.URL), input.String()
+	})
+	b.inputFlag, b.stdin = "--config", true
+	// curl --fail exits with 22 on the HTTP errors
+	b.httpStatus = matchHTTPStatus(22, regexp.MustCompile(`returned error: (\d{3})`))
+	return b
+}
+
+// matchHTTPStatus returns the httpStatus of a program which exits with the code on the HTTP errors and prints their status.
+func matchHTTPStatus(code int, pattern *regexp.Regexp) func(int, string) int {
+	return func(exitCode int, stderr string) int {
+		if exitCode != code {
+			return 0
+		}
+		m := pattern.FindStringSubmatch(stderr)
+		if m == nil {
+			return 0
+		}
+		status, _ := strconv.Atoi(m[1])
+		return status
+	}
+}
+
+// curlQuote quotes a value of a curl config file.
+func curlQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func newWgetBackend(option Options) Backend {
+	rate := partRate(option.LimitRate, option.ThreadNumber)
+	b := newCommandBackend(option, "wget", false, func(part *PartDownload, path string) ([]string, string) {
+		// the errors are printed without the progress
+		args := []string{"--no-verbose", "--output-document", path}
+		if rate > 0 {
+			args = append(args, "--limit-rate", strconv.FormatInt(rate, 10))
+		}
+		var input strings.Builder
+		for _, line := range headerLines(part.Header) {
+			fmt.Fprintf(&input, "header = %s\n", line)
+		}
+		return append(args, part.URL), input.String()
+	})
+	// wget reads its startup file only from a file
+	b.inputFlag = "--config"
+	// wget exits with 8 on the error responses, eg: "ERROR 404: Not Found."
+	b.httpStatus = matchHTTPStatus(8, regexp.MustCompile(`ERROR (\d{3})`))
+	return b
+}
+
+func newAria2cBackend(option Options) Backend {
+	rate := partRate(option.LimitRate, option.ThreadNumber)
+	var split int
+	if option.MultiThread {
+		split = option.ThreadNumber
+	}
+	b := newCommandBackend(option, "aria2c", false, func(part *PartDownload, path string) ([]string, string) {
+		args := []string{
+			"--quiet", "--allow-overwrite=true", "--auto-file-renaming=false",
+			"--dir", filepath.Dir(path), "--out", filepath.Base(path),
+		}
+		if split > 0 {
+			// aria2 allows 16 connections per server at most
+			args = append(args, "--split", strconv.Itoa(split), "--max-connection-per-server", strconv.Itoa(min(split, 16)))
+		}
+		if rate > 0 {
+			args = append(args, "--max-download-limit", strconv.FormatInt(rate, 10))
+		}
+		// the options of a URI of the input file are on the indented lines after it
+		input := part.URL + "\n"
+		for _, line := range headerLines(part.Header) {
+			input += " header=" + line + "\n"
+		}
+		return args, input
+	})
+	b.inputFlag, b.stdin = "--input-file", true
+	// the exit codes of aria2c are the only hint since --quiet hides the responses
+	b.httpStatus = func(exitCode int, _ string) int {
+		switch exitCode {
+		case 3:
+			// resource not found
+			return http.StatusNotFound
+		case 24:
+			// HTTP authorization failed
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	return b
+}
+
+// Download runs the commands of ThreadNumber parts at a time, a failed command is retried by the retry policy of the host.
+func (b *commandBackend) Download(ctx context.Context, parts []*PartDownload, progress BackendProgress) error {
+	if !b.ranges && hasByteRanges(parts) {
+		return errors.WithStack(ErrByteRangeUnsupported)
+	}
+	if _, err := exec.LookPath(b.program); err != nil {
+		return errors.Wrapf(err, "%s is required by the %s backend", b.program, b.program)
+	}
+
+	wgp := utils.NewWaitGroupPool(b.threads)
+	var (
+		errs []error
+		lock sync.Mutex
+	)
+	for _, part := range parts {
+		lock.Lock()
+		failed := len(errs) > 0
+		lock.Unlock()
+		if failed || ctx.Err() != nil {
+			break
+		}
+
+		wgp.Add()
+		go func(part *PartDownload) {
+			defer wgp.Done()
+			progress.Started(part, part.Part.Size)
+			err := b.save(ctx, part, progress)
+			progress.Done(part, err)
+			if err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(part)
+	}
+	wgp.Wait()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return errors.WithStack(ctx.Err())
+}
+
+// save downloads the part with retries.
+func (b *commandBackend) save(ctx context.Context, part *PartDownload, progress BackendProgress) error {
+	tempFilePath := part.Path + DOWNLOAD_FILE_EXT
+	// the bytes of the failed attempts are reported once
+	var reported int64
+	for i := 0; ; i++ {
+		err := b.run(ctx, part, tempFilePath, &reported, progress)
+		if err == nil {
+			return errors.WithStack(os.Rename(tempFilePath, part.Path))
+		}
+		policy := b.client.RetryPolicy(part.URL)
+		if !request.IsRetryable(err) || i+1 >= policy.MaxAttempts(b.retries) || ctx.Err() != nil {
+			os.Remove(tempFilePath) // nolint
+			return err
+		}
+		progress.Retry(part, i+1, err)
+		if err = sleep(ctx, policy.Delay(i+1, err)); err != nil {
+			os.Remove(tempFilePath) // nolint
+			return err
+		}
+	}
+}
+
+// run runs the command once and reports the size of the file while it's running.
+func (b *commandBackend) run(ctx context.Context, part *PartDownload, path string, reported *int64, progress BackendProgress) error {
+	report := func() {
+		if size, _, _ := utils.FileSize(path); size > *reported {
+			progress.Written(part, size-*reported)
+			*reported = size
+		}
+	}
+
+	args, input := b.args(part, path)
+	var stdin io.Reader
+	if input != "" {
+		if b.stdin {
+			args = append([]string{b.inputFlag, "-"}, args...)
+			stdin = strings.NewReader(input)
+		} else {
+			inputPath, err := writeInputFile(b.program, input)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(inputPath) // nolint
+			args = append([]string{b.inputFlag, inputPath}, args...)
+		}
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.program, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return errors.WithStack(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	ticker := time.NewTicker(commandPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			report()
+			if err != nil {
+				if ctx.Err() != nil {
+					return errors.WithStack(ctx.Err())
+				}
+				// the HTTP errors are returned as status errors, so that the permanent ones aren't retried
+				var exitErr *exec.ExitError
+				if b.httpStatus != nil && errors.As(err, &exitErr) {
+					if status := b.httpStatus(exitErr.ExitCode(), stderr.String()); status > 0 {
+						return errors.WithMessage(&request.StatusError{URL: part.URL, StatusCode: status}, b.program)
+					}
+				}
+				return errors.Errorf("%s failed to download %s: %s\n%s", b.program, part.URL, err, stderr.String())
+			}
+			return nil
+		case <-ticker.C:
+			report()
+		}
+	}
+}
+
+// writeInputFile writes the input of the program to a temporary file which only the user can read.
+func writeInputFile(program, input string) (string, error) {
+	// the file is created with the mode 0600
+	file, err := os.CreateTemp("", program+"-*.conf")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer file.Close() // nolint
+	if _, err = file.WriteString(input); err != nil {
+		os.Remove(file.Name()) // nolint
+		return "", errors.WithStack(err)
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
+)
+
+// key returns the decryption key of the part, keys fetched from the same URI are only requested once,
+// the parts which need a key being fetched wait for it.
+func (downloader *Downloader) key(ctx context.Context, part *extractors.Part, refer string) ([]byte, error) {
+	if len(part.Key.Value) > 0 {
+		return part.Key.Value, nil
+	}
+	if part.Key.URI == "" {
+		return nil, errors.New("the key of the encrypted part has neither a value nor an URI")
+	}
+
+	// the lock isn't held while fetching, so that the keys of other URIs aren't blocked
+	downloader.keysLock.Lock()
+	fetch, ok := downloader.keys[part.Key.URI]
+	if !ok {
+		fetch = &keyFetch{done: make(chan struct{})}
+		downloader.keys[part.Key.URI] = fetch
+	}
+	downloader.keysLock.Unlock()
+
+	if !ok {
+		fetch.key, fetch.err = downloader.fetchKey(ctx, part, refer)
+		if fetch.err != nil {
+			// the next part fetches it again
+			downloader.keysLock.Lock()
+			delete(downloader.keys, part.Key.URI)
+			downloader.keysLock.Unlock()
+		}
+		close(fetch.done)
+	}
+	select {
+	case <-fetch.done:
+		return fetch.key, fetch.err
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+// keyFetch is a decryption key which is being fetched or has been fetched, done is closed once it's fetched.
+type keyFetch struct {
+	done chan struct{}
+	key  []byte
+	err  error
+}
+
+// fetchKey requests the decryption key of the part.
+func (downloader *Downloader) fetchKey(ctx context.Context, part *extractors.Part, refer string) ([]byte, error) {
+	body, err := downloader.option.Client.GetByteWithContext(ctx, part.Key.URI, refer, partHeaders(part, refer))
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.DecodeAESKey(body)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "key %s", part.Key.URI)
+	}
+	return key, nil
+}
+
+// decrypt decrypts the downloaded file of the part in place.
+func (downloader *Downloader) decrypt(ctx context.Context, part *extractors.Part, refer, filePath string) error {
+	if part.Key.Method != "AES-128" {
+		return errors.Errorf("unsupported encryption method %s", part.Key.Method)
+	}
+	key, err := downloader.key(ctx, part, refer)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	plain, err := utils.AES128Decrypt(data, key, part.Key.IV)
+	if err != nil {
+		return errors.WithMessagef(err, "decrypt %s", part.URL)
+	}
+	return errors.WithStack(os.WriteFile(filePath, plain, 0644))
+}
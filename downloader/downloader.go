@@ -2,10 +2,11 @@ package downloader
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path"
@@ -16,10 +17,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/mp4"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
@@ -35,12 +36,43 @@ type Options struct {
 	OutputName     string
 	FileNameLength int
 	Caption        bool
+	// Client sends the requests of the downloads, nil means the default client of the request package
+	Client *request.Client
+	// OutputTemplate is the path of the output files relative to OutputPath, it overrides OutputName
+	OutputTemplate *OutputTemplate
+	// Archive records the downloaded items and skips the items in it, nil means no archive
+	Archive *Archive
+	// WriteInfoJSON writes the data, the stream and the output files of each item to <title>.info.json beside the merged file
+	WriteInfoJSON bool
+	// WriteThumbnail writes the best thumbnail to <title>.<ext> beside the merged file
+	WriteThumbnail bool
+	// ExtractAudio selects the best audio stream unless Stream is given, a stream with video is selected if there is no audio stream,
+	// the audio is extracted by the ExtractAudio post-processor
+	ExtractAudio bool
+	// PostProcessors run in order after the parts of an item are merged
+	PostProcessors []PostProcessor
 
 	MultiThread  bool
 	ThreadNumber int
 	RetryTimes   int
 	ChunkSizeMB  int
-	// Aria2
+	// Progress receives the progress events, the progress of each part is shown if it's nil and Silent is false
+	Progress ProgressReporter
+	// UseFFmpeg merges the parts with ffmpeg instead of the built-in remuxer and muxer
+	UseFFmpeg bool
+	// LimitRate is the maximum download rate in bytes per second shared by all downloads, 0 means unlimited
+	LimitRate int64
+	// LimitRateSchedule overrides LimitRate by the time of the day
+	LimitRateSchedule []utils.RateRule
+	// Limiter is shared with the other downloaders so that the rate applies to all of them,
+	// LimitRate and LimitRateSchedule are ignored if it's set
+	Limiter *utils.RateLimiter
+	// Live records the stream by polling its playlist until it ends, LiveDuration elapses or the download is canceled
+	Live         bool
+	LiveDuration time.Duration
+	// Backend is the name of the backend downloading the parts, see BackendNames, empty means native
+	Backend string
+	// Aria2 RPC, UseAria2RPC chooses the aria2rpc backend if Backend is empty
 	UseAria2RPC bool
 	Aria2Token  string
 	Aria2Method string
@@ -49,93 +81,116 @@ type Options struct {
 
 // Downloader is the default downloader.
 type Downloader struct {
-	bar    *pb.ProgressBar
-	option Options
+	option   Options
+	progress *itemProgress
+
+	// keys caches the decryption keys by URI
+	keys     map[string]*keyFetch
+	keysLock sync.Mutex
+
+	limiter *utils.RateLimiter
 }
 
 const (
 	DOWNLOAD_FILE_EXT = ".download"
 )
 
-func progressBar(size int64) *pb.ProgressBar {
-	tmpl := `{{counters .}} {{bar . "[" "=" ">" "-" "]"}} {{speed .}} {{percent . | green}} {{rtime .}}`
-	return pb.New64(size).
-		Set(pb.Bytes, true).
-		SetMaxWidth(1000).
-		SetTemplate(pb.ProgressBarTemplate(tmpl))
-}
-
 // New returns a new Downloader implementation.
 func New(option Options) *Downloader {
 	downloader := &Downloader{
-		option: option,
+		option:  option,
+		keys:    make(map[string]*keyFetch),
+		limiter: option.Limiter,
+	}
+	if downloader.limiter == nil {
+		downloader.limiter = utils.NewRateLimiter(option.LimitRate)
+		downloader.limiter.SetSchedule(option.LimitRateSchedule)
+	}
+	if downloader.option.Progress == nil {
+		if option.Silent {
+			downloader.option.Progress = nopReporter{}
+		} else {
+			downloader.option.Progress = NewMultiLineReporter(os.Stdout)
+		}
 	}
 	return downloader
 }
 
-// caption downloads danmaku, subtitles, etc
-func (downloader *Downloader) caption(url, fileName, ext string, transform func([]byte) ([]byte, error)) error {
+// SetLimitRate changes the maximum download rate in bytes per second, it applies to the running downloads too.
+func (downloader *Downloader) SetLimitRate(rate int64) {
+	downloader.limiter.SetRate(rate)
+}
+
+// SetLimitRateSchedule changes the download rates by the time of the day, it applies to the running downloads too.
+func (downloader *Downloader) SetLimitRateSchedule(schedule []utils.RateRule) {
+	downloader.limiter.SetSchedule(schedule)
+}
+
+// caption downloads danmaku, subtitles, etc, it returns the path of the caption file
+func (downloader *Downloader) caption(ctx context.Context, url, fileName, ext string, transform func([]byte) ([]byte, error)) (string, error) {
 	refer := downloader.option.Refer
 	if refer == "" {
 		refer = url
 	}
-	body, err := request.GetByte(url, refer, nil)
+	body, err := downloader.option.Client.GetByteWithContext(ctx, url, refer, nil)
 	if err != nil {
-		return err
+		return "", err
+	}
+	// captions are small, they are accounted for after the fact
+	if err = downloader.limiter.WaitN(ctx, len(body)); err != nil {
+		return "", err
 	}
 
 	if transform != nil {
 		body, err = transform(body)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
 	filePath, err := utils.FilePath(fileName, ext, downloader.option.FileNameLength, downloader.option.OutputPath, true)
 	if err != nil {
-		return err
+		return "", err
 	}
 	file, fileError := os.Create(filePath)
 	if fileError != nil {
-		return fileError
+		return "", fileError
 	}
 	defer file.Close() // nolint
 
 	if _, err = file.Write(body); err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return filePath, nil
 }
 
-func (downloader *Downloader) writeFile(url string, file *os.File, headers map[string]string) (int64, error) {
-	res, err := request.Request(http.MethodGet, url, nil, headers)
+// writeFile writes the response of the part, rangeIndex is the byte range it belongs to in a multi-threaded download.
+// The request isn't retried, the callers retry it from the written bytes.
+func (downloader *Downloader) writeFile(ctx context.Context, part *extractors.Part, rangeIndex int, file *os.File, headers map[string]string) (int64, error) {
+	res, err := downloader.option.Client.RequestOnceWithContext(ctx, http.MethodGet, part.URL, nil, headers)
 	if err != nil {
 		return 0, err
 	}
 	defer res.Body.Close() // nolint
 
-	barWriter := downloader.bar.NewProxyWriter(file)
+	writer := &progressWriter{w: file, part: part, rangeIndex: rangeIndex, progress: downloader.progress}
 	// Note that io.Copy reads 32kb(maximum) from input and writes them to output, then repeats.
 	// So don't worry about memory.
-	written, copyErr := io.Copy(barWriter, res.Body)
+	written, copyErr := io.Copy(writer, downloader.limiter.Reader(ctx, res.Body))
 	if copyErr != nil && copyErr != io.EOF {
-		return written, errors.Errorf("file copy error: %s", copyErr)
+		return written, errors.Wrap(copyErr, "file copy error")
 	}
 	return written, nil
 }
 
-func (downloader *Downloader) save(part *extractors.Part, refer, fileName string) error {
-	filePath, err := utils.FilePath(fileName, part.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
-	if err != nil {
-		return err
-	}
+func (downloader *Downloader) save(ctx context.Context, part *extractors.Part, refer, filePath string) (err error) {
 	fileSize, exists, err := utils.FileSize(filePath)
 	if err != nil {
 		return err
 	}
 	// Skip segment file
 	if exists && fileSize != 0 && fileSize == part.Size {
-		downloader.bar.Add64(fileSize)
+		downloader.progress.bytesWritten(part, 0, fileSize)
 		return nil
 	}
 
@@ -144,18 +199,18 @@ func (downloader *Downloader) save(part *extractors.Part, refer, fileName string
 	if err != nil {
 		return err
 	}
-	headers := map[string]string{
-		"Referer": refer,
-	}
+	headers := partHeaders(part, refer)
 	var (
 		file      *os.File
 		fileError error
 	)
-	if tempFileSize > 0 {
+	if tempFileSize > 0 || part.Range != nil {
 		// range start from 0, 0-1023 means the first 1024 bytes of the file
-		headers["Range"] = fmt.Sprintf("bytes=%d-", tempFileSize)
+		headers["Range"] = byteRange(part, tempFileSize, -1)
+	}
+	if tempFileSize > 0 {
 		file, fileError = os.OpenFile(tempFilePath, os.O_APPEND|os.O_WRONLY, 0644)
-		downloader.bar.Add64(tempFileSize)
+		downloader.progress.bytesWritten(part, 0, tempFileSize)
 	} else {
 		file, fileError = os.Create(tempFilePath)
 	}
@@ -168,12 +223,25 @@ func (downloader *Downloader) save(part *extractors.Part, refer, fileName string
 		// must close the file before rename or it will cause
 		// `The process cannot access the file because it is being used by another process.` error.
 		file.Close() // nolint
-		if err == nil {
-			os.Rename(tempFilePath, filePath) // nolint
+		if err != nil {
+			if ctx.Err() != nil {
+				// a canceled download isn't resumed
+				os.Remove(tempFilePath) // nolint
+			}
+			return
+		}
+		if part.Key != nil {
+			if err = downloader.decrypt(ctx, part, refer, tempFilePath); err != nil {
+				// the encrypted data can't be resumed after a failed decryption
+				os.Remove(tempFilePath) // nolint
+				return
+			}
 		}
+		err = os.Rename(tempFilePath, filePath)
 	}()
 
-	if downloader.option.ChunkSizeMB > 0 {
+	// the size of some parts is unknown, eg: HLS segments, download them in one go
+	if downloader.option.ChunkSizeMB > 0 && part.Size > 0 {
 		var start, end, chunkSize int64
 		chunkSize = int64(downloader.option.ChunkSizeMB) * 1024 * 1024
 		remainingSize := part.Size
@@ -188,43 +256,50 @@ func (downloader *Downloader) save(part *extractors.Part, refer, fileName string
 		var i int64 = 1
 		for ; i <= chunk; i++ {
 			end = start + chunkSize - 1
-			headers["Range"] = fmt.Sprintf("bytes=%d-%d", start, end)
+			headers["Range"] = byteRange(part, start, end)
 			temp := start
 			for i := 0; ; i++ {
-				written, err := downloader.writeFile(part.URL, file, headers)
+				written, err := downloader.writeFile(ctx, part, 0, file, headers)
 				if err == nil {
 					break
-				} else if i+1 >= downloader.option.RetryTimes {
+				} else if !downloader.canRetry(ctx, part.URL, i+1, err) {
 					return err
 				}
+				downloader.progress.retry(part, 0, i+1, err)
 				temp += written
-				headers["Range"] = fmt.Sprintf("bytes=%d-%d", temp, end)
-				time.Sleep(1 * time.Second)
+				headers["Range"] = byteRange(part, temp, end)
+				if err = sleep(ctx, downloader.option.Client.RetryPolicy(part.URL).Delay(i+1, err)); err != nil {
+					return err
+				}
 			}
 			start = end + 1
 		}
 	} else {
 		temp := tempFileSize
 		for i := 0; ; i++ {
-			written, err := downloader.writeFile(part.URL, file, headers)
+			written, err := downloader.writeFile(ctx, part, 0, file, headers)
 			if err == nil {
 				break
-			} else if i+1 >= downloader.option.RetryTimes {
+			} else if !downloader.canRetry(ctx, part.URL, i+1, err) {
 				return err
 			}
+			downloader.progress.retry(part, 0, i+1, err)
 			temp += written
-			headers["Range"] = fmt.Sprintf("bytes=%d-", temp)
-			time.Sleep(1 * time.Second)
+			headers["Range"] = byteRange(part, temp, -1)
+			if err = sleep(ctx, downloader.option.Client.RetryPolicy(part.URL).Delay(i+1, err)); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer, fileName string) error {
-	filePath, err := utils.FilePath(fileName, dataPart.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
-	if err != nil {
-		return err
+func (downloader *Downloader) multiThreadSave(ctx context.Context, dataPart *extractors.Part, refer, filePath string) error {
+	// the part can't be split into ranges if the size is unknown,
+	// and encrypted parts must be decrypted as a whole
+	if dataPart.Size <= 0 || dataPart.Key != nil {
+		return downloader.save(ctx, dataPart, refer, filePath)
 	}
 	fileSize, exists, err := utils.FileSize(filePath)
 	if err != nil {
@@ -234,7 +309,7 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 	// Skip segment file
 	// TODO: Live video URLs will not return the size
 	if exists && fileSize == dataPart.Size {
-		downloader.bar.Add64(fileSize)
+		downloader.progress.bytesWritten(dataPart, 0, fileSize)
 		return nil
 	}
 	tmpFilePath := filePath + DOWNLOAD_FILE_EXT
@@ -244,7 +319,7 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 	}
 	if tmpExists {
 		if tmpFileSize == dataPart.Size {
-			downloader.bar.Add64(dataPart.Size)
+			downloader.progress.bytesWritten(dataPart, 0, dataPart.Size)
 			return os.Rename(tmpFilePath, filePath)
 		}
 
@@ -254,7 +329,7 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 	}
 
 	// Scan all parts
-	parts, err := readDirAllFilePart(filePath, fileName, dataPart.Ext)
+	parts, err := readDirAllFilePart(filePath)
 	if err != nil {
 		return err
 	}
@@ -329,7 +404,7 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 		}
 	}
 	if savedSize > 0 {
-		downloader.bar.Add64(savedSize)
+		downloader.progress.bytesWritten(dataPart, 0, savedSize)
 		if savedSize == dataPart.Size {
 			return mergeMultiPart(filePath, parts)
 		}
@@ -338,9 +413,15 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 	wgp := utils.NewWaitGroupPool(downloader.option.ThreadNumber)
 	var errs []error
 	var mu sync.Mutex
-	for _, part := range unfinishedPart {
+	for i, part := range unfinishedPart {
 		wgp.Add()
-		go func(part *FilePartMeta) {
+		go func(part *FilePartMeta, rangeIndex int) {
+			downloader.progress.partStarted(dataPart, rangeIndex, part.End-part.Cur+1)
+			var err error
+			defer func() {
+				downloader.progress.partDone(dataPart, rangeIndex, err)
+				wgp.Done()
+			}()
 			file, err := os.OpenFile(filePartPath(filePath, part), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
 			if err != nil {
 				mu.Lock()
@@ -348,15 +429,10 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 				mu.Unlock()
 				return
 			}
-			defer func() {
-				file.Close() // nolint
-				wgp.Done()
-			}()
+			defer file.Close() // nolint
 
 			var end, chunkSize int64
-			headers := map[string]string{
-				"Referer": refer,
-			}
+			headers := partHeaders(dataPart, refer)
 			if downloader.option.ChunkSizeMB <= 0 {
 				chunkSize = part.End - part.Start + 1
 			} else {
@@ -375,33 +451,93 @@ func (downloader *Downloader) multiThreadSave(dataPart *extractors.Part, refer,
 			}
 			for remainingSize > 0 {
 				end = computeEnd(part.Cur, chunkSize, part.End)
-				headers["Range"] = fmt.Sprintf("bytes=%d-%d", part.Cur, end)
+				headers["Range"] = byteRange(dataPart, part.Cur, end)
 				temp := part.Cur
 				for i := 0; ; i++ {
-					written, err := downloader.writeFile(dataPart.URL, file, headers)
+					var written int64
+					written, err = downloader.writeFile(ctx, dataPart, rangeIndex, file, headers)
 					if err == nil {
 						remainingSize -= chunkSize
 						break
-					} else if i+1 >= downloader.option.RetryTimes {
+					} else if !downloader.canRetry(ctx, dataPart.URL, i+1, err) {
 						mu.Lock()
 						errs = append(errs, err)
 						mu.Unlock()
 						return
 					}
+					downloader.progress.retry(dataPart, rangeIndex, i+1, err)
 					temp += written
-					headers["Range"] = fmt.Sprintf("bytes=%d-%d", temp, end)
+					headers["Range"] = byteRange(dataPart, temp, end)
+					if err = sleep(ctx, downloader.option.Client.RetryPolicy(dataPart.URL).Delay(i+1, err)); err != nil {
+						mu.Lock()
+						errs = append(errs, err)
+						mu.Unlock()
+						return
+					}
 				}
 				part.Cur = end + 1
 			}
-		}(part)
+		}(part, i+1)
 	}
 	wgp.Wait()
 	if len(errs) > 0 {
+		if ctx.Err() != nil {
+			// a canceled download isn't resumed
+			for _, part := range parts {
+				os.Remove(filePartPath(filePath, part)) // nolint
+			}
+		}
 		return errs[0]
 	}
 	return mergeMultiPart(filePath, parts)
 }
 
+// canRetry reports whether a part of the URL is downloaded again after the attempt-th attempt failed with err,
+// the number of attempts is RetryTimes unless the retry policy of the host sets it.
+func (downloader *Downloader) canRetry(ctx context.Context, url string, attempt int, err error) bool {
+	attempts := downloader.option.Client.RetryPolicy(url).MaxAttempts(downloader.option.RetryTimes)
+	return attempt < attempts && ctx.Err() == nil && request.IsRetryable(err)
+}
+
+// sleep pauses for the duration, it returns the error of ctx early if ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// partHeaders returns the HTTP headers to download the part.
+func partHeaders(part *extractors.Part, refer string) map[string]string {
+	headers := map[string]string{
+		"Referer": refer,
+	}
+	for k, v := range part.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+// byteRange returns the Range header to fetch the bytes from start to end of the part,
+// both are relative to the beginning of the part and a negative end means the end of the part.
+func byteRange(part *extractors.Part, start, end int64) string {
+	if part.Range != nil {
+		if end < 0 {
+			end = part.Range.Length - 1
+		}
+		start += part.Range.Offset
+		end += part.Range.Offset
+	}
+	if end < 0 {
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
 func filePartPath(filepath string, part *FilePartMeta) string {
 	return fmt.Sprintf("%s.part%f", filepath, part.Index)
 }
@@ -415,7 +551,7 @@ func computeEnd(s, chunkSize, max int64) int64 {
 	return end
 }
 
-func readDirAllFilePart(filePath, filename, extname string) ([]*FilePartMeta, error) {
+func readDirAllFilePart(filePath string) ([]*FilePartMeta, error) {
 	dirPath := filepath.Dir(filePath)
 	dir, err := os.Open(dirPath)
 	if err != nil {
@@ -427,7 +563,7 @@ func readDirAllFilePart(filePath, filename, extname string) ([]*FilePartMeta, er
 		return nil, errors.WithStack(err)
 	}
 	var metas []*FilePartMeta
-	reg := regexp.MustCompile(fmt.Sprintf("%s.%s.part.+", regexp.QuoteMeta(filename), extname))
+	reg := regexp.MustCompile(regexp.QuoteMeta(filepath.Base(filePath)) + `\.part.+`)
 	for _, fn := range fns {
 		if reg.MatchString(fn.Name()) {
 			meta, err := parseFilePartMeta(path.Join(dirPath, fn.Name()), fn.Size())
@@ -505,49 +641,86 @@ func mergeMultiPart(filepath string, parts []*FilePartMeta) error {
 	return err
 }
 
-func (downloader *Downloader) aria2(title string, stream *extractors.Stream) error {
-	rpcData := Aria2RPCData{
-		JSONRPC: "2.0",
-		ID:      "lux", // can be modified
-		Method:  "aria2.addUri",
-	}
-	rpcData.Params[0] = "token:" + downloader.option.Aria2Token
-	var urls []string
-	for _, p := range stream.Parts {
-		urls = append(urls, p.URL)
-	}
-	var inputs Aria2Input
-	inputs.Header = append(inputs.Header, "Referer: "+downloader.option.Refer)
-	for i := range urls {
-		rpcData.Params[1] = urls[i : i+1]
-		inputs.Out = fmt.Sprintf("%s[%d].%s", title, i, stream.Parts[0].Ext)
-		rpcData.Params[2] = &inputs
-		jsonData, err := json.Marshal(rpcData)
-		if err != nil {
-			return err
+// joinTracks joins the files of the parts sharing the same track in order,
+// the joined file takes the place of the first part of its track in the returned paths.
+func joinTracks(parts []*extractors.Part, paths []string, title string, length int, outputPath string) ([]string, error) {
+	result := make([]string, 0, len(paths))
+	trackIndex := make(map[string]int)
+	trackFiles := make(map[string][]string)
+	trackExt := make(map[string]string)
+	for i, part := range parts {
+		if paths[i] == "" {
+			continue
+		}
+		if part.Track == "" {
+			result = append(result, paths[i])
+			continue
 		}
-		reqURL := fmt.Sprintf("%s://%s/jsonrpc", downloader.option.Aria2Method, downloader.option.Aria2Addr)
-		req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewBuffer(jsonData))
+		if _, ok := trackIndex[part.Track]; !ok {
+			trackIndex[part.Track] = len(result)
+			trackExt[part.Track] = part.Ext
+			result = append(result, "")
+		}
+		trackFiles[part.Track] = append(trackFiles[part.Track], paths[i])
+	}
+
+	for track, index := range trackIndex {
+		if len(trackFiles[track]) == 1 {
+			result[index] = trackFiles[track][0]
+			continue
+		}
+		filePath, err := utils.FilePath(fmt.Sprintf("%s[%s]", title, track), trackExt[track], length, outputPath, false)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		req.Header.Set("Content-Type", "application/json")
+		if err = joinFiles(trackFiles[track], filePath); err != nil {
+			return nil, err
+		}
+		result[index] = filePath
+	}
+	return result, nil
+}
 
-		var client = http.Client{Timeout: 30 * time.Second}
-		res, err := client.Do(req)
+// joinFiles concatenates the files into one and removes them.
+func joinFiles(paths []string, filePath string) error {
+	tempFilePath := filePath + DOWNLOAD_FILE_EXT
+	tempFile, err := os.Create(tempFilePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, p := range paths {
+		file, err := os.Open(p)
 		if err != nil {
-			return err
+			tempFile.Close() // nolint
+			return errors.WithStack(err)
+		}
+		_, err = io.Copy(tempFile, file)
+		file.Close() // nolint
+		if err != nil {
+			tempFile.Close() // nolint
+			return errors.WithStack(err)
 		}
-		// The http Client and Transport guarantee that Body is always
-		// non-nil, even on responses without a body or responses with
-		// a zero-length body.
-		res.Body.Close() // nolint
+	}
+	if err = tempFile.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = os.Rename(tempFilePath, filePath); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, p := range paths {
+		os.Remove(p) // nolint
 	}
 	return nil
 }
 
 // Download download urls
 func (downloader *Downloader) Download(data *extractors.Data) error {
+	return downloader.DownloadContext(context.Background(), data)
+}
+
+// DownloadContext is like Download but stops when ctx is canceled,
+// the unfinished files of the canceled download are removed.
+func (downloader *Downloader) DownloadContext(ctx context.Context, data *extractors.Data) error {
 	if len(data.Streams) == 0 {
 		return errors.Errorf("no streams in title %s", data.Title)
 	}
@@ -557,25 +730,21 @@ func (downloader *Downloader) Download(data *extractors.Data) error {
 		printInfo(data, sortedStreams)
 		return nil
 	}
-
-	title := downloader.option.OutputName
-	if title == "" {
-		title = data.Title
-	}
-	// Support multi-level paths in title
-	if strings.Contains(title, "/") {
-		title = utils.FileNameWithPath(title, "", downloader.option.FileNameLength)
-	} else {
-		title = utils.FileName(title, "", downloader.option.FileNameLength)
+	if key := data.ArchiveKey(); key != "" && downloader.option.Archive != nil && downloader.option.Archive.Has(key) {
+		if !downloader.option.Silent {
+			fmt.Printf("%s: %s is already in the download archive, skipping\n", data.Title, key)
+		}
+		return nil
 	}
 
-	streamName := downloader.option.Stream
-	if streamName == "" {
-		streamName = sortedStreams[0].ID
-	}
-	stream, ok := data.Streams[streamName]
-	if !ok {
-		return errors.Errorf("no stream named %s", streamName)
+	var (
+		stream *extractors.Stream
+		err    error
+	)
+	if downloader.option.ExtractAudio && downloader.option.Stream == "" {
+		stream = selectAudioStream(data, sortedStreams)
+	} else if stream, err = selectStream(data, sortedStreams, downloader.option.Stream); err != nil {
+		return err
 	}
 
 	if downloader.option.AudioOnly {
@@ -605,28 +774,59 @@ func (downloader *Downloader) Download(data *extractors.Data) error {
 		}
 	}
 
+	var title string
+	if downloader.option.OutputTemplate != nil {
+		title = downloader.option.OutputTemplate.Render(data, stream, downloader.option.FileNameLength)
+	}
+	if title == "" {
+		title = downloader.option.OutputName
+		if title == "" {
+			title = data.Title
+		}
+		// Support multi-level paths in title
+		if strings.Contains(title, "/") {
+			title = utils.FileNameWithPath(title, "", downloader.option.FileNameLength)
+		} else {
+			title = utils.FileName(title, "", downloader.option.FileNameLength)
+		}
+	}
+
 	if !downloader.option.Silent {
 		printStreamInfo(data, stream)
 	}
 
+	info := &InfoJSON{Data: data, RequestedStream: stream}
 	// download caption
 	if downloader.option.Caption && data.Captions != nil {
 		fmt.Println("\nDownloading captions...")
+		info.CaptionFiles = make(map[string]string, len(data.Captions))
 		for k, v := range data.Captions {
 			if v != nil {
 				fmt.Printf("Downloading %s ...\n", k)
-				downloader.caption(v.URL, title, v.Ext, v.Transform) // nolint
+				if path, err := downloader.caption(ctx, v.URL, title, v.Ext, v.Transform); err == nil {
+					info.CaptionFiles[k] = path
+				}
 			}
 		}
 	}
 
-	// Use aria2 rpc to download
-	if downloader.option.UseAria2RPC {
-		return downloader.aria2(title, stream)
+	if downloader.option.WriteThumbnail && len(data.Thumbnails) > 0 {
+		// a missing thumbnail doesn't fail the item
+		thumbnail, ext, err := downloader.thumbnail(ctx, data.Thumbnails[0].URL)
+		if err != nil {
+			slog.Warn("Failed to download the thumbnail", "url", data.Thumbnails[0].URL, "error", err)
+		} else if info.ThumbnailFile, err = downloader.writeThumbnail(thumbnail, title, ext); err != nil {
+			return err
+		}
 	}
 
-	// Skip the complete file that has been merged
-	mergedFilePath, err := utils.FilePath(title, stream.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
+	// Skip the complete file that has been merged,
+	// a single part is saved with its own extension, eg: the .ts file of an HLS stream
+	ext := stream.Ext
+	if len(stream.Parts) == 1 && !downloader.option.Live {
+		ext = stream.Parts[0].Ext
+	}
+	mergedFilePath, err := utils.FilePath(title, ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
 	if err != nil {
 		return err
 	}
@@ -635,83 +835,164 @@ func (downloader *Downloader) Download(data *extractors.Data) error {
 		return err
 	}
 	// After the merge, the file size has changed, so we do not check whether the size matches
+	info.Filepath = mergedFilePath
 	if mergedFileExists {
 		fmt.Printf("%s: file already exists, skipping\n", mergedFilePath)
-		return nil
+		return downloader.finish(info, title)
 	}
 
-	downloader.bar = progressBar(stream.Size)
-	if !downloader.option.Silent {
-		downloader.bar.Start()
+	downloader.progress = &itemProgress{
+		reporter: downloader.option.Progress,
+		title:    title,
+		parts:    make(map[*extractors.Part]int, len(stream.Parts)),
 	}
-	if len(stream.Parts) == 1 {
-		// only one fragment
-		var err error
-		if downloader.option.MultiThread {
-			err = downloader.multiThreadSave(stream.Parts[0], data.URL, title)
-		} else {
-			err = downloader.save(stream.Parts[0], data.URL, title)
+	for index, part := range stream.Parts {
+		downloader.progress.parts[part] = index
+	}
+	size := stream.Size
+	if downloader.option.Live {
+		// the size of a live stream is unknown
+		size = 0
+	}
+	downloader.progress.report(ProgressEvent{Type: EventItemStarted, Size: size})
+	filePath, err := downloader.download(ctx, data, stream, title, mergedFilePath)
+	if err != nil {
+		downloader.progress.report(ProgressEvent{Type: EventFailed, Err: err})
+		return err
+	}
+	event := ProgressEvent{Type: EventDone}
+	if filePath != "" {
+		info.Filepath = filePath
+		if err = downloader.postProcess(ctx, info); err != nil {
+			downloader.progress.report(ProgressEvent{Type: EventFailed, Err: err})
+			return err
 		}
+		event.Path = info.Filepath
+	}
+	downloader.progress.report(event)
+	return downloader.finish(info, title)
+}
 
-		if err != nil {
+// finish writes the info JSON file and adds the downloaded item to the download archive.
+func (downloader *Downloader) finish(info *InfoJSON, title string) error {
+	if downloader.option.WriteInfoJSON {
+		if err := downloader.writeInfoJSON(info, title); err != nil {
 			return err
 		}
-		downloader.bar.Finish()
+	}
+	key := info.ArchiveKey()
+	if key == "" || downloader.option.Archive == nil {
 		return nil
 	}
+	return downloader.option.Archive.Add(key)
+}
 
-	wgp := utils.NewWaitGroupPool(downloader.option.ThreadNumber)
-	// multiple fragments
-	errs := make([]error, 0)
-	lock := sync.Mutex{}
-	parts := make([]string, len(stream.Parts))
-	for index, part := range stream.Parts {
-		if len(errs) > 0 {
-			break
+// download downloads the parts of the stream and merges them into the merged file.
+// It returns the path of the downloaded file, which is empty if the parts are kept as separate files.
+func (downloader *Downloader) download(ctx context.Context, data *extractors.Data, stream *extractors.Stream, title, mergedFilePath string) (string, error) {
+	if downloader.option.Live {
+		if err := downloader.record(ctx, data, stream, title, mergedFilePath); err != nil || data.Type != extractors.DataTypeVideo {
+			return "", err
 		}
+		return mergedFilePath, nil
+	}
 
-		if downloader.option.AudioOnly && (part.Ext != "m4a") {
-			continue
+	paths := make([]string, len(stream.Parts))
+	parts := make([]*PartDownload, 0, len(stream.Parts))
+	for index, part := range stream.Parts {
+		fileName := title
+		if len(stream.Parts) > 1 {
+			if downloader.option.AudioOnly && (part.Ext != "m4a") {
+				continue
+			}
+			fileName = fmt.Sprintf("%s[%d]", title, index)
 		}
-
-		partFileName := fmt.Sprintf("%s[%d]", title, index)
-		partFilePath, err := utils.FilePath(partFileName, part.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
+		filePath, err := utils.FilePath(fileName, part.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
 		if err != nil {
-			return err
+			return "", err
 		}
-		parts[index] = partFilePath
-
-		wgp.Add()
-		go func(part *extractors.Part, fileName string) {
-			defer wgp.Done()
-			var err error
-			if downloader.option.MultiThread {
-				err = downloader.multiThreadSave(part, data.URL, fileName)
-			} else {
-				err = downloader.save(part, data.URL, fileName)
-			}
-			if err != nil {
-				lock.Lock()
-				errs = append(errs, err)
-				lock.Unlock()
-			}
-		}(part, partFileName)
+		paths[index] = filePath
+		partDownload, err := downloader.partDownload(part, data.URL, filePath)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, partDownload)
 	}
-	wgp.Wait()
-	if len(errs) > 0 {
-		return errs[0]
+	if err := downloader.downloadParts(ctx, parts, data.URL); err != nil {
+		return "", err
 	}
-	downloader.bar.Finish()
 
+	if len(parts) == 1 {
+		// a single part, or the only audio part of an audio only download
+		return parts[0].Path, nil
+	}
 	if data.Type != extractors.DataTypeVideo || downloader.option.AudioOnly {
-		return nil
+		return "", nil
 	}
 
-	if !downloader.option.Silent {
-		fmt.Printf("Merging video parts into %s\n", mergedFilePath)
+	if err := downloader.merge(ctx, stream, paths, title, mergedFilePath); err != nil {
+		return "", err
+	}
+	return mergedFilePath, nil
+}
+
+// partDownload returns the download of the part to the path with the complete header of its request.
+func (downloader *Downloader) partDownload(part *extractors.Part, refer, filePath string) (*PartDownload, error) {
+	header, err := downloader.option.Client.Header(part.URL, partHeaders(part, refer))
+	if err != nil {
+		return nil, err
+	}
+	return &PartDownload{Part: part, URL: part.URL, Header: header, Range: part.Range, Path: filePath}, nil
+}
+
+// merge merges the downloaded files of the stream parts into the merged file.
+func (downloader *Downloader) merge(ctx context.Context, stream *extractors.Stream, parts []string, title, mergedFilePath string) error {
+	parts, err := joinTracks(stream.Parts, parts, title, downloader.option.FileNameLength, downloader.option.OutputPath)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 1 && !stream.NeedMux {
+		return os.Rename(parts[0], mergedFilePath)
+	}
+
+	downloader.progress.report(ProgressEvent{Type: EventMergeStarted, Path: mergedFilePath})
+	if stream.NeedMux && stream.Ext == "mp4" && !downloader.option.UseFFmpeg {
+		err = mp4.Mux(parts, mergedFilePath)
+		if err == nil {
+			for _, part := range parts {
+				os.Remove(part) // nolint
+			}
+			return nil
+		}
+		if !errors.Is(err, mp4.ErrUnsupportedCodec) {
+			return err
+		}
+		// fall back to ffmpeg for the formats the muxer can't handle, eg: webm
 	}
 	if stream.Ext != "mp4" || stream.NeedMux {
-		return utils.MergeFilesWithSameExtension(parts, mergedFilePath)
+		return utils.MergeFilesWithSameExtension(ctx, parts, mergedFilePath)
+	}
+	if downloader.option.UseFFmpeg || !allTS(parts) {
+		return utils.MergeToMP4(ctx, parts, mergedFilePath, title)
+	}
+	if err = mp4.RemuxTS(parts, mergedFilePath); err != nil {
+		if errors.Is(err, mp4.ErrUnsupportedCodec) {
+			return errors.WithMessage(err, "use --ffmpeg to merge the parts with ffmpeg")
+		}
+		return err
+	}
+	for _, part := range parts {
+		os.Remove(part) // nolint
+	}
+	return nil
+}
+
+// allTS reports whether all files are MPEG-TS files which can be remuxed without ffmpeg.
+func allTS(paths []string) bool {
+	for _, p := range paths {
+		if filepath.Ext(p) != ".ts" {
+			return false
+		}
 	}
-	return utils.MergeToMP4(parts, mergedFilePath, title)
+	return true
 }
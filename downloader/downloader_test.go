@@ -1,9 +1,23 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/request"
 )
 
 func TestDownload(t *testing.T) {
@@ -93,9 +107,371 @@ func TestDownload(t *testing.T) {
 		},
 	}
 	for _, testCase := range testCases {
-		err := New(Options{}).Download(testCase.data)
+		err := New(Options{OutputPath: t.TempDir()}).Download(testCase.data)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	part := &extractors.Part{}
+	ranged := &extractors.Part{Range: &extractors.ByteRange{Offset: 100, Length: 50}}
+	tests := []struct {
+		name       string
+		part       *extractors.Part
+		start, end int64
+		want       string
+	}{
+		{"open ended", part, 10, -1, "bytes=10-"},
+		{"closed", part, 10, 19, "bytes=10-19"},
+		{"ranged part", ranged, 0, -1, "bytes=100-149"},
+		{"ranged part resume", ranged, 20, -1, "bytes=120-149"},
+		{"ranged part chunk", ranged, 0, 9, "bytes=100-109"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := byteRange(tt.part, tt.start, tt.end); got != tt.want {
+				t.Errorf("byteRange() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinTracks(t *testing.T) {
+	dir := t.TempDir()
+	parts := []*extractors.Part{
+		{Ext: "mp4", Track: "video"},
+		{Ext: "m4s", Track: "video"},
+		{Ext: "m4a"},
+	}
+	paths := make([]string, len(parts))
+	for i, content := range []string{"init", "segment", "audio"} {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("test[%d]", i))
+		if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := joinTracks(parts, paths, "test", 0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "test[video].mp4"), paths[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("joinTracks() = %v, want %v", got, want)
+	}
+	content, err := os.ReadFile(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "initsegment" {
+		t.Errorf("joined content = %s", content)
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Error("joined files should be removed")
+	}
+}
+
+func TestDownloadContextCanceled(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1000)) // nolint
+		w.(http.Flusher).Flush()
+		close(started)
+		// never finish the response
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title: "canceled",
+		Type:  extractors.DataTypeVideo,
+		URL:   server.URL,
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID:    "default",
+				Parts: []*extractors.Part{{URL: server.URL, Size: 2000, Ext: "mp4"}},
+				Size:  2000,
+			},
+		},
+	}
+	err := New(Options{Silent: true, OutputPath: dir, RetryTimes: 3}).DownloadContext(ctx, data)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DownloadContext() error = %v, want context.Canceled", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) > 0 {
+		t.Errorf("the unfinished files should be removed, got %v", files)
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	var (
+		lock     sync.Mutex
+		requests = map[string]int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		lock.Unlock()
+		switch {
+		case r.URL.Path == "/missing.jpg":
+			http.NotFound(w, r)
+		case r.URL.Path == "/broken.jpg":
+			http.Error(w, "broken", http.StatusBadGateway)
+		case n == 1:
+			// the body is cut short
+			w.Header().Set("Content-Length", "100")
+			w.Write(content[:10]) // nolint
+		default:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	var retries int
+	option := Options{
+		OutputPath:   t.TempDir(),
+		RetryTimes:   5,
+		ThreadNumber: 1,
+		Client:       request.NewClient(request.Options{RetryTimes: 5, Retry: request.RetryPolicy{MinDelay: time.Millisecond}}),
+		Progress: ProgressReporterFunc(func(event *ProgressEvent) {
+			if event.Type == EventRetry {
+				retries++
+			}
+		}),
+	}
+	data := &extractors.Data{
+		Title: "retry",
+		Type:  extractors.DataTypeImage,
+		URL:   server.URL,
+		Streams: map[string]*extractors.Stream{
+			"default": {ID: "default", Parts: []*extractors.Part{{URL: server.URL + "/flaky.jpg", Size: 100, Ext: "jpg"}}},
+		},
+	}
+	if err := New(option).Download(data); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(option.OutputPath, "retry.jpg")); !bytes.Equal(got, content) || retries != 1 {
+		t.Errorf("got %q after %d retries", got, retries)
+	}
+
+	// a missing file isn't retried
+	retries = 0
+	data.Title = "missing"
+	data.Streams["default"].Parts[0].URL = server.URL + "/missing.jpg"
+	if err := New(option).Download(data); err == nil {
+		t.Fatal("Download() should fail")
+	}
+	if requests["/missing.jpg"] != 1 || retries != 0 {
+		t.Errorf("the missing file is requested %d times with %d retries", requests["/missing.jpg"], retries)
+	}
+
+	// a failed request is only retried by the downloader
+	retries = 0
+	data.Title = "broken"
+	data.Streams["default"].Parts[0].URL = server.URL + "/broken.jpg"
+	if err := New(option).Download(data); err == nil {
+		t.Fatal("Download() should fail")
+	}
+	if requests["/broken.jpg"] != 5 || retries != 4 {
+		t.Errorf("the broken file is requested %d times with %d retries", requests["/broken.jpg"], retries)
+	}
+}
+
+func TestKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	started, release := make(chan struct{}), make(chan struct{})
+	var (
+		lock     sync.Mutex
+		requests = map[string]int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		lock.Unlock()
+		switch {
+		case r.URL.Path == "/slow.key":
+			close(started)
+			<-release
+		case r.URL.Path == "/flaky.key" && n == 1:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(key) // nolint
+	}))
+	defer server.Close()
+
+	downloader := New(Options{Client: request.NewClient(request.Options{RetryTimes: 1}), Silent: true})
+	part := func(name string) *extractors.Part {
+		return &extractors.Part{Key: &extractors.Key{Method: "AES-128", URI: server.URL + "/" + name}}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := downloader.key(context.Background(), part("slow.key"), "")
+			errs <- err
+		}()
+	}
+	// the other keys aren't blocked by a key being fetched
+	<-started
+	if got, err := downloader.key(context.Background(), part("fast.key"), ""); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("key() = %q, %v", got, err)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
 		if err != nil {
 			t.Error(err)
 		}
 	}
+
+	// a failed key is fetched again
+	if _, err := downloader.key(context.Background(), part("flaky.key"), ""); err == nil {
+		t.Error("key() should fail with a 404 response")
+	}
+	if got, err := downloader.key(context.Background(), part("flaky.key"), ""); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("key() = %q, %v", got, err)
+	}
+	if want := map[string]int{"/slow.key": 1, "/fast.key": 1, "/flaky.key": 2}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100)) // nolint
+	}))
+	defer server.Close()
+
+	var (
+		lock   sync.Mutex
+		events []*ProgressEvent
+	)
+	reporter := ProgressReporterFunc(func(event *ProgressEvent) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	})
+	data := &extractors.Data{
+		Title: "progress",
+		Type:  extractors.DataTypeImage,
+		URL:   server.URL,
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID: "default",
+				Parts: []*extractors.Part{
+					{URL: server.URL + "/0.jpg", Size: 100, Ext: "jpg"},
+					{URL: server.URL + "/1.jpg", Size: 100, Ext: "jpg"},
+				},
+				Size: 200,
+			},
+		},
+	}
+	err := New(Options{OutputPath: t.TempDir(), RetryTimes: 1, ThreadNumber: 2, Progress: reporter}).Download(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) < 4 || events[0].Type != EventItemStarted || events[0].Size != 200 || events[len(events)-1].Type != EventDone {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	var (
+		bytes int64
+		parts = map[int]bool{}
+	)
+	for _, event := range events {
+		if event.Title != "progress" {
+			t.Errorf("unexpected title of %+v", event)
+		}
+		switch event.Type {
+		case EventPartStarted:
+			parts[event.Index] = true
+		case EventBytesWritten:
+			bytes += event.Bytes
+		}
+	}
+	if bytes != 200 || !parts[0] || !parts[1] {
+		t.Errorf("got %d bytes written of the parts %v", bytes, parts)
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	NewJSONReporter(&buf).Report(&ProgressEvent{Type: EventRetry, Title: "test", Index: 1, Attempt: 2, Err: fmt.Errorf("timeout")})
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["type"] != "retry" || got["attempt"] != float64(2) || got["error"] != "timeout" || got["index"] != float64(1) {
+		t.Errorf("unexpected JSON %s", buf.String())
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(make([]byte, 100)) // nolint
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.txt")
+	archive, err := OpenArchive(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := func(id string) *extractors.Data {
+		return &extractors.Data{
+			Title:     "archive " + id,
+			ID:        id,
+			Extractor: "test",
+			Type:      extractors.DataTypeImage,
+			Streams: map[string]*extractors.Stream{
+				"default": {ID: "default", Parts: []*extractors.Part{{URL: server.URL, Size: 100, Ext: "jpg"}}, Size: 100},
+			},
+		}
+	}
+	downloader := New(Options{OutputPath: dir, RetryTimes: 1, Silent: true, Archive: archive})
+	if err = downloader.Download(data("1")); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "archive 1.jpg")) // nolint
+
+	// the item is skipped after the file is moved away
+	archive, err = OpenArchive(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloader = New(Options{OutputPath: dir, RetryTimes: 1, Silent: true, Archive: archive})
+	if err = downloader.Download(data("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err = downloader.Download(data("2")); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || !archive.Has("test:2") {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if content, _ := os.ReadFile(archivePath); string(content) != "test:1\ntest:2\n" {
+		t.Errorf("unexpected archive %q", content)
+	}
 }
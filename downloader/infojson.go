@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
+)
+
+// InfoJSON is the content of the .info.json file written beside a downloaded item.
+type InfoJSON struct {
+	*extractors.Data
+	// RequestedStream is the downloaded stream, it isn't in the streams of the data if a selector merged it from two streams
+	RequestedStream *extractors.Stream `json:"requested_stream"`
+	// Filepath is the path of the merged file
+	Filepath string `json:"filepath"`
+	// CaptionFiles are the paths of the downloaded captions by their names, eg: danmaku
+	CaptionFiles map[string]string `json:"caption_files,omitempty"`
+	// ThumbnailFile is the path of the thumbnail written by --write-thumbnail
+	ThumbnailFile string `json:"thumbnail_file,omitempty"`
+}
+
+// writeInfoJSON writes the info of the downloaded item to the .info.json file beside the merged file.
+func (downloader *Downloader) writeInfoJSON(info *InfoJSON, title string) error {
+	path, err := utils.FilePath(title, "info.json", downloader.option.FileNameLength, downloader.option.OutputPath, false)
+	if err != nil {
+		return err
+	}
+	var content bytes.Buffer
+	e := json.NewEncoder(&content)
+	e.SetIndent("", "\t")
+	// the URLs are written as is
+	e.SetEscapeHTML(false)
+	if err = e.Encode(info); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = os.WriteFile(path, content.Bytes(), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ReadInfoJSON reads an .info.json file written by --write-info-json,
+// the requested stream is added to the streams of the data so it can be selected by its ID.
+func ReadInfoJSON(path string) (*InfoJSON, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	info := &InfoJSON{}
+	if err = json.Unmarshal(content, info); err != nil {
+		return nil, errors.Wrapf(err, "invalid info JSON file %s", path)
+	}
+	if info.Data == nil || len(info.Streams) == 0 && info.RequestedStream == nil {
+		return nil, errors.Errorf("no streams in the info JSON file %s", path)
+	}
+	if stream := info.RequestedStream; stream != nil {
+		if info.Streams == nil {
+			info.Streams = make(map[string]*extractors.Stream, 1)
+		}
+		if _, ok := info.Streams[stream.ID]; !ok {
+			info.Streams[stream.ID] = stream
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+func TestInfoJSON(t *testing.T) {
+	dir := t.TempDir()
+	video := &extractors.Stream{ID: "137", Parts: []*extractors.Part{{URL: "https://example.com/v?a=1&b=2", Ext: "mp4"}}, Ext: "mp4"}
+	audio := &extractors.Stream{ID: "140", Parts: []*extractors.Part{{URL: "https://example.com/a", Ext: "m4a"}}, Ext: "m4a"}
+	data := &extractors.Data{
+		URL:       "https://example.com/watch",
+		ID:        "abc",
+		Extractor: "example",
+		Title:     "title",
+		Type:      extractors.DataTypeVideo,
+		Streams:   map[string]*extractors.Stream{"137": video, "140": audio},
+		Uploader:  "up",
+	}
+	stream, err := selectStream(data, genSortedStreams(data.Streams), "137+140")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloader := New(Options{Silent: true, OutputPath: dir})
+	err = downloader.writeInfoJSON(&InfoJSON{Data: data, RequestedStream: stream, Filepath: filepath.Join(dir, "title.mp4")}, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "title.info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "v?a=1&b=2") || !strings.Contains(string(content), `"uploader": "up"`) {
+		t.Errorf("unexpected info JSON %s", content)
+	}
+
+	info, err := ReadInfoJSON(filepath.Join(dir, "title.info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "title" || info.ArchiveKey() != "example:abc" || info.Filepath != filepath.Join(dir, "title.mp4") {
+		t.Errorf("unexpected info %+v", info)
+	}
+	// the merged stream can be selected by its ID
+	loaded, err := selectStream(info.Data, genSortedStreams(info.Streams), info.RequestedStream.ID)
+	if err != nil || len(loaded.Parts) != 2 || loaded.Parts[1].URL != "https://example.com/a" {
+		t.Errorf("unexpected stream %+v, %v", loaded, err)
+	}
+
+	if _, err = ReadInfoJSON(filepath.Join(dir, "missing.info.json")); err == nil {
+		t.Error("reading a missing file should fail")
+	}
+}
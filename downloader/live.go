@@ -0,0 +1,154 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
+	"github.com/hydrz/lux/utils"
+)
+
+// record downloads the segments of a live stream with the backend as they are added to its playlist and its separate audio playlist,
+// it stops when the playlists end, the live duration elapses or ctx is canceled, and merges what has been recorded.
+func (downloader *Downloader) record(ctx context.Context, data *extractors.Data, stream *extractors.Stream, title, mergedFilePath string) error {
+	if stream.Playlist == "" {
+		return errors.Errorf("stream %s has no HLS playlist and can't be recorded live", stream.ID)
+	}
+	var headers map[string]string
+	if len(stream.Parts) > 0 {
+		headers = stream.Parts[0].Headers
+	}
+	// the separate audio of a variant is recorded as another track, they are muxed at the end
+	tracks := []*liveTrack{{live: hls.NewLive(downloader.option.Client, stream.Playlist, headers)}}
+	if stream.AudioPlaylist != "" {
+		tracks[0].name = "video"
+		tracks = append(tracks, &liveTrack{name: "audio", live: hls.NewLive(downloader.option.Client, stream.AudioPlaylist, headers)})
+	}
+
+	var deadline <-chan time.Time
+	if downloader.option.LiveDuration > 0 {
+		timer := time.NewTimer(downloader.option.LiveDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	stopped := false
+	stop := func() bool {
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-deadline:
+			stopped = true
+		default:
+		}
+		return stopped
+	}
+
+	if !downloader.option.Silent {
+		fmt.Println("Recording the live stream, press Ctrl+C to stop")
+	}
+	var (
+		parts []*extractors.Part
+		files []string
+		index int
+	)
+	for !stop() {
+		newParts, ended, err := refreshTracks(ctx, tracks)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if len(files) == 0 {
+				return err
+			}
+			// the playlist may be gone when the stream is over, keep what has been recorded
+			slog.Warn("Failed to refresh the live playlist, stop recording", "url", stream.Playlist, "error", err)
+			break
+		}
+		for _, part := range newParts {
+			if stop() {
+				break
+			}
+			fileName := fmt.Sprintf("%s[%d]", title, index)
+			downloader.progress.parts[part] = index
+			index++
+			filePath, err := utils.FilePath(fileName, part.Ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
+			if err != nil {
+				return err
+			}
+			partDownload, err := downloader.partDownload(part, data.URL, filePath)
+			if err != nil {
+				return err
+			}
+			// the segments are downloaded one at a time, a failed segment doesn't stop the recording
+			if err = downloader.downloadParts(ctx, []*PartDownload{partDownload}, data.URL); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				// a missing segment leaves a gap in the recording, but there is nothing to keep yet
+				if len(parts) == 0 {
+					return err
+				}
+				slog.Warn("Failed to download a live segment, skipping", "url", part.URL, "error", err)
+				continue
+			}
+			parts = append(parts, part)
+			files = append(files, filePath)
+		}
+		if ended {
+			break
+		}
+
+		// wait for the next segment, or half as long if the playlist hasn't changed
+		wait := time.Duration(tracks[0].live.TargetDuration * float64(time.Second))
+		if len(newParts) == 0 {
+			wait /= 2
+		}
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-deadline:
+			stopped = true
+		case <-time.After(max(wait, time.Second)):
+		}
+	}
+	if len(files) == 0 {
+		return errors.New("nothing was recorded")
+	}
+	if data.Type != extractors.DataTypeVideo {
+		return nil
+	}
+	recorded := *stream
+	recorded.Parts = parts
+	// canceling ctx stops the recording, what has been recorded is still merged
+	return downloader.merge(context.WithoutCancel(ctx), &recorded, files, title, mergedFilePath)
+}
+
+// liveTrack is a live playlist of a stream, name is the track of its parts.
+type liveTrack struct {
+	name string
+	live *hls.Live
+}
+
+// refreshTracks returns the new parts of all the tracks, ended reports whether all of them have ended.
+func refreshTracks(ctx context.Context, tracks []*liveTrack) (parts []*extractors.Part, ended bool, err error) {
+	ended = true
+	for _, track := range tracks {
+		newParts, trackEnded, err := track.live.Refresh(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		if track.name != "" {
+			for _, part := range newParts {
+				part.Track = track.name
+			}
+		}
+		parts = append(parts, newParts...)
+		ended = ended && trackEnded
+	}
+	return parts, ended, nil
+}
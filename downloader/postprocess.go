@@ -0,0 +1,239 @@
+package downloader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/id3"
+	"github.com/hydrz/lux/mp4"
+	"github.com/hydrz/lux/request"
+	"github.com/hydrz/lux/utils"
+)
+
+// PostProcessor processes a downloaded item after its parts are merged, eg: embeds the metadata or converts the container.
+type PostProcessor interface {
+	// Process processes the file of info.Filepath, it sets info.Filepath if the file is replaced by another one.
+	Process(ctx context.Context, info *InfoJSON) error
+}
+
+// PostProcessorFunc is a function used as a PostProcessor.
+type PostProcessorFunc func(ctx context.Context, info *InfoJSON) error
+
+// Process calls f(ctx, info).
+func (f PostProcessorFunc) Process(ctx context.Context, info *InfoJSON) error {
+	return f(ctx, info)
+}
+
+// postProcess runs the post-processors in order, the chain stops at the first error.
+func (downloader *Downloader) postProcess(ctx context.Context, info *InfoJSON) error {
+	for _, processor := range downloader.option.PostProcessors {
+		if err := processor.Process(ctx, info); err != nil {
+			return errors.WithMessagef(err, "post-process %s", info.Filepath)
+		}
+	}
+	return nil
+}
+
+// fileExt returns the lower case extension of the file without the dot.
+func fileExt(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// isMP4 reports whether the extension is of the MP4 family which the built-in muxer writes.
+func isMP4(ext string) bool {
+	switch ext {
+	case "mp4", "m4a", "m4v", "mov":
+		return true
+	}
+	return false
+}
+
+// ffmpegReplace runs ffmpeg with the arguments and the output file, then replaces the file with the output.
+func ffmpegReplace(ctx context.Context, path string, args ...string) error {
+	ext := filepath.Ext(path)
+	output := strings.TrimSuffix(path, ext) + ".temp" + ext
+	if err := utils.RunFFmpeg(ctx, append(append([]string{"-y"}, args...), output)...); err != nil {
+		os.Remove(output) // nolint
+		return err
+	}
+	return errors.WithStack(os.Rename(output, path))
+}
+
+// EmbedThumbnail sets the best thumbnail as the cover art of MP4 and MP3 files,
+// the file written by --write-thumbnail is used if there is one.
+type EmbedThumbnail struct {
+	// Client downloads the thumbnail, nil means the default client of the request package
+	Client *request.Client
+}
+
+// Process embeds the thumbnail, the files of the other formats are skipped.
+func (e EmbedThumbnail) Process(ctx context.Context, info *InfoJSON) error {
+	ext := fileExt(info.Filepath)
+	if !isMP4(ext) && ext != "mp3" {
+		slog.Warn("Thumbnails can't be embedded into the file, skipping", "path", info.Filepath)
+		return nil
+	}
+
+	var thumbnail []byte
+	var err error
+	if info.ThumbnailFile != "" {
+		if thumbnail, err = os.ReadFile(info.ThumbnailFile); err != nil {
+			return errors.WithStack(err)
+		}
+	} else if len(info.Thumbnails) > 0 {
+		// a missing thumbnail doesn't fail the item
+		if thumbnail, err = e.Client.GetByteWithContext(ctx, info.Thumbnails[0].URL, info.URL, nil); err != nil {
+			slog.Warn("Failed to download the thumbnail", "url", info.Thumbnails[0].URL, "error", err)
+			return nil
+		}
+	}
+	if thumbnail == nil {
+		return nil
+	}
+	return embedThumbnail(info.Filepath, thumbnail)
+}
+
+// EmbedMetadata writes the title, the uploader, the upload date, the description and the URL of the data
+// into the metadata of MP4 and MP3 files.
+type EmbedMetadata struct{}
+
+// Process embeds the metadata, the files of the other formats are skipped.
+func (EmbedMetadata) Process(_ context.Context, info *InfoJSON) error {
+	ext := fileExt(info.Filepath)
+	switch {
+	case isMP4(ext):
+		return mp4.EmbedMetadata(info.Filepath, mp4.Metadata{
+			Title:       info.Title,
+			Artist:      info.Uploader,
+			Date:        info.UploadDate,
+			Description: info.Description,
+			Comment:     info.URL,
+		})
+	case ext == "mp3":
+		return id3.EmbedMetadata(info.Filepath, id3.Metadata{
+			Title:   info.Title,
+			Artist:  info.Uploader,
+			Date:    info.UploadDate,
+			Comment: info.Description,
+			URL:     info.URL,
+		})
+	}
+	slog.Warn("Metadata can't be embedded into the file, skipping", "path", info.Filepath)
+	return nil
+}
+
+// subtitleCodecs are the ffmpeg codecs of the embedded subtitles by the file extensions
+var subtitleCodecs = map[string]string{
+	"mp4": "mov_text",
+	"m4v": "mov_text",
+	"mov": "mov_text",
+	"mkv": "copy",
+}
+
+// subtitleExts are the caption formats that can be embedded, danmaku are not subtitles
+var subtitleExts = map[string]bool{"srt": true, "vtt": true, "ass": true}
+
+// EmbedSubtitles embeds the downloaded subtitles into MP4 and MKV files with ffmpeg, the captions must be downloaded.
+type EmbedSubtitles struct{}
+
+// Process embeds the subtitles, the subtitles are named after their captions.
+func (EmbedSubtitles) Process(ctx context.Context, info *InfoJSON) error {
+	names := make([]string, 0, len(info.CaptionFiles))
+	for name, path := range info.CaptionFiles {
+		if subtitleExts[fileExt(path)] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	codec, ok := subtitleCodecs[fileExt(info.Filepath)]
+	if !ok {
+		slog.Warn("Subtitles can't be embedded into the file, skipping", "path", info.Filepath)
+		return nil
+	}
+	sort.Strings(names)
+
+	args := []string{"-i", info.Filepath}
+	for _, name := range names {
+		args = append(args, "-i", info.CaptionFiles[name])
+	}
+	// the existing subtitles are replaced
+	args = append(args, "-map", "0:v?", "-map", "0:a?")
+	for i := range names {
+		args = append(args, "-map", strconv.Itoa(i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", codec)
+	for i, name := range names {
+		args = append(args, "-metadata:s:s:"+strconv.Itoa(i), "title="+name)
+	}
+	return ffmpegReplace(ctx, info.Filepath, args...)
+}
+
+// ConvertContainer remuxes the file into another container with ffmpeg without re-encoding, eg: mkv.
+type ConvertContainer struct {
+	// Format is the extension of the new file
+	Format string
+}
+
+// Process remuxes the file, the original file is removed.
+func (c ConvertContainer) Process(ctx context.Context, info *InfoJSON) error {
+	format := strings.ToLower(strings.TrimPrefix(c.Format, "."))
+	if format == "" || format == fileExt(info.Filepath) {
+		return nil
+	}
+	output := strings.TrimSuffix(info.Filepath, filepath.Ext(info.Filepath)) + "." + format
+	if err := utils.RunFFmpeg(ctx, "-y", "-i", info.Filepath, "-map", "0", "-c", "copy", output); err != nil {
+		os.Remove(output) // nolint
+		return err
+	}
+	os.Remove(info.Filepath) // nolint
+	info.Filepath = output
+	return nil
+}
+
+// Exec runs a command after the item is downloaded, {} in the command is replaced with the quoted path of the file,
+// the path is appended to the command if there is no {}.
+type Exec struct {
+	Command string
+}
+
+// Process runs the command with the shell of the system.
+func (e Exec) Process(ctx context.Context, info *InfoJSON) error {
+	path := quoteArg(info.Filepath)
+	command := e.Command
+	if strings.Contains(command, "{}") {
+		command = strings.ReplaceAll(command, "{}", path)
+	} else {
+		command += " " + path
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "run %q", command)
+	}
+	return nil
+}
+
+// quoteArg quotes an argument of the shell command.
+func quoteArg(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,140 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+func TestPostProcessors(t *testing.T) {
+	audio := []byte("\xff\xfb\x90\x64audio")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(audio) // nolint
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title:    "post-process",
+		Type:     extractors.DataTypeAudio,
+		URL:      server.URL,
+		Uploader: "uploader",
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID:    "default",
+				Parts: []*extractors.Part{{URL: server.URL, Size: int64(len(audio)), Ext: "mp3"}},
+				Size:  int64(len(audio)),
+				Ext:   "mp3",
+			},
+		},
+	}
+	renamed := filepath.Join(dir, "renamed.mp3")
+	var paths []string
+	processors := []PostProcessor{
+		EmbedMetadata{},
+		PostProcessorFunc(func(_ context.Context, info *InfoJSON) error {
+			paths = append(paths, info.Filepath)
+			if err := os.Rename(info.Filepath, renamed); err != nil {
+				return err
+			}
+			info.Filepath = renamed
+			return nil
+		}),
+		PostProcessorFunc(func(_ context.Context, info *InfoJSON) error {
+			paths = append(paths, info.Filepath)
+			return nil
+		}),
+	}
+	err := New(Options{OutputPath: dir, RetryTimes: 1, Silent: true, WriteInfoJSON: true, PostProcessors: processors}).Download(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the processors run in order and see the path of the previous one
+	if len(paths) != 2 || paths[0] != filepath.Join(dir, "post-process.mp3") || paths[1] != renamed {
+		t.Errorf("unexpected paths %v", paths)
+	}
+	content, _ := os.ReadFile(renamed)
+	if !bytes.HasPrefix(content, []byte("ID3")) || !bytes.Contains(content, []byte("TPE1")) || !bytes.HasSuffix(content, audio) {
+		t.Errorf("the metadata isn't embedded: %q", content)
+	}
+	info, err := ReadInfoJSON(filepath.Join(dir, "post-process.info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Filepath != renamed {
+		t.Errorf("got file path %q, want %q", info.Filepath, renamed)
+	}
+}
+
+func TestPostProcessSinglePart(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("segment")) // nolint
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	// the single part of an HLS stream is saved as a .ts file
+	data := &extractors.Data{
+		Title: "single",
+		Type:  extractors.DataTypeVideo,
+		URL:   server.URL,
+		Streams: map[string]*extractors.Stream{
+			"default": {ID: "default", Parts: []*extractors.Part{{URL: server.URL, Ext: "ts"}}, Ext: "mp4"},
+		},
+	}
+	var paths []string
+	processor := PostProcessorFunc(func(_ context.Context, info *InfoJSON) error {
+		paths = append(paths, info.Filepath)
+		return nil
+	})
+	downloader := New(Options{OutputPath: dir, RetryTimes: 1, Silent: true, WriteInfoJSON: true, PostProcessors: []PostProcessor{processor}})
+	if err := downloader.Download(data); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "single.ts")
+	if len(paths) != 1 || paths[0] != want {
+		t.Errorf("unexpected paths %v, want %s", paths, want)
+	}
+	if info, err := ReadInfoJSON(filepath.Join(dir, "single.info.json")); err != nil || info.Filepath != want {
+		t.Errorf("ReadInfoJSON() = %+v, %v", info, err)
+	}
+
+	// the downloaded file is found the next time
+	if err := downloader.Download(data); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("the part is requested %d times, want 1", requests)
+	}
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command uses sh")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "it's a file.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "copied.mp4")
+	if err := (Exec{Command: "cp {} " + quoteArg(output)}).Process(context.Background(), &InfoJSON{Filepath: path}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(output); string(content) != "video" {
+		t.Errorf("the command didn't run, got %q", content)
+	}
+	if err := (Exec{Command: "false"}).Process(context.Background(), &InfoJSON{Filepath: path}); err == nil {
+		t.Error("Exec should fail if the command fails")
+	}
+}
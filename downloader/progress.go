@@ -0,0 +1,205 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+// ProgressEventType is the type of a progress event.
+type ProgressEventType string
+
+const (
+	// EventItemStarted is sent when the download of an item starts, Size is the estimated size of the stream.
+	EventItemStarted ProgressEventType = "item_started"
+	// EventPartStarted is sent when the download of a part, or of a range of it, starts.
+	EventPartStarted ProgressEventType = "part_started"
+	// EventPartDone is sent when a part, or a range of it, is downloaded, Err is set if it failed.
+	EventPartDone ProgressEventType = "part_done"
+	// EventBytesWritten is sent when Bytes of a part are written, including the bytes of resumed files.
+	EventBytesWritten ProgressEventType = "bytes_written"
+	// EventRetry is sent when a request of a part fails and is about to be retried.
+	EventRetry ProgressEventType = "retry"
+	// EventMergeStarted is sent when the parts start to be merged into Path.
+	EventMergeStarted ProgressEventType = "merge_started"
+	// EventDone is sent when the item is downloaded.
+	EventDone ProgressEventType = "done"
+	// EventFailed is sent when the download of the item fails.
+	EventFailed ProgressEventType = "failed"
+)
+
+// ProgressEvent is a structured progress event of a download.
+type ProgressEvent struct {
+	Type ProgressEventType `json:"type"`
+	Time time.Time         `json:"time"`
+	// Title of the item
+	Title string `json:"title"`
+	// Part is the part of the part events, Index is its index in the stream or -1 for the item events
+	Part  *extractors.Part `json:"-"`
+	Index int              `json:"index"`
+	// Range is the index of the byte range starting from 1 if the part is downloaded by multiple threads, 0 for the whole part
+	Range int `json:"range,omitempty"`
+	// Size is the total size of the item or the part, 0 if it's unknown
+	Size int64 `json:"size,omitempty"`
+	// Bytes is the number of bytes written
+	Bytes int64 `json:"bytes,omitempty"`
+	// Attempt is the number of the failed attempt of a retry event, starting from 1
+	Attempt int `json:"attempt,omitempty"`
+	// Path is the merged file
+	Path string `json:"path,omitempty"`
+	// Err is the error of a retry or failed event
+	Err error `json:"-"`
+}
+
+// ProgressReporter receives the progress events of the downloads,
+// Report is called from multiple goroutines and should return quickly.
+type ProgressReporter interface {
+	Report(event *ProgressEvent)
+}
+
+// ProgressReporterFunc is a function used as a ProgressReporter.
+type ProgressReporterFunc func(event *ProgressEvent)
+
+// Report calls f(event).
+func (f ProgressReporterFunc) Report(event *ProgressEvent) {
+	f(event)
+}
+
+// nopReporter discards the events, eg: in silent mode.
+type nopReporter struct{}
+
+func (nopReporter) Report(*ProgressEvent) {}
+
+// barReporter shows the progress of an item in a progress bar.
+type barReporter struct {
+	mu  sync.Mutex
+	bar *pb.ProgressBar
+}
+
+// NewBarReporter returns a ProgressReporter that shows a progress bar of the item being downloaded.
+func NewBarReporter() ProgressReporter {
+	return &barReporter{}
+}
+
+func progressBar(size int64) *pb.ProgressBar {
+	tmpl := `{{counters .}} {{bar . "[" "=" ">" "-" "]"}} {{speed .}} {{percent . | green}} {{rtime .}}`
+	return pb.New64(size).
+		Set(pb.Bytes, true).
+		SetMaxWidth(1000).
+		SetTemplate(pb.ProgressBarTemplate(tmpl))
+}
+
+func (r *barReporter) Report(event *ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch event.Type {
+	case EventItemStarted:
+		r.bar = progressBar(event.Size).Start()
+	case EventBytesWritten:
+		if r.bar != nil {
+			r.bar.Add64(event.Bytes)
+		}
+	case EventMergeStarted:
+		r.finish()
+		fmt.Printf("Merging video parts into %s\n", event.Path)
+	case EventDone, EventFailed:
+		r.finish()
+	}
+}
+
+func (r *barReporter) finish() {
+	if r.bar != nil {
+		r.bar.Finish()
+		r.bar = nil
+	}
+}
+
+// jsonReporter writes the events as JSON lines.
+type jsonReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONReporter returns a ProgressReporter that writes each event to w as a line of JSON.
+func NewJSONReporter(w io.Writer) ProgressReporter {
+	return &jsonReporter{w: w}
+}
+
+func (r *jsonReporter) Report(event *ProgressEvent) {
+	line := struct {
+		*ProgressEvent
+		Error string `json:"error,omitempty"`
+	}{ProgressEvent: event}
+	if event.Err != nil {
+		line.Error = event.Err.Error()
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(data, '\n')) // nolint
+}
+
+// itemProgress sends the events of the item being downloaded.
+type itemProgress struct {
+	reporter ProgressReporter
+	title    string
+	// the index of the parts in the stream
+	parts map[*extractors.Part]int
+}
+
+func (p *itemProgress) report(event ProgressEvent) {
+	event.Time = time.Now()
+	event.Title = p.title
+	event.Index = -1
+	if event.Part != nil {
+		if index, ok := p.parts[event.Part]; ok {
+			event.Index = index
+		}
+	}
+	p.reporter.Report(&event)
+}
+
+// partStarted reports the start of the part or of its byte range.
+func (p *itemProgress) partStarted(part *extractors.Part, rangeIndex int, size int64) {
+	p.report(ProgressEvent{Type: EventPartStarted, Part: part, Range: rangeIndex, Size: size})
+}
+
+// partDone reports the end of the part or of its byte range.
+func (p *itemProgress) partDone(part *extractors.Part, rangeIndex int, err error) {
+	p.report(ProgressEvent{Type: EventPartDone, Part: part, Range: rangeIndex, Err: err})
+}
+
+// bytesWritten reports the bytes of the part written to the file, eg: a resumed part.
+func (p *itemProgress) bytesWritten(part *extractors.Part, rangeIndex int, n int64) {
+	if n > 0 {
+		p.report(ProgressEvent{Type: EventBytesWritten, Part: part, Range: rangeIndex, Bytes: n})
+	}
+}
+
+// retry reports a failed attempt to download the part.
+func (p *itemProgress) retry(part *extractors.Part, rangeIndex, attempt int, err error) {
+	p.report(ProgressEvent{Type: EventRetry, Part: part, Range: rangeIndex, Attempt: attempt, Err: err})
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	w          io.Writer
+	part       *extractors.Part
+	rangeIndex int
+	progress   *itemProgress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.progress.bytesWritten(w.part, w.rangeIndex, int64(n))
+	return n, err
+}
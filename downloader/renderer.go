@@ -0,0 +1,326 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb/v3/termutil"
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	// renderInterval is how often the lines are redrawn on a terminal
+	renderInterval = 200 * time.Millisecond
+	// logInterval is how often a progress line is logged when the output isn't a terminal
+	logInterval = 10 * time.Second
+	// stallTimeout is how long a worker may go without receiving any bytes before it's shown as stalled
+	stallTimeout = 10 * time.Second
+	// speedWindow is roughly the time over which the speeds are averaged
+	speedWindow = 3 * time.Second
+	// maxWorkerLines limits the worker lines drawn under the overall bar
+	maxWorkerLines = 16
+)
+
+type workerKey struct {
+	index      int
+	rangeIndex int
+}
+
+// workerStatus is the progress of a part or of a byte range being downloaded.
+type workerStatus struct {
+	workerKey
+	size    int64
+	bytes   int64
+	retries int
+	// last is when the last bytes were received
+	last time.Time
+	speed
+}
+
+// speed is an average of the transfer rate.
+type speed struct {
+	rate      float64
+	lastBytes int64
+	lastTime  time.Time
+}
+
+// update adds a sample of the total bytes at now.
+func (s *speed) update(bytes int64, now time.Time) {
+	if !s.lastTime.IsZero() {
+		if dt := now.Sub(s.lastTime); dt > 0 {
+			sample := float64(bytes-s.lastBytes) / dt.Seconds()
+			s.rate += min(float64(dt)/float64(speedWindow), 1) * (sample - s.rate)
+		}
+	}
+	s.lastBytes = bytes
+	s.lastTime = now
+}
+
+// lineReporter shows an overall bar of the item with a line per part or byte range being downloaded,
+// or logs a plain progress line periodically if the output isn't a terminal.
+type lineReporter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	tty      bool
+	width    func() int
+	interval time.Duration
+
+	title   string
+	size    int64
+	bytes   int64
+	retries int
+	started time.Time
+	speed
+	workers map[workerKey]*workerStatus
+	// lines is the number of lines drawn by the last render
+	lines int
+	// stop stops the ticker of the current item
+	stop chan struct{}
+}
+
+// NewMultiLineReporter returns a ProgressReporter that draws an overall progress bar of the item
+// and the status of each part or byte range being downloaded, eg: speed and retries, on the terminal f.
+// A progress line is logged periodically instead if f isn't a terminal.
+func NewMultiLineReporter(f *os.File) ProgressReporter {
+	if !isatty.IsTerminal(f.Fd()) && !isatty.IsCygwinTerminal(f.Fd()) {
+		return newLineReporter(f, false, nil)
+	}
+	return newLineReporter(colorable.NewColorable(f), true, func() int {
+		width, err := termutil.TerminalWidth()
+		if err != nil || width <= 0 {
+			return 80
+		}
+		return width
+	})
+}
+
+func newLineReporter(w io.Writer, tty bool, width func() int) *lineReporter {
+	r := &lineReporter{
+		w:        w,
+		tty:      tty,
+		width:    width,
+		interval: logInterval,
+	}
+	if tty {
+		r.interval = renderInterval
+	}
+	return r
+}
+
+func (r *lineReporter) Report(event *ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := workerKey{event.Index, event.Range}
+	switch event.Type {
+	case EventItemStarted:
+		r.finish(event.Time)
+		r.title = event.Title
+		r.size = event.Size
+		r.bytes = 0
+		r.retries = 0
+		r.started = event.Time
+		r.speed = speed{}
+		r.workers = make(map[workerKey]*workerStatus)
+		r.lines = 0
+		r.stop = make(chan struct{})
+		go r.tick(r.stop)
+	case EventPartStarted:
+		if r.workers != nil {
+			r.workers[key] = &workerStatus{workerKey: key, size: event.Size, last: event.Time}
+		}
+	case EventBytesWritten:
+		r.bytes += event.Bytes
+		if worker := r.workers[key]; worker != nil {
+			worker.bytes += event.Bytes
+			worker.last = event.Time
+		}
+	case EventRetry:
+		r.retries++
+		if worker := r.workers[key]; worker != nil {
+			worker.retries++
+		}
+		if !r.tty {
+			fmt.Fprintf(r.w, "%s: retrying %s, attempt %d failed: %v\n", r.title, key, event.Attempt, event.Err)
+		}
+	case EventPartDone:
+		delete(r.workers, key)
+	case EventMergeStarted:
+		r.finish(event.Time)
+		fmt.Fprintf(r.w, "Merging video parts into %s\n", event.Path)
+	case EventDone, EventFailed:
+		r.finish(event.Time)
+		if !r.tty && event.Type == EventDone {
+			fmt.Fprintf(r.w, "%s: done, %s in %s\n", r.title, formatBytes(r.bytes), formatDuration(event.Time.Sub(r.started)))
+		}
+	}
+}
+
+// tick renders the progress until stop is closed.
+func (r *lineReporter) tick(stop chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			// the item may have finished while waiting for the lock
+			if r.stop == stop {
+				r.render(now)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// finish stops the ticker and draws the final state of the item.
+func (r *lineReporter) finish(now time.Time) {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.stop = nil
+	r.workers = nil
+	if r.tty {
+		r.render(now)
+	}
+}
+
+func (r *lineReporter) render(now time.Time) {
+	r.speed.update(r.bytes, now)
+	workers := make([]*workerStatus, 0, len(r.workers))
+	for _, worker := range r.workers {
+		worker.speed.update(worker.bytes, now)
+		workers = append(workers, worker)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].index != workers[j].index {
+			return workers[i].index < workers[j].index
+		}
+		return workers[i].rangeIndex < workers[j].rangeIndex
+	})
+	if r.tty {
+		r.draw(now, workers)
+	} else {
+		r.log(now, workers)
+	}
+}
+
+// draw redraws the overall bar and the worker lines in place.
+func (r *lineReporter) draw(now time.Time, workers []*workerStatus) {
+	lines := []string{r.overall(now)}
+	for i, worker := range workers {
+		if i == maxWorkerLines {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(workers)-i))
+			break
+		}
+		line := fmt.Sprintf("  %-12s %s %9s/s", worker.workerKey, progressLine(worker.bytes, worker.size, 20), formatBytes(int64(worker.rate)))
+		if worker.retries > 0 {
+			line += fmt.Sprintf("  retries %d", worker.retries)
+		}
+		if now.Sub(worker.last) > stallTimeout {
+			line += fmt.Sprintf("  stalled %s", formatDuration(now.Sub(worker.last)))
+		}
+		lines = append(lines, line)
+	}
+
+	var b strings.Builder
+	if r.lines > 0 {
+		// move back to the first line drawn last time
+		fmt.Fprintf(&b, "\x1b[%dA", r.lines)
+	}
+	width := r.width()
+	for _, line := range lines {
+		// a wrapped line would break the redrawing
+		if width > 1 && len(line) >= width {
+			line = line[:width-1]
+		}
+		b.WriteString("\r" + line + "\x1b[K\n")
+	}
+	// clear the lines of the workers that are gone
+	b.WriteString("\x1b[J")
+	r.lines = len(lines)
+	io.WriteString(r.w, b.String()) // nolint
+}
+
+// log writes a plain progress line.
+func (r *lineReporter) log(now time.Time, workers []*workerStatus) {
+	line := fmt.Sprintf("%s: %s", r.title, formatBytes(r.bytes))
+	if r.size > 0 {
+		line += fmt.Sprintf(" / %s (%d%%)", formatBytes(r.size), int(min(float64(r.bytes)/float64(r.size), 1)*100))
+	}
+	line += fmt.Sprintf(" at %s/s, %d parts in progress", formatBytes(int64(r.rate)), len(workers))
+	if r.retries > 0 {
+		line += fmt.Sprintf(", %d retries", r.retries)
+	}
+	var stalled []string
+	for _, worker := range workers {
+		if now.Sub(worker.last) > stallTimeout {
+			stalled = append(stalled, worker.String())
+		}
+	}
+	if len(stalled) > 0 {
+		line += ", stalled: " + strings.Join(stalled, ", ")
+	}
+	fmt.Fprintln(r.w, line)
+}
+
+// overall returns the overall bar of the item.
+func (r *lineReporter) overall(now time.Time) string {
+	if r.size <= 0 {
+		// eg: a live stream
+		return fmt.Sprintf("%s %s/s %s", formatBytes(r.bytes), formatBytes(int64(r.rate)), formatDuration(now.Sub(r.started)))
+	}
+	eta := "--"
+	if r.bytes >= r.size {
+		eta = "0s"
+	} else if r.rate > 0 {
+		eta = formatDuration(time.Duration(float64(r.size-r.bytes) / r.rate * float64(time.Second)))
+	}
+	return fmt.Sprintf("%s / %s %s %s/s ETA %s", formatBytes(r.bytes), formatBytes(r.size), progressLine(r.bytes, r.size, 30), formatBytes(int64(r.rate)), eta)
+}
+
+func (k workerKey) String() string {
+	if k.rangeIndex > 0 {
+		return fmt.Sprintf("part %d #%d", k.index, k.rangeIndex)
+	}
+	return fmt.Sprintf("part %d", k.index)
+}
+
+// progressLine returns a bar of the width followed by the percentage.
+func progressLine(bytes, size int64, width int) string {
+	if size <= 0 {
+		return fmt.Sprintf("[%s] %4s", strings.Repeat("-", width), "")
+	}
+	ratio := min(float64(bytes)/float64(size), 1)
+	done := int(ratio * float64(width))
+	bar := strings.Repeat("=", done)
+	if done < width {
+		bar += ">" + strings.Repeat("-", width-done-1)
+	}
+	return fmt.Sprintf("[%s] %3d%%", bar, int(ratio*100))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[prefix])
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
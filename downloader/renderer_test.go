@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineReporterDraw(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLineReporter(&buf, true, func() int { return 120 })
+	start := time.Now()
+	r.Report(&ProgressEvent{Type: EventItemStarted, Time: start, Index: -1, Size: 300})
+	r.Report(&ProgressEvent{Type: EventPartStarted, Time: start, Index: 0, Range: 1, Size: 100})
+	r.Report(&ProgressEvent{Type: EventPartStarted, Time: start, Index: 0, Range: 2, Size: 200})
+	r.Report(&ProgressEvent{Type: EventBytesWritten, Time: start, Index: 0, Range: 1, Bytes: 50})
+	r.Report(&ProgressEvent{Type: EventRetry, Time: start, Index: 0, Range: 2, Attempt: 1, Err: errors.New("timeout")})
+
+	r.mu.Lock()
+	r.render(start.Add(time.Minute))
+	r.mu.Unlock()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\x1b[J"), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "50 B / 300 B") {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if !strings.Contains(lines[1], "part 0 #1") || !strings.Contains(lines[1], " 50%") {
+		t.Errorf("unexpected line of the first range %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "part 0 #2") || !strings.Contains(lines[2], "retries 1") || !strings.Contains(lines[2], "stalled 1m0s") {
+		t.Errorf("unexpected line of the second range %q", lines[2])
+	}
+
+	buf.Reset()
+	r.Report(&ProgressEvent{Type: EventPartDone, Time: start, Index: 0, Range: 1})
+	r.Report(&ProgressEvent{Type: EventDone, Time: start.Add(time.Minute), Index: -1})
+	// the cursor goes back over the 3 lines drawn before and only the overall bar is left
+	if out := buf.String(); !strings.HasPrefix(out, "\x1b[3A") || strings.Count(out, "\n") != 1 || strings.Contains(out, "part 0") {
+		t.Errorf("unexpected final output %q", out)
+	}
+}
+
+func TestLineReporterLog(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLineReporter(&buf, false, nil)
+	start := time.Now()
+	r.Report(&ProgressEvent{Type: EventItemStarted, Time: start, Title: "test", Index: -1, Size: 4 << 20})
+	r.Report(&ProgressEvent{Type: EventPartStarted, Time: start, Title: "test", Index: 3, Size: 4 << 20})
+	r.Report(&ProgressEvent{Type: EventRetry, Time: start, Title: "test", Index: 3, Attempt: 1, Err: errors.New("timeout")})
+	r.Report(&ProgressEvent{Type: EventBytesWritten, Time: start, Title: "test", Index: 3, Bytes: 1 << 20})
+
+	r.mu.Lock()
+	r.render(start.Add(time.Minute))
+	r.mu.Unlock()
+	r.Report(&ProgressEvent{Type: EventDone, Time: start.Add(time.Minute), Title: "test", Index: -1})
+
+	want := []string{
+		"test: retrying part 3, attempt 1 failed: timeout",
+		"test: 1.0 MiB / 4.0 MiB (25%) at 0 B/s, 1 parts in progress, 1 retries, stalled: part 3",
+		"test: done, 1.0 MiB in 1m0s",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Contains(buf.String(), "\x1b") {
+		t.Error("escape sequences shouldn't be written when the output isn't a terminal")
+	}
+}
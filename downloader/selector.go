@@ -0,0 +1,506 @@
+package downloader
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
+)
+
+// A stream selector picks a stream by its properties rather than its ID, eg: best[height<=1080][codec=avc]/best
+//
+//	selector    = alternative { "/" alternative }    the first alternative that matches a stream wins
+//	alternative = single [ "+" single ]              the video of the first stream is merged with the audio of the second one
+//	single      = [ name ] { "[" filter "]" }        the name defaults to best
+//	name        = best | worst | bestvideo | worstvideo | bestaudio | worstaudio | the ID of a stream
+//	filter      = field op [ "?" ] value             ? accepts the streams without the field
+//
+// The streams are ranked by size like the default stream.
+type selector []selectorAlternative
+
+type selectorAlternative []*selectorSingle
+
+type selectorSingle struct {
+	name    string
+	filters []selectorFilter
+}
+
+type selectorFilter struct {
+	field string
+	op    string
+	value string
+	// optional accepts the streams whose field is unknown
+	optional bool
+}
+
+// the operators of the filters, the longer ones are matched first
+var selectorOps = []string{"<=", ">=", "!=", "^=", "$=", "*=", "=", "<", ">"}
+
+// the numeric fields of the filters, the others are text
+var selectorNumericFields = map[string]bool{
+	"height":  true,
+	"width":   true,
+	"fps":     true,
+	"bitrate": true,
+	"size":    true,
+}
+
+var selectorTextFields = map[string]bool{
+	"id":      true,
+	"ext":     true,
+	"quality": true,
+	"codec":   true,
+	"vcodec":  true,
+	"acodec":  true,
+}
+
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	for _, alternative := range strings.Split(s, "/") {
+		var alt selectorAlternative
+		singles := strings.Split(alternative, "+")
+		if len(singles) > 2 {
+			return nil, errors.Errorf("invalid stream selector %q, only two streams can be merged", s)
+		}
+		for _, single := range singles {
+			parsed, err := parseSelectorSingle(strings.TrimSpace(single))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "invalid stream selector %q", s)
+			}
+			alt = append(alt, parsed)
+		}
+		sel = append(sel, alt)
+	}
+	return sel, nil
+}
+
+func parseSelectorSingle(s string) (*selectorSingle, error) {
+	name, filters, _ := strings.Cut(s, "[")
+	single := &selectorSingle{name: strings.TrimSpace(name)}
+	if single.name == "" {
+		single.name = "best"
+	}
+	if filters == "" {
+		if strings.Contains(s, "[") {
+			return nil, errors.New("empty filter")
+		}
+		return single, nil
+	}
+	for _, filter := range strings.Split("["+filters, "[")[1:] {
+		filter, ok := strings.CutSuffix(strings.TrimSpace(filter), "]")
+		if !ok || strings.Contains(filter, "]") {
+			return nil, errors.Errorf("unclosed filter [%s", filter)
+		}
+		parsed, err := parseSelectorFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		single.filters = append(single.filters, parsed)
+	}
+	return single, nil
+}
+
+func parseSelectorFilter(s string) (selectorFilter, error) {
+	for _, op := range selectorOps {
+		index := strings.Index(s, op)
+		if index <= 0 {
+			continue
+		}
+		filter := selectorFilter{
+			field: strings.TrimSpace(s[:index]),
+			op:    op,
+			value: s[index+len(op):],
+		}
+		filter.value, filter.optional = strings.CutPrefix(filter.value, "?")
+		filter.value = strings.TrimSpace(filter.value)
+		switch {
+		case selectorNumericFields[filter.field]:
+			if op == "^=" || op == "$=" || op == "*=" {
+				return filter, errors.Errorf("operator %s can't be used with the numeric field %s", op, filter.field)
+			}
+			if _, err := filter.number(); err != nil {
+				return filter, err
+			}
+		case selectorTextFields[filter.field]:
+			if strings.ContainsAny(op, "<>") {
+				return filter, errors.Errorf("operator %s can't be used with the text field %s", op, filter.field)
+			}
+		default:
+			return filter, errors.Errorf("unknown field %s in the filter [%s]", filter.field, s)
+		}
+		return filter, nil
+	}
+	return selectorFilter{}, errors.Errorf("invalid filter [%s], eg: [height<=1080]", s)
+}
+
+// number returns the numeric value of the filter, the sizes may have a unit, eg: 500M
+func (f selectorFilter) number() (float64, error) {
+	if f.field == "size" {
+		size, err := utils.ParseRate(f.value)
+		return float64(size), err
+	}
+	value, err := strconv.ParseFloat(f.value, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid number %q of the field %s", f.value, f.field)
+	}
+	return value, nil
+}
+
+func (f selectorFilter) match(stream *extractors.Stream) bool {
+	info := newStreamInfo(stream)
+	if selectorNumericFields[f.field] {
+		actual := info.number(f.field)
+		if actual == 0 {
+			return f.optional
+		}
+		value, _ := f.number()
+		switch f.op {
+		case "=":
+			return actual == value
+		case "!=":
+			return actual != value
+		case "<":
+			return actual < value
+		case "<=":
+			return actual <= value
+		case ">":
+			return actual > value
+		case ">=":
+			return actual >= value
+		}
+		return false
+	}
+
+	actual := info.text(f.field)
+	if actual == "" {
+		return f.optional
+	}
+	actual, value := strings.ToLower(actual), strings.ToLower(f.value)
+	isCodec := strings.Contains(f.field, "codec")
+	switch f.op {
+	case "=":
+		return actual == value || isCodec && codecFamily(actual) == codecFamily(value)
+	case "!=":
+		return actual != value && (!isCodec || codecFamily(actual) != codecFamily(value))
+	case "^=":
+		return strings.HasPrefix(actual, value)
+	case "$=":
+		return strings.HasSuffix(actual, value)
+	case "*=":
+		return strings.Contains(actual, value)
+	}
+	return false
+}
+
+// selectStream returns the stream of the selector, the sorted streams are ranked from the best to the worst.
+func selectStream(data *extractors.Data, sortedStreams []*extractors.Stream, s string) (*extractors.Stream, error) {
+	if s == "" {
+		return sortedStreams[0], nil
+	}
+	// the IDs are selected as is even if they look like selectors
+	if stream, ok := data.Streams[s]; ok {
+		return stream, nil
+	}
+	sel, err := parseSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, alt := range sel {
+		streams := make([]*extractors.Stream, 0, len(alt))
+		for _, single := range alt {
+			stream := single.pick(data, sortedStreams)
+			if stream == nil {
+				break
+			}
+			streams = append(streams, stream)
+		}
+		if len(streams) < len(alt) {
+			continue
+		}
+		if len(streams) == 1 {
+			return streams[0], nil
+		}
+		if stream := mergeStreams(streams[0], streams[1]); stream != nil {
+			return stream, nil
+		}
+	}
+	return nil, errors.Errorf("no stream matches %s", s)
+}
+
+// pick returns the stream matching the name and the filters, or nil.
+func (single *selectorSingle) pick(data *extractors.Data, sortedStreams []*extractors.Stream) *extractors.Stream {
+	var candidates []*extractors.Stream
+	switch single.name {
+	case "best", "worst":
+		candidates = sortedStreams
+	case "bestvideo", "worstvideo":
+		for _, stream := range sortedStreams {
+			if !newStreamInfo(stream).audioOnly {
+				candidates = append(candidates, stream)
+			}
+		}
+	case "bestaudio", "worstaudio":
+		for _, stream := range sortedStreams {
+			if newStreamInfo(stream).audioOnly {
+				candidates = append(candidates, stream)
+			}
+		}
+	default:
+		if stream, ok := data.Streams[single.name]; ok {
+			candidates = []*extractors.Stream{stream}
+		}
+	}
+
+	var matched []*extractors.Stream
+	for _, stream := range candidates {
+		ok := true
+		for _, filter := range single.filters {
+			if !filter.match(stream) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, stream)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	if strings.HasPrefix(single.name, "worst") {
+		return matched[len(matched)-1]
+	}
+	return matched[0]
+}
+
+// selectAudioStream returns the best audio only stream, or the audio of the best stream whose tracks can be told apart,
+// or the smallest stream which isn't known to have no audio.
+func selectAudioStream(data *extractors.Data, sortedStreams []*extractors.Stream) *extractors.Stream {
+	if stream := (&selectorSingle{name: "bestaudio"}).pick(data, sortedStreams); stream != nil {
+		return stream
+	}
+	for _, stream := range sortedStreams {
+		if !stream.NeedMux {
+			continue
+		}
+		if _, audioParts := splitTracks(stream); len(audioParts) > 0 {
+			audio := &extractors.Stream{
+				ID:      stream.ID + "-audio",
+				Quality: stream.Quality,
+				Parts:   audioParts,
+				Ext:     audioParts[0].Ext,
+			}
+			audio.AudioCodec = newStreamInfo(stream).acodec
+			for _, part := range audioParts {
+				audio.Size += part.Size
+			}
+			return audio
+		}
+	}
+	for i := len(sortedStreams) - 1; i >= 0; i-- {
+		// the extractor knows the codecs of the stream and there is no audio
+		if media := sortedStreams[i].Media; media.VideoCodec != "" && media.AudioCodec == "" {
+			continue
+		}
+		return sortedStreams[i]
+	}
+	return sortedStreams[len(sortedStreams)-1]
+}
+
+// mergeStreams returns a stream of the video of the first stream and the audio of the second one,
+// it's nil if the tracks can't be told apart.
+func mergeStreams(video, audio *extractors.Stream) *extractors.Stream {
+	videoParts, _ := splitTracks(video)
+	_, audioParts := splitTracks(audio)
+	if len(videoParts) == 0 || len(audioParts) == 0 {
+		return nil
+	}
+	stream := &extractors.Stream{
+		ID:      video.ID + "+" + audio.ID,
+		Quality: video.Quality + " + " + audio.Quality,
+		Parts:   append(append([]*extractors.Part{}, videoParts...), audioParts...),
+		Ext:     video.Ext,
+		NeedMux: true,
+	}
+	for _, part := range stream.Parts {
+		stream.Size += part.Size
+	}
+	return stream
+}
+
+// splitTracks returns the video and the audio parts of the stream,
+// the last part of the streams that need mux is the audio if the parts have no tracks.
+func splitTracks(stream *extractors.Stream) (video, audio []*extractors.Part) {
+	if newStreamInfo(stream).audioOnly {
+		return nil, stream.Parts
+	}
+	for _, part := range stream.Parts {
+		switch {
+		case part.Track == "video", part.HasVideo():
+			video = append(video, part)
+		case part.Track == "audio", part.AudioCodec != "":
+			audio = append(audio, part)
+		}
+	}
+	if len(video) > 0 || len(audio) > 0 {
+		return video, audio
+	}
+	if stream.NeedMux && len(stream.Parts) > 1 {
+		last := len(stream.Parts) - 1
+		return stream.Parts[:last], stream.Parts[last:]
+	}
+	return stream.Parts, nil
+}
+
+var (
+	qualityHeight  = regexp.MustCompile(`(?i)\b(\d{3,4})[pP]`)
+	qualitySize    = regexp.MustCompile(`\b(\d{3,4})x(\d{3,4})\b`)
+	qualityBitrate = regexp.MustCompile(`(?i)\b(\d+)\s?kbps\b`)
+	qualityFPS     = regexp.MustCompile(`(?i)\b(\d+(\.\d+)?)\s?fps\b`)
+	qualityCodec   = regexp.MustCompile(`(?i)\b(avc[13]|hev1|hvc1|av01|vp0?[89]|mp4a|opus|vorbis|[ae]c-3|flac|h26[45]|hevc)(\.[\w.]+)?`)
+)
+
+var audioExts = map[string]bool{
+	"m4a":  true,
+	"mp3":  true,
+	"aac":  true,
+	"opus": true,
+	"ogg":  true,
+	"flac": true,
+	"wav":  true,
+}
+
+// streamInfo is the properties of a stream, the ones the extractor doesn't know are parsed from its quality,
+// eg: 高清 1080P avc1.640032
+type streamInfo struct {
+	stream        *extractors.Stream
+	width, height int
+	fps           float64
+	vcodec        string
+	acodec        string
+	audioOnly     bool
+	// bitrate is in kbps
+	bitrate float64
+}
+
+func newStreamInfo(stream *extractors.Stream) *streamInfo {
+	info := &streamInfo{stream: stream}
+	quality := stream.Quality
+	if m := qualitySize.FindStringSubmatch(quality); m != nil {
+		info.width, _ = strconv.Atoi(m[1])
+		info.height, _ = strconv.Atoi(m[2])
+	} else if m = qualityHeight.FindStringSubmatch(quality); m != nil {
+		info.height, _ = strconv.Atoi(m[1])
+	}
+	for _, m := range qualityBitrate.FindAllStringSubmatch(quality, -1) {
+		kbps, _ := strconv.ParseFloat(m[1], 64)
+		info.bitrate += kbps
+	}
+	if m := qualityFPS.FindStringSubmatch(quality); m != nil {
+		info.fps, _ = strconv.ParseFloat(m[1], 64)
+	}
+	for _, m := range qualityCodec.FindAllString(quality, -1) {
+		if isAudioCodec(m) {
+			if info.acodec == "" {
+				info.acodec = m
+			}
+		} else if info.vcodec == "" {
+			info.vcodec = m
+		}
+	}
+
+	media := stream.Media
+	if media.Height > 0 {
+		info.width, info.height = media.Width, media.Height
+	}
+	if media.FPS > 0 {
+		info.fps = media.FPS
+	}
+	if media.Bitrate > 0 {
+		info.bitrate = float64(media.Bitrate) / 1000
+	}
+	if media.VideoCodec != "" {
+		info.vcodec = media.VideoCodec
+	}
+	if media.AudioCodec != "" {
+		info.acodec = media.AudioCodec
+	}
+
+	info.audioOnly = info.height == 0 && info.vcodec == "" &&
+		(strings.Contains(strings.ToLower(quality), "audio") || info.acodec != "" || audioExts[stream.Ext] || allAudioParts(stream))
+	return info
+}
+
+func allAudioParts(stream *extractors.Stream) bool {
+	for _, part := range stream.Parts {
+		if !audioExts[part.Ext] && part.Track != "audio" {
+			return false
+		}
+	}
+	return len(stream.Parts) > 0
+}
+
+func (info *streamInfo) number(field string) float64 {
+	switch field {
+	case "height":
+		return float64(info.height)
+	case "width":
+		return float64(info.width)
+	case "fps":
+		return info.fps
+	case "bitrate":
+		return info.bitrate
+	case "size":
+		return float64(info.stream.Size)
+	}
+	return 0
+}
+
+func (info *streamInfo) text(field string) string {
+	switch field {
+	case "id":
+		return info.stream.ID
+	case "ext":
+		return info.stream.Ext
+	case "quality":
+		return info.stream.Quality
+	case "codec", "vcodec":
+		return info.vcodec
+	case "acodec":
+		return info.acodec
+	}
+	return ""
+}
+
+func isAudioCodec(codec string) bool {
+	switch codecFamily(codec) {
+	case "aac", "opus", "vorbis", "ac-3", "ec-3", "flac":
+		return true
+	}
+	return false
+}
+
+// codecFamily returns the common name of a codec, eg: avc for avc1.640032, h264 and avc
+func codecFamily(codec string) string {
+	codec = strings.ToLower(codec)
+	name, _, _ := strings.Cut(codec, ".")
+	switch {
+	case strings.HasPrefix(name, "avc"), name == "h264":
+		return "avc"
+	case name == "hev1", name == "hvc1", name == "h265", name == "hevc":
+		return "hevc"
+	case name == "av01", name == "av1":
+		return "av1"
+	case name == "vp09", name == "vp9":
+		return "vp9"
+	case name == "vp08", name == "vp8":
+		return "vp8"
+	case name == "mp4a", name == "aac":
+		return "aac"
+	}
+	return name
+}
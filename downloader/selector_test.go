@@ -0,0 +1,194 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+func TestSelectStream(t *testing.T) {
+	streams := []*extractors.Stream{
+		{
+			ID:      "120-12",
+			Quality: "超清 4K hev1.1.6.L153.90",
+			Parts:   []*extractors.Part{{URL: "v4k", Ext: "m4s"}, {URL: "a1", Ext: "m4s"}},
+			Size:    400,
+			NeedMux: true,
+		},
+		{
+			ID:      "80-7",
+			Quality: "高清 1080P avc1.640032",
+			Parts:   []*extractors.Part{{URL: "v1080", Ext: "m4s"}, {URL: "a1", Ext: "m4s"}},
+			Size:    200,
+			NeedMux: true,
+		},
+		{
+			ID:      "64-7",
+			Quality: "高清 720P avc1.64001F",
+			Parts:   []*extractors.Part{{URL: "v720", Ext: "m4s"}, {URL: "a2", Ext: "m4s"}},
+			Size:    100,
+			NeedMux: true,
+		},
+		{
+			ID:      "audio",
+			Quality: "audio 128kbps mp4a.40.2",
+			Parts:   []*extractors.Part{{URL: "a3", Ext: "m4a"}},
+			Size:    10,
+			Ext:     "m4a",
+		},
+	}
+	data := &extractors.Data{Streams: make(map[string]*extractors.Stream)}
+	for _, stream := range streams {
+		data.Streams[stream.ID] = stream
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"", "120-12"},
+		{"80-7", "80-7"},
+		{"best", "120-12"},
+		{"worst", "audio"},
+		{"worstvideo", "64-7"},
+		{"bestaudio", "audio"},
+		{"best[height<=1080][codec=avc]/best", "80-7"},
+		{"best[height<720]/worstvideo", "64-7"},
+		{"best[vcodec=h265]", "120-12"},
+		{"best[height<=720]", "64-7"},
+		// the height of 4K isn't known
+		{"best[height<=?720]", "120-12"},
+		{"best[quality*=720P]", "64-7"},
+		{"best[size>1k]/best", "120-12"},
+		{"80-7[height=1080]", "80-7"},
+		{"bestvideo[height<=1080]+bestaudio", "80-7+audio"},
+		{"64-7+80-7", "64-7+80-7"},
+	}
+	for _, tt := range tests {
+		stream, err := selectStream(data, streams, tt.selector)
+		if err != nil {
+			t.Errorf("selectStream(%q) error: %v", tt.selector, err)
+			continue
+		}
+		if stream.ID != tt.want {
+			t.Errorf("selectStream(%q) = %s, want %s", tt.selector, stream.ID, tt.want)
+		}
+	}
+
+	merged, _ := selectStream(data, streams, "bestvideo[height<=1080]+bestaudio")
+	if len(merged.Parts) != 2 || merged.Parts[0].URL != "v1080" || merged.Parts[1].URL != "a3" || !merged.NeedMux || merged.Size != 0 {
+		t.Errorf("unexpected merged stream %+v", merged)
+	}
+	merged, _ = selectStream(data, streams, "64-7+80-7")
+	if len(merged.Parts) != 2 || merged.Parts[0].URL != "v720" || merged.Parts[1].URL != "a1" {
+		t.Errorf("unexpected merged stream %+v", merged)
+	}
+
+	for _, selector := range []string{"best[height<=480]", "bestaudio[acodec=opus]", "360"} {
+		if _, err := selectStream(data, streams, selector); err == nil {
+			t.Errorf("selectStream(%q) should fail", selector)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{"best[height<=1080]/bestvideo+bestaudio", "[ext=mp4]", "best[fps>=?30][size<500M]"} {
+		if _, err := parseSelector(s); err != nil {
+			t.Errorf("parseSelector(%q) error: %v", s, err)
+		}
+	}
+	for _, s := range []string{
+		"best[height<=1080",
+		"best[]",
+		"best[foo=1]",
+		"best[height=high]",
+		"best[height^=10]",
+		"best[ext>mp4]",
+		"best[height]",
+		"a+b+c",
+	} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("parseSelector(%q) should fail", s)
+		}
+	}
+}
+
+func TestSelectStreamMedia(t *testing.T) {
+	video := &extractors.Part{URL: "v", Ext: "mp4", Media: extractors.Media{Height: 1080, VideoCodec: "hvc1.2.4.L150", FPS: 60}}
+	audio := &extractors.Part{URL: "a", Ext: "mp4", Media: extractors.Media{AudioCodec: "mp4a.40.2", Language: "en"}}
+	streams := []*extractors.Stream{
+		{
+			ID:      "137",
+			Quality: "1080p60",
+			Parts:   []*extractors.Part{video, audio},
+			Size:    100,
+			NeedMux: true,
+			Media:   extractors.Media{Height: 1080, VideoCodec: "hvc1.2.4.L150", AudioCodec: "mp4a.40.2", FPS: 60},
+		},
+		{
+			ID:      "140",
+			Quality: "medium",
+			Parts:   []*extractors.Part{audio},
+			Size:    10,
+			Media:   extractors.Media{AudioCodec: "mp4a.40.2", Bitrate: 128000},
+		},
+	}
+	data := &extractors.Data{Streams: map[string]*extractors.Stream{"137": streams[0], "140": streams[1]}}
+
+	for selector, want := range map[string]string{
+		"best[codec=hevc][fps>=60]": "137",
+		"bestaudio[bitrate<=128]":   "140",
+		"worst[acodec=aac]":         "140",
+		"137+140":                   "137+140",
+	} {
+		stream, err := selectStream(data, streams, selector)
+		if err != nil || stream.ID != want {
+			t.Errorf("selectStream(%q) = %v, %v, want %s", selector, stream, err, want)
+		}
+	}
+	// the tracks are told apart by their codecs
+	merged, _ := selectStream(data, streams, "137+140")
+	if len(merged.Parts) != 2 || merged.Parts[0] != video || merged.Parts[1] != audio {
+		t.Errorf("unexpected merged parts %v", merged.Parts)
+	}
+}
+
+func TestSelectAudioStream(t *testing.T) {
+	video := &extractors.Part{URL: "v", Ext: "m4s", Track: "video"}
+	audio := &extractors.Part{URL: "a", Ext: "m4a", Track: "audio", Size: 10}
+	dash := &extractors.Stream{ID: "80", Quality: "1080P", Parts: []*extractors.Part{video, audio}, Size: 100, NeedMux: true, Ext: "mp4"}
+	muxed := &extractors.Stream{ID: "sd", Quality: "360P", Parts: []*extractors.Part{{URL: "sd", Ext: "mp4"}}, Size: 50, Ext: "mp4"}
+	// the extractor knows there is no audio
+	silent := &extractors.Stream{
+		ID:    "silent",
+		Parts: []*extractors.Part{{URL: "silent", Ext: "mp4"}},
+		Size:  10,
+		Ext:   "mp4",
+		Media: extractors.Media{Height: 144, VideoCodec: "avc1"},
+	}
+	audioOnly := &extractors.Stream{ID: "audio", Quality: "audio", Parts: []*extractors.Part{audio}, Size: 10, Ext: "m4a"}
+
+	tests := []struct {
+		streams []*extractors.Stream
+		want    string
+	}{
+		{[]*extractors.Stream{dash, muxed, audioOnly}, "audio"},
+		{[]*extractors.Stream{dash, muxed}, "80-audio"},
+		{[]*extractors.Stream{muxed, silent}, "sd"},
+	}
+	for _, tt := range tests {
+		data := &extractors.Data{Streams: make(map[string]*extractors.Stream)}
+		for _, stream := range tt.streams {
+			data.Streams[stream.ID] = stream
+		}
+		stream := selectAudioStream(data, tt.streams)
+		if stream.ID != tt.want {
+			t.Errorf("selectAudioStream() = %s, want %s", stream.ID, tt.want)
+		}
+	}
+
+	stream := selectAudioStream(&extractors.Data{}, []*extractors.Stream{dash, muxed})
+	if len(stream.Parts) != 1 || stream.Parts[0] != audio || stream.Ext != "m4a" || stream.Size != 10 || stream.NeedMux {
+		t.Errorf("unexpected audio stream %+v", stream)
+	}
+}
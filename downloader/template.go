@@ -0,0 +1,140 @@
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
+)
+
+// templateField returns the value of a field of the output template, it's a string or an int.
+type templateField func(data *extractors.Data, stream *extractors.Stream) interface{}
+
+var templateFields = map[string]templateField{
+	"id":        func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.ID },
+	"title":     func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.Title },
+	"site":      func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.Site },
+	"extractor": func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.Extractor },
+	"type":      func(data *extractors.Data, _ *extractors.Stream) interface{} { return string(data.Type) },
+	"url":       func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.URL },
+	"stream":    func(_ *extractors.Data, stream *extractors.Stream) interface{} { return stream.ID },
+	"quality":   func(_ *extractors.Data, stream *extractors.Stream) interface{} { return stream.Quality },
+	"ext":       func(_ *extractors.Data, stream *extractors.Stream) interface{} { return stream.Ext },
+	"playlist_index": func(data *extractors.Data, _ *extractors.Stream) interface{} {
+		return data.PlaylistIndex
+	},
+	"uploader":    func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.Uploader },
+	"uploader_id": func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.UploaderID },
+	"upload_date": func(data *extractors.Data, _ *extractors.Stream) interface{} { return data.UploadDate },
+	// in seconds
+	"duration":   func(data *extractors.Data, _ *extractors.Stream) interface{} { return int(data.Duration) },
+	"view_count": func(data *extractors.Data, _ *extractors.Stream) interface{} { return int(data.ViewCount) },
+}
+
+// templateMissing replaces the fields without a value, eg: an empty ID
+const templateMissing = "NA"
+
+// templateSpec is the formatting of a field like the verbs of fmt, eg: 03d or .50s
+var templateSpec = regexp.MustCompile(`^[-+# 0]*\d*(\.\d+)?[sdqv]$`)
+
+type templateToken struct {
+	// literal is used if field is empty
+	literal string
+	field   string
+	format  string
+}
+
+// OutputTemplate is the template of the output file path,
+// eg: {extractor}/{playlist_index:03d} - {title} [{id}].{ext}
+type OutputTemplate struct {
+	tokens []templateToken
+}
+
+// ParseOutputTemplate parses an output template, the fields are enclosed in braces with an optional format after a colon,
+// eg: {playlist_index:03d}, {{ and }} are literal braces.
+func ParseOutputTemplate(s string) (*OutputTemplate, error) {
+	t := &OutputTemplate{}
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c == '{' || c == '}') && i+1 < len(s) && s[i+1] == c:
+			literal.WriteByte(c)
+			i++
+		case c == '}':
+			return nil, errors.Errorf("unexpected } in the output template %q, use }} for a literal brace", s)
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed { in the output template %q", s)
+			}
+			name, format, _ := strings.Cut(s[i+1:i+end], ":")
+			field, ok := templateFields[name]
+			if !ok {
+				return nil, errors.Errorf("unknown field {%s} in the output template %q", name, s)
+			}
+			if format == "" {
+				format = "v"
+			}
+			if !templateSpec.MatchString(format) {
+				return nil, errors.Errorf("invalid format %q of the field {%s}", format, name)
+			}
+			// the formats of numbers can't be applied to strings
+			if _, isString := field(&extractors.Data{}, &extractors.Stream{}).(string); isString && strings.HasSuffix(format, "d") {
+				return nil, errors.Errorf("invalid format %q of the text field {%s}", format, name)
+			}
+			if literal.Len() > 0 {
+				t.tokens = append(t.tokens, templateToken{literal: literal.String()})
+				literal.Reset()
+			}
+			t.tokens = append(t.tokens, templateToken{field: name, format: "%" + format})
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if literal.Len() > 0 {
+		t.tokens = append(t.tokens, templateToken{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// Render returns the output path of the stream without the extension of the stream, separated by /.
+// The values can't add path segments, and each segment is a valid file name of at most length characters.
+func (t *OutputTemplate) Render(data *extractors.Data, stream *extractors.Stream, length int) string {
+	var b strings.Builder
+	for _, token := range t.tokens {
+		if token.field == "" {
+			b.WriteString(token.literal)
+			continue
+		}
+		value := templateFields[token.field](data, stream)
+		if value == "" || value == 0 {
+			b.WriteString(templateMissing)
+			continue
+		}
+		if s, ok := value.(string); ok {
+			// a / in a value would be a path separator
+			value = utils.FileName(s, "", 0)
+		}
+		fmt.Fprintf(&b, token.format, value)
+	}
+	path := strings.TrimSuffix(b.String(), "."+stream.Ext)
+
+	segments := make([]string, 0, strings.Count(path, "/")+1)
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.TrimSpace(utils.FileName(segment, "", length))
+		switch segment {
+		case "":
+			continue
+		case ".", "..":
+			segment = "_"
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
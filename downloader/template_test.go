@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+func TestOutputTemplate(t *testing.T) {
+	data := &extractors.Data{
+		Site:          "哔哩哔哩 bilibili.com",
+		Extractor:     "bilibili",
+		Title:         "AC/DC: Live",
+		PlaylistIndex: 3,
+		Uploader:      "up",
+		UploadDate:    "2020-01-01",
+	}
+	stream := &extractors.Stream{ID: "80-7", Quality: "高清 1080P", Ext: "mp4"}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{extractor}/{playlist_index:03d} - {title} [{id}].{ext}", "bilibili/003 - AC DC：Live [NA]"},
+		{"{title:.5s} {stream} {{{quality}}}", "AC DC 80-7 {高清 1080P}"},
+		{"/{title}/../{extractor}//{id}.mkv", "AC DC：Live/_/bilibili/NA.mkv"},
+		{"{id}", "NA"},
+		{"{uploader}/{upload_date} {title} {duration}", "up/2020-01-01 AC DC：Live NA"},
+	}
+	for _, tt := range tests {
+		template, err := ParseOutputTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := template.Render(data, stream, 0); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	template, _ := ParseOutputTemplate("{title}/{title}")
+	if got := template.Render(data, stream, 6); got != "AC .../AC ..." {
+		t.Errorf("the segments should be limited, got %q", got)
+	}
+
+	for _, s := range []string{"{channel}", "{title", "title}", "{title:03d}", "{playlist_index:%d}"} {
+		if _, err := ParseOutputTemplate(s); err == nil {
+			t.Errorf("ParseOutputTemplate(%q) should fail", s)
+		}
+	}
+}
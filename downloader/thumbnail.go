@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif" // decode GIF thumbnails
+	"image/jpeg"
+	_ "image/png" // decode PNG thumbnails
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/id3"
+	"github.com/hydrz/lux/mp4"
+	"github.com/hydrz/lux/utils"
+)
+
+// thumbnailExts are the file extensions of the thumbnails by their content types
+var thumbnailExts = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// thumbnail downloads a thumbnail, it returns the image and its file extension.
+func (downloader *Downloader) thumbnail(ctx context.Context, url string) ([]byte, string, error) {
+	refer := downloader.option.Refer
+	if refer == "" {
+		refer = url
+	}
+	body, err := downloader.option.Client.GetByteWithContext(ctx, url, refer, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	// thumbnails are small, they are accounted for after the fact
+	if err = downloader.limiter.WaitN(ctx, len(body)); err != nil {
+		return nil, "", err
+	}
+	ext, ok := thumbnailExts[http.DetectContentType(body)]
+	if !ok {
+		ext = strings.TrimPrefix(path.Ext(strings.SplitN(url, "?", 2)[0]), ".")
+		if ext == "" {
+			ext = "jpg"
+		}
+	}
+	return body, ext, nil
+}
+
+// writeThumbnail writes the thumbnail to <title>.<ext> beside the merged file, it returns the path of the file.
+func (downloader *Downloader) writeThumbnail(thumbnail []byte, title, ext string) (string, error) {
+	filePath, err := utils.FilePath(title, ext, downloader.option.FileNameLength, downloader.option.OutputPath, false)
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filePath, thumbnail, 0644); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return filePath, nil
+}
+
+// embedThumbnail sets the thumbnail as the cover art of an MP4 or MP3 file.
+func embedThumbnail(filePath string, thumbnail []byte) error {
+	var embed func(string, []byte) error
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".mp4", ".m4a", ".m4v", ".mov":
+		embed = mp4.EmbedCover
+	case ".mp3":
+		embed = id3.EmbedCover
+	default:
+		return errors.Errorf("thumbnails can't be embedded into %s files", ext)
+	}
+	cover, err := coverImage(thumbnail)
+	if err != nil {
+		return err
+	}
+	return embed(filePath, cover)
+}
+
+// coverImage converts the thumbnail to JPEG unless it's a JPEG or PNG image, which are the formats of cover arts.
+func coverImage(thumbnail []byte) ([]byte, error) {
+	switch http.DetectContentType(thumbnail) {
+	case "image/jpeg", "image/png":
+		return thumbnail, nil
+	}
+	img, format, err := image.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		return nil, errors.Wrap(err, "unsupported thumbnail format")
+	}
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, errors.Wrapf(err, "convert the %s thumbnail to JPEG", format)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hydrz/lux/extractors"
+)
+
+func TestThumbnail(t *testing.T) {
+	var thumbnail bytes.Buffer
+	if err := gif.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	audio := []byte("\xff\xfb\x90\x64audio")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/thumbnail" {
+			w.Write(thumbnail.Bytes()) // nolint
+			return
+		}
+		w.Write(audio) // nolint
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	data := &extractors.Data{
+		Title:      "thumbnail",
+		Type:       extractors.DataTypeAudio,
+		URL:        server.URL,
+		Thumbnails: []*extractors.Thumbnail{{URL: server.URL + "/thumbnail"}},
+		Streams: map[string]*extractors.Stream{
+			"default": {
+				ID:    "default",
+				Parts: []*extractors.Part{{URL: server.URL + "/audio", Size: int64(len(audio)), Ext: "mp3"}},
+				Size:  int64(len(audio)),
+				Ext:   "mp3",
+			},
+		},
+	}
+	err := New(Options{OutputPath: dir, RetryTimes: 1, Silent: true, WriteThumbnail: true, WriteInfoJSON: true, PostProcessors: []PostProcessor{EmbedThumbnail{}}}).Download(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(dir, "thumbnail.gif")); !bytes.Equal(content, thumbnail.Bytes()) {
+		t.Error("the thumbnail isn't written")
+	}
+	info, err := ReadInfoJSON(filepath.Join(dir, "thumbnail.info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ThumbnailFile != filepath.Join(dir, "thumbnail.gif") {
+		t.Errorf("unexpected thumbnail file %q", info.ThumbnailFile)
+	}
+	// the GIF thumbnail is converted to a JPEG cover
+	content, _ := os.ReadFile(filepath.Join(dir, "thumbnail.mp3"))
+	if !bytes.HasPrefix(content, []byte("ID3")) || !bytes.Contains(content, []byte("APIC\x00")) ||
+		!bytes.Contains(content, []byte("image/jpeg")) || !bytes.HasSuffix(content, audio) {
+		t.Errorf("the cover isn't embedded: %q", content)
+	}
+}
+
+func TestEmbedThumbnailUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.webm")
+	if err := os.WriteFile(path, []byte("webm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := embedThumbnail(path, []byte("\xff\xd8\xff\xe0")); err == nil {
+		t.Error("embedThumbnail should fail with a webm file")
+	}
+	if _, err := coverImage([]byte("RIFF\x00\x00\x00\x00WEBPVP8 ")); err == nil {
+		t.Error("coverImage should fail with a WebP image")
+	}
+}
@@ -6,18 +6,26 @@ type Aria2RPCData struct {
 	// https://aria2.github.io/manual/en/html/aria2c.html#rpc-interface
 	JSONRPC string `json:"jsonrpc"`
 	ID      string `json:"id"`
-	// For a simple download, only implemented `addUri`
+	// eg: aria2.addUri, aria2.tellStatus or system.multicall
 	Method string `json:"method"`
-	// secret, uris, options
-	Params [3]interface{} `json:"params"`
+	// secret and the params of the method, system.multicall has no secret but the method calls
+	Params []interface{} `json:"params"`
 }
 
 // Aria2Input is options for `aria2.addUri`
 // https://aria2.github.io/manual/en/html/aria2c.html#id3
 type Aria2Input struct {
-	// The file name of the downloaded file
+	// The directory and the file name of the downloaded file
+	Dir string `json:"dir,omitempty"`
 	Out string `json:"out"`
-	// For a simple download, only add headers
+	// The number of connections of the download
+	Split string `json:"split,omitempty"`
+	// The maximum download rate in bytes per second
+	MaxDownloadLimit string `json:"max-download-limit,omitempty"`
+	// "true" replaces an existing file instead of renaming the download, eg: a file left by a failed run
+	AllowOverwrite   string `json:"allow-overwrite,omitempty"`
+	AutoFileRenaming string `json:"auto-file-renaming,omitempty"`
+	// The request headers, eg: Referer, Cookie and User-Agent
 	Header []string `json:"header"`
 }
 
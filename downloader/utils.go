@@ -3,10 +3,14 @@ package downloader
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/utils"
 )
 
 var (
@@ -35,6 +39,38 @@ func printHeader(data *extractors.Data) {
 	fmt.Println(data.Title)
 	cyan.Printf(" Type:      ") // nolint
 	fmt.Println(data.Type)
+	printMetadata(data)
+}
+
+// printMetadata prints the metadata the extractor knows, the description is cut to its first line.
+func printMetadata(data *extractors.Data) {
+	field := func(name, value string) {
+		if value == "" {
+			return
+		}
+		cyan.Printf(" %-10s ", name+":") // nolint
+		fmt.Println(value)
+	}
+	field("ID", data.ID)
+	uploader := data.Uploader
+	if data.UploaderID != "" {
+		uploader = strings.TrimSpace(fmt.Sprintf("%s (%s)", data.Uploader, data.UploaderID))
+	}
+	field("Uploader", uploader)
+	field("Date", data.UploadDate)
+	if data.Duration > 0 {
+		field("Duration", time.Duration(data.Duration*float64(time.Second)).Round(time.Second).String())
+	}
+	if data.ViewCount > 0 {
+		field("Views", strconv.FormatInt(data.ViewCount, 10))
+	}
+	field("Tags", strings.Join(data.Tags, ", "))
+	if description, _, _ := strings.Cut(strings.TrimSpace(data.Description), "\n"); description != "" {
+		field("Desc", utils.LimitLength(description, 80))
+	}
+	if len(data.Thumbnails) > 0 {
+		field("Thumbnail", data.Thumbnails[0].URL)
+	}
 }
 
 func printStream(stream *extractors.Stream) {
@@ -43,12 +79,45 @@ func printStream(stream *extractors.Stream) {
 		cyan.Printf("     Quality:         ") // nolint
 		fmt.Println(stream.Quality)
 	}
+	if media := mediaString(stream.Media); media != "" {
+		cyan.Printf("     Media:           ") // nolint
+		fmt.Println(media)
+	}
 	cyan.Printf("     Size:            ") // nolint
 	fmt.Printf("%.2f MiB (%d Bytes)\n", float64(stream.Size)/(1024*1024), stream.Size)
 	cyan.Printf("     # download with: ") // nolint
 	fmt.Printf("lux -f %s ...\n\n", stream.ID)
 }
 
+// mediaString describes the known properties of the media, eg: 1920x1080 60fps HDR avc1.640032 mp4a.40.2 5000 kbps en
+func mediaString(m extractors.Media) string {
+	var fields []string
+	switch {
+	case m.Width > 0 && m.Height > 0:
+		fields = append(fields, fmt.Sprintf("%dx%d", m.Width, m.Height))
+	case m.Height > 0:
+		fields = append(fields, fmt.Sprintf("%dp", m.Height))
+	}
+	if m.FPS > 0 {
+		fields = append(fields, strconv.FormatFloat(m.FPS, 'f', -1, 64)+"fps")
+	}
+	if m.HDR {
+		fields = append(fields, "HDR")
+	}
+	for _, codec := range []string{m.VideoCodec, m.AudioCodec} {
+		if codec != "" {
+			fields = append(fields, codec)
+		}
+	}
+	if m.Bitrate > 0 {
+		fields = append(fields, fmt.Sprintf("%d kbps", m.Bitrate/1000))
+	}
+	if m.Language != "" {
+		fields = append(fields, m.Language)
+	}
+	return strings.Join(fields, " ")
+}
+
 func printInfo(data *extractors.Data, sortedStreams []*extractors.Stream) {
 	printHeader(data)
 
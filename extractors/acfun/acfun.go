@@ -36,7 +36,8 @@ func New() extractors.Extractor {
 
 // Extract ...
 func (e *extractor) Extract(URL string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.GetByte(URL, referer, nil)
+	client := option.Client
+	html, err := client.GetByte(URL, referer, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -69,7 +70,7 @@ func (e *extractor) Extract(URL string, option extractors.Options) ([]*extractor
 		wgp.Add()
 		go func() {
 			defer wgp.Done()
-			datas = append(datas, extractBangumi(concatURL(t)))
+			datas = append(datas, extractBangumi(client, concatURL(t)))
 		}()
 	}
 	wgp.Wait()
@@ -80,9 +81,9 @@ func concatURL(epData *episodeData) string {
 	return fmt.Sprintf(bangumiHTMLURL, epData.BangumiID, epData.ItemID)
 }
 
-func extractBangumi(URL string) *extractors.Data {
+func extractBangumi(client *request.Client, URL string) *extractors.Data {
 	var err error
-	html, err := request.GetByte(URL, referer, nil)
+	html, err := client.GetByte(URL, referer, nil)
 	if err != nil {
 		return extractors.EmptyData(URL, err)
 	}
@@ -100,14 +101,14 @@ func extractBangumi(URL string) *extractors.Data {
 			return extractors.EmptyData(URL, err)
 		}
 
-		urls, err := utils.M3u8URLs(m3u8URL.String())
+		urls, err := utils.M3u8URLs(client, m3u8URL.String())
 		if err != nil {
 			_, err = url.Parse(stm.URL)
 			if err != nil {
 				return extractors.EmptyData(URL, err)
 			}
 
-			urls, err = utils.M3u8URLs(stm.BackURL)
+			urls, err = utils.M3u8URLs(client, stm.BackURL)
 			if err != nil {
 				return extractors.EmptyData(URL, err)
 			}
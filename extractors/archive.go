@@ -0,0 +1,49 @@
+package extractors
+
+import (
+	"errors"
+)
+
+// ErrArchived is the error of the items skipped because they are in the download archive.
+var ErrArchived = errors.New("already in the download archive")
+
+// Archive records the keys of the downloaded items, see ArchiveKey.
+type Archive interface {
+	Has(key string) bool
+}
+
+// IDExtractor is an Extractor that can tell the ID of the item of a URL without any requests,
+// the archived items are skipped before they are extracted.
+type IDExtractor interface {
+	Extractor
+	// ExtractID returns the ID of the item, it's the same as the Data.ID extracted from the URL.
+	ExtractID(url string) (string, bool)
+}
+
+// ArchiveKey returns the key of an item in the download archive, eg: bilibili:BV1GJ411x7h7
+func ArchiveKey(extractor, id string) string {
+	return extractor + ":" + id
+}
+
+// ArchiveKey returns the key of the item in the download archive, it's empty if the item has no ID.
+func (d *Data) ArchiveKey() string {
+	if d.ID == "" || d.Extractor == "" {
+		return ""
+	}
+	return ArchiveKey(d.Extractor, d.ID)
+}
+
+// Archived reports whether the item of the ID is in the download archive,
+// playlist extractors check it to skip the items before extracting their streams.
+func (o Options) Archived(id string) bool {
+	return o.Archive != nil && id != "" && o.extractor != "" && o.Archive.Has(ArchiveKey(o.extractor, id))
+}
+
+// ArchivedData returns the Data of an item skipped because it's in the download archive.
+func ArchivedData(url, id string) *Data {
+	return &Data{
+		URL: url,
+		ID:  id,
+		Err: ErrArchived,
+	}
+}
@@ -0,0 +1,47 @@
+package extractors
+
+import (
+	"testing"
+)
+
+type archive map[string]bool
+
+func (a archive) Has(key string) bool {
+	return a[key]
+}
+
+type idExtractor struct {
+	extracted bool
+}
+
+func (e *idExtractor) ExtractID(url string) (string, bool) {
+	return "1", true
+}
+
+func (e *idExtractor) Extract(url string, option Options) ([]*Data, error) {
+	e.extracted = true
+	return []*Data{{URL: url, ID: "1", Streams: map[string]*Stream{}}}, nil
+}
+
+func TestExtractArchived(t *testing.T) {
+	e := &idExtractor{}
+	Register("archive-test", e)
+	Register("archive-test-alias", e)
+	option := Options{Archive: archive{"archive-test:1": true}}
+
+	data, err := Extract("https://archive-test-alias.com/1", option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.extracted || len(data) != 1 || data[0].Err != ErrArchived || data[0].ArchiveKey() != "archive-test:1" {
+		t.Fatalf("the archived item should be skipped, got %+v", data)
+	}
+
+	option.Archive = archive{}
+	if data, err = Extract("https://archive-test.com/1", option); err != nil {
+		t.Fatal(err)
+	}
+	if !e.extracted || data[0].Err != nil || data[0].ArchiveKey() != "archive-test:1" {
+		t.Fatalf("the item should be extracted, got %+v", data)
+	}
+}
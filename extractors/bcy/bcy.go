@@ -8,7 +8,6 @@ import (
 
 	"github.com/hydrz/lux/extractors"
 	"github.com/hydrz/lux/parser"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -35,7 +34,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -62,12 +62,12 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	parts := make([]*extractors.Part, 0, len(data.Detail.PostData.Multi))
 	var totalSize int64
 	for _, img := range data.Detail.PostData.Multi {
-		size, err := request.Size(img.OriginalPath, url)
+		size, err := client.Size(img.OriginalPath, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 		totalSize += size
-		_, ext, err := utils.GetNameAndExt(img.OriginalPath)
+		_, ext, err := utils.GetNameAndExt(client, img.OriginalPath)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -33,14 +33,14 @@ const referer = "https://www.bilibili.com"
 
 var utoken string
 
-func genAPI(aid, cid, quality int, bvid string, bangumi bool, cookie string) (string, error) {
+func genAPI(client *request.Client, aid, cid, quality int, bvid string, bangumi bool, cookie string) (string, error) {
 	var (
 		err        error
 		baseAPIURL string
 		params     string
 	)
 	if cookie != "" && utoken == "" {
-		utoken, err = request.Get(
+		utoken, err = client.Get(
 			fmt.Sprintf("%said=%d&cid=%d", bilibiliTokenAPI, aid, cid),
 			referer,
 			nil,
@@ -92,6 +92,16 @@ type bilibiliOptions struct {
 	bvid     string
 	page     int
 	subtitle string
+	// the position in the playlist starting from 1
+	playlistIndex int
+}
+
+// id returns the ID of the video, the page is appended for the pages after the first one, eg: BV1GJ411x7h7_p2
+func (o bilibiliOptions) id() string {
+	if o.page > 1 {
+		return fmt.Sprintf("%s_p%d", o.bvid, o.page)
+	}
+	return o.bvid
 }
 
 func extractBangumi(url, html string, extractOption extractors.Options) ([]*extractors.Data, error) {
@@ -156,7 +166,6 @@ func extractBangumi(url, html string, extractOption extractors.Options) ([]*extr
 		if !slices.Contains(needDownloadItems, index+1) {
 			continue
 		}
-		wgp.Add()
 		id := u.EpID
 		if id == 0 {
 			id = u.EpID
@@ -171,6 +180,13 @@ func extractBangumi(url, html string, extractOption extractors.Options) ([]*extr
 
 			subtitle: fmt.Sprintf("%s %s", u.Title, u.LongTitle),
 		}
+		options.playlistIndex = index + 1
+		if extractOption.Archived(options.id()) {
+			extractedData[dataIndex] = extractors.ArchivedData(options.url, options.id())
+			dataIndex++
+			continue
+		}
+		wgp.Add()
 		go func(index int, options bilibiliOptions, extractedData []*extractors.Data) {
 			defer wgp.Done()
 			extractedData[index] = bilibiliDownload(options, extractOption)
@@ -284,7 +300,6 @@ func multiEpisodeDownload(url, html string, extractOption extractors.Options, pa
 		if !slices.Contains(needDownloadItems, index+1) {
 			continue
 		}
-		wgp.Add()
 		options := bilibiliOptions{
 			url:      url,
 			html:     html,
@@ -293,6 +308,13 @@ func multiEpisodeDownload(url, html string, extractOption extractors.Options, pa
 			cid:      u.Cid,
 			subtitle: fmt.Sprintf("%s P%d", u.Title, index+1),
 		}
+		options.playlistIndex = index + 1
+		if extractOption.Archived(options.id()) {
+			extractedData[dataIndex] = extractors.ArchivedData(options.url, options.id())
+			dataIndex++
+			continue
+		}
+		wgp.Add()
 		go func(index int, options bilibiliOptions, extractedData []*extractors.Data) {
 			defer wgp.Done()
 			extractedData[index] = bilibiliDownload(options, extractOption)
@@ -313,7 +335,6 @@ func multiPageDownload(url, html string, extractOption extractors.Options, pageD
 		if !slices.Contains(needDownloadItems, index+1) {
 			continue
 		}
-		wgp.Add()
 		options := bilibiliOptions{
 			url:      url,
 			html:     html,
@@ -323,6 +344,13 @@ func multiPageDownload(url, html string, extractOption extractors.Options, pageD
 			subtitle: u.Part,
 			page:     u.Page,
 		}
+		options.playlistIndex = index + 1
+		if extractOption.Archived(options.id()) {
+			extractedData[dataIndex] = extractors.ArchivedData(options.url, options.id())
+			dataIndex++
+			continue
+		}
+		wgp.Add()
 		go func(index int, options bilibiliOptions, extractedData []*extractors.Data) {
 			defer wgp.Done()
 			extractedData[index] = bilibiliDownload(options, extractOption)
@@ -340,10 +368,27 @@ func New() extractors.Extractor {
 	return &extractor{}
 }
 
+// ExtractID returns the ID of a video URL, eg: https://www.bilibili.com/video/BV1GJ411x7h7?p=2
+func (e *extractor) ExtractID(url string) (string, bool) {
+	if strings.Contains(url, "bangumi") || strings.Contains(url, "festival") {
+		return "", false
+	}
+	bvid := utils.MatchOneOf(url, `/video/(BV\w+)`)
+	if bvid == nil {
+		return "", false
+	}
+	options := bilibiliOptions{bvid: bvid[1], page: 1}
+	if page := utils.MatchOneOf(url, `\?p=(\d+)`); page != nil {
+		options.page, _ = strconv.Atoi(page[1])
+	}
+	return options.id(), true
+}
+
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	var err error
-	html, err := request.Get(url, referer, nil)
+	html, err := client.Get(url, referer, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -364,6 +409,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 // bilibiliDownload is the download function for a single URL
 func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options) *extractors.Data {
+	client := extractOption.Client
 	var (
 		err  error
 		html string
@@ -372,7 +418,7 @@ func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options)
 		// reuse html string, but this can't be reused in case of playlist
 		html = options.html
 	} else {
-		html, err = request.Get(options.url, referer, nil)
+		html, err = client.Get(options.url, referer, nil)
 		if err != nil {
 			return extractors.EmptyData(options.url, err)
 		}
@@ -381,11 +427,11 @@ func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options)
 	// Get "accept_quality" and "accept_description"
 	// "accept_description":["超高清 8K","超清 4K","高清 1080P+","高清 1080P","高清 720P","清晰 480P","流畅 360P"],
 	// "accept_quality":[127，120,112,80,48,32,16],
-	api, err := genAPI(options.aid, options.cid, 127, options.bvid, options.bangumi, extractOption.Cookie)
+	api, err := genAPI(client, options.aid, options.cid, 127, options.bvid, options.bangumi, extractOption.Cookie)
 	if err != nil {
 		return extractors.EmptyData(options.url, err)
 	}
-	jsonString, err := request.Get(api, referer, nil)
+	jsonString, err := client.Get(api, referer, nil)
 	if err != nil {
 		return extractors.EmptyData(options.url, err)
 	}
@@ -406,37 +452,39 @@ func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options)
 	if dashData.Streams.Audio != nil {
 		// Get audio part
 		var audioID int
-		audios := map[int]string{}
+		audios := map[int]dashStream{}
 		bandwidth := 0
 		for _, stream := range dashData.Streams.Audio {
 			if stream.Bandwidth > bandwidth {
 				audioID = stream.ID
 				bandwidth = stream.Bandwidth
 			}
-			audios[stream.ID] = stream.BaseURL
+			audios[stream.ID] = stream
 		}
-		s, err := request.Size(audios[audioID], referer)
+		s, err := client.Size(audios[audioID].BaseURL, referer)
 		if err != nil {
 			return extractors.EmptyData(options.url, err)
 		}
 		audioPart = &extractors.Part{
-			URL:  audios[audioID],
-			Size: s,
-			Ext:  "m4a",
+			URL:   audios[audioID].BaseURL,
+			Size:  s,
+			Ext:   "m4a",
+			Media: audios[audioID].media(),
 		}
 	}
 
 	streams := make(map[string]*extractors.Stream, len(dashData.Quality))
 	for _, stream := range dashData.Streams.Video {
-		s, err := request.Size(stream.BaseURL, referer)
+		s, err := client.Size(stream.BaseURL, referer)
 		if err != nil {
 			return extractors.EmptyData(options.url, err)
 		}
 		parts := make([]*extractors.Part, 0, 2)
 		parts = append(parts, &extractors.Part{
-			URL:  stream.BaseURL,
-			Size: s,
-			Ext:  getExtFromMimeType(stream.MimeType),
+			URL:   stream.BaseURL,
+			Size:  s,
+			Ext:   getExtFromMimeType(stream.MimeType),
+			Media: stream.media(),
 		})
 		if audioPart != nil {
 			parts = append(parts, audioPart)
@@ -497,8 +545,9 @@ func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options)
 		}
 	}
 
-	return &extractors.Data{
+	extractedData := &extractors.Data{
 		Site:    "哔哩哔哩 bilibili.com",
+		ID:      options.id(),
 		Title:   title,
 		Type:    extractors.DataTypeVideo,
 		Streams: streams,
@@ -509,9 +558,45 @@ func bilibiliDownload(options bilibiliOptions, extractOption extractors.Options)
 					Ext: "xml",
 				},
 			},
-			"subtitle": getSubTitleCaptionPart(options.aid, options.cid),
+			"subtitle": getSubTitleCaptionPart(client, options.aid, options.cid),
 		},
-		URL: options.url,
+		URL:           options.url,
+		PlaylistIndex: options.playlistIndex,
+	}
+	// the bangumi and festival pages have no video data
+	if pageData, err := getMultiPageData(html); err == nil && pageData.BVid == options.bvid {
+		fillMetadata(extractedData, pageData, options.cid)
+	}
+	return extractedData
+}
+
+// fillMetadata fills up the metadata of the video from the page data, the duration is the one of the page of the cid.
+func fillMetadata(data *extractors.Data, pageData *multiPage, cid int) {
+	video := pageData.VideoData
+	data.Description = video.Desc
+	data.Duration = float64(video.Duration)
+	for _, page := range video.Pages {
+		if page.Cid == cid && page.Duration > 0 {
+			data.Duration = float64(page.Duration)
+		}
+	}
+	if video.Pubdate > 0 {
+		data.UploadDate = extractors.FormatDate(time.Unix(video.Pubdate, 0))
+	}
+	data.Uploader = video.Owner.Name
+	if video.Owner.Mid > 0 {
+		data.UploaderID = strconv.FormatInt(video.Owner.Mid, 10)
+	}
+	data.ViewCount = video.Stat.View
+	for _, tag := range pageData.Tags {
+		data.Tags = append(data.Tags, tag.TagName)
+	}
+	if video.Pic != "" {
+		// the covers are protocol-relative sometimes, eg: //i0.hdslb.com/bfs/archive/xxx.jpg
+		if strings.HasPrefix(video.Pic, "//") {
+			video.Pic = "https:" + video.Pic
+		}
+		data.Thumbnails = []*extractors.Thumbnail{{URL: video.Pic}}
 	}
 }
 
@@ -523,8 +608,26 @@ func getExtFromMimeType(mimeType string) string {
 	return "mp4"
 }
 
-func getSubTitleCaptionPart(aid int, cid int) *extractors.CaptionPart {
-	jsonString, err := request.Get(
+// media returns the typed properties of the dash stream, the audio streams have no height.
+func (s dashStream) media() extractors.Media {
+	fps, _ := strconv.ParseFloat(s.FrameRate, 64)
+	media := extractors.Media{
+		Width:   s.Width,
+		Height:  s.Height,
+		Bitrate: int64(s.Bandwidth),
+		FPS:     fps,
+		HDR:     hdrQualities[s.ID],
+	}
+	if s.Height > 0 {
+		media.VideoCodec = s.Codecs
+	} else {
+		media.AudioCodec = s.Codecs
+	}
+	return media
+}
+
+func getSubTitleCaptionPart(client *request.Client, aid int, cid int) *extractors.CaptionPart {
+	jsonString, err := client.Get(
 		fmt.Sprintf("http://api.bilibili.com/x/player/wbi/v2?aid=%d&cid=%d", aid, cid), referer, nil,
 	)
 	if err != nil {
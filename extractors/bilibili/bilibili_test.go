@@ -1,6 +1,7 @@
 package bilibili
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/hydrz/lux/extractors"
@@ -95,3 +96,37 @@ func TestBilibili(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractID(t *testing.T) {
+	e := New().(extractors.IDExtractor)
+	for url, want := range map[string]string{
+		"https://www.bilibili.com/video/BV1GJ411x7h7":          "BV1GJ411x7h7",
+		"https://www.bilibili.com/video/BV1GJ411x7h7/?p=1":     "BV1GJ411x7h7",
+		"https://www.bilibili.com/video/BV1GJ411x7h7?p=3":      "BV1GJ411x7h7_p3",
+		"https://www.bilibili.com/video/av20203945/":           "",
+		"https://www.bilibili.com/bangumi/play/ep167000":       "",
+		"https://www.bilibili.com/festival/2021bnj?bvid=BV1Do": "",
+	} {
+		if got, ok := e.ExtractID(url); got != want || ok != (want != "") {
+			t.Errorf("ExtractID(%q) = %q, %v, want %q", url, got, ok, want)
+		}
+	}
+}
+
+func TestFillMetadata(t *testing.T) {
+	html := `<script>window.__INITIAL_STATE__={"aid":1,"bvid":"BV1GJ411x7h7","videoData":{"title":"t","pic":"//i0.hdslb.com/bfs/archive/a.jpg","desc":"d","pubdate":1577836800,"duration":300,` +
+		`"owner":{"mid":42,"name":"up"},"stat":{"view":1000},"pages":[{"cid":1,"page":1,"duration":100},{"cid":2,"page":2,"duration":200}]},"tags":[{"tag_name":"a"},{"tag_name":"b"}]};(function(){})</script>`
+	pageData, err := getMultiPageData(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &extractors.Data{}
+	fillMetadata(data, pageData, 2)
+	if data.Duration != 200 || data.UploadDate != "2020-01-01" || data.Uploader != "up" || data.UploaderID != "42" ||
+		data.Description != "d" || data.ViewCount != 1000 || strings.Join(data.Tags, ",") != "a,b" {
+		t.Errorf("unexpected metadata %+v", data)
+	}
+	if len(data.Thumbnails) != 1 || data.Thumbnails[0].URL != "https://i0.hdslb.com/bfs/archive/a.jpg" {
+		t.Errorf("unexpected thumbnails %v", data.Thumbnails)
+	}
+}
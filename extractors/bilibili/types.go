@@ -35,14 +35,27 @@ type bangumiData struct {
 }
 
 type videoPagesData struct {
-	Cid  int    `json:"cid"`
-	Part string `json:"part"`
-	Page int    `json:"page"`
+	Cid      int    `json:"cid"`
+	Part     string `json:"part"`
+	Page     int    `json:"page"`
+	Duration int    `json:"duration"`
 }
 
 type multiPageVideoData struct {
 	Title string           `json:"title"`
 	Pages []videoPagesData `json:"pages"`
+	// cover image
+	Pic      string `json:"pic"`
+	Desc     string `json:"desc"`
+	Pubdate  int64  `json:"pubdate"`
+	Duration int    `json:"duration"`
+	Owner    struct {
+		Mid  int64  `json:"mid"`
+		Name string `json:"name"`
+	} `json:"owner"`
+	Stat struct {
+		View int64 `json:"view"`
+	} `json:"stat"`
 }
 
 type episode struct {
@@ -62,6 +75,9 @@ type multiPage struct {
 	BVid      string             `json:"bvid"`
 	Sections  []multiEpisodeData `json:"sections"`
 	VideoData multiPageVideoData `json:"videoData"`
+	Tags      []struct {
+		TagName string `json:"tag_name"`
+	} `json:"tags"`
 }
 
 type dashStream struct {
@@ -71,6 +87,10 @@ type dashStream struct {
 	MimeType  string `json:"mimeType"`
 	Codecid   int    `json:"codecid"`
 	Codecs    string `json:"codecs"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	// eg: 29.970
+	FrameRate string `json:"frameRate"`
 }
 
 type dashStreams struct {
@@ -113,6 +133,12 @@ var qualityString = map[int]string{
 	15:  "流畅 360P",
 }
 
+// the qualities of HDR and Dolby Vision
+var hdrQualities = map[int]bool{
+	125: true,
+	126: true,
+}
+
 type subtitleData struct {
 	From     float32 `json:"from"`
 	To       float32 `json:"to"`
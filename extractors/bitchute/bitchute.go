@@ -12,7 +12,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 )
 
 func init() {
@@ -28,6 +27,7 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	regVideoID := regexp.MustCompile(`/video/([^?/]+)`)
 	matchVideoID := regVideoID.FindStringSubmatch(u)
 	if len(matchVideoID) < 2 {
@@ -35,7 +35,7 @@ func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.
 	}
 	embedURL := fmt.Sprintf("https://www.bitchute.com/api/beta9/embed/?videoID=%s", matchVideoID[1])
 
-	res, err := request.Request(http.MethodGet, embedURL, nil, nil)
+	res, err := client.Request(http.MethodGet, embedURL, nil, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -75,7 +75,7 @@ func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.
 	videoName := strings.ReplaceAll(matchVideoName[1], `\"`, "")
 
 	streams := make(map[string]*extractors.Stream, 1)
-	size, err := request.Size(mediaURL, u)
+	size, err := client.Size(mediaURL, u)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
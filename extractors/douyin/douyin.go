@@ -9,6 +9,7 @@ import (
 	netURL "net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/pkg/errors"
@@ -34,17 +35,26 @@ func New() extractors.Extractor {
 	return &extractor{}
 }
 
+// ExtractID returns the item ID of a video URL, the short links are resolved by Extract
+func (e *extractor) ExtractID(url string) (string, bool) {
+	itemIds := utils.MatchOneOf(url, `/video/(\d+)`)
+	if itemIds == nil {
+		return "", false
+	}
+	return itemIds[1], true
+}
+
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	if strings.Contains(url, "v.douyin.com") {
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		c := http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+		c := *client.HTTPClient()
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
 		}
 		resp, err := c.Do(req)
 		if err != nil {
@@ -64,7 +74,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	itemId := itemIds[len(itemIds)-1]
 
 	// dynamic generate cookie
-	cookie, err := createCookie()
+	cookie, err := createCookie(client)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -92,7 +102,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 	api = fmt.Sprintf("%s&X-Bogus=%s", api, sign)
 
-	jsonData, err := request.Get(api, url, headers)
+	jsonData, err := client.Get(api, url, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -109,12 +119,12 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		douyinType = extractors.DataTypeImage
 		for _, img := range douyin.AwemeDetail.Images {
 			realURL := img.URLList[len(img.URLList)-1]
-			size, err := request.Size(realURL, url)
+			size, err := client.Size(realURL, url)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
 			totalSize += size
-			_, ext, err := utils.GetNameAndExt(realURL)
+			_, ext, err := utils.GetNameAndExt(client, realURL)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
@@ -127,7 +137,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	} else {
 		douyinType = extractors.DataTypeVideo
 		realURL := douyin.AwemeDetail.Video.PlayAddr.URLList[0]
-		totalSize, err = request.Size(realURL, url)
+		totalSize, err = client.Size(realURL, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -144,23 +154,41 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		},
 	}
 
-	return []*extractors.Data{
-		{
-			Site:    "抖音 douyin.com",
-			Title:   douyin.AwemeDetail.Desc,
-			Type:    douyinType,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	detail := douyin.AwemeDetail
+	data := &extractors.Data{
+		Site:        "抖音 douyin.com",
+		ID:          itemId,
+		Title:       detail.Desc,
+		Type:        douyinType,
+		Streams:     streams,
+		URL:         url,
+		Uploader:    detail.Author.Nickname,
+		UploaderID:  detail.Author.SecUID,
+		Description: detail.Desc,
+		ViewCount:   int64(detail.Statistics.PlayCount),
+		// in milliseconds
+		Duration: float64(detail.Duration) / 1000,
+	}
+	if detail.CreateTime > 0 {
+		data.UploadDate = extractors.FormatDate(time.Unix(int64(detail.CreateTime), 0))
+	}
+	for _, tag := range detail.TextExtra {
+		if tag.HashtagName != "" {
+			data.Tags = append(data.Tags, tag.HashtagName)
+		}
+	}
+	if cover := detail.Video.OriginCover; len(cover.URLList) > 0 {
+		data.Thumbnails = []*extractors.Thumbnail{{URL: cover.URLList[0], Width: cover.Width, Height: cover.Height}}
+	}
+	return []*extractors.Data{data}, nil
 }
 
-func createCookie() (string, error) {
+func createCookie(client *request.Client) (string, error) {
 	v1, err := msToken(107)
 	if err != nil {
 		return "", err
 	}
-	v2, err := ttwid()
+	v2, err := ttwid(client)
 	if err != nil {
 		return "", err
 	}
@@ -183,7 +211,7 @@ func msToken(length int) (string, error) {
 	return string(token), nil
 }
 
-func ttwid() (string, error) {
+func ttwid(client *request.Client) (string, error) {
 	body := map[string]interface{}{
 		"aid":           1768,
 		"union":         true,
@@ -198,7 +226,7 @@ func ttwid() (string, error) {
 		return "", err
 	}
 	payload := strings.NewReader(string(bytes))
-	resp, err := request.Request(http.MethodPost, "https://ttwid.bytedance.com/ttwid/union/register/", payload, nil)
+	resp, err := client.Request(http.MethodPost, "https://ttwid.bytedance.com/ttwid/union/register/", payload, nil)
 	if err != nil {
 		return "", err
 	}
@@ -1,11 +1,21 @@
 package douyu
 
 import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
@@ -21,37 +31,36 @@ type douyuData struct {
 	} `json:"data"`
 }
 
-type douyuURLInfo struct {
-	URL  string
-	Size int64
+// douyuRoom is the information of a live room, see https://www.douyu.com/betard/{roomID}
+type douyuRoom struct {
+	Room struct {
+		RoomName string `json:"room_name"`
+		Nickname string `json:"nickname"`
+		// ShowStatus is 1 if the room is live
+		ShowStatus int `json:"show_status"`
+		// VideoLoop is 1 if the room replays the recorded videos while it's offline
+		VideoLoop int    `json:"videoLoop"`
+		RoomPic   string `json:"room_pic"`
+	} `json:"room"`
 }
 
-func douyuM3u8(url string) ([]douyuURLInfo, int64, error) {
-	var (
-		data            []douyuURLInfo
-		temp            douyuURLInfo
-		size, totalSize int64
-		err             error
-	)
-	urls, err := utils.M3u8URLs(url)
-	if err != nil {
-		return nil, 0, err
-	}
-	for _, u := range urls {
-		size, err = request.Size(u, url)
-		if err != nil {
-			return nil, 0, err
-		}
-		totalSize += size
-		temp = douyuURLInfo{
-			URL:  u,
-			Size: size,
-		}
-		data = append(data, temp)
-	}
-	return data, totalSize, nil
+// douyuPreview is the HLS stream of a live room
+type douyuPreview struct {
+	Error int    `json:"error"`
+	Msg   string `json:"msg"`
+	Data  struct {
+		RtmpURL  string `json:"rtmp_url"`
+		RtmpLive string `json:"rtmp_live"`
+	} `json:"data"`
 }
 
+const (
+	douyuRoomAPI    = "https://www.douyu.com/betard/"
+	douyuPreviewAPI = "https://playweb.douyucdn.cn/lapi/live/hlsH5Preview/"
+	// douyuDeviceID is the device ID of the web player without a login
+	douyuDeviceID = "10000000000000000000000000001501"
+)
+
 type extractor struct{}
 
 // New returns a douyu extractor.
@@ -61,13 +70,19 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	var err error
-	liveVid := utils.MatchOneOf(url, `https?://www.douyu.com/(\S+)`)
-	if liveVid != nil {
-		return nil, errors.New("暂不支持斗鱼直播")
+	// live rooms, eg: https://www.douyu.com/9999
+	if utils.MatchOneOf(url, `https?://(?:www\.|m\.)?douyu\.com/\S+`) != nil {
+		return extractLive(ctx, client, url)
 	}
 
-	html, err := request.Get(url, url, nil)
+	html, err := client.GetWithContext(ctx, url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -83,7 +98,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 	vid := vids[1]
 
-	dataString, err := request.Get("http://vmobile.douyu.com/video/getInfo?vid="+vid, url, nil)
+	dataString, err := client.GetWithContext(ctx, "http://vmobile.douyu.com/video/getInfo?vid="+vid, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -92,25 +107,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
-	m3u8URLs, totalSize, err := douyuM3u8(dataDict.Data.VideoURL)
+	streams, err := hls.StreamsContext(ctx, client, dataDict.Data.VideoURL, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	urls := make([]*extractors.Part, len(m3u8URLs))
-	for index, u := range m3u8URLs {
-		urls[index] = &extractors.Part{
-			URL:  u.URL,
-			Size: u.Size,
-			Ext:  "ts",
-		}
-	}
 
-	streams := map[string]*extractors.Stream{
-		"default": {
-			Parts: urls,
-			Size:  totalSize,
-		},
-	}
 	return []*extractors.Data{
 		{
 			Site:    "斗鱼 douyu.com",
@@ -121,3 +122,88 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		},
 	}, nil
 }
+
+// liveRoomID returns the ID of the live room of the URL, eg: 9999 of https://www.douyu.com/9999,
+// the rooms with a custom address are looked up in their pages.
+func liveRoomID(ctx context.Context, client *request.Client, url string) (string, error) {
+	if u, err := neturl.Parse(url); err == nil && u.Query().Get("rid") != "" {
+		return u.Query().Get("rid"), nil
+	}
+	if id := utils.MatchOneOf(url, `douyu\.com/(\d+)`); len(id) > 1 {
+		return id[1], nil
+	}
+	page, err := client.GetWithContext(ctx, url, url, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	id := utils.MatchOneOf(page, `\$ROOM\.room_id\s*=\s*(\d+)`, `\\?"room_id\\?"\s*:\s*(\d+)`)
+	if len(id) < 2 {
+		return "", errors.WithStack(extractors.ErrURLParseFailed)
+	}
+	return id[1], nil
+}
+
+// extractLive returns the HLS stream of a live room.
+func extractLive(ctx context.Context, client *request.Client, url string) ([]*extractors.Data, error) {
+	roomID, err := liveRoomID(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var room douyuRoom
+	body, err := client.GetByteWithContext(ctx, douyuRoomAPI+roomID, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = json.Unmarshal(body, &room); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if room.Room.ShowStatus != 1 || room.Room.VideoLoop == 1 {
+		return nil, errors.Errorf("the douyu room %s is offline", roomID)
+	}
+
+	// the preview API is signed by the MD5 hash of the room ID and the time in milliseconds
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	sum := md5.Sum([]byte(roomID + now))
+	form := neturl.Values{"rid": {roomID}, "did": {douyuDeviceID}}
+	res, err := client.RequestWithContext(ctx, http.MethodPost, douyuPreviewAPI+roomID, strings.NewReader(form.Encode()), map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Referer":      url,
+		"rid":          roomID,
+		"time":         now,
+		"auth":         hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close() // nolint
+	var preview douyuPreview
+	if err = json.NewDecoder(res.Body).Decode(&preview); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if preview.Error != 0 || preview.Data.RtmpLive == "" {
+		return nil, errors.Errorf("failed to get the stream of the douyu room %s: %s (%d)", roomID, preview.Msg, preview.Error)
+	}
+
+	streams, err := hls.StreamsContext(ctx, client, preview.Data.RtmpURL+"/"+preview.Data.RtmpLive, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	title := room.Room.RoomName
+	if room.Room.Nickname != "" {
+		title = fmt.Sprintf("%s - %s", room.Room.Nickname, title)
+	}
+	data := &extractors.Data{
+		Site:    "斗鱼直播 douyu.com",
+		ID:      roomID,
+		Title:   title,
+		Type:    extractors.DataTypeVideo,
+		Streams: streams,
+		URL:     url,
+	}
+	if room.Room.RoomPic != "" {
+		data.Thumbnails = []*extractors.Thumbnail{{URL: room.Room.RoomPic}}
+	}
+	return []*extractors.Data{data}, nil
+}
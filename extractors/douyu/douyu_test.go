@@ -1,6 +1,7 @@
 package douyu
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hydrz/lux/extractors"
@@ -27,3 +28,15 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestLiveRoomID(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://www.douyu.com/9999":                  "9999",
+		"https://m.douyu.com/9999?from=share":         "9999",
+		"https://www.douyu.com/topic/s12?rid=5720533": "5720533",
+	} {
+		if id, err := liveRoomID(context.Background(), nil, url); err != nil || id != want {
+			t.Errorf("liveRoomID(%q) = %q, %v, want %q", url, id, err, want)
+		}
+	}
+}
@@ -10,7 +10,6 @@ import (
 
 	"github.com/hydrz/lux/extractors"
 	"github.com/hydrz/lux/parser"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -105,7 +104,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(u, u, nil)
+	client := option.Client
+	html, err := client.Get(u, u, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -125,7 +125,7 @@ func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.
 	for _, src := range srcs {
 		srcurl := uu.Scheme + "://" + uu.Host + src.url
 		// skipping an extra HEAD request to the URL.
-		// size, err := request.Size(srcurl, u)
+		// size, err := client.Size(srcurl, u)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -1,6 +1,7 @@
 package extractors
 
 import (
+	"context"
 	"net/url"
 	"strings"
 	"sync"
@@ -13,27 +14,51 @@ import (
 var lock sync.RWMutex
 var extractorMap = make(map[string]Extractor)
 
+// extractorNames are the first domains the extractors are registered with, eg: youtube rather than youtu
+var extractorNames = make(map[Extractor]string)
+
 // Register registers an Extractor.
 func Register(domain string, e Extractor) {
 	lock.Lock()
 	extractorMap[domain] = e
+	if _, ok := extractorNames[e]; !ok {
+		extractorNames[e] = domain
+	}
 	lock.Unlock()
 }
 
+// bilibiliShortLinks are the URL prefixes of the bilibili short links by their type, eg: av20203945
+var bilibiliShortLinks = map[string]string{
+	"av": "https://www.bilibili.com/video/",
+	"BV": "https://www.bilibili.com/video/",
+	"ep": "https://www.bilibili.com/bangumi/play/",
+}
+
+// ResolveURL returns the URL of a short link, eg: the bilibili video of av20203945, the other URLs are returned as is.
+func ResolveURL(u string) string {
+	u = strings.TrimSpace(u)
+	if link := utils.MatchOneOf(u, `^(av|BV|ep)\w+`); len(link) > 1 {
+		return bilibiliShortLinks[link[1]] + u
+	}
+	return u
+}
+
 // Extract is the main function to extract the data.
 func Extract(u string, option Options) ([]*Data, error) {
+	return ExtractContext(context.Background(), u, option)
+}
+
+// ExtractContext is like Extract but the extraction is canceled with ctx.
+func ExtractContext(ctx context.Context, u string, option Options) ([]*Data, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
 	u = strings.TrimSpace(u)
 	var domain string
 
-	bilibiliShortLink := utils.MatchOneOf(u, `^(av|BV|ep)\w+`)
-	if len(bilibiliShortLink) > 1 {
-		bilibiliURL := map[string]string{
-			"av": "https://www.bilibili.com/video/",
-			"BV": "https://www.bilibili.com/video/",
-			"ep": "https://www.bilibili.com/bangumi/play/",
-		}
+	if resolved := ResolveURL(u); resolved != u {
 		domain = "bilibili"
-		u = bilibiliURL[bilibiliShortLink[1]] + u
+		u = resolved
 	} else {
 		u, err := url.ParseRequestURI(u)
 		if err != nil {
@@ -51,11 +76,40 @@ func Extract(u string, option Options) ([]*Data, error) {
 	if extractor == nil {
 		extractor = extractorMap[""]
 	}
-	videos, err := extractor.Extract(u, option)
+	name := extractorNames[extractor]
+	option.extractor = name
+	if e, ok := extractor.(IDExtractor); ok && !option.Playlist {
+		// skip the archived item without extracting it
+		if id, ok := e.ExtractID(u); ok && option.Archived(id) {
+			data := ArchivedData(u, id)
+			data.Extractor = name
+			return []*Data{data}, nil
+		}
+	}
+	var (
+		videos []*Data
+		err    error
+	)
+	if e, ok := extractor.(ContextExtractor); ok {
+		videos, err = e.ExtractContext(ctx, u, option)
+	} else {
+		videos, err = extractor.Extract(u, option)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	for _, v := range videos {
+	for i, v := range videos {
+		if v == nil {
+			continue
+		}
+		v.Extractor = name
+		// the position in the result if the extractor doesn't know the position in the playlist
+		if option.Playlist && v.PlaylistIndex == 0 {
+			v.PlaylistIndex = i + 1
+		}
 		v.FillUpStreamsData()
 	}
 	return videos, nil
@@ -1,13 +1,15 @@
 package facebook
 
 import (
+	"context"
+	"encoding/json"
 	"regexp"
 	"strings"
 
 	"github.com/pkg/errors"
 
+	"github.com/hydrz/lux/dash"
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -15,6 +17,8 @@ func init() {
 	extractors.Register("facebook", New())
 }
 
+var reDashManifest = regexp.MustCompile(`"dash_manifest(?:_xml_string)?":\s*"((?:[^"\\]|\\.)*)"`)
+
 type extractor struct{}
 
 // New returns a facebook extractor.
@@ -24,8 +28,14 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	var err error
-	html, err := request.Get(url, url, nil)
+	html, err := client.GetWithContext(ctx, url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -53,7 +63,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 		u := strings.ReplaceAll(matcher[1], "\\", "")
 
-		size, err := request.Size(u, url)
+		size, err := client.SizeWithContext(ctx, u, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -70,6 +80,25 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		}
 	}
 
+	// the DASH manifest has the HD resolutions with a separate audio track
+	if matcher := reDashManifest.FindStringSubmatch(html); len(matcher) > 1 {
+		var manifest string
+		if err := json.Unmarshal([]byte(`"`+matcher[1]+`"`), &manifest); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		mpd, err := dash.Parse(manifest, url)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		dashStreams, err := mpd.StreamsContext(ctx, client, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for id, stream := range dashStreams {
+			streams[id] = stream
+		}
+	}
+
 	return []*extractors.Data{
 		{
 			Site:    "Facebook facebook.com",
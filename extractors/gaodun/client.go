@@ -2,6 +2,7 @@ package gaodun
 
 import (
 	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"maps"
@@ -56,8 +57,9 @@ type APIClient interface {
 	Headers() map[string]string
 }
 
-// NewClient creates a new API client with proper authentication headers
-func NewClient() APIClient {
+// NewClient creates a new API client with proper authentication headers, the requests are sent by httpClient
+// and canceled with ctx.
+func NewClient(ctx context.Context, httpClient *request.Client) APIClient {
 	token := os.Getenv("GAODUN_AUTH_TOKEN")
 	if token == "" {
 		log.Fatal("GAODUN_AUTH_TOKEN environment variable is not set")
@@ -68,6 +70,8 @@ func NewClient() APIClient {
 		ApiVersion, "oppo", "264", "oneplus", "gaodunapp", generateDeviceID(), "oppo", "android",
 	)
 	return &client{
+		ctx:  ctx,
+		http: httpClient,
 		headers: map[string]string{
 			"User-Agent":         userAgent,
 			"Authentication":     token,
@@ -82,6 +86,9 @@ func NewClient() APIClient {
 
 // client handles all API interactions with Gaodun services
 type client struct {
+	// ctx is the context of the extraction which the client is created for
+	ctx     context.Context
+	http    *request.Client
 	headers map[string]string
 }
 
@@ -100,7 +107,7 @@ func (c *client) do(method, url string, body io.Reader, additionalHeaders ...map
 		}
 	}
 
-	resp, err := request.Request(method, url, body, headers)
+	resp, err := c.http.RequestWithContext(c.ctx, method, url, body, headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
@@ -1,12 +1,13 @@
 package gaodun
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
 
 func TestClient(t *testing.T) {
-	client := NewClient()
+	client := NewClient(context.Background(), nil)
 	gStudyGradations, err := client.GStudy("33795")
 	if err != nil {
 		t.Fatalf("error: %v", err)
@@ -1,8 +1,10 @@
 package gaodun
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -10,6 +12,7 @@ import (
 	"sync"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 	"github.com/pkg/errors"
@@ -19,9 +22,19 @@ func init() {
 	extractors.Register("gaodun", New())
 }
 
+// webHeaders are the headers of the browser which the files of gaodun are requested with
+var webHeaders = map[string]string{
+	"User-Agent": "Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.120 Mobile Safari/537.36",
+	"Referer":    "https://www.gaodun.com/",
+}
+
 type extractor struct {
-	api    APIClient
+	api APIClient
+	// http is the client of the playlists, it has the browser headers
+	http   *request.Client
 	option extractors.Options
+	// ctx cancels the requests of the extraction
+	ctx context.Context
 }
 
 // New returns a new gaodun extractor
@@ -47,6 +60,18 @@ func (e *extractor) isGStudyCourse(courseID string) (bool, error) {
 	return false, nil // Not a G-Study course, might be Ep-Study
 }
 
+// resolutionMedia parses the resolution of a video quality, eg: 1280x720 or 720P
+func resolutionMedia(resolution string) extractors.Media {
+	var media extractors.Media
+	if m := utils.MatchOneOf(resolution, `(\d+)\s*[xX*×]\s*(\d+)`); len(m) > 2 {
+		media.Width, _ = strconv.Atoi(m[1])
+		media.Height, _ = strconv.Atoi(m[2])
+	} else if m := utils.MatchOneOf(resolution, `(\d+)[pP]`); len(m) > 1 {
+		media.Height, _ = strconv.Atoi(m[1])
+	}
+	return media
+}
+
 // extractCourseID extracts course ID from the URL
 func extractCourseID(URL string) (string, error) {
 	// Support both course_id and courseId parameters
@@ -70,16 +95,18 @@ func extractCourseID(URL string) (string, error) {
 
 // Extract extracts video and PDF data from gaodun.com URLs
 func (e *extractor) Extract(URL string, option extractors.Options) ([]*extractors.Data, error) {
-	// Create API client
-	e.api = NewClient()
-	e.option = option
-
-	// Set request options for better compatibility with Gaodun servers
-	request.SetOptions(request.Options{
-		UserAgent:  "Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.120 Mobile Safari/537.36",
-		Refer:      "https://www.gaodun.com/",
-		RetryTimes: 3,
+	return e.ExtractContext(context.Background(), URL, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, URL string, option extractors.Options) ([]*extractors.Data, error) {
+	// Create API client, the browser headers are required by Gaodun servers
+	httpClient := option.Client.With(request.Options{
+		UserAgent: webHeaders["User-Agent"],
+		Refer:     webHeaders["Referer"],
 	})
+	// the registered extractor is shared by concurrent extractions, each one uses its own copy
+	e = &extractor{api: NewClient(ctx, httpClient), http: httpClient, option: option, ctx: ctx}
 
 	// Parse course ID from URL
 	courseID, err := extractCourseID(URL)
@@ -452,22 +479,25 @@ func (e *extractor) processVideoResource(resource Resource, baseDir string) (*ex
 			continue
 		}
 
-		urls, err := utils.M3u8URLsWithHeaders(qualityInfo.Path, e.api.Headers())
+		playlist, err := hls.LoadMediaContext(e.ctx, e.http, qualityInfo.Path, e.api.Headers())
 		if err != nil {
-			slog.Error("failed to parse M3U8 URLs",
+			slog.Error("failed to parse M3U8 playlist",
 				"path", qualityInfo.Path,
 				"error", err,
 			)
 			continue
 		}
 
-		// Create parts for M3U8 segments
-		parts := make([]*extractors.Part, 0, len(urls))
-		for _, url := range urls {
-			parts = append(parts, &extractors.Part{
-				URL: url,
-				Ext: "ts",
-			})
+		parts := playlist.Parts()
+		for _, part := range parts {
+			part.Headers = webHeaders
+		}
+		if err := e.authorizeKeys(parts); err != nil {
+			slog.Error("failed to authorize the decryption key",
+				"path", qualityInfo.Path,
+				"error", err,
+			)
+			continue
 		}
 
 		id := resource.VideoID + "_" + quality
@@ -478,6 +508,7 @@ func (e *extractor) processVideoResource(resource Resource, baseDir string) (*ex
 			Quality: qualityInfo.Resolution.Resolution,
 			Size:    int64(qualityInfo.FileSize * 1024),
 			NeedMux: false,
+			Media:   resolutionMedia(qualityInfo.Resolution.Resolution),
 		}
 	}
 
@@ -536,9 +567,10 @@ func (e *extractor) processNonVideoResource(resource Resource, baseDir string) (
 	// Create single part for direct download
 	parts := []*extractors.Part{
 		{
-			URL:  resource.Path,
-			Size: int64(size),
-			Ext:  ext,
+			URL:     resource.Path,
+			Size:    int64(size),
+			Ext:     ext,
+			Headers: webHeaders,
 		},
 	}
 
@@ -561,3 +593,35 @@ func (e *extractor) processNonVideoResource(resource Resource, baseDir string) (
 		URL:     resource.Path,
 	}, nil
 }
+
+// authorizeKeys fills the decryption keys of encrypted parts,
+// the key URI of the playlist can't be requested directly and must be authorized by its id.
+func (e *extractor) authorizeKeys(parts []*extractors.Part) error {
+	keys := make(map[string][]byte)
+	for _, part := range parts {
+		if part.Key == nil || part.Key.URI == "" {
+			continue
+		}
+		u, err := url.Parse(part.Key.URI)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		id := u.Query().Get("id")
+		if id == "" {
+			continue
+		}
+		key, ok := keys[id]
+		if !ok {
+			resp, err := e.api.AuthorizeKey(id)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if key, err = utils.DecodeAESKey([]byte(resp)); err != nil {
+				return err
+			}
+			keys[id] = key
+		}
+		part.Key.Value = key
+	}
+	return nil
+}
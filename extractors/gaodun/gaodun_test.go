@@ -1,7 +1,10 @@
 package gaodun
 
 import (
+	"context"
 	"testing"
+
+	"github.com/hydrz/lux/extractors"
 )
 
 func TestExtractCourseID(t *testing.T) {
@@ -103,7 +106,7 @@ func TestSanitizeFileName(t *testing.T) {
 }
 
 func TestIsGStudyCourse(t *testing.T) {
-	client := NewClient()
+	client := NewClient(context.Background(), nil)
 
 	ex := &extractor{
 		api: client,
@@ -127,3 +130,17 @@ func TestIsGStudyCourse(t *testing.T) {
 	}
 
 }
+
+func TestResolutionMedia(t *testing.T) {
+	tests := map[string]extractors.Media{
+		"1280x720":  {Width: 1280, Height: 720},
+		"1920*1080": {Width: 1920, Height: 1080},
+		"720P":      {Height: 720},
+		"高清":        {},
+	}
+	for resolution, expected := range tests {
+		if got := resolutionMedia(resolution); got != expected {
+			t.Errorf("resolutionMedia(%q) = %+v, want %+v", resolution, got, expected)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package geekbang
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,7 +10,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -39,7 +40,7 @@ type playInfo struct {
 	VideoBase struct {
 		VideoID  string `json:"VideoId"`
 		Title    string `json:"Title"`
-		CoverURL string `josn:"CoverURL"`
+		CoverURL string `json:"CoverURL"`
 	} `json:"VideoBase"`
 	PlayInfoList struct {
 		PlayInfo []struct {
@@ -50,32 +51,6 @@ type playInfo struct {
 	} `json:"PlayInfoList"`
 }
 
-type geekURLInfo struct {
-	URL  string
-	Size int64
-}
-
-func geekM3u8(url string) ([]geekURLInfo, error) {
-	var (
-		data []geekURLInfo
-		temp geekURLInfo
-		size int64
-		err  error
-	)
-	urls, err := utils.M3u8URLs(url)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	for _, u := range urls {
-		temp = geekURLInfo{
-			URL:  u,
-			Size: size,
-		}
-		data = append(data, temp)
-	}
-	return data, nil
-}
-
 type extractor struct{}
 
 // New returns a geekbang extractor.
@@ -84,7 +59,13 @@ func New() extractors.Extractor {
 }
 
 // Extract is the main function to extract the data.
-func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Data, error) {
+func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	var err error
 	matches := utils.MatchOneOf(url, `https?://time.geekbang.org/course/detail/(\d+)-(\d+)`)
 	if matches == nil || len(matches) < 3 {
@@ -94,7 +75,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 	// Get video information
 	heanders := map[string]string{"Origin": "https://time.geekbang.org", "Content-Type": "application/json", "Referer": url}
 	params := strings.NewReader(fmt.Sprintf(`{"id": %q}`, matches[2]))
-	res, err := request.Request(http.MethodPost, "https://time.geekbang.org/serv/v1/article", params, heanders)
+	res, err := client.RequestWithContext(ctx, http.MethodPost, "https://time.geekbang.org/serv/v1/article", params, heanders)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -115,7 +96,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 
 	// Get video license token information
 	params = strings.NewReader("{\"source_type\":1,\"aid\":" + matches[2] + ",\"video_id\":\"" + data.Data.VideoID + "\"}")
-	res, err = request.Request(http.MethodPost, "https://time.geekbang.org/serv/v3/source_auth/video_play_auth", params, heanders)
+	res, err = client.RequestWithContext(ctx, http.MethodPost, "https://time.geekbang.org/serv/v3/source_auth/video_play_auth", params, heanders)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -132,7 +113,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 
 	// Get video playback information
 	heanders = map[string]string{"Accept-Encoding": ""}
-	res, err = request.Request(http.MethodGet, "http://ali.mantv.top/play/info?playAuth="+playAuth.Data.PlayAuth, nil, heanders)
+	res, err = client.RequestWithContext(ctx, http.MethodGet, "http://ali.mantv.top/play/info?playAuth="+playAuth.Data.PlayAuth, nil, heanders)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -148,34 +129,30 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 	streams := make(map[string]*extractors.Stream, len(playInfo.PlayInfoList.PlayInfo))
 
 	for _, media := range playInfo.PlayInfoList.PlayInfo {
-		m3u8URLs, err := geekM3u8(media.URL)
-
+		playlist, err := hls.LoadMediaContext(ctx, client, media.URL, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		urls := make([]*extractors.Part, len(m3u8URLs))
-		for index, u := range m3u8URLs {
-			urls[index] = &extractors.Part{
-				URL:  u.URL,
-				Size: u.Size,
-				Ext:  "ts",
-			}
-		}
-
 		streams[media.Definition] = &extractors.Stream{
-			Parts: urls,
+			Parts: playlist.Parts(),
 			Size:  media.Size,
 		}
 	}
 
+	var thumbnails []*extractors.Thumbnail
+	if playInfo.VideoBase.CoverURL != "" {
+		thumbnails = append(thumbnails, &extractors.Thumbnail{URL: playInfo.VideoBase.CoverURL})
+	}
+
 	return []*extractors.Data{
 		{
-			Site:    "极客时间 geekbang.org",
-			Title:   title,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
+			Site:       "极客时间 geekbang.org",
+			Title:      title,
+			Type:       extractors.DataTypeVideo,
+			Streams:    streams,
+			URL:        url,
+			Thumbnails: thumbnails,
 		},
 	}, nil
 }
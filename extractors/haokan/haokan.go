@@ -6,7 +6,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -23,7 +22,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -48,12 +48,12 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 	playurl := strings.Replace(urls[1], `\/`, `/`, -1)
 
-	size, err := request.Size(playurl, url)
+	size, err := client.Size(playurl, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	_, ext, err := utils.GetNameAndExt(playurl)
+	_, ext, err := utils.GetNameAndExt(client, playurl)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -4,7 +4,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -20,7 +19,8 @@ func New() extractors.Extractor {
 }
 
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -41,7 +41,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(extractors.ErrURLParseFailed)
 	}
 
-	size, err := request.Size(videoUrl, url)
+	size, err := client.Size(videoUrl, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
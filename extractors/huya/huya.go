@@ -1,9 +1,17 @@
 package huya
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
@@ -22,7 +30,18 @@ func New() extractors.Extractor {
 }
 
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	// live rooms, eg: https://www.huya.com/660000
+	if utils.MatchOneOf(url, `https?://(?:www\.|m\.)?huya\.com/\w+`) != nil && !strings.Contains(url, "/video/") {
+		return extractLive(ctx, client, url)
+	}
+
+	html, err := client.GetWithContext(ctx, url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -43,7 +62,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(extractors.ErrURLParseFailed)
 	}
 
-	size, err := request.Size(videoUrl, url)
+	size, err := client.SizeWithContext(ctx, videoUrl, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -70,3 +89,95 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		},
 	}, nil
 }
+
+// huyaLiveData is the base64 encoded stream information of a live room
+type huyaLiveData struct {
+	Data []struct {
+		GameLiveInfo struct {
+			Nick         string `json:"nick"`
+			Introduction string `json:"introduction"`
+			RoomName     string `json:"roomName"`
+		} `json:"gameLiveInfo"`
+		GameStreamInfoList []struct {
+			CDNType      string `json:"sCdnType"`
+			StreamName   string `json:"sStreamName"`
+			HlsURL       string `json:"sHlsUrl"`
+			HlsURLSuffix string `json:"sHlsUrlSuffix"`
+			HlsAntiCode  string `json:"sHlsAntiCode"`
+		} `json:"gameStreamInfoList"`
+	} `json:"data"`
+}
+
+// extractLive returns the HLS streams of a live room, one for each CDN.
+func extractLive(ctx context.Context, client *request.Client, url string) ([]*extractors.Data, error) {
+	page, err := client.GetWithContext(ctx, url, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	matches := utils.MatchOneOf(page, `"stream"\s*:\s*"([a-zA-Z0-9+/=]{32,})"`)
+	if len(matches) < 2 {
+		// the room is offline
+		return nil, errors.WithStack(extractors.ErrURLParseFailed)
+	}
+	b, err := base64.StdEncoding.DecodeString(matches[1])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var data huyaLiveData
+	if err = json.Unmarshal(b, &data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(data.Data) == 0 {
+		return nil, errors.WithStack(extractors.ErrURLParseFailed)
+	}
+
+	info := data.Data[0].GameLiveInfo
+	title := info.Introduction
+	if title == "" {
+		title = info.RoomName
+	}
+	if info.Nick != "" {
+		title = fmt.Sprintf("%s - %s", info.Nick, title)
+	}
+
+	streams := make(map[string]*extractors.Stream)
+	for _, s := range data.Data[0].GameStreamInfoList {
+		if s.HlsURL == "" {
+			continue
+		}
+		uri := fmt.Sprintf("%s/%s.%s?%s", s.HlsURL, s.StreamName, s.HlsURLSuffix, html.UnescapeString(s.HlsAntiCode))
+		cdnStreams, err := hls.StreamsContext(ctx, client, uri, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, errors.WithStack(ctx.Err())
+			}
+			// some CDNs refuse the requests from outside of China
+			continue
+		}
+		cdn := strings.ToLower(s.CDNType)
+		for id, stream := range cdnStreams {
+			if id != "default" {
+				id = cdn + "-" + id
+			} else {
+				id = cdn
+			}
+			if stream.Quality == "" {
+				stream.Quality = s.CDNType
+			}
+			streams[id] = stream
+		}
+	}
+	if len(streams) == 0 {
+		return nil, errors.WithStack(extractors.ErrURLParseFailed)
+	}
+
+	return []*extractors.Data{
+		{
+			Site:    "虎牙直播 huya.com",
+			Title:   title,
+			Type:    extractors.DataTypeVideo,
+			Streams: streams,
+			URL:     url,
+		},
+	}, nil
+}
@@ -3,8 +3,6 @@ package instagram
 import (
 	"encoding/json"
 	"fmt"
-	"net"
-	"net/http"
 	netURL "net/url"
 	"regexp"
 	"strings"
@@ -19,19 +17,8 @@ import (
 	"github.com/hydrz/lux/utils"
 )
 
-var client *http.Client
-
 func init() {
 	extractors.Register("instagram", New())
-	client = &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: 5 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 5 * time.Second,
-		},
-	}
 }
 
 // sliderItemNode contains information about the Instagram post
@@ -65,13 +52,16 @@ func (s instagramPayload) isEmpty() bool {
 	return s.Media.ID == ""
 }
 
-func getPostWithCode(code string) ([]string, error) {
+func getPostWithCode(client *request.Client, code string) ([]string, error) {
 	URL := fmt.Sprintf("https://www.instagram.com/p/%v/embed/captioned/", code)
 
 	var embeddedMediaImage string
 	var embedResponse = instagramPayload{}
 	collector := colly.NewCollector()
-	collector.SetClient(client)
+	// colly changes the redirect policy of the client
+	httpClient := *client.HTTPClient()
+	httpClient.Timeout = 10 * time.Second
+	collector.SetClient(&httpClient)
 	var collectorErr error
 
 	collector.OnHTML("img.EmbeddedMediaImage", func(e *colly.HTMLElement) {
@@ -144,6 +134,7 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	u, err := netURL.Parse(url)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -154,7 +145,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
-	urls, err := getPostWithCode(shortCode)
+	urls, err := getPostWithCode(client, shortCode)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -163,11 +154,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	var parts []*extractors.Part
 
 	for _, u := range urls {
-		_, ext, err := utils.GetNameAndExt(u)
+		_, ext, err := utils.GetNameAndExt(client, u)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		fileSize, err := request.Size(u, url)
+		fileSize, err := client.Size(u, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -194,6 +185,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	return []*extractors.Data{
 		{
 			Site:    "Instagram instagram.com",
+			ID:      shortCode,
 			Title:   "Instagram " + shortCode,
 			Type:    extractors.DataTypeImage,
 			Streams: streams,
@@ -90,7 +90,7 @@ func getVF(params string) string {
 	return utils.Md5(params)
 }
 
-func getVPS(tvid, vid, refer string) (*iqiyi, error) {
+func getVPS(client *request.Client, tvid, vid, refer string) (*iqiyi, error) {
 	t := time.Now().Unix() * 1000
 	host := "http://cache.video.qiyi.com"
 	params := fmt.Sprintf(
@@ -99,7 +99,7 @@ func getVPS(tvid, vid, refer string) (*iqiyi, error) {
 	)
 	vf := getVF(params)
 	apiURL := fmt.Sprintf("%s%s&vf=%s", host, params, vf)
-	info, err := request.Get(apiURL, refer, nil)
+	info, err := client.Get(apiURL, refer, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -122,7 +122,8 @@ func New(siteType SiteType) extractors.Extractor {
 }
 
 // Extract is the main function to extract the data.
-func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Data, error) {
+func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	refer := iqiyiReferer
 	headers := make(map[string]string)
 	if e.siteType == SiteTypeIQ {
@@ -131,7 +132,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 		}
 		refer = iqReferer
 	}
-	html, err := request.Get(url, refer, headers)
+	html, err := client.Get(url, refer, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -195,7 +196,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 	if title == "" {
 		title = doc.Find("title").Text()
 	}
-	videoDatas, err := getVPS(tvid[1], vid[1], refer)
+	videoDatas, err := getVPS(client, tvid[1], vid[1], refer)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -208,7 +209,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 	for _, video := range videoDatas.Data.VP.Tkl[0].Vs {
 		urls := make([]*extractors.Part, len(video.Fs))
 		for index, v := range video.Fs {
-			realURLData, err := request.Get(urlPrefix+v.L, refer, nil)
+			realURLData, err := client.Get(urlPrefix+v.L, refer, nil)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
@@ -216,7 +217,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 			if err = json.Unmarshal([]byte(realURLData), &realURL); err != nil {
 				return nil, errors.WithStack(err)
 			}
-			_, ext, err := utils.GetNameAndExt(realURL.L)
+			_, ext, err := utils.GetNameAndExt(client, realURL.L)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
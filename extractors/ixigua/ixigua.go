@@ -4,7 +4,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"regexp"
 	"strings"
 
@@ -12,7 +11,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -40,6 +38,7 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	headers := map[string]string{
 		"User-Agent": browser.Chrome(),
 		"Cookie":     option.Cookie,
@@ -58,7 +57,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 
 	if strings.HasPrefix(url, "https://v.ixigua.com/") || strings.HasPrefix(url, "https://m.toutiao.com/") {
-		resp, err := http.Get(url)
+		resp, err := client.HTTPClient().Get(url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -73,7 +72,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	id := r.FindSubmatch([]byte(finalURL))[2]
 	url2 := fmt.Sprintf("https://www.ixigua.com/%s", string(id))
 
-	body, err := request.Get(url2, url, headers)
+	body, err := client.Get(url2, url, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
@@ -45,11 +46,6 @@ type mgtvVideoAddr struct {
 	Info string `json:"info"`
 }
 
-type mgtvURLInfo struct {
-	URL  string
-	Size int64
-}
-
 type mgtvPm2Data struct {
 	Data struct {
 		Atc struct {
@@ -59,33 +55,33 @@ type mgtvPm2Data struct {
 	} `json:"data"`
 }
 
-func mgtvM3u8(url string) ([]mgtvURLInfo, int64, error) {
-	var data []mgtvURLInfo
-	var temp mgtvURLInfo
-	var size, totalSize int64
-	urls, err := utils.M3u8URLs(url)
+func mgtvM3u8(client *request.Client, url string) ([]*extractors.Part, int64, error) {
+	m3u8String, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, 0, err
 	}
-	m3u8String, err := request.Get(url, url, nil)
+	_, playlist, err := hls.Parse(m3u8String, url)
 	if err != nil {
 		return nil, 0, err
 	}
+	if playlist == nil {
+		return nil, 0, errors.New("unexpected master playlist")
+	}
 	sizes := utils.MatchAll(m3u8String, `#EXT-MGTV-File-SIZE:(\d+)`)
 	// sizes: [[#EXT-MGTV-File-SIZE:1893724, 1893724]]
-	for index, u := range urls {
-		size, err = strconv.ParseInt(sizes[index][1], 10, 64)
+	parts := playlist.Parts()
+	if len(sizes) != len(parts) {
+		return parts, 0, nil
+	}
+	var totalSize int64
+	for index, part := range parts {
+		part.Size, err = strconv.ParseInt(sizes[index][1], 10, 64)
 		if err != nil {
 			return nil, 0, err
 		}
-		totalSize += size
-		temp = mgtvURLInfo{
-			URL:  u,
-			Size: size,
-		}
-		data = append(data, temp)
+		totalSize += part.Size
 	}
-	return data, totalSize, nil
+	return parts, totalSize, nil
 }
 
 func encodeTk2(str string) string {
@@ -109,7 +105,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -132,7 +129,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		"Cookie": "PM_CHKID=1",
 	}
 	clit := fmt.Sprintf("clit=%d", time.Now().Unix()/1000)
-	pm2DataString, err := request.Get(
+	pm2DataString, err := client.Get(
 		fmt.Sprintf(
 			"https://pcweb.api.mgtv.com/player/video?video_id=%s&tk2=%s",
 			vid[1],
@@ -151,7 +148,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
-	dataString, err := request.Get(
+	dataString, err := client.Get(
 		fmt.Sprintf(
 			"https://pcweb.api.mgtv.com/player/getSource?video_id=%s&tk2=%s&pm2=%s",
 			vid[1], encodeTk2(clit), pm2.Data.Atc.Pm2,
@@ -179,7 +176,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		}
 		// real download address
 		addr = mgtvVideoAddr{}
-		addrInfo, err := request.GetByte(mgtvData.Data.StreamDomain[0]+stream.URL, url, headers)
+		addrInfo, err := client.GetByte(mgtvData.Data.StreamDomain[0]+stream.URL, url, headers)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -187,18 +184,10 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 			return nil, errors.WithStack(err)
 		}
 
-		m3u8URLs, totalSize, err := mgtvM3u8(addr.Info)
+		urls, totalSize, err := mgtvM3u8(client, addr.Info)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		urls := make([]*extractors.Part, len(m3u8URLs))
-		for index, u := range m3u8URLs {
-			urls[index] = &extractors.Part{
-				URL:  u.URL,
-				Size: u.Size,
-				Ext:  "ts",
-			}
-		}
 		streams[stream.Def] = &extractors.Stream{
 			Parts:   urls,
 			Size:    totalSize,
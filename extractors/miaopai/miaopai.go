@@ -9,7 +9,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -49,6 +48,7 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	ids := utils.MatchOneOf(url, `/media/([^\./]+)`, `/show(?:/channel)?/([^\./]+)`)
 	if ids == nil || len(ids) < 2 {
 		return nil, errors.WithStack(extractors.ErrURLParseFailed)
@@ -58,7 +58,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	randomString := getRandomString(10)
 
 	var data miaopaiData
-	jsonString, err := request.Get(
+	jsonString, err := client.Get(
 		fmt.Sprintf("https://n.miaopai.com/api/aj_media/info.json?smid=%s&appid=530&_cb=_jsonp%s", id, randomString),
 		url, nil,
 	)
@@ -77,7 +77,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 
 	realURL := data.Data.MetaData[0].URLs.M
-	size, err := request.Size(realURL, url)
+	size, err := client.Size(realURL, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
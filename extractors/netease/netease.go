@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -24,13 +23,14 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	url = strings.Replace(url, "/#/", "/", 1)
 	vid := utils.MatchOneOf(url, `/(mv|video)\?id=(\w+)`)
 	if vid == nil {
 		return nil, errors.New("invalid url for netease music")
 	}
 
-	html, err := request.Get(url, url, nil)
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -50,7 +50,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 	realURL, _ := netURL.QueryUnescape(realURLs[1])
 
-	size, err := request.Size(realURL, url)
+	size, err := client.Size(realURL, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -9,7 +9,6 @@ import (
 	"regexp"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/pkg/errors"
 )
 
@@ -33,7 +32,8 @@ func New() extractors.Extractor {
 }
 
 func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.Data, error) {
-	res, err := request.Request(http.MethodGet, u, nil, nil)
+	client := option.Client
+	res, err := client.Request(http.MethodGet, u, nil, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -67,7 +67,7 @@ func (e *extractor) Extract(u string, option extractors.Options) ([]*extractors.
 	}
 
 	streams := make(map[string]*extractors.Stream, 1)
-	size, err := request.Size(resData.ContentURL, u)
+	size, err := client.Size(resData.ContentURL, u)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 )
 
 func init() {
@@ -23,7 +22,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, map[string]string{
+	client := option.Client
+	html, err := client.Get(url, url, map[string]string{
 		// pinterest require a user agent
 		"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:98.0) Gecko/20100101 Firefox/98.0",
 	})
@@ -59,7 +59,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 	streams := make(map[string]*extractors.Stream)
 
-	size, err := request.Size(videoURL, url)
+	size, err := client.Size(videoURL, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/hydrz/lux/extractors"
 	"github.com/hydrz/lux/parser"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -22,7 +21,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -33,11 +33,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 	parts := make([]*extractors.Part, 0, len(urls))
 	for _, u := range urls {
-		_, ext, err := utils.GetNameAndExt(u)
+		_, ext, err := utils.GetNameAndExt(client, u)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		size, err := request.Size(u, url)
+		size, err := client.Size(u, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -14,7 +14,6 @@ import (
 	"github.com/robertkrimen/otto"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -38,7 +37,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	res, err := request.Request(http.MethodGet, url, nil, nil)
+	client := option.Client
+	res, err := client.Request(http.MethodGet, url, nil, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -136,7 +136,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.New("can not found media")
 	}
 
-	resApi, err := request.Get(mp4MediaDefinition.VideoURL, mp4MediaDefinition.VideoURL, map[string]string{
+	resApi, err := client.Get(mp4MediaDefinition.VideoURL, mp4MediaDefinition.VideoURL, map[string]string{
 		"Cookie": strings.Join(cookiesArr, "; "),
 	})
 	if err != nil {
@@ -152,7 +152,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	streams := make(map[string]*extractors.Stream, len(pornhubs))
 
 	for _, data := range pornhubs {
-		size, err := request.Size(data.VideoURL, data.VideoURL)
+		size, err := client.Size(data.VideoURL, data.VideoURL)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -1,13 +1,14 @@
 package reddit
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/pkg/errors"
 
+	"github.com/hydrz/lux/dash"
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -21,17 +22,8 @@ const (
 
 	redditMP4API = "https://v.redd.it/"
 	redditIMGAPI = "https://i.redd.it/"
-	audioURLPart = "/DASH_audio.mp4"
 )
 
-var resMap = map[string]string{
-	"720p": "/DASH_720.mp4",
-	"480p": "/DASH_480.mp4",
-	"360p": "/DASH_360.mp4",
-	"240p": "/DASH_240.mp4",
-	"220p": "/DASH_220.mp4",
-}
-
 type extractor struct{}
 
 func New() extractors.Extractor {
@@ -39,7 +31,13 @@ func New() extractors.Extractor {
 }
 
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, referer, nil)
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	html, err := client.GetWithContext(ctx, url, referer, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -55,38 +53,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 			return nil, errors.New("can't match mp4 content downloadable url")
 		}
 
-		audioURL := fmt.Sprintf("%s%s%s", redditMP4API, mp4URL, audioURLPart)
-		size, err := request.Size(audioURL, referer)
+		// the DASH manifest lists all resolutions and the audio track
+		streams, err := dash.StreamsContext(ctx, client, fmt.Sprintf("%s%s/DASHPlaylist.mpd", redditMP4API, mp4URL), nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		audioPart := &extractors.Part{
-			URL:  audioURL,
-			Size: size,
-			Ext:  "mp3",
-		}
-
-		streams := make(map[string]*extractors.Stream, len(resMap))
-		for res, urlParts := range resMap {
-			resURL := fmt.Sprintf("%s%s%s", redditMP4API, mp4URL, urlParts)
-			size, err := request.Size(resURL, referer)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-			streams[res] = &extractors.Stream{
-				Parts: []*extractors.Part{
-					{
-						URL:  resURL,
-						Size: size,
-						Ext:  "mp4",
-					},
-					audioPart,
-				},
-				Size:    size + audioPart.Size,
-				Quality: res,
-				NeedMux: true,
-			}
-		}
 
 		return []*extractors.Data{
 			{
@@ -102,14 +73,14 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		var size int64
 		if utils.MatchOneOf(html, `content":"https:\/\/i.redd.it\/(.+?)","type":"image"`) != nil {
 			imgURL = redditIMGAPI + utils.MatchOneOf(html, `content":"https:\/\/i.redd.it\/(.+?)","type":"image"`)[1]
-			size, err = request.Size(imgURL, referer)
+			size, err = client.SizeWithContext(ctx, imgURL, referer)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
 		} else {
 			imgURL = utils.MatchOneOf(html, `content":"(.+?)","type":"image"`)[1]
 			imgURL = strings.ReplaceAll(imgURL, "auto=webp\\u0026s", "auto=webp&s")
-			size, err = request.Size(imgURL, referer)
+			size, err = client.SizeWithContext(ctx, imgURL, referer)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
@@ -144,7 +115,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		gifURL = strings.ReplaceAll(gifURL, "&amp;", "&")
 		gifURL = strings.ReplaceAll(gifURL, "\"", "")
 
-		size, err := request.Size(gifURL, "reddit.com")
+		size, err := client.SizeWithContext(ctx, gifURL, "reddit.com")
 		if err != nil {
 			return nil, errors.New("can't get video size")
 		}
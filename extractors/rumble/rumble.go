@@ -3,18 +3,20 @@ package rumble
 import (
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
-	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/hls"
 	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
@@ -38,11 +40,52 @@ type rumbleData struct {
 	Type         string `json:"@type"`
 	VideoURL     string `json:"videoUrl"`
 	Quality      string `json:"quality"`
+	Description  string `json:"description"`
+	// eg: 2022-01-01T00:00:00+00:00
+	UploadDate string `json:"uploadDate"`
+	// eg: PT00H10M05S
+	Duration string `json:"duration"`
+	Author   struct {
+		Name string `json:"name"`
+		// eg: https://rumble.com/c/name
+		URL string `json:"url"`
+	} `json:"author"`
+	InteractionStatistic struct {
+		UserInteractionCount int64 `json:"userInteractionCount"`
+	} `json:"interactionStatistic"`
+}
+
+// fillMetadata fills up the metadata of the video from the payload.
+func (r *rumbleData) fillMetadata(data *extractors.Data) {
+	data.Description = r.Description
+	data.Uploader = r.Author.Name
+	if r.Author.URL != "" {
+		data.UploaderID = path.Base(r.Author.URL)
+	}
+	data.ViewCount = r.InteractionStatistic.UserInteractionCount
+	if t, err := time.Parse(time.RFC3339, r.UploadDate); err == nil {
+		data.UploadDate = extractors.FormatDate(t)
+	}
+	if m := utils.MatchOneOf(r.Duration, `^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`); m != nil {
+		for i, unit := range []float64{3600, 60, 1} {
+			n, _ := strconv.Atoi(m[i+1])
+			data.Duration += float64(n) * unit
+		}
+	}
+	if r.ThumbnailURL != "" {
+		data.Thumbnails = []*extractors.Thumbnail{{URL: r.ThumbnailURL}}
+	}
 }
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	res, err := request.Request(http.MethodGet, url, nil, nil)
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	res, err := client.RequestWithContext(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -84,20 +127,21 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
-	streams, err := fetchVideoQuality(videoID)
+	streams, err := fetchVideoQuality(ctx, client, videoID)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	return []*extractors.Data{
-		{
-			Site:    "Rumble rumble.com",
-			Title:   title,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	data := &extractors.Data{
+		Site:    "Rumble rumble.com",
+		ID:      videoID,
+		Title:   title,
+		Type:    extractors.DataTypeVideo,
+		Streams: streams,
+		URL:     url,
+	}
+	payload.fillMetadata(data)
+	return []*extractors.Data{data}, nil
 }
 
 // Read JSON object from the video webpage
@@ -214,97 +258,50 @@ func (rs *rumbleStreams) makeAllVODStreams(m map[string]*extractors.Stream) {
 	m["2161"] = makeStreamMeta("2161", "mp4", &rs.FMp4.Q2161.streamInfo)
 }
 
-var reResolution = regexp.MustCompile(`_(\d{3,4})p\/`) // ex. _720p/
-
-// Use this to create all the streams for live videos
-func (rs *rumbleStreams) makeAllLiveStreams(m map[string]*extractors.Stream) error {
-	playlists, err := utils.M3u8URLs(rs.FHLS.QAuto.URL)
+// Use this to create all the streams for live videos, each variant of the master playlist is a stream
+func (rs *rumbleStreams) makeAllLiveStreams(ctx context.Context, client *request.Client, m map[string]*extractors.Stream) error {
+	streams, err := hls.StreamsContext(ctx, client, rs.FHLS.QAuto.URL, nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if len(playlists) == 0 {
+	if len(streams) == 0 {
 		return errors.WithStack(extractors.ErrURLParseFailed)
 	}
 
-	// Find the highest resolution
-	playlistURL := playlists[0]
-	maxRes := 0
-	for _, x := range playlists {
-		matched := reResolution.FindStringSubmatch(x)
-		if len(matched) == 0 {
-			continue
-		}
-		res, err := strconv.Atoi(matched[1])
-		if err != nil {
-			continue
-		}
-
-		if maxRes < res {
-			maxRes = res
-			playlistURL = x
-		}
-	}
-
-	tsURLs, err := utils.M3u8URLs(playlistURL)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	var parts []*extractors.Part
-	for _, x := range tsURLs {
-		part := &extractors.Part{
-			URL:  x,
-			Size: rs.FHLS.QAuto.streamInfo.Meta.Size,
-			Ext:  "ts",
-		}
-		parts = append(parts, part)
-	}
-
-	m["hls"] = &extractors.Stream{
-		Parts:   parts,
-		Size:    rs.FHLS.QAuto.streamInfo.Meta.Size,
-		Quality: strconv.Itoa(maxRes),
+	for id, stream := range streams {
+		m["hls-"+id] = stream
 	}
 
 	return nil
 }
 
-func (rs *rumbleStreams) makeAllNewVodStreams(m map[string]*extractors.Stream) error {
+func (rs *rumbleStreams) makeAllNewVodStreams(ctx context.Context, client *request.Client, m map[string]*extractors.Stream) error {
 	for size, details := range rs.FTAR {
-		playlists, err := utils.M3u8URLs(details.URL)
+		playlist, err := hls.LoadMediaContext(ctx, client, details.URL, nil)
 		if err != nil {
 			return errors.WithStack(err)
 		}
 
-		if len(playlists) == 0 {
+		if len(playlist.Segments) == 0 {
 			return errors.WithStack(extractors.ErrURLParseFailed)
 		}
 
-		var parts []*extractors.Part
-		for _, x := range playlists {
-			part := &extractors.Part{
-				URL:  x,
-				Size: details.Meta.Size,
-				Ext:  "ts",
-			}
-			parts = append(parts, part)
-		}
-
 		m[size] = &extractors.Stream{
-			Parts:   parts,
+			Parts:   playlist.Parts(),
 			Size:    details.Meta.Size,
 			Quality: strconv.Itoa(int(details.Meta.Height)),
+			Media:   details.media(),
 		}
 	}
 	return nil
 }
 
 // Request video formats and qualities
-func fetchVideoQuality(videoID string) (map[string]*extractors.Stream, error) {
+func fetchVideoQuality(ctx context.Context, client *request.Client, videoID string) (map[string]*extractors.Stream, error) {
 	reqURL := fmt.Sprintf(`https://rumble.com/embedJS/u3/?request=video&ver=2&v=%s&ext={"ad_count":null}&ad_wt=0`, videoID)
 
-	res, err := request.Request(http.MethodGet, reqURL, nil, nil)
+	res, err := client.RequestWithContext(ctx, http.MethodGet, reqURL, nil, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -333,8 +330,8 @@ func fetchVideoQuality(videoID string) (map[string]*extractors.Stream, error) {
 
 	streams := make(map[string]*extractors.Stream, 9)
 	rs.makeAllVODStreams(streams)
-	_ = rs.makeAllLiveStreams(streams)
-	_ = rs.makeAllNewVodStreams(streams)
+	_ = rs.makeAllLiveStreams(ctx, client, streams)
+	_ = rs.makeAllNewVodStreams(ctx, client, streams)
 	return streams, nil
 }
 
@@ -349,5 +346,15 @@ func makeStreamMeta(q, ext string, info *streamInfo) *extractors.Stream {
 		Parts:   []*extractors.Part{urlMeta},
 		Size:    info.Meta.Size,
 		Quality: q,
+		Media:   info.media(),
+	}
+}
+
+// media returns the typed properties of the stream, the bitrate of the meta is in kbps.
+func (info *streamInfo) media() extractors.Media {
+	return extractors.Media{
+		Width:   int(info.Meta.Width),
+		Height:  int(info.Meta.Height),
+		Bitrate: int64(info.Meta.Bitrate) * 1000,
 	}
 }
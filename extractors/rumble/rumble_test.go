@@ -47,3 +47,22 @@ func TestRumble(t *testing.T) {
 		})
 	}
 }
+
+func TestFillMetadata(t *testing.T) {
+	payload := &rumbleData{
+		ThumbnailURL: "https://sp.rmbl.ws/a.jpg",
+		Description:  "d",
+		UploadDate:   "2022-01-01T20:00:00-05:00",
+		Duration:     "PT01H10M05S",
+	}
+	payload.Author.Name = "Rumble"
+	payload.Author.URL = "https://rumble.com/c/rumble"
+	payload.InteractionStatistic.UserInteractionCount = 42
+
+	data := &extractors.Data{}
+	payload.fillMetadata(data)
+	if data.Duration != 4205 || data.UploadDate != "2022-01-02" || data.Uploader != "Rumble" || data.UploaderID != "rumble" ||
+		data.ViewCount != 42 || data.Description != "d" || len(data.Thumbnails) != 1 {
+		t.Errorf("unexpected metadata %+v", data)
+	}
+}
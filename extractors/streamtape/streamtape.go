@@ -7,7 +7,6 @@ import (
 	"github.com/robertkrimen/otto"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -25,8 +24,9 @@ func New() extractors.Extractor {
 }
 
 // Extract is the main function to extract the data.
-func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -59,7 +59,7 @@ func (e *extractor) Extract(url string, _ extractors.Options) ([]*extractors.Dat
 		title = titleMatch[1]
 	}
 
-	size, err := request.Size(u, url)
+	size, err := client.Size(u, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
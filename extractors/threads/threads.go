@@ -2,8 +2,6 @@ package threads
 
 import (
 	"fmt"
-	"net"
-	"net/http"
 	netURL "net/url"
 	"strings"
 	"time"
@@ -12,7 +10,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -20,23 +17,11 @@ func init() {
 	extractors.Register("threads", New())
 }
 
-type extractor struct {
-	client *http.Client
-}
+type extractor struct{}
 
 // New returns a instagram extractor.
 func New() extractors.Extractor {
-	return &extractor{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-			Transport: &http.Transport{
-				Dial: (&net.Dialer{
-					Timeout: 5 * time.Second,
-				}).Dial,
-				TLSHandshakeTimeout: 5 * time.Second,
-			},
-		},
-	}
+	return &extractor{}
 }
 
 type media struct {
@@ -46,6 +31,7 @@ type media struct {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	URL, err := netURL.Parse(url)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -64,7 +50,10 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	title := fmt.Sprintf("Threads %s - %s", poster, shortCode)
 
 	collector := colly.NewCollector()
-	collector.SetClient(e.client)
+	// colly changes the redirect policy of the client
+	httpClient := *client.HTTPClient()
+	httpClient.Timeout = 10 * time.Second
+	collector.SetClient(&httpClient)
 
 	// case single image or video
 	collector.OnHTML("div.SingleInnerMediaContainer", func(e *colly.HTMLElement) {
@@ -111,11 +100,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	var parts []*extractors.Part
 
 	for _, m := range medias {
-		_, ext, err := utils.GetNameAndExt(m.URL)
+		_, ext, err := utils.GetNameAndExt(client, m.URL)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		fileSize, err := request.Size(m.URL, url)
+		fileSize, err := client.Size(m.URL, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -1,10 +1,67 @@
 package extractors
 
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hydrz/lux/request"
+)
+
+// ByteRange is a sub-range of a resource, eg: HLS EXT-X-BYTERANGE.
+type ByteRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// Key is the decryption key of an encrypted part, eg: HLS EXT-X-KEY.
+type Key struct {
+	// eg: AES-128
+	Method string `json:"method"`
+	URI    string `json:"uri,omitempty"`
+	// Value is the key itself, it will be fetched from URI if it's empty
+	Value []byte `json:"value,omitempty"`
+	IV    []byte `json:"iv,omitempty"`
+}
+
+// Media is the typed properties of a stream or a part, the zero values mean they are unknown.
+type Media struct {
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// eg: avc1.640032
+	VideoCodec string `json:"vcodec,omitempty"`
+	// eg: mp4a.40.2
+	AudioCodec string `json:"acodec,omitempty"`
+	// Bitrate is in bits per second
+	Bitrate int64   `json:"bitrate,omitempty"`
+	FPS     float64 `json:"fps,omitempty"`
+	HDR     bool    `json:"hdr,omitempty"`
+	// Language of the audio, eg: en
+	Language string `json:"language,omitempty"`
+}
+
+// HasVideo reports whether the media is known to have a video track.
+func (m Media) HasVideo() bool {
+	return m.VideoCodec != "" || m.Height > 0
+}
+
 // Part is the data structure for a single part of the video stream information.
 type Part struct {
 	URL  string `json:"url"`
 	Size int64  `json:"size"`
 	Ext  string `json:"ext"`
+	// Media is the properties of the track of the part, eg: the video of a DASH stream
+	Media
+	// Range limits the download to a part of the URL, nil means the whole resource
+	Range *ByteRange `json:"range,omitempty"`
+	// Parts sharing the same non-empty Track are joined byte by byte in order before merging,
+	// eg: the initialization section and media segments of a fragmented MP4
+	Track string `json:"track,omitempty"`
+	// Key is used to decrypt the part after it's downloaded, nil means the part is not encrypted
+	Key *Key `json:"key,omitempty"`
+	// Headers are the extra HTTP headers required to download the part and its key
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type CaptionPart struct {
@@ -28,6 +85,81 @@ type Stream struct {
 	Ext string `json:"ext"`
 	// if the parts need mux
 	NeedMux bool
+	// Playlist is the URL of the HLS media playlist of the stream, it's polled for new parts when recording a live stream
+	Playlist string `json:"playlist,omitempty"`
+	// AudioPlaylist is the URL of the HLS media playlist of the separate audio track, it's polled along with Playlist
+	AudioPlaylist string `json:"audio_playlist,omitempty"`
+	// Live indicates the playlist is still growing, the parts are the segments available at the time of extraction
+	Live bool `json:"live,omitempty"`
+	// Media is the properties of the merged stream, the unknown ones are filled up from the parts
+	Media
+}
+
+// fillUpMedia fills up the unknown properties of the stream from its parts,
+// the bitrate is the sum of the first video part and the first audio part.
+func (s *Stream) fillUpMedia() {
+	var video, audio *Part
+	for _, part := range s.Parts {
+		switch {
+		case part.HasVideo():
+			if video == nil {
+				video = part
+			}
+		case part.AudioCodec != "" || part.Language != "":
+			if audio == nil {
+				audio = part
+			}
+		}
+	}
+	if video != nil {
+		if s.Width == 0 && s.Height == 0 {
+			s.Width, s.Height = video.Width, video.Height
+		}
+		if s.VideoCodec == "" {
+			s.VideoCodec = video.VideoCodec
+		}
+		if s.FPS == 0 {
+			s.FPS = video.FPS
+		}
+		s.HDR = s.HDR || video.HDR
+	}
+	for _, part := range []*Part{video, audio} {
+		if part == nil {
+			continue
+		}
+		if s.AudioCodec == "" {
+			s.AudioCodec = part.AudioCodec
+		}
+		if s.Language == "" {
+			s.Language = part.Language
+		}
+	}
+	if s.Bitrate == 0 {
+		if video != nil {
+			s.Bitrate += video.Bitrate
+		}
+		if audio != nil {
+			s.Bitrate += audio.Bitrate
+		}
+	}
+}
+
+// Thumbnail is a cover image of an item, the size is 0 if it's unknown.
+type Thumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// DateLayout is the layout of Data.UploadDate.
+const DateLayout = "2006-01-02"
+
+// FormatDate returns the upload date of a time in UTC, it's empty for the zero time.
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(DateLayout)
 }
 
 // DataType indicates the type of extracted data, eg: video or image.
@@ -47,14 +179,33 @@ const (
 // Data is the main data structure for the whole video data.
 type Data struct {
 	// URL is used to record the address of this download
-	URL   string   `json:"url"`
-	Site  string   `json:"site"`
-	Title string   `json:"title"`
-	Type  DataType `json:"type"`
+	URL  string `json:"url"`
+	Site string `json:"site"`
+	// ID is the stable ID of the item on the site, eg: the bvid of bilibili, it's empty if it's unknown
+	ID string `json:"id,omitempty"`
+	// Extractor is the name the extractor is registered with, it's set by Extract
+	Extractor string   `json:"extractor,omitempty"`
+	Title     string   `json:"title"`
+	Type      DataType `json:"type"`
 	// each stream has it's own Parts and Quality
 	Streams map[string]*Stream `json:"streams"`
 	// danmaku, subtitles, etc
 	Captions map[string]*CaptionPart `json:"caption"`
+	// Duration is the length of the media in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// UploadDate is the date the item was published, eg: 2006-01-02, see FormatDate
+	UploadDate string `json:"upload_date,omitempty"`
+	// Uploader is the name of the user or the channel who published the item
+	Uploader string `json:"uploader,omitempty"`
+	// UploaderID is the ID of the uploader on the site
+	UploaderID  string   `json:"uploader_id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	ViewCount   int64    `json:"view_count,omitempty"`
+	// Thumbnails are the cover images of the item, the best one comes first
+	Thumbnails []*Thumbnail `json:"thumbnails,omitempty"`
+	// PlaylistIndex is the position of the item in the playlist starting from 1, 0 if it's not extracted from a playlist
+	PlaylistIndex int `json:"playlist_index,omitempty"`
 	// Err is used to record whether an error occurred when extracting the list data
 	Err error `json:"err"`
 }
@@ -67,6 +218,7 @@ func (d *Data) FillUpStreamsData() {
 		if stream.Quality == "" {
 			stream.Quality = id
 		}
+		stream.fillUpMedia()
 
 		// generate the merged file extension
 		if d.Type == DataTypeVideo && stream.Ext == "" {
@@ -92,6 +244,31 @@ func (d *Data) FillUpStreamsData() {
 	}
 }
 
+// UniqueStreamID returns the ID of a new stream of the streams,
+// the codec is added to the ID if another stream has it, eg: the H.264 and HEVC streams of the same height and bitrate.
+func UniqueStreamID(streams map[string]*Stream, id, codecs string) string {
+	if _, ok := streams[id]; !ok {
+		return id
+	}
+	// the codec family is enough in most cases, eg: avc1 of avc1.640028
+	family, _, _ := strings.Cut(codecs, ".")
+	for _, codec := range []string{family, codecs} {
+		if codec == "" {
+			continue
+		}
+		candidate := id + "-" + codec
+		if _, ok := streams[candidate]; !ok {
+			return candidate
+		}
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", id, i)
+		if _, ok := streams[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
 // EmptyData returns an "empty" Data object with the given URL and error.
 func EmptyData(url string, err error) *Data {
 	return &Data{
@@ -121,6 +298,13 @@ type Options struct {
 	YoukuCcode    string
 	YoukuCkey     string
 	YoukuPassword string
+
+	// Archive skips the items that have been downloaded, see Archived
+	Archive Archive
+	// Client sends the requests of the extractor, nil means the default client of the request package
+	Client *request.Client
+	// extractor is the name of the extractor, it's set by Extract
+	extractor string
 }
 
 // Extractor implements video data extraction related operations.
@@ -128,3 +312,11 @@ type Extractor interface {
 	// Extract is the main function to extract the data.
 	Extract(url string, option Options) ([]*Data, error)
 }
+
+// ContextExtractor is an Extractor whose extraction can be canceled,
+// extractors that don't implement it are only checked for cancellation before and after extracting.
+type ContextExtractor interface {
+	Extractor
+	// ExtractContext is like Extract but the requests are canceled with ctx.
+	ExtractContext(ctx context.Context, url string, option Options) ([]*Data, error)
+}
@@ -0,0 +1,34 @@
+package extractors
+
+import (
+	"testing"
+)
+
+func TestFillUpStreamsMedia(t *testing.T) {
+	data := &Data{
+		Type: DataTypeVideo,
+		Streams: map[string]*Stream{
+			"80": {
+				Parts: []*Part{
+					{Ext: "m4s", Media: Media{Width: 1920, Height: 1080, VideoCodec: "avc1.640032", Bitrate: 3000000, FPS: 30}},
+					{Ext: "m4s", Media: Media{AudioCodec: "mp4a.40.2", Bitrate: 128000}},
+				},
+			},
+			"hdr": {
+				Parts: []*Part{{Ext: "mp4", Media: Media{Height: 2160, HDR: true}}},
+				Media: Media{Width: 3840, Height: 2160, Bitrate: 20000000},
+			},
+		},
+	}
+	data.FillUpStreamsData()
+
+	expected := Media{Width: 1920, Height: 1080, VideoCodec: "avc1.640032", AudioCodec: "mp4a.40.2", Bitrate: 3128000, FPS: 30}
+	if got := data.Streams["80"].Media; got != expected {
+		t.Errorf("got media %+v, want %+v", got, expected)
+	}
+	// the properties set by the extractor are kept
+	expected = Media{Width: 3840, Height: 2160, Bitrate: 20000000, HDR: true}
+	if got := data.Streams["hdr"].Media; got != expected {
+		t.Errorf("got media %+v, want %+v", got, expected)
+	}
+}
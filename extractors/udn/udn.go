@@ -6,7 +6,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -49,12 +48,13 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	url = prepareEmbedURL(url)
 	if len(url) == 0 {
 		return nil, errors.WithStack(extractors.ErrURLParseFailed)
 	}
 
-	html, err := request.Get(url, url, nil)
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -70,11 +70,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	if cdnURL == "" {
 		return nil, errors.New("empty list")
 	}
-	srcURL, err := request.Get("http://"+cdnURL, url, nil)
+	srcURL, err := client.Get("http://"+cdnURL, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	size, err := request.Size(srcURL, url)
+	size, err := client.Size(srcURL, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -1,10 +1,13 @@
 package universal
 
 import (
+	"context"
+	"strconv"
+	"strings"
+
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -21,11 +24,24 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	filename, ext, err := utils.GetNameAndExt(url)
+	return e.ExtractContext(context.Background(), url, option)
+}
+
+// ExtractContext is like Extract but the requests are canceled with ctx.
+func (e *extractor) ExtractContext(ctx context.Context, url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	filename, ext, err := utils.GetNameAndExt(client, url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	headers, err := client.HeadersWithContext(ctx, url, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	size, err := request.Size(url, url)
+	if headers.Get("Content-Length") == "" {
+		return nil, errors.New("Content-Length is not present")
+	}
+	size, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -41,10 +57,8 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 			Size: size,
 		},
 	}
-	contentType, err := request.ContentType(url, url)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
+	// handle Content-Type like this: "text/html; charset=utf-8"
+	contentType := strings.Split(headers.Get("Content-Type"), ";")[0]
 
 	return []*extractors.Data{
 		{
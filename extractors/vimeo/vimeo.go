@@ -2,12 +2,13 @@ package vimeo
 
 import (
 	"encoding/json"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -32,7 +33,29 @@ type vimeoRequest struct {
 }
 
 type vimeoVideo struct {
-	Title string `json:"title"`
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Duration int    `json:"duration"`
+	Owner    struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"owner"`
+	// the thumbnails by their widths, eg: {"640": "https://i.vimeocdn.com/video/xxx_640", "base": "..."}
+	Thumbs map[string]string `json:"thumbs"`
+}
+
+// thumbnails returns the thumbnails from the widest one.
+func (v vimeoVideo) thumbnails() []*extractors.Thumbnail {
+	thumbnails := make([]*extractors.Thumbnail, 0, len(v.Thumbs))
+	for width, url := range v.Thumbs {
+		w, err := strconv.Atoi(width)
+		if err != nil {
+			continue
+		}
+		thumbnails = append(thumbnails, &extractors.Thumbnail{URL: url, Width: w})
+	}
+	sort.Slice(thumbnails, func(i, j int) bool { return thumbnails[i].Width > thumbnails[j].Width })
+	return thumbnails
 }
 
 type vimeo struct {
@@ -47,20 +70,30 @@ func New() extractors.Extractor {
 	return &extractor{}
 }
 
+// ExtractID returns the video ID of a URL, eg: https://vimeo.com/259325107
+func (e *extractor) ExtractID(url string) (string, bool) {
+	vid := utils.MatchOneOf(url, `vimeo\.com/(?:video/)?(\d+)`)
+	if vid == nil {
+		return "", false
+	}
+	return vid[1], true
+}
+
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	var (
 		html, vid string
 		err       error
 	)
 	if strings.Contains(url, "player.vimeo.com") {
-		html, err = request.Get(url, url, nil)
+		html, err = client.Get(url, url, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 	} else {
 		vid = utils.MatchOneOf(url, `vimeo\.com/(\d+)`)[1]
-		html, err = request.Get("https://player.vimeo.com/video/"+vid, url, nil)
+		html, err = client.Get("https://player.vimeo.com/video/"+vid, url, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -76,10 +109,14 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
+	if vimeoData.Video.ID > 0 {
+		vid = strconv.FormatInt(vimeoData.Video.ID, 10)
+	}
+
 	streams := make(map[string]*extractors.Stream, len(vimeoData.Request.Files.Progressive))
 	var size int64
 	for _, video := range vimeoData.Request.Files.Progressive {
-		size, err = request.Size(video.URL, url)
+		size, err = client.Size(video.URL, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -92,16 +129,23 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 			Parts:   []*extractors.Part{urlData},
 			Size:    size,
 			Quality: video.Quality,
+			Media:   extractors.Media{Width: video.Width, Height: video.Height},
 		}
 	}
 
-	return []*extractors.Data{
-		{
-			Site:    "Vimeo vimeo.com",
-			Title:   vimeoData.Video.Title,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	data := &extractors.Data{
+		Site:       "Vimeo vimeo.com",
+		ID:         vid,
+		Title:      vimeoData.Video.Title,
+		Type:       extractors.DataTypeVideo,
+		Streams:    streams,
+		URL:        url,
+		Duration:   float64(vimeoData.Video.Duration),
+		Uploader:   vimeoData.Video.Owner.Name,
+		Thumbnails: vimeoData.Video.thumbnails(),
+	}
+	if vimeoData.Video.Owner.ID > 0 {
+		data.UploaderID = strconv.FormatInt(vimeoData.Video.Owner.ID, 10)
+	}
+	return []*extractors.Data{data}, nil
 }
@@ -7,7 +7,6 @@ import (
 
 	"github.com/hydrz/lux/config"
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -31,6 +30,7 @@ func New() extractors.Extractor {
 }
 
 func (e extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	// If url comes from feed or search, its id stored in url parameter.
 	// We need to convert it to direct link to make it work with m.vk.com.
 	if strings.Contains(url, "z=") {
@@ -51,7 +51,7 @@ func (e extractor) Extract(url string, option extractors.Options) ([]*extractors
 	config.FakeHeaders["Cookie"] += "remixlang=0; remixaudio_show_alert_today=0; remixff=0; remixmdevice=1920/1080/1/!!-!!!!!!"
 
 	// Get html.
-	html, err := request.Get(url, url, config.FakeHeaders)
+	html, err := client.Get(url, url, config.FakeHeaders)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -82,7 +82,7 @@ func (e extractor) Extract(url string, option extractors.Options) ([]*extractors
 	// Create download streams.
 	streams := make(map[string]*extractors.Stream)
 	for i := range srcs {
-		size, err := request.Size(srcs[i], "m.vk.vom")
+		size, err := client.Size(srcs[i], "m.vk.vom")
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -9,6 +9,7 @@ import (
 	netURL "net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -24,6 +25,15 @@ func init() {
 type playInfo struct {
 	Title string            `json:"title"`
 	URLs  map[string]string `json:"urls"`
+	// the description
+	Text         string  `json:"text"`
+	Author       string  `json:"author"`
+	AuthorID     int64   `json:"author_id"`
+	DurationTime float64 `json:"duration_time"`
+	// eg: //wx1.sinaimg.cn/orj480/xxx.jpg
+	CoverImage string `json:"cover_image"`
+	// the unix time it was published
+	RealDate int64 `json:"real_date"`
 }
 
 type playData struct {
@@ -36,11 +46,10 @@ type weiboData struct {
 	Msg  string   `json:"msg"`
 }
 
-func getXSRFToken() (string, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+func getXSRFToken(client *request.Client) (string, error) {
+	httpClient := *client.HTTPClient()
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 	url := "https://weibo.com/ajax/getversion"
 	req, err := http.NewRequest(http.MethodHead, url, nil)
@@ -49,7 +58,7 @@ func getXSRFToken() (string, error) {
 	}
 	req.Header.Add("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.116 Safari/537.36")
 
-	res, err := client.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -66,7 +75,7 @@ func getXSRFToken() (string, error) {
 	return xsrfTokens[1], nil
 }
 
-func downloadWeiboVideo(url string) ([]*extractors.Data, error) {
+func downloadWeiboVideo(client *request.Client, url string) ([]*extractors.Data, error) {
 	urldata, err := netURL.Parse(url)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -75,7 +84,7 @@ func downloadWeiboVideo(url string) ([]*extractors.Data, error) {
 		"https://video.h5.weibo.cn/s/video/object?object_id=%s&mid=%s",
 		strings.Split(urldata.Path, "/")[1], strings.Split(urldata.Path, "/")[2],
 	)
-	jsonString, err := request.Get(api, "", nil)
+	jsonString, err := client.Get(api, "", nil)
 
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -91,7 +100,7 @@ func downloadWeiboVideo(url string) ([]*extractors.Data, error) {
 		return nil, errors.WithStack(err)
 	}
 	realhdURL := strings.ReplaceAll(unescapedhdURL, `\/`, `/`)
-	hdsize, err := request.Size(realhdURL, "")
+	hdsize, err := client.Size(realhdURL, "")
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -113,7 +122,7 @@ func downloadWeiboVideo(url string) ([]*extractors.Data, error) {
 		return nil, errors.WithStack(err)
 	}
 	realURL := strings.ReplaceAll(unescapedURL, `\/`, `/`)
-	size, err := request.Size(realURL, "")
+	size, err := client.Size(realURL, "")
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -128,25 +137,40 @@ func downloadWeiboVideo(url string) ([]*extractors.Data, error) {
 		Size:    size,
 		Quality: "sd",
 	}
-	return []*extractors.Data{
-		{
-			Site:    "微博 weibo.com",
-			Title:   summary,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	data := &extractors.Data{
+		Site:    "微博 weibo.com",
+		ID:      strings.Split(urldata.Path, "/")[1],
+		Title:   summary,
+		Type:    extractors.DataTypeVideo,
+		Streams: streams,
+		URL:     url,
+	}
+	if screenNames := utils.MatchOneOf(jsonString, `"screen_name":"(.+?)",`); screenNames != nil {
+		data.Uploader = unquote(screenNames[1])
+	}
+	if durations := utils.MatchOneOf(jsonString, `"duration":([\d.]+)`); durations != nil {
+		data.Duration, _ = strconv.ParseFloat(durations[1], 64)
+	}
+	return []*extractors.Data{data}, nil
 }
 
-func downloadWeiboTV(url string) ([]*extractors.Data, error) {
+// unquote decodes the \uXXXX escapes of a JSON string matched by a regexp, the string is returned as is if it's invalid.
+func unquote(s string) string {
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `\/`, `/`) + `"`)
+	if err != nil {
+		return s
+	}
+	return unquoted
+}
+
+func downloadWeiboTV(client *request.Client, url string) ([]*extractors.Data, error) {
 	APIEndpoint := "https://weibo.com/tv/api/component?page="
 	urldata, err := netURL.Parse(url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	APIURL := APIEndpoint + netURL.QueryEscape(urldata.Path)
-	token, err := getXSRFToken()
+	token, err := getXSRFToken(client)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -162,7 +186,7 @@ func downloadWeiboTV(url string) ([]*extractors.Data, error) {
 	oid := utils.MatchOneOf(url, `tv/show/([^?]+)`)[1]
 	postData := "data=" + netURL.QueryEscape("{\"Component_Play_Playinfo\":{\"oid\":\""+oid+"\"}}")
 	payload := strings.NewReader(postData)
-	res, err := request.Request(http.MethodPost, APIURL, payload, headers)
+	res, err := client.Request(http.MethodPost, APIURL, payload, headers)
 
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -195,7 +219,7 @@ func downloadWeiboTV(url string) ([]*extractors.Data, error) {
 
 	streams := make(map[string]*extractors.Stream, len(realURLs))
 	for q, u := range realURLs {
-		size, err := request.Size(u, "")
+		size, err := client.Size(u, "")
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -211,15 +235,31 @@ func downloadWeiboTV(url string) ([]*extractors.Data, error) {
 			Quality: q,
 		}
 	}
-	return []*extractors.Data{
-		{
-			Site:    "微博 weibo.com",
-			Title:   data.Data.PlayInfo.Title,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	info := data.Data.PlayInfo
+	extractedData := &extractors.Data{
+		Site:        "微博 weibo.com",
+		ID:          oid,
+		Title:       info.Title,
+		Type:        extractors.DataTypeVideo,
+		Streams:     streams,
+		URL:         url,
+		Duration:    info.DurationTime,
+		Uploader:    info.Author,
+		Description: info.Text,
+	}
+	if info.AuthorID > 0 {
+		extractedData.UploaderID = strconv.FormatInt(info.AuthorID, 10)
+	}
+	if info.RealDate > 0 {
+		extractedData.UploadDate = extractors.FormatDate(time.Unix(info.RealDate, 0))
+	}
+	if info.CoverImage != "" {
+		if strings.HasPrefix(info.CoverImage, "//") {
+			info.CoverImage = "https:" + info.CoverImage
+		}
+		extractedData.Thumbnails = []*extractors.Thumbnail{{URL: info.CoverImage}}
+	}
+	return []*extractors.Data{extractedData}, nil
 }
 
 type extractor struct{}
@@ -231,15 +271,16 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	if !strings.Contains(url, "m.weibo.cn") {
 		if strings.Contains(url, "weibo.com/tv/show/") {
-			return downloadWeiboTV(url)
+			return downloadWeiboTV(client, url)
 		} else if strings.Contains(url, "video.h5.weibo.cn") {
-			return downloadWeiboVideo(url)
+			return downloadWeiboVideo(client, url)
 		}
 		url = strings.Replace(url, "weibo.com", "m.weibo.cn", 1)
 	}
-	html, err := request.Get(url, url, nil)
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -268,7 +309,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	var size int64
 	for quality, realURL := range qualityUrls {
 		streamId := quality
-		size, err = request.Size(realURL, url)
+		size, err = client.Size(realURL, url)
 		if err != nil {
 			continue
 		}
@@ -286,13 +327,36 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		return nil, errors.WithStack(err)
 	}
 
-	return []*extractors.Data{
-		{
-			Site:    "微博 weibo.com",
-			Title:   title,
-			Type:    extractors.DataTypeVideo,
-			Streams: streams,
-			URL:     url,
-		},
-	}, nil
+	data := &extractors.Data{
+		Site:    "微博 weibo.com",
+		Title:   title,
+		Type:    extractors.DataTypeVideo,
+		Streams: streams,
+		URL:     url,
+	}
+	fillStatusMetadata(data, html)
+	return []*extractors.Data{data}, nil
+}
+
+// fillStatusMetadata fills up the metadata from the status in the render data of a m.weibo.cn page.
+func fillStatusMetadata(data *extractors.Data, html string) {
+	if mids := utils.MatchOneOf(html, `"mid": "(\d+)"`); mids != nil {
+		data.ID = mids[1]
+	}
+	if createdAt := utils.MatchOneOf(html, `"created_at": "(.+?)"`); createdAt != nil {
+		// eg: Sat Jan 01 12:00:00 +0800 2022
+		if t, err := time.Parse(time.RubyDate, createdAt[1]); err == nil {
+			data.UploadDate = extractors.FormatDate(t)
+		}
+	}
+	if users := utils.MatchOneOf(html, `"user": \{\s*"id": (\d+),\s*"screen_name": "(.+?)"`); users != nil {
+		data.UploaderID = users[1]
+		data.Uploader = unquote(users[2])
+	}
+	if durations := utils.MatchOneOf(html, `"duration": ([\d.]+)`); durations != nil {
+		data.Duration, _ = strconv.ParseFloat(durations[1], 64)
+	}
+	if pics := utils.MatchOneOf(html, `"page_pic": \{\s*"url": "(.+?)"`); pics != nil {
+		data.Thumbnails = []*extractors.Thumbnail{{URL: unquote(pics[1])}}
+	}
 }
@@ -9,7 +9,7 @@ import (
 
 func TestToken(t *testing.T) {
 	t.Run(
-		"XSRF token test", func(t *testing.T) { getXSRFToken() },
+		"XSRF token test", func(t *testing.T) { getXSRFToken(nil) },
 	)
 }
 
@@ -52,3 +52,35 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestFillStatusMetadata(t *testing.T) {
+	html := `var $render_data = [{
+    "status": {
+        "created_at": "Sat Jan 01 23:00:00 +0800 2022",
+        "id": "4721133431521234",
+        "mid": "4721133431521234",
+        "user": {
+            "id": 1234567890,
+            "screen_name": "微博",
+            "profile_image_url": "https:\/\/tvax1.sinaimg.cn\/a.jpg"
+        },
+        "page_info": {
+            "page_pic": {
+                "url": "https:\/\/wx1.sinaimg.cn\/orj480\/b.jpg"
+            },
+            "media_info": {
+                "duration": 62.5
+            }
+        }
+    }
+}][0] || {};`
+	data := &extractors.Data{}
+	fillStatusMetadata(data, html)
+	if data.ID != "4721133431521234" || data.UploadDate != "2022-01-01" || data.Uploader != "微博" ||
+		data.UploaderID != "1234567890" || data.Duration != 62.5 {
+		t.Errorf("unexpected metadata %+v", data)
+	}
+	if len(data.Thumbnails) != 1 || data.Thumbnails[0].URL != "https://wx1.sinaimg.cn/orj480/b.jpg" {
+		t.Errorf("unexpected thumbnails %v", data.Thumbnails)
+	}
+}
@@ -10,7 +10,6 @@ import (
 
 	"github.com/hydrz/lux/config"
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -29,7 +28,8 @@ const mp4VideoType = "mp4"
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, config.FakeHeaders)
+	client := option.Client
+	html, err := client.Get(url, url, config.FakeHeaders)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -64,7 +64,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		if !strings.Contains(u, mp4VideoType) {
 			continue
 		}
-		size, err = request.Size(u, u)
+		size, err = client.Size(u, u)
 		if err != nil {
 			continue
 		}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/hydrz/lux/extractors"
 	"github.com/hydrz/lux/parser"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -24,7 +23,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -45,7 +45,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	}
 	itemId := itemIds[len(itemIds)-1]
 
-	jsonData, err := request.Get("https://www.ximalaya.com/revision/play/v1/audio?id="+itemId+"&ptype=1", url, nil)
+	jsonData, err := client.Get("https://www.ximalaya.com/revision/play/v1/audio?id="+itemId+"&ptype=1", url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -56,11 +56,11 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 	realURL := ximalaya.Data.Src
 	urlData := make([]*extractors.Part, 0)
-	totalSize, err := request.Size(realURL, url)
+	totalSize, err := client.Size(realURL, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	_, ext, err := utils.GetNameAndExt(realURL)
+	_, ext, err := utils.GetNameAndExt(client, realURL)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -10,7 +10,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 )
 
 func init() {
@@ -36,11 +35,12 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	headers := map[string]string{
 		"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:98.0) Gecko/20100101 Firefox/98.0",
 	}
 
-	html, err := request.Get(url, url, headers)
+	html, err := client.Get(url, url, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -52,7 +52,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	appKey := r2.FindSubmatch([]byte(html))[1]
 
 	video_url := fmt.Sprintf("https://mod-api.xinpianchang.com/mod/api/v2/media/%s?appKey=%s", string(vid), string(appKey))
-	body, err := request.Get(video_url, url, headers)
+	body, err := client.Get(video_url, url, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
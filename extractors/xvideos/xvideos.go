@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -90,7 +89,8 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
-	html, err := request.Get(url, url, nil)
+	client := option.Client
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -104,7 +104,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 
 	streams := make(map[string]*extractors.Stream, len(getSrc(html)))
 	for _, src := range getSrc(html) {
-		size, err := request.Size(src.url, url)
+		size, err := client.Size(src.url, url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -34,6 +33,7 @@ func New() extractors.Extractor {
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	vid := utils.MatchOneOf(
 		url,
 		`https?://v.yinyuetai.com/video/(\d+)(?:\?vid=\d+)?`,
@@ -47,7 +47,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 	// generate api url
 	apiURL := genAPI(actionGetMvInfo, params)
 	var err error
-	html, err := request.Get(apiURL, url, nil)
+	html, err := client.Get(apiURL, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -16,7 +16,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -83,6 +82,7 @@ func getAudioLang(lang string) string {
 // var ccodes = []string{"0510", "0502", "0507", "0508", "0512", "0513", "0514", "0503", "0590"}
 
 func youkuUps(vid string, option extractors.Options) (*youkuData, error) {
+	client := option.Client
 	var (
 		url   string
 		utid  string
@@ -92,7 +92,7 @@ func youkuUps(vid string, option extractors.Options) (*youkuData, error) {
 	if strings.Contains(option.Cookie, "cna") {
 		utids = utils.MatchOneOf(option.Cookie, `cna=(.+?);`, `cna\s+(.+?)\s`, `cna\s+(.+?)$`)
 	} else {
-		headers, err := request.Headers("http://log.mmstat.com/eg.js", youkuReferer)
+		headers, err := client.Headers("http://log.mmstat.com/eg.js", youkuReferer)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -117,7 +117,7 @@ func youkuUps(vid string, option extractors.Options) (*youkuData, error) {
 		if option.YoukuPassword != "" {
 			url = fmt.Sprintf("%s&password=%s", url, option.YoukuPassword)
 		}
-		html, err := request.GetByte(url, youkuReferer, nil)
+		html, err := client.GetByte(url, youkuReferer, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -2,9 +2,9 @@ package youtube
 
 import (
 	"fmt"
-	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/kkdai/youtube/v2"
 	"github.com/pkg/errors"
@@ -23,30 +23,32 @@ func init() {
 const referer = "https://www.youtube.com"
 
 type extractor struct {
+	// client is the youtube client of an extraction
 	client *youtube.Client
 }
 
 // New returns a youtube extractor.
 func New() extractors.Extractor {
-	return &extractor{
-		client: &youtube.Client{
-			HTTPClient: &http.Client{
-				Transport: &http.Transport{
-					Proxy: http.ProxyFromEnvironment,
-				},
-			},
-		},
-	}
+	return &extractor{}
+}
+
+// ExtractID returns the video ID of a URL, eg: dQw4w9WgXcQ
+func (e *extractor) ExtractID(url string) (string, bool) {
+	id, err := youtube.ExtractVideoID(url)
+	return id, err == nil
 }
 
 // Extract is the main function to extract the data.
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
+	// the registered extractor is shared by concurrent extractions, each one uses its own youtube client
+	e = &extractor{client: &youtube.Client{HTTPClient: client.HTTPClient()}}
 	if !option.Playlist {
 		video, err := e.client.GetVideo(url)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		return []*extractors.Data{e.youtubeDownload(url, video)}, nil
+		return []*extractors.Data{e.youtubeDownload(client, url, video)}, nil
 	}
 
 	playlist, err := e.client.GetPlaylist(url)
@@ -62,16 +64,22 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		if !slices.Contains(needDownloadItems, index+1) {
 			continue
 		}
+		if option.Archived(videoEntry.ID) {
+			extractedData[dataIndex] = extractors.ArchivedData("https://www.youtube.com/watch?v="+videoEntry.ID, videoEntry.ID)
+			dataIndex++
+			continue
+		}
 
 		wgp.Add()
-		go func(index int, entry *youtube.PlaylistEntry, extractedData []*extractors.Data) {
+		go func(index, playlistIndex int, entry *youtube.PlaylistEntry, extractedData []*extractors.Data) {
 			defer wgp.Done()
 			video, err := e.client.VideoFromPlaylistEntry(entry)
 			if err != nil {
 				return
 			}
-			extractedData[index] = e.youtubeDownload(url, video)
-		}(dataIndex, videoEntry, extractedData)
+			extractedData[index] = e.youtubeDownload(client, url, video)
+			extractedData[index].PlaylistIndex = playlistIndex
+		}(dataIndex, index+1, videoEntry, extractedData)
 		dataIndex++
 	}
 	wgp.Wait()
@@ -79,7 +87,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 }
 
 // youtubeDownload download function for single url
-func (e *extractor) youtubeDownload(url string, video *youtube.Video) *extractors.Data {
+func (e *extractor) youtubeDownload(client *request.Client, url string, video *youtube.Video) *extractors.Data {
 	streams := make(map[string]*extractors.Stream, len(video.Formats))
 	audioCache := make(map[string]*extractors.Part)
 
@@ -91,7 +99,7 @@ func (e *extractor) youtubeDownload(url string, video *youtube.Video) *extractor
 			quality = fmt.Sprintf("%s %s", f.QualityLabel, f.MimeType)
 		}
 
-		part, err := e.genPartByFormat(video, f)
+		part, err := e.genPartByFormat(client, video, f)
 		if err != nil {
 			return extractors.EmptyData(url, err)
 		}
@@ -116,7 +124,7 @@ func (e *extractor) youtubeDownload(url string, video *youtube.Video) *extractor
 				if err != nil {
 					return extractors.EmptyData(url, err)
 				}
-				audioPart, err = e.genPartByFormat(video, audio)
+				audioPart, err = e.genPartByFormat(client, video, audio)
 				if err != nil {
 					return extractors.EmptyData(url, err)
 				}
@@ -127,16 +135,33 @@ func (e *extractor) youtubeDownload(url string, video *youtube.Video) *extractor
 		streams[itag] = stream
 	}
 
+	thumbnails := make([]*extractors.Thumbnail, 0, len(video.Thumbnails))
+	for _, t := range video.Thumbnails {
+		thumbnails = append(thumbnails, &extractors.Thumbnail{URL: t.URL, Width: int(t.Width), Height: int(t.Height)})
+	}
+	// the largest thumbnail comes first
+	slices.SortStableFunc(thumbnails, func(a, b *extractors.Thumbnail) int {
+		return b.Width*b.Height - a.Width*a.Height
+	})
+
 	return &extractors.Data{
-		Site:    "YouTube youtube.com",
-		Title:   video.Title,
-		Type:    "video",
-		Streams: streams,
-		URL:     url,
+		Site:        "YouTube youtube.com",
+		ID:          video.ID,
+		Title:       video.Title,
+		Type:        "video",
+		Streams:     streams,
+		URL:         url,
+		Duration:    video.Duration.Seconds(),
+		UploadDate:  extractors.FormatDate(video.PublishDate),
+		Uploader:    video.Author,
+		UploaderID:  video.ChannelID,
+		Description: video.Description,
+		ViewCount:   int64(video.Views),
+		Thumbnails:  thumbnails,
 	}
 }
 
-func (e *extractor) genPartByFormat(video *youtube.Video, f *youtube.Format) (*extractors.Part, error) {
+func (e *extractor) genPartByFormat(client *request.Client, video *youtube.Video, f *youtube.Format) (*extractors.Part, error) {
 	ext := getStreamExt(f.MimeType)
 	url, err := e.client.GetStreamURL(video, f)
 	if err != nil {
@@ -144,15 +169,48 @@ func (e *extractor) genPartByFormat(video *youtube.Video, f *youtube.Format) (*e
 	}
 	size := f.ContentLength
 	if size == 0 {
-		size, _ = request.Size(url, referer)
+		size, _ = client.Size(url, referer)
 	}
 	return &extractors.Part{
-		URL:  url,
-		Size: size,
-		Ext:  ext,
+		URL:   url,
+		Size:  size,
+		Ext:   ext,
+		Media: formatMedia(f),
 	}, nil
 }
 
+// formatMedia returns the typed properties of the format, the codecs are in its mime type.
+func formatMedia(f *youtube.Format) extractors.Media {
+	media := extractors.Media{
+		Width:   f.Width,
+		Height:  f.Height,
+		Bitrate: int64(f.Bitrate),
+		FPS:     float64(f.FPS),
+		HDR:     strings.Contains(f.QualityLabel, "HDR"),
+	}
+	// video/mp4; codecs="avc1.640028, mp4a.40.2" --> avc1.640028, mp4a.40.2
+	var codecs []string
+	if m := utils.MatchOneOf(f.MimeType, `codecs="([^"]+)"`); len(m) > 1 {
+		codecs = strings.Split(m[1], ",")
+	}
+	for i := range codecs {
+		codecs[i] = strings.TrimSpace(codecs[i])
+	}
+	switch {
+	case strings.HasPrefix(f.MimeType, "audio/") && len(codecs) > 0:
+		media.AudioCodec = codecs[0]
+	case len(codecs) > 1:
+		media.VideoCodec, media.AudioCodec = codecs[0], codecs[1]
+	case len(codecs) > 0:
+		media.VideoCodec = codecs[0]
+	}
+	if f.AudioTrack != nil {
+		// eg: en.4 or en-US.3
+		media.Language, _, _ = strings.Cut(f.AudioTrack.ID, ".")
+	}
+	return media
+}
+
 func getVideoAudio(v *youtube.Video, mimeType string) (*youtube.Format, error) {
 	audioFormats := v.Formats.Type(mimeType).Type("audio")
 	if len(audioFormats) == 0 {
@@ -8,7 +8,6 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/hydrz/lux/extractors"
-	"github.com/hydrz/lux/request"
 	"github.com/hydrz/lux/utils"
 )
 
@@ -28,11 +27,12 @@ func New() extractors.Extractor {
 }
 
 func (e *extractor) Extract(url string, option extractors.Options) ([]*extractors.Data, error) {
+	client := option.Client
 	if !strings.Contains(url, videoURL) {
 		return nil, errors.WithStack(extractors.ErrURLParseFailed)
 	}
 
-	html, err := request.Get(url, url, nil)
+	html, err := client.Get(url, url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -49,7 +49,7 @@ func (e *extractor) Extract(url string, option extractors.Options) ([]*extractor
 		title = titleMatch[1]
 	}
 
-	resp, err := request.GetByte(fmt.Sprintf("%s%s", api, videoID[1]), url, nil)
+	resp, err := client.GetByte(fmt.Sprintf("%s%s", api, videoID[1]), url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
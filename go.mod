@@ -4,7 +4,6 @@ go 1.22
 
 require (
 	github.com/EDDYCJY/fake-useragent v0.2.0
-	github.com/MercuryEngineering/CookieMonster v0.0.0-20180304172713-1584578b3403
 	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/buger/jsonparser v1.1.1
 	github.com/cheggaaa/pb/v3 v3.0.8
@@ -15,9 +14,12 @@ require (
 	github.com/json-iterator/go v1.1.12
 	github.com/kkdai/youtube/v2 v2.10.1
 	github.com/kr/pretty v0.3.0
+	github.com/mattn/go-colorable v0.1.12
+	github.com/mattn/go-isatty v0.0.14
 	github.com/pkg/errors v0.9.1
 	github.com/robertkrimen/otto v0.0.0-20211024170158-b87d35c0b86f
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/net v0.23.0
 )
 
 require (
@@ -37,8 +39,6 @@ require (
 	github.com/itchyny/timefmt-go v0.1.3 // indirect
 	github.com/kennygrant/sanitize v1.2.4 // indirect
 	github.com/kr/text v0.2.0 // indirect
-	github.com/mattn/go-colorable v0.1.12 // indirect
-	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
@@ -47,7 +47,6 @@ require (
 	github.com/saintfish/chardet v0.0.0-20120816061221-3af4cd4741ca // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/temoto/robotstxt v1.1.1 // indirect
-	golang.org/x/net v0.23.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	google.golang.org/appengine v1.6.6 // indirect
@@ -0,0 +1,384 @@
+package hls
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/request"
+	"github.com/hydrz/lux/utils"
+)
+
+// fmp4Track is the track name of fragmented MP4 segments, they must be joined with their initialization section.
+const fmp4Track = "fmp4"
+
+// Load fetches and parses the playlist of the given URL with the client, a nil client is the default client.
+func Load(client *request.Client, uri string, headers map[string]string) (*MasterPlaylist, *MediaPlaylist, error) {
+	return LoadContext(context.Background(), client, uri, headers)
+}
+
+// LoadContext is like Load but the request is canceled with ctx.
+func LoadContext(ctx context.Context, client *request.Client, uri string, headers map[string]string) (*MasterPlaylist, *MediaPlaylist, error) {
+	if uri == "" {
+		return nil, nil, errors.New("url is null")
+	}
+	content, err := client.GetWithContext(ctx, uri, "", headers)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return Parse(content, uri)
+}
+
+// LoadMedia fetches the media playlist of the given URL,
+// the variant with the highest bandwidth is used if it is a master playlist.
+func LoadMedia(client *request.Client, uri string, headers map[string]string) (*MediaPlaylist, error) {
+	return LoadMediaContext(context.Background(), client, uri, headers)
+}
+
+// LoadMediaContext is like LoadMedia but the requests are canceled with ctx.
+func LoadMediaContext(ctx context.Context, client *request.Client, uri string, headers map[string]string) (*MediaPlaylist, error) {
+	master, media, err := LoadContext(ctx, client, uri, headers)
+	if err != nil {
+		return nil, err
+	}
+	if media != nil {
+		return media, nil
+	}
+	variants := master.SortedVariants()
+	_, media, err = LoadContext(ctx, client, variants[0].URI, headers)
+	if err != nil {
+		return nil, err
+	}
+	if media == nil {
+		return nil, errors.Errorf("%s: nested master playlist", variants[0].URI)
+	}
+	return media, nil
+}
+
+// SortedVariants returns the variants sorted by bandwidth, from highest to lowest.
+func (p *MasterPlaylist) SortedVariants() []*Variant {
+	variants := make([]*Variant, len(p.Variants))
+	copy(variants, p.Variants)
+	sort.SliceStable(variants, func(i, j int) bool { return variants[i].Bandwidth > variants[j].Bandwidth })
+	return variants
+}
+
+// Streams fetches the playlist of the given URL and turns it into streams.
+// Each variant of a master playlist becomes its own stream.
+func Streams(client *request.Client, uri string, headers map[string]string) (map[string]*extractors.Stream, error) {
+	return StreamsContext(context.Background(), client, uri, headers)
+}
+
+// StreamsContext is like Streams but the requests are canceled with ctx.
+func StreamsContext(ctx context.Context, client *request.Client, uri string, headers map[string]string) (map[string]*extractors.Stream, error) {
+	master, media, err := LoadContext(ctx, client, uri, headers)
+	if err != nil {
+		return nil, err
+	}
+	if media != nil {
+		stream := NewStream(nil, media)
+		stream.Playlist = uri
+		setHeaders(stream, headers)
+		return map[string]*extractors.Stream{
+			"default": stream,
+		}, nil
+	}
+
+	// the media playlists of the variants and of their audio renditions
+	uris := make([]string, 0, len(master.Variants))
+	audios := make(map[*Variant]*Rendition)
+	for _, v := range master.Variants {
+		uris = append(uris, v.URI)
+		if r := master.AudioRendition(v); r != nil {
+			audios[v] = r
+			uris = append(uris, r.URI)
+		}
+	}
+	playlists, err := loadMediaPlaylists(ctx, client, uris, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]*extractors.Stream, len(master.Variants))
+	listed := make(map[[2]string]bool, len(master.Variants))
+	for _, v := range master.Variants {
+		// some sites list the same variant more than once
+		key := [2]string{v.URI}
+		if r := audios[v]; r != nil {
+			key[1] = r.URI
+		}
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+		// the variants of another codec may have the same height and bandwidth
+		id := extractors.UniqueStreamID(streams, v.ID(), v.Codecs)
+		stream := NewStream(v, playlists[v.URI])
+		stream.Playlist = v.URI
+		if r := audios[v]; r != nil {
+			addAudio(stream, r, playlists[r.URI])
+		}
+		setHeaders(stream, headers)
+		streams[id] = stream
+	}
+	return streams, nil
+}
+
+// playlistFetches is the number of the media playlists of a master playlist fetched at the same time
+const playlistFetches = 4
+
+// loadMediaPlaylists fetches the media playlists of the URIs, playlistFetches at a time.
+func loadMediaPlaylists(ctx context.Context, client *request.Client, uris []string, headers map[string]string) (map[string]*MediaPlaylist, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	playlists := make(map[string]*MediaPlaylist, len(uris))
+	var (
+		lock     sync.Mutex
+		firstErr error
+	)
+	fetched := make(map[string]bool, len(uris))
+	wgp := utils.NewWaitGroupPool(playlistFetches)
+	for _, uri := range uris {
+		// the variants may share a playlist or an audio rendition
+		if fetched[uri] || ctx.Err() != nil {
+			continue
+		}
+		fetched[uri] = true
+		wgp.Add()
+		go func(uri string) {
+			defer wgp.Done()
+			_, media, err := LoadContext(ctx, client, uri, headers)
+			if err == nil && media == nil {
+				err = errors.Errorf("%s: nested master playlist", uri)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					// the other playlists are useless
+					cancel()
+				}
+				return
+			}
+			playlists[uri] = media
+		}(uri)
+	}
+	wgp.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return playlists, nil
+}
+
+// AudioRendition returns the audio rendition of the variant which has its own playlist,
+// the default one is preferred. It returns nil if the audio is in the variant stream.
+func (p *MasterPlaylist) AudioRendition(v *Variant) *Rendition {
+	if v.Audio == "" {
+		return nil
+	}
+	var found *Rendition
+	for _, r := range p.Renditions {
+		if r.Type != "AUDIO" || r.GroupID != v.Audio || r.URI == "" {
+			continue
+		}
+		if r.Default {
+			return r
+		}
+		if found == nil {
+			found = r
+		}
+	}
+	return found
+}
+
+// addAudio adds the parts of the audio rendition to the stream as a separate track, it's muxed with the video when merging.
+func addAudio(stream *extractors.Stream, r *Rendition, p *MediaPlaylist) {
+	for _, part := range stream.Parts {
+		part.Track = "video"
+	}
+	for _, part := range p.Parts() {
+		part.Track = "audio"
+		stream.Parts = append(stream.Parts, part)
+	}
+	stream.Ext = "mp4"
+	stream.NeedMux = true
+	stream.AudioPlaylist = r.URI
+	if name := first(r.Name, r.Language); name != "" {
+		stream.Quality += " + " + name
+	}
+}
+
+// first returns the first non-empty string.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setHeaders makes the parts use the same headers as the playlist.
+func setHeaders(stream *extractors.Stream, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	for _, part := range stream.Parts {
+		part.Headers = headers
+	}
+}
+
+// ID returns an identifier of the variant that is stable across extractions, eg: 1080p-5000k
+func (v *Variant) ID() string {
+	kbps := v.Bandwidth / 1000
+	if v.Height > 0 {
+		return fmt.Sprintf("%dp-%dk", v.Height, kbps)
+	}
+	return fmt.Sprintf("%dk", kbps)
+}
+
+// Quality returns a human readable description of the variant, eg: 1920x1080 5000 kbps
+func (v *Variant) Quality() string {
+	var quality []string
+	if v.Width > 0 && v.Height > 0 {
+		quality = append(quality, fmt.Sprintf("%dx%d", v.Width, v.Height))
+	}
+	if v.Bandwidth > 0 {
+		quality = append(quality, fmt.Sprintf("%d kbps", v.Bandwidth/1000))
+	}
+	if v.Codecs != "" {
+		quality = append(quality, v.Codecs)
+	}
+	return strings.Join(quality, " ")
+}
+
+// NewStream builds a stream from a media playlist, the variant is optional.
+func NewStream(v *Variant, p *MediaPlaylist) *extractors.Stream {
+	stream := &extractors.Stream{
+		Parts: p.Parts(),
+		Live:  !p.EndList,
+	}
+	if v != nil {
+		stream.Quality = v.Quality()
+		bandwidth := v.AverageBandwidth
+		if bandwidth == 0 {
+			bandwidth = v.Bandwidth
+		}
+		// There is no size information in the m3u8 file, estimate it by the bandwidth.
+		stream.Size = int64(float64(bandwidth) / 8 * p.Duration())
+	}
+	if p.hasMap() {
+		stream.Ext = "mp4"
+	}
+	return stream
+}
+
+func (p *MediaPlaylist) hasMap() bool {
+	for _, s := range p.Segments {
+		if s.Map != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Parts converts the segments to parts,
+// the initialization section of fragmented MP4 segments is inserted as a separate part.
+func (p *MediaPlaylist) Parts() []*extractors.Part {
+	parts, _ := p.partsFrom(0, "")
+	return parts
+}
+
+// partsFrom converts the segments from the sequence number on,
+// lastMap is the key of the initialization section of the parts converted before.
+func (p *MediaPlaylist) partsFrom(sequence uint64, lastMap string) ([]*extractors.Part, string) {
+	parts := make([]*extractors.Part, 0, len(p.Segments))
+	for _, s := range p.Segments {
+		if s.Sequence < sequence {
+			continue
+		}
+		if s.Map != nil && s.Map.key() != lastMap {
+			part := newPart(s.Map.URI, s.Map.ByteRange, "mp4", fmp4Track)
+			// the initialization section is only encrypted if the key has an explicit IV
+			if s.Key != nil && s.Key.IV != nil {
+				part.Key = newKey(s.Key, s.Sequence)
+			}
+			parts = append(parts, part)
+			lastMap = s.Map.key()
+		}
+		var part *extractors.Part
+		if s.Map != nil {
+			part = newPart(s.URI, s.ByteRange, segmentExt(s.URI, "m4s"), fmp4Track)
+		} else {
+			part = newPart(s.URI, s.ByteRange, segmentExt(s.URI, "ts"), "")
+		}
+		if s.Key != nil {
+			part.Key = newKey(s.Key, s.Sequence)
+		}
+		parts = append(parts, part)
+	}
+	return parts, lastMap
+}
+
+// key identifies the initialization section, the same section is reloaded as a new Map with each playlist.
+func (m *Map) key() string {
+	if m.ByteRange == nil {
+		return m.URI
+	}
+	return fmt.Sprintf("%s@%d-%d", m.URI, m.ByteRange.Offset, m.ByteRange.Length)
+}
+
+func newPart(uri string, r *ByteRange, ext, track string) *extractors.Part {
+	part := &extractors.Part{
+		URL:   uri,
+		Ext:   ext,
+		Track: track,
+	}
+	if r != nil {
+		part.Range = &extractors.ByteRange{
+			Offset: r.Offset,
+			Length: r.Length,
+		}
+		part.Size = r.Length
+	}
+	return part
+}
+
+// newKey returns the key of a segment, the IV is derived from the media sequence number if it's absent.
+func newKey(k *Key, sequence uint64) *extractors.Key {
+	iv := k.IV
+	if iv == nil {
+		iv = make([]byte, 16)
+		binary.BigEndian.PutUint64(iv[8:], sequence)
+	}
+	return &extractors.Key{
+		Method: k.Method,
+		URI:    k.URI,
+		IV:     iv,
+	}
+}
+
+// segmentExt returns the file extension of the segment URI if it's a known media extension.
+func segmentExt(uri, fallback string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fallback
+	}
+	switch ext := strings.TrimPrefix(path.Ext(u.Path), "."); ext {
+	case "ts", "aac", "mp4", "m4s", "m4a", "m4v":
+		return ext
+	}
+	return fallback
+}
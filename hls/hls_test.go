@@ -0,0 +1,164 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hydrz/lux/request"
+)
+
+func TestStreams(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "lux" {
+			http.Error(w, "the playlists are requested by another client", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/master.m3u8":
+			// the second variant is an absolute URL, the first one is listed twice,
+			// the HEVC variant has the same resolution and bandwidth as the second one
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=640x360\n360p/index.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS=\"avc1.640028,mp4a.40.2\"\n%s/1080p/index.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=640x360\n360p/index.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS=\"hvc1.1.6.L120.90,mp4a.40.2\"\n1080p-hevc/index.m3u8\n", server.URL)
+		case "/360p/index.m3u8", "/1080p/index.m3u8", "/1080p-hevc/index.m3u8":
+			fmt.Fprint(w, mediaPlaylist)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := request.NewClient(request.Options{RetryTimes: 1, UserAgent: "lux"})
+	streams, err := Streams(client, server.URL+"/master.m3u8", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 3 {
+		t.Fatalf("got %d streams, want 3", len(streams))
+	}
+	if hevc := streams["1080p-5000k-hvc1"]; hevc == nil || hevc.Playlist != server.URL+"/1080p-hevc/index.m3u8" {
+		t.Errorf("the HEVC variant isn't kept: %v", streams)
+	}
+	hd, ok := streams["1080p-5000k"]
+	if !ok {
+		t.Fatalf("stream 1080p-5000k not found in %v", streams)
+	}
+	if hd.Quality != "1920x1080 5000 kbps avc1.640028,mp4a.40.2" {
+		t.Errorf("Quality = %q", hd.Quality)
+	}
+	if len(hd.Parts) != 3 || hd.Parts[0].Ext != "ts" {
+		t.Errorf("unexpected parts %+v", hd.Parts)
+	}
+	if hd.Size <= streams["360p-1280k"].Size {
+		t.Errorf("the size of 1080p should be estimated larger than 360p")
+	}
+
+	media, err := Streams(client, server.URL+"/360p/index.m3u8", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := media["default"]; !ok || len(media) != 1 {
+		t.Errorf("a media playlist should produce a single default stream, got %v", media)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := StreamsContext(ctx, client, server.URL+"/master.m3u8", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("StreamsContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestStreamsAudio(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/master.m3u8":
+			// both variants use the audio of the default rendition
+			fmt.Fprint(w, "#EXTM3U\n"+
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"English\",LANGUAGE=\"en\",URI=\"audio/en.m3u8\"\n"+
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"Deutsch\",LANGUAGE=\"de\",DEFAULT=YES,URI=\"audio/de.m3u8\"\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=640x360,AUDIO=\"aac\"\n360p/index.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,AUDIO=\"aac\"\n1080p/index.m3u8\n")
+		case "/360p/index.m3u8", "/1080p/index.m3u8", "/audio/de.m3u8":
+			fmt.Fprint(w, mediaPlaylist)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := request.NewClient(request.Options{RetryTimes: 1})
+	streams, err := Streams(client, server.URL+"/master.m3u8", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the audio playlist is fetched once
+	if n := requests.Load(); n != 4 {
+		t.Errorf("got %d requests, want 4", n)
+	}
+	hd := streams["1080p-5000k"]
+	if hd == nil {
+		t.Fatalf("stream 1080p-5000k not found in %v", streams)
+	}
+	if !hd.NeedMux || hd.Ext != "mp4" || hd.Quality != "1920x1080 5000 kbps + Deutsch" || hd.AudioPlaylist != server.URL+"/audio/de.m3u8" {
+		t.Errorf("unexpected stream %+v", hd)
+	}
+	if len(hd.Parts) != 6 || hd.Parts[0].Track != "video" || hd.Parts[5].Track != "audio" ||
+		hd.Parts[5].URL != server.URL+"/audio/seg9.ts" {
+		t.Errorf("unexpected parts %+v", hd.Parts)
+	}
+}
+
+func TestLive(t *testing.T) {
+	var (
+		sequence int
+		ended    bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a sliding window of 3 segments
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXT-X-MAP:URI=\"init.mp4\"\n", sequence)
+		for i := sequence; i < sequence+3; i++ {
+			fmt.Fprintf(w, "#EXTINF:4,\n%d.m4s\n", i)
+		}
+		if ended {
+			fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+		}
+	}))
+	defer server.Close()
+
+	live := NewLive(nil, server.URL+"/live.m3u8", map[string]string{"Origin": "https://example.com"})
+	parts, end, err := live.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end || len(parts) != 4 || parts[0].URL != server.URL+"/init.mp4" || parts[3].URL != server.URL+"/2.m4s" {
+		t.Fatalf("unexpected first refresh %+v", parts)
+	}
+	if live.TargetDuration != 4 || parts[1].Headers["Origin"] != "https://example.com" {
+		t.Errorf("unexpected target duration %v or headers %v", live.TargetDuration, parts[1].Headers)
+	}
+
+	parts, _, err = live.Refresh(context.Background())
+	if err != nil || len(parts) != 0 {
+		t.Fatalf("no new segments expected, got %+v, %v", parts, err)
+	}
+
+	// the initialization section isn't repeated
+	sequence = 2
+	ended = true
+	parts, end, err = live.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !end || len(parts) != 2 || parts[0].URL != server.URL+"/3.m4s" || parts[1].URL != server.URL+"/4.m4s" {
+		t.Errorf("unexpected last refresh %+v", parts)
+	}
+}
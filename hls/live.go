@@ -0,0 +1,66 @@
+package hls
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hydrz/lux/extractors"
+	"github.com/hydrz/lux/request"
+)
+
+// Live follows a live media playlist and returns the segments as they are added.
+type Live struct {
+	client  *request.Client
+	uri     string
+	headers map[string]string
+
+	// the media sequence number of the next segment
+	next    uint64
+	started bool
+	lastMap string
+
+	// TargetDuration is the maximum segment duration of the last loaded playlist in seconds
+	TargetDuration float64
+}
+
+// NewLive returns a Live that follows the media playlist of the given URL,
+// the variant with the highest bandwidth is followed if it is a master playlist.
+func NewLive(client *request.Client, uri string, headers map[string]string) *Live {
+	return &Live{
+		client:  client,
+		uri:     uri,
+		headers: headers,
+	}
+}
+
+// Refresh reloads the playlist and returns the parts of the segments added since the last refresh,
+// ended reports whether the playlist has ended, see EXT-X-ENDLIST. The requests are canceled with ctx.
+func (l *Live) Refresh(ctx context.Context) (parts []*extractors.Part, ended bool, err error) {
+	p, err := LoadMediaContext(ctx, l.client, l.uri, l.headers)
+	if err != nil {
+		return nil, false, err
+	}
+	l.TargetDuration = p.TargetDuration
+	if len(p.Segments) == 0 {
+		return nil, p.EndList, nil
+	}
+
+	first, last := p.Segments[0].Sequence, p.Segments[len(p.Segments)-1].Sequence
+	if l.started && last+1 < l.next {
+		// the media sequence starts over, eg: the stream was restarted
+		l.next = first
+	}
+	if l.started && first > l.next {
+		slog.Warn("Segments of the live stream were removed before they were downloaded", "url", l.uri, "missed", first-l.next)
+	}
+	parts, l.lastMap = p.partsFrom(l.next, l.lastMap)
+	l.next = last + 1
+	l.started = true
+
+	if len(l.headers) > 0 {
+		for _, part := range parts {
+			part.Headers = l.headers
+		}
+	}
+	return parts, p.EndList, nil
+}
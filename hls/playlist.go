@@ -0,0 +1,343 @@
+package hls
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ByteRange is a sub-range of a resource, see EXT-X-BYTERANGE.
+type ByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// Key describes how the media segments are encrypted, see EXT-X-KEY.
+type Key struct {
+	// eg: AES-128, SAMPLE-AES
+	Method string
+	URI    string
+	// IV is nil when the playlist doesn't specify one,
+	// the media sequence number is used as the IV in that case.
+	IV        []byte
+	KeyFormat string
+}
+
+// Map is the media initialization section of the following segments, see EXT-X-MAP.
+type Map struct {
+	URI       string
+	ByteRange *ByteRange
+}
+
+// Segment is a single media segment of a media playlist.
+type Segment struct {
+	URI      string
+	Duration float64
+	Title    string
+	// Sequence is the media sequence number of this segment
+	Sequence      uint64
+	ByteRange     *ByteRange
+	Key           *Key
+	Map           *Map
+	Discontinuity bool
+}
+
+// MediaPlaylist is a playlist that contains a list of media segments.
+type MediaPlaylist struct {
+	Version        int
+	TargetDuration float64
+	MediaSequence  uint64
+	// eg: VOD, EVENT
+	PlaylistType string
+	// EndList indicates that no more segments will be added to the playlist
+	EndList  bool
+	Segments []*Segment
+}
+
+// Duration returns the total duration of all segments in seconds.
+func (p *MediaPlaylist) Duration() float64 {
+	var duration float64
+	for _, s := range p.Segments {
+		duration += s.Duration
+	}
+	return duration
+}
+
+// Variant is a variant stream of a master playlist, see EXT-X-STREAM-INF.
+type Variant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	Width            int
+	Height           int
+	FrameRate        float64
+	// group IDs of the renditions
+	Audio     string
+	Video     string
+	Subtitles string
+}
+
+// Rendition is an alternative rendition of a master playlist, see EXT-X-MEDIA.
+type Rendition struct {
+	// eg: AUDIO, VIDEO, SUBTITLES, CLOSED-CAPTIONS
+	Type       string
+	GroupID    string
+	Name       string
+	Language   string
+	URI        string
+	Default    bool
+	AutoSelect bool
+	Channels   string
+}
+
+// MasterPlaylist is a playlist that lists the variant streams of a presentation.
+type MasterPlaylist struct {
+	Version    int
+	Variants   []*Variant
+	Renditions []*Rendition
+}
+
+// Parse parses an m3u8 document, relative URIs are resolved against baseURL.
+// Exactly one of the returned playlists is non-nil when err is nil.
+func Parse(content, baseURL string) (*MasterPlaylist, *MediaPlaylist, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(strings.TrimSpace(content), "#EXTM3U") {
+		return nil, nil, errors.New("invalid m3u8 playlist: missing #EXTM3U header")
+	}
+	if strings.Contains(content, "#EXT-X-STREAM-INF") {
+		master, err := parseMaster(content, base)
+		return master, nil, err
+	}
+	media, err := parseMedia(content, base)
+	return nil, media, err
+}
+
+func parseMaster(content string, base *url.URL) (*MasterPlaylist, error) {
+	p := new(MasterPlaylist)
+	var variant *Variant
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-VERSION:"):
+			p.Version, _ = strconv.Atoi(tagValue(line))
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseAttributes(tagValue(line))
+			variant = &Variant{
+				Codecs:    attrs["CODECS"],
+				Audio:     attrs["AUDIO"],
+				Video:     attrs["VIDEO"],
+				Subtitles: attrs["SUBTITLES"],
+			}
+			variant.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			variant.AverageBandwidth, _ = strconv.ParseInt(attrs["AVERAGE-BANDWIDTH"], 10, 64)
+			variant.FrameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+			if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				variant.Width, _ = strconv.Atoi(w)
+				variant.Height, _ = strconv.Atoi(h)
+			}
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parseAttributes(tagValue(line))
+			rendition := &Rendition{
+				Type:       attrs["TYPE"],
+				GroupID:    attrs["GROUP-ID"],
+				Name:       attrs["NAME"],
+				Language:   attrs["LANGUAGE"],
+				Default:    attrs["DEFAULT"] == "YES",
+				AutoSelect: attrs["AUTOSELECT"] == "YES",
+				Channels:   attrs["CHANNELS"],
+			}
+			if attrs["URI"] != "" {
+				rendition.URI = resolve(base, attrs["URI"])
+			}
+			p.Renditions = append(p.Renditions, rendition)
+		case strings.HasPrefix(line, "#"):
+			// comments and tags we don't care about, eg: #EXT-X-I-FRAME-STREAM-INF
+		default:
+			if variant == nil {
+				continue
+			}
+			variant.URI = resolve(base, line)
+			p.Variants = append(p.Variants, variant)
+			variant = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(p.Variants) == 0 {
+		return nil, errors.New("invalid m3u8 playlist: no variant streams")
+	}
+	return p, nil
+}
+
+func parseMedia(content string, base *url.URL) (*MediaPlaylist, error) {
+	p := new(MediaPlaylist)
+	var (
+		segment       = new(Segment)
+		key           *Key
+		initSection   *Map
+		discontinuity bool
+		// the end of the last sub-range of each resource, used when EXT-X-BYTERANGE has no offset
+		rangeEnds = map[string]int64{}
+		sequence  uint64
+		sequenced bool
+	)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-VERSION:"):
+			p.Version, _ = strconv.Atoi(tagValue(line))
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			p.TargetDuration, _ = strconv.ParseFloat(tagValue(line), 64)
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			p.MediaSequence, _ = strconv.ParseUint(tagValue(line), 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE:"):
+			p.PlaylistType = tagValue(line)
+		case line == "#EXT-X-ENDLIST":
+			p.EndList = true
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration, title, _ := strings.Cut(tagValue(line), ",")
+			segment.Duration, _ = strconv.ParseFloat(strings.TrimSpace(duration), 64)
+			segment.Title = strings.TrimSpace(title)
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			r, err := parseByteRange(tagValue(line))
+			if err != nil {
+				return nil, err
+			}
+			segment.ByteRange = r
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseAttributes(tagValue(line))
+			if attrs["METHOD"] == "" || attrs["METHOD"] == "NONE" {
+				key = nil
+				continue
+			}
+			key = &Key{
+				Method:    attrs["METHOD"],
+				KeyFormat: attrs["KEYFORMAT"],
+			}
+			if attrs["URI"] != "" {
+				key.URI = resolve(base, attrs["URI"])
+			}
+			if iv := attrs["IV"]; iv != "" {
+				b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+				if err != nil {
+					return nil, errors.Errorf("invalid m3u8 playlist: bad IV %s", iv)
+				}
+				key.IV = b
+			}
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			attrs := parseAttributes(tagValue(line))
+			initSection = &Map{URI: resolve(base, attrs["URI"])}
+			if attrs["BYTERANGE"] != "" {
+				r, err := parseByteRange(attrs["BYTERANGE"])
+				if err != nil {
+					return nil, err
+				}
+				if r.Offset < 0 {
+					r.Offset = 0
+				}
+				initSection.ByteRange = r
+			}
+		case strings.HasPrefix(line, "#"):
+			// comments and tags we don't care about, eg: #EXT-X-PROGRAM-DATE-TIME
+		default:
+			if !sequenced {
+				sequence = p.MediaSequence
+				sequenced = true
+			}
+			segment.URI = resolve(base, line)
+			segment.Sequence = sequence
+			segment.Key = key
+			segment.Map = initSection
+			segment.Discontinuity = discontinuity
+			if r := segment.ByteRange; r != nil {
+				if r.Offset < 0 {
+					r.Offset = rangeEnds[segment.URI]
+				}
+				rangeEnds[segment.URI] = r.Offset + r.Length
+			}
+			p.Segments = append(p.Segments, segment)
+			segment = new(Segment)
+			discontinuity = false
+			sequence++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p, nil
+}
+
+// parseByteRange parses `<n>[@<o>]`, the offset is -1 if it is absent.
+func parseByteRange(s string) (*ByteRange, error) {
+	length, offset, hasOffset := strings.Cut(s, "@")
+	r := &ByteRange{Offset: -1}
+	var err error
+	if r.Length, err = strconv.ParseInt(length, 10, 64); err != nil {
+		return nil, errors.Errorf("invalid m3u8 playlist: bad byte range %s", s)
+	}
+	if hasOffset {
+		if r.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+			return nil, errors.Errorf("invalid m3u8 playlist: bad byte range %s", s)
+		}
+	}
+	return r, nil
+}
+
+// tagValue returns the part after the colon of a tag line.
+func tagValue(line string) string {
+	_, value, _ := strings.Cut(line, ":")
+	return strings.TrimSpace(value)
+}
+
+// parseAttributes parses an attribute list like `BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"`.
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		name = strings.TrimSpace(name)
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[name] = strings.TrimSpace(value)
+		s = rest
+	}
+	return attrs
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
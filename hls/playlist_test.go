@@ -0,0 +1,182 @@
+package hls
+
+import (
+	"reflect"
+	"testing"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AVERAGE-BANDWIDTH=1000000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2",FRAME-RATE=29.970,AUDIO="aac"
+360p/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,URI="iframe.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2",AUDIO="aac"
+https://cdn.example.com/1080p/index.m3u8
+`
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXTINF:9.009,first
+seg7.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:9.009,
+seg8.ts
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-DISCONTINUITY
+#EXTINF:3.003,
+seg9.ts
+#EXT-X-ENDLIST
+`
+
+func TestParseMaster(t *testing.T) {
+	master, media, err := Parse(masterPlaylist, "https://example.com/video/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media != nil {
+		t.Fatal("expected a master playlist")
+	}
+	want := []*Variant{
+		{
+			URI:              "https://example.com/video/360p/index.m3u8",
+			Bandwidth:        1280000,
+			AverageBandwidth: 1000000,
+			Codecs:           "avc1.4d401e,mp4a.40.2",
+			Width:            640,
+			Height:           360,
+			FrameRate:        29.97,
+			Audio:            "aac",
+		},
+		{
+			URI:       "https://cdn.example.com/1080p/index.m3u8",
+			Bandwidth: 5000000,
+			Codecs:    "avc1.640028,mp4a.40.2",
+			Width:     1920,
+			Height:    1080,
+			Audio:     "aac",
+		},
+	}
+	if !reflect.DeepEqual(master.Variants, want) {
+		t.Errorf("Variants = %+v, want %+v", master.Variants, want)
+	}
+	if len(master.Renditions) != 1 || master.Renditions[0].URI != "https://example.com/video/audio/en.m3u8" ||
+		!master.Renditions[0].Default || master.Renditions[0].Language != "en" {
+		t.Errorf("Renditions = %+v", master.Renditions)
+	}
+	if v := master.SortedVariants()[0]; v.Height != 1080 || v.ID() != "1080p-5000k" {
+		t.Errorf("SortedVariants()[0] = %+v", v)
+	}
+}
+
+func TestParseMedia(t *testing.T) {
+	master, media, err := Parse(mediaPlaylist, "https://example.com/video/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master != nil {
+		t.Fatal("expected a media playlist")
+	}
+	if !media.EndList || media.TargetDuration != 10 || media.MediaSequence != 7 {
+		t.Errorf("unexpected playlist header %+v", media)
+	}
+	if len(media.Segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(media.Segments))
+	}
+	first, second, third := media.Segments[0], media.Segments[1], media.Segments[2]
+	if first.URI != "https://example.com/video/seg7.ts" || first.Title != "first" || first.Sequence != 7 || first.Key != nil {
+		t.Errorf("unexpected first segment %+v", first)
+	}
+	if second.Key == nil || second.Key.Method != "AES-128" || second.Key.URI != "https://example.com/video/key.bin" ||
+		len(second.Key.IV) != 16 || second.Key.IV[15] != 0x0f {
+		t.Errorf("unexpected key %+v", second.Key)
+	}
+	if third.Key != nil || !third.Discontinuity || third.Sequence != 9 {
+		t.Errorf("unexpected third segment %+v", third)
+	}
+	if d := media.Duration(); d < 21.02 || d > 21.03 {
+		t.Errorf("Duration() = %f", d)
+	}
+
+	parts := media.Parts()
+	if parts[0].Key != nil || parts[2].Key != nil {
+		t.Errorf("unencrypted segments shouldn't have a key")
+	}
+	if k := parts[1].Key; k == nil || k.Method != "AES-128" || k.IV[15] != 0x0f {
+		t.Errorf("unexpected part key %+v", k)
+	}
+}
+
+func TestPartsDeriveIV(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:258
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:4,
+seg.ts
+`
+	_, media, err := Parse(content, "https://example.com/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2}
+	if iv := media.Parts()[0].Key.IV; !reflect.DeepEqual(iv, want) {
+		t.Errorf("IV = %x, want %x", iv, want)
+	}
+}
+
+func TestParseByteRangeAndMap(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="main.mp4",BYTERANGE="720@0"
+#EXTINF:4,
+#EXT-X-BYTERANGE:1000@720
+main.mp4
+#EXTINF:4,
+#EXT-X-BYTERANGE:2000
+main.mp4
+`
+	_, media, err := Parse(content, "https://example.com/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.EndList {
+		t.Error("a playlist without EXT-X-ENDLIST should be live")
+	}
+	if m := media.Segments[0].Map; m == nil || m.URI != "https://example.com/main.mp4" || *m.ByteRange != (ByteRange{Length: 720}) {
+		t.Errorf("unexpected map %+v", m)
+	}
+	if r := media.Segments[1].ByteRange; *r != (ByteRange{Length: 2000, Offset: 1720}) {
+		t.Errorf("unexpected byte range %+v", r)
+	}
+
+	parts := media.Parts()
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+	if parts[0].Ext != "mp4" || parts[0].Track == "" || parts[0].Size != 720 {
+		t.Errorf("unexpected initialization part %+v", parts[0])
+	}
+	if parts[2].Range.Offset != 1720 || parts[2].Track != parts[0].Track {
+		t.Errorf("unexpected segment part %+v", parts[2])
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, _, err := Parse("<html></html>", "https://example.com/index.m3u8"); err == nil {
+		t.Error("expected an error for a non-m3u8 document")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401e,mp4a.40.2",NAME="a=b"`)
+	want := map[string]string{
+		"BANDWIDTH": "1280000",
+		"CODECS":    "avc1.4d401e,mp4a.40.2",
+		"NAME":      "a=b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAttributes() = %v, want %v", got, want)
+	}
+}
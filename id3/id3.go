@@ -0,0 +1,243 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+const headerSize = 10
+
+// the flags of the tag header
+const (
+	flagUnsynchronisation = 0x80
+	flagExtendedHeader    = 0x40
+	flagFooter            = 0x10
+)
+
+// pictureFrontCover is the picture type of the front cover in APIC frames
+const pictureFrontCover = 3
+
+// encodingUTF16 is the text encoding of UTF-16 strings with a BOM
+const encodingUTF16 = 1
+
+// EmbedCover sets the front cover of an MP3 file, the image must be a JPEG or PNG file.
+// The other frames of an existing ID3v2.3 or ID3v2.4 tag are kept, a new ID3v2.3 tag is added if there is none.
+func EmbedCover(path string, image []byte) error {
+	mime := http.DetectContentType(image)
+	if mime != "image/jpeg" && mime != "image/png" {
+		return errors.New("the cover must be a JPEG or PNG image")
+	}
+	apic := append([]byte{0}, mime...)
+	apic = append(apic, 0, pictureFrontCover, 0)
+	apic = append(apic, image...)
+	return setFrames(path, func(byte) map[string][]byte {
+		return map[string][]byte{"APIC": apic}
+	})
+}
+
+// Metadata are the text metadata of a file, the empty fields are left as is.
+type Metadata struct {
+	Title  string
+	Artist string
+	// Date is formatted as 2006-01-02
+	Date    string
+	Comment string
+	// URL is the web page of the audio
+	URL string
+}
+
+// EmbedMetadata sets the text frames of the ID3 tag of an MP3 file.
+func EmbedMetadata(path string, metadata Metadata) error {
+	return setFrames(path, func(version byte) map[string][]byte {
+		frames := make(map[string][]byte)
+		if metadata.Title != "" {
+			frames["TIT2"] = text(metadata.Title)
+		}
+		if metadata.Artist != "" {
+			frames["TPE1"] = text(metadata.Artist)
+		}
+		if metadata.Date != "" {
+			if version == 4 {
+				frames["TDRC"] = text(metadata.Date)
+			} else if date, err := time.Parse("2006-01-02", metadata.Date); err == nil {
+				// ID3v2.3 has no timestamps but the year and the day
+				frames["TYER"] = text(date.Format("2006"))
+				frames["TDAT"] = text(date.Format("0201"))
+			}
+		}
+		if metadata.Comment != "" {
+			// the language is unknown and the description is empty
+			comm := append([]byte{encodingUTF16}, "und"...)
+			comm = append(comm, utf16String("")...)
+			frames["COMM"] = append(comm, utf16String(metadata.Comment)...)
+		}
+		if metadata.URL != "" {
+			frames["WOAS"] = []byte(metadata.URL)
+		}
+		return frames
+	})
+}
+
+// setFrames replaces the frames of the ID3 tag of an MP3 file with the frames of the same IDs,
+// newFrames returns the payloads of the frames by their IDs for the version of the tag.
+func setFrames(path string, newFrames func(version byte) map[string][]byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close() // nolint
+
+	version := byte(3)
+	// tagSize is the size of the existing tag, the audio data starts after it
+	var tagSize int64
+	var tag []byte
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return errors.WithStack(err)
+	}
+	if n == headerSize && string(header[:3]) == "ID3" {
+		version = header[3]
+		if version != 3 && version != 4 {
+			return errors.Errorf("unsupported ID3v2.%d tag", version)
+		}
+		flags := header[5]
+		if flags&flagUnsynchronisation != 0 {
+			return errors.New("unsynchronised ID3 tags are not supported")
+		}
+		size := synchsafe(header[6:])
+		tag = make([]byte, size)
+		if _, err = io.ReadFull(file, tag); err != nil {
+			return errors.Wrap(err, "truncated ID3 tag")
+		}
+		tagSize = headerSize + int64(size)
+		if flags&flagFooter != 0 {
+			tagSize += headerSize
+		}
+		if flags&flagExtendedHeader != 0 {
+			if tag, err = skipExtendedHeader(tag, version); err != nil {
+				return err
+			}
+		}
+	}
+
+	payloads := newFrames(version)
+	if len(payloads) == 0 {
+		return nil
+	}
+	frames, err := removeFrames(tag, version, payloads)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(payloads))
+	for id := range payloads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		frames = append(frames, frame(id, version, payloads[id])...)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.id3")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(temp.Name()) // nolint
+	tagHeader := []byte{'I', 'D', '3', version, 0, 0}
+	tagHeader = append(tagHeader, toSynchsafe(uint32(len(frames)))...)
+	_, err = temp.Write(append(tagHeader, frames...))
+	if err == nil {
+		if _, err = file.Seek(tagSize, io.SeekStart); err == nil {
+			_, err = io.Copy(temp, file)
+		}
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file.Close() // nolint
+	return errors.WithStack(os.Rename(temp.Name(), path))
+}
+
+// skipExtendedHeader returns the frames after the extended header of the tag.
+func skipExtendedHeader(tag []byte, version byte) ([]byte, error) {
+	if len(tag) < 4 {
+		return nil, errors.New("truncated ID3 extended header")
+	}
+	// the size of ID3v2.3 excludes itself
+	size := int(binary.BigEndian.Uint32(tag)) + 4
+	if version == 4 {
+		size = int(synchsafe(tag))
+	}
+	if size < 4 || size > len(tag) {
+		return nil, errors.Errorf("invalid ID3 extended header size %d", size)
+	}
+	return tag[size:], nil
+}
+
+// removeFrames returns the frames of the tag without the frames of the given IDs, the padding is dropped.
+func removeFrames(tag []byte, version byte, ids map[string][]byte) ([]byte, error) {
+	var frames []byte
+	for len(tag) >= headerSize && tag[0] != 0 {
+		size := binary.BigEndian.Uint32(tag[4:])
+		if version == 4 {
+			size = synchsafe(tag[4:])
+		}
+		end := headerSize + int(size)
+		if end > len(tag) {
+			return nil, errors.Errorf("invalid size %d of the ID3 frame %s", size, tag[:4])
+		}
+		if _, ok := ids[string(tag[:4])]; !ok {
+			frames = append(frames, tag[:end]...)
+		}
+		tag = tag[end:]
+	}
+	return frames, nil
+}
+
+// frame returns an ID3 frame without flags.
+func frame(id string, version byte, payload []byte) []byte {
+	b := bytes.NewBufferString(id)
+	if version == 4 {
+		b.Write(toSynchsafe(uint32(len(payload))))
+	} else {
+		binary.Write(b, binary.BigEndian, uint32(len(payload))) // nolint
+	}
+	b.Write([]byte{0, 0})
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// text returns the payload of a text frame.
+func text(s string) []byte {
+	return append([]byte{encodingUTF16}, utf16String(s)...)
+}
+
+// utf16String encodes a terminated UTF-16 string with a BOM, which is supported by both ID3v2.3 and ID3v2.4.
+func utf16String(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return append(b, 0, 0)
+}
+
+// synchsafe decodes a 28 bits integer stored in 4 bytes of 7 bits.
+func synchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func toSynchsafe(v uint32) []byte {
+	return []byte{byte(v>>21) & 0x7f, byte(v>>14) & 0x7f, byte(v>>7) & 0x7f, byte(v) & 0x7f}
+}
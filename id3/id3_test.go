@@ -0,0 +1,108 @@
+package id3
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+// audio is an MPEG frame header followed by some data
+var audio = []byte("\xff\xfb\x90\x64audio")
+
+func TestEmbedCover(t *testing.T) {
+	dir := t.TempDir()
+
+	title := frame("TIT2", 4, []byte("\x03title"))
+	oldCover := frame("APIC", 4, []byte("\x00image/jpeg\x00\x03\x00old"))
+	frames := append(append(append([]byte{}, title...), oldCover...), make([]byte, 16)...)
+	tagged := append(append([]byte{'I', 'D', '3', 4, 0, 0}, toSynchsafe(uint32(len(frames)))...), frames...)
+
+	tests := []struct {
+		name    string
+		content []byte
+		version byte
+		frames  []byte
+	}{
+		{"untagged", audio, 3, nil},
+		// the old cover and the padding are removed
+		{"tagged", append(tagged, audio...), 4, title},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".mp3")
+		if err := os.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := EmbedCover(path, testPNG); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apic := frame("APIC", tt.version, append([]byte("\x00image/png\x00\x03\x00"), testPNG...))
+		want := append(append([]byte{}, tt.frames...), apic...)
+		want = append(append([]byte{'I', 'D', '3', tt.version, 0, 0}, toSynchsafe(uint32(len(want)))...), want...)
+		want = append(want, audio...)
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: got %q, want %q", tt.name, data, want)
+		}
+	}
+
+	path := filepath.Join(dir, "unsupported.mp3")
+	if err := os.WriteFile(path, append([]byte{'I', 'D', '3', 2, 0, 0, 0, 0, 0, 0}, audio...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedCover(path, testPNG); err == nil {
+		t.Error("EmbedCover should fail with an ID3v2.2 tag")
+	}
+	if err := EmbedCover(path, []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")); err == nil {
+		t.Error("EmbedCover should fail with a WebP image")
+	}
+}
+
+func TestSynchsafe(t *testing.T) {
+	for _, v := range []uint32{0, 127, 128, 1<<28 - 1} {
+		if got := synchsafe(toSynchsafe(v)); got != v {
+			t.Errorf("synchsafe(toSynchsafe(%d)) = %d", v, got)
+		}
+	}
+}
+
+func TestEmbedMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio.mp3")
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedCover(path, testPNG); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedMetadata(path, Metadata{Title: "标题", Date: "2024-01-02", Comment: "desc", URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := removeFrames(data[headerSize:len(data)-len(audio)], 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]byte{
+		frame("APIC", 3, append([]byte("\x00image/png\x00\x03\x00"), testPNG...)),
+		frame("TIT2", 3, []byte("\x01\xff\xfe\x07\x68\x98\x98\x00\x00")),
+		frame("TYER", 3, text("2024")),
+		frame("TDAT", 3, text("0201")),
+		frame("COMM", 3, append([]byte("\x01und\xff\xfe\x00\x00"), utf16String("desc")...)),
+		frame("WOAS", 3, []byte("https://example.com")),
+	} {
+		if !bytes.Contains(frames, want) {
+			t.Errorf("frame %q not found", want[:4])
+		}
+	}
+	if !bytes.HasSuffix(data, audio) {
+		t.Error("the audio data is changed")
+	}
+}
@@ -0,0 +1,103 @@
+package mp4
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// aacSampleRates are the sampling frequencies by index.
+var aacSampleRates = []uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// aacSamplesPerFrame is the number of PCM samples of an AAC frame.
+const aacSamplesPerFrame = 1024
+
+// adtsHeader is the header of an AAC frame in ADTS format.
+type adtsHeader struct {
+	objectType   byte
+	rateIndex    byte
+	channels     byte
+	headerLength int
+	frameLength  int
+}
+
+func parseADTSHeader(data []byte) (*adtsHeader, error) {
+	if len(data) < 7 || data[0] != 0xff || data[1]&0xf0 != 0xf0 {
+		return nil, errors.New("invalid ADTS header")
+	}
+	h := &adtsHeader{
+		objectType:   data[2]>>6 + 1,
+		rateIndex:    data[2] >> 2 & 0x0f,
+		channels:     data[2]&0x01<<2 | data[3]>>6,
+		headerLength: 7,
+		frameLength:  int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5),
+	}
+	// CRC is present
+	if data[1]&0x01 == 0 {
+		h.headerLength = 9
+	}
+	if int(h.rateIndex) >= len(aacSampleRates) {
+		return nil, errors.Errorf("invalid ADTS sampling frequency index %d", h.rateIndex)
+	}
+	if h.frameLength < h.headerLength {
+		return nil, errors.New("invalid ADTS frame length")
+	}
+	return h, nil
+}
+
+func (h *adtsHeader) sampleRate() uint32 {
+	return aacSampleRates[h.rateIndex]
+}
+
+// audioSpecificConfig returns the AudioSpecificConfig of the ADTS stream.
+func (h *adtsHeader) audioSpecificConfig() []byte {
+	return []byte{h.objectType<<3 | h.rateIndex>>1, h.rateIndex<<7 | h.channels<<3}
+}
+
+// mp4aEntry returns the mp4a sample entry of an AAC stream.
+func mp4aEntry(config []byte, channels uint16, sampleRate uint32) []byte {
+	return audioSampleEntry("mp4a", channels, sampleRate, esds(config))
+}
+
+// audioSampleEntry returns an audio sample entry with the codec configuration box.
+func audioSampleEntry(typ string, channels uint16, sampleRate uint32, config []byte) []byte {
+	entry := make([]byte, 6, 28)
+	entry = binary.BigEndian.AppendUint16(entry, 1) // data reference index
+	entry = append(entry, make([]byte, 8)...)
+	entry = binary.BigEndian.AppendUint16(entry, channels)
+	entry = binary.BigEndian.AppendUint16(entry, 16) // sample size
+	entry = append(entry, make([]byte, 4)...)
+	if sampleRate > 0xffff {
+		sampleRate = 0
+	}
+	entry = binary.BigEndian.AppendUint32(entry, sampleRate<<16)
+	return box(typ, entry, config)
+}
+
+// esds returns the elementary stream descriptor box of an AAC stream.
+func esds(config []byte) []byte {
+	descriptor := func(tag byte, payloads ...[]byte) []byte {
+		size := 0
+		for _, p := range payloads {
+			size += len(p)
+		}
+		d := []byte{tag, 0x80, 0x80, 0x80, byte(size)}
+		for _, p := range payloads {
+			d = append(d, p...)
+		}
+		return d
+	}
+	decoderConfig := []byte{
+		0x40,    // MPEG-4 audio
+		0x15,    // audio stream
+		0, 0, 0, // buffer size
+		0, 0, 0, 0, // max bitrate
+		0, 0, 0, 0, // average bitrate
+	}
+	es := descriptor(0x03,
+		[]byte{0, 1, 0}, // ES_ID and flags
+		descriptor(0x04, decoderConfig, descriptor(0x05, config)),
+		descriptor(0x06, []byte{0x02}),
+	)
+	return fullBox("esds", 0, 0, es)
+}
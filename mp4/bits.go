@@ -0,0 +1,125 @@
+package mp4
+
+import (
+	"github.com/pkg/errors"
+)
+
+var errShortBitstream = errors.New("unexpected end of bitstream")
+
+// bitReader reads the bits of a NAL unit payload, eg: the exp-Golomb codes of a SPS.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) bit() (uint32, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, errShortBitstream
+	}
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint32(b), nil
+}
+
+func (r *bitReader) bits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+func (r *bitReader) skip(n int) error {
+	if r.pos+n > len(r.data)*8 {
+		return errShortBitstream
+	}
+	r.pos += n
+	return nil
+}
+
+// ue reads an unsigned exp-Golomb code.
+func (r *bitReader) ue() (uint32, error) {
+	zeros := 0
+	for {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, errors.New("invalid exp-Golomb code")
+		}
+	}
+	v, err := r.bits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<zeros - 1) + v, nil
+}
+
+// se reads a signed exp-Golomb code.
+func (r *bitReader) se() (int32, error) {
+	v, err := r.ue()
+	if err != nil {
+		return 0, err
+	}
+	if v%2 == 1 {
+		return int32((v + 1) / 2), nil
+	}
+	return -int32(v / 2), nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes (0x000003) of a NAL unit.
+func unescapeRBSP(nal []byte) []byte {
+	rbsp := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+// splitAnnexB splits an Annex B byte stream into NAL units without the start codes.
+func splitAnnexB(data []byte) [][]byte {
+	var (
+		nals  [][]byte
+		start = -1
+	)
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			// the zero byte of a 4 bytes start code belongs to the next start code
+			for end > start && data[end-1] == 0 {
+				end--
+			}
+			if end > start {
+				nals = append(nals, data[start:end])
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(data) {
+		nals = append(nals, data[start:])
+	}
+	return nals
+}
@@ -0,0 +1,67 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// box returns an MP4 box of the given type with the payloads as its content.
+func box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// fullBox returns an MP4 box with the version and flags header.
+func fullBox(typ string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payloads...)...)
+}
+
+// unityMatrix is the transformation matrix of tkhd and mvhd.
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func appendMatrix(b []byte) []byte {
+	for _, v := range unityMatrix {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// appendTime appends a time field of a version 0 or 1 box, the version is 1 if the value overflows 32 bits.
+func appendTime(b []byte, version byte, v uint64) []byte {
+	if version == 1 {
+		return binary.BigEndian.AppendUint64(b, v)
+	}
+	return binary.BigEndian.AppendUint32(b, uint32(v))
+}
+
+// timeVersion returns the box version that can hold the values.
+func timeVersion(values ...uint64) byte {
+	for _, v := range values {
+		if v > math.MaxUint32 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// language packs an ISO 639-2 language code into 15 bits, eg: und
+func language(code string) uint16 {
+	if len(code) != 3 {
+		code = "und"
+	}
+	var v uint16
+	for i := 0; i < 3; i++ {
+		v = v<<5 | uint16(code[i]-0x60)&0x1f
+	}
+	return v
+}
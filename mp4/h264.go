@@ -0,0 +1,214 @@
+package mp4
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// H.264 NAL unit types
+const (
+	h264NALIDR = 5
+	h264NALSPS = 7
+	h264NALPPS = 8
+	h264NALAUD = 9
+)
+
+// h264Dimensions returns the picture size of an H.264 SPS.
+func h264Dimensions(sps []byte) (int, int, error) {
+	if len(sps) < 4 {
+		return 0, 0, errors.New("invalid H.264 SPS")
+	}
+	r := &bitReader{data: unescapeRBSP(sps[1:])}
+	profile, _ := r.bits(8)
+	// constraint flags and level
+	if err := r.skip(16); err != nil {
+		return 0, 0, err
+	}
+	if _, err := r.ue(); err != nil { // seq_parameter_set_id
+		return 0, 0, err
+	}
+
+	chromaFormat := uint32(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		var err error
+		if chromaFormat, err = r.ue(); err != nil {
+			return 0, 0, err
+		}
+		if chromaFormat == 3 {
+			if err = r.skip(1); err != nil { // separate_colour_plane_flag
+				return 0, 0, err
+			}
+		}
+		// bit depths and qpprime_y_zero_transform_bypass_flag
+		if _, err = r.ue(); err != nil {
+			return 0, 0, err
+		}
+		if _, err = r.ue(); err != nil {
+			return 0, 0, err
+		}
+		if err = r.skip(1); err != nil {
+			return 0, 0, err
+		}
+		scalingMatrix, err := r.bit()
+		if err != nil {
+			return 0, 0, err
+		}
+		if scalingMatrix == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				present, err := r.bit()
+				if err != nil {
+					return 0, 0, err
+				}
+				if present == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err = skipScalingList(r, size); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+	}
+
+	if _, err := r.ue(); err != nil { // log2_max_frame_num_minus4
+		return 0, 0, err
+	}
+	pocType, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	switch pocType {
+	case 0:
+		if _, err = r.ue(); err != nil {
+			return 0, 0, err
+		}
+	case 1:
+		if err = r.skip(1); err != nil {
+			return 0, 0, err
+		}
+		if _, err = r.se(); err != nil {
+			return 0, 0, err
+		}
+		if _, err = r.se(); err != nil {
+			return 0, 0, err
+		}
+		cycle, err := r.ue()
+		if err != nil {
+			return 0, 0, err
+		}
+		for i := uint32(0); i < cycle; i++ {
+			if _, err = r.se(); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if _, err = r.ue(); err != nil { // max_num_ref_frames
+		return 0, 0, err
+	}
+	if err = r.skip(1); err != nil { // gaps_in_frame_num_value_allowed_flag
+		return 0, 0, err
+	}
+	widthMbs, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	heightMapUnits, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	frameMbsOnly, err := r.bit()
+	if err != nil {
+		return 0, 0, err
+	}
+	if frameMbsOnly == 0 {
+		if err = r.skip(1); err != nil { // mb_adaptive_frame_field_flag
+			return 0, 0, err
+		}
+	}
+	if err = r.skip(1); err != nil { // direct_8x8_inference_flag
+		return 0, 0, err
+	}
+
+	width := int(widthMbs+1) * 16
+	height := int(2-frameMbsOnly) * int(heightMapUnits+1) * 16
+	cropping, err := r.bit()
+	if err != nil {
+		return 0, 0, err
+	}
+	if cropping == 1 {
+		var crop [4]uint32
+		for i := range crop {
+			if crop[i], err = r.ue(); err != nil {
+				return 0, 0, err
+			}
+		}
+		cropX, cropY := 1, int(2-frameMbsOnly)
+		switch chromaFormat {
+		case 1:
+			cropX, cropY = 2, 2*cropY
+		case 2:
+			cropX = 2
+		}
+		width -= cropX * int(crop[0]+crop[1])
+		height -= cropY * int(crop[2]+crop[3])
+	}
+	return width, height, nil
+}
+
+func skipScalingList(r *bitReader, size int) error {
+	last, next := int32(8), int32(8)
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			delta, err := r.se()
+			if err != nil {
+				return err
+			}
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+	return nil
+}
+
+// avc1Entry returns the avc1 sample entry of the H.264 parameter sets.
+func avc1Entry(sps, pps [][]byte, width, height int) []byte {
+	avcC := []byte{1, sps[0][1], sps[0][2], sps[0][3], 0xff, 0xe0 | byte(len(sps))}
+	for _, s := range sps {
+		avcC = binary.BigEndian.AppendUint16(avcC, uint16(len(s)))
+		avcC = append(avcC, s...)
+	}
+	avcC = append(avcC, byte(len(pps)))
+	for _, p := range pps {
+		avcC = binary.BigEndian.AppendUint16(avcC, uint16(len(p)))
+		avcC = append(avcC, p...)
+	}
+	return visualSampleEntry("avc1", width, height, box("avcC", avcC))
+}
+
+// visualSampleEntry returns a video sample entry with the codec configuration box.
+func visualSampleEntry(typ string, width, height int, config []byte) []byte {
+	entry := make([]byte, 6, 78)
+	entry = binary.BigEndian.AppendUint16(entry, 1) // data reference index
+	entry = append(entry, make([]byte, 16)...)
+	entry = binary.BigEndian.AppendUint16(entry, uint16(width))
+	entry = binary.BigEndian.AppendUint16(entry, uint16(height))
+	entry = binary.BigEndian.AppendUint32(entry, 0x00480000) // 72 dpi
+	entry = binary.BigEndian.AppendUint32(entry, 0x00480000)
+	entry = binary.BigEndian.AppendUint32(entry, 0)
+	entry = binary.BigEndian.AppendUint16(entry, 1) // frame count
+	entry = append(entry, make([]byte, 32)...)      // compressor name
+	entry = binary.BigEndian.AppendUint16(entry, 0x0018)
+	entry = binary.BigEndian.AppendUint16(entry, 0xffff)
+	return box(typ, entry, config)
+}
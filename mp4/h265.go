@@ -0,0 +1,175 @@
+package mp4
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// H.265 NAL unit types
+const (
+	h265NALVPS = 32
+	h265NALSPS = 33
+	h265NALPPS = 34
+	h265NALAUD = 35
+)
+
+// h265IsKeyFrame reports whether the NAL unit type is an IRAP picture.
+func h265IsKeyFrame(typ byte) bool {
+	return typ >= 16 && typ <= 21
+}
+
+// h265SPS is the information of an H.265 SPS needed by the hvcC box.
+type h265SPS struct {
+	// general_profile_space, general_tier_flag, general_profile_idc, compatibility and constraint flags, level
+	profileTierLevel  [12]byte
+	maxSubLayers      byte
+	temporalIDNesting byte
+	chromaFormat      uint32
+	bitDepthLuma      uint32
+	bitDepthChroma    uint32
+	width             int
+	height            int
+}
+
+func parseH265SPS(sps []byte) (*h265SPS, error) {
+	if len(sps) < 15 {
+		return nil, errors.New("invalid H.265 SPS")
+	}
+	data := unescapeRBSP(sps[2:])
+	r := &bitReader{data: data}
+	info := new(h265SPS)
+	if err := r.skip(4); err != nil { // sps_video_parameter_set_id
+		return nil, err
+	}
+	maxSubLayers, err := r.bits(3)
+	if err != nil {
+		return nil, err
+	}
+	info.maxSubLayers = byte(maxSubLayers + 1)
+	nesting, err := r.bit()
+	if err != nil {
+		return nil, err
+	}
+	info.temporalIDNesting = byte(nesting)
+	if len(data) < 13 {
+		return nil, errors.New("invalid H.265 SPS")
+	}
+	copy(info.profileTierLevel[:], data[1:13])
+	if err = r.skip(96); err != nil {
+		return nil, err
+	}
+
+	// sub layers of profile_tier_level
+	profilePresent := make([]uint32, maxSubLayers)
+	levelPresent := make([]uint32, maxSubLayers)
+	for i := range profilePresent {
+		if profilePresent[i], err = r.bit(); err != nil {
+			return nil, err
+		}
+		if levelPresent[i], err = r.bit(); err != nil {
+			return nil, err
+		}
+	}
+	if maxSubLayers > 0 {
+		if err = r.skip(2 * (8 - int(maxSubLayers))); err != nil {
+			return nil, err
+		}
+	}
+	for i := range profilePresent {
+		if profilePresent[i] == 1 {
+			if err = r.skip(88); err != nil {
+				return nil, err
+			}
+		}
+		if levelPresent[i] == 1 {
+			if err = r.skip(8); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err = r.ue(); err != nil { // sps_seq_parameter_set_id
+		return nil, err
+	}
+	if info.chromaFormat, err = r.ue(); err != nil {
+		return nil, err
+	}
+	if info.chromaFormat == 3 {
+		if err = r.skip(1); err != nil { // separate_colour_plane_flag
+			return nil, err
+		}
+	}
+	width, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	height, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	info.width, info.height = int(width), int(height)
+	conformance, err := r.bit()
+	if err != nil {
+		return nil, err
+	}
+	if conformance == 1 {
+		var window [4]uint32
+		for i := range window {
+			if window[i], err = r.ue(); err != nil {
+				return nil, err
+			}
+		}
+		subWidth, subHeight := 1, 1
+		switch info.chromaFormat {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+		info.width -= subWidth * int(window[0]+window[1])
+		info.height -= subHeight * int(window[2]+window[3])
+	}
+	if info.bitDepthLuma, err = r.ue(); err != nil {
+		return nil, err
+	}
+	if info.bitDepthChroma, err = r.ue(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// hvc1Entry returns the hvc1 sample entry of the H.265 parameter sets.
+func hvc1Entry(vps, sps, pps [][]byte) ([]byte, error) {
+	info, err := parseH265SPS(sps[0])
+	if err != nil {
+		return nil, err
+	}
+	hvcC := []byte{1}
+	hvcC = append(hvcC, info.profileTierLevel[:]...)
+	hvcC = binary.BigEndian.AppendUint16(hvcC, 0xf000) // min_spatial_segmentation_idc
+	hvcC = append(hvcC,
+		0xfc, // parallelismType
+		0xfc|byte(info.chromaFormat),
+		0xf8|byte(info.bitDepthLuma),
+		0xf8|byte(info.bitDepthChroma),
+		0, 0, // avgFrameRate
+		// constantFrameRate, numTemporalLayers, temporalIdNested and lengthSizeMinusOne
+		info.maxSubLayers<<3|info.temporalIDNesting<<2|3,
+	)
+	arrays := []struct {
+		typ  byte
+		nals [][]byte
+	}{{h265NALVPS, vps}, {h265NALSPS, sps}, {h265NALPPS, pps}}
+	hvcC = append(hvcC, byte(len(arrays)))
+	for _, a := range arrays {
+		// array_completeness is set as the parameter sets are not in the samples
+		hvcC = append(hvcC, 0x80|a.typ)
+		hvcC = binary.BigEndian.AppendUint16(hvcC, uint16(len(a.nals)))
+		for _, nal := range a.nals {
+			hvcC = binary.BigEndian.AppendUint16(hvcC, uint16(len(nal)))
+			hvcC = append(hvcC, nal...)
+		}
+	}
+	return visualSampleEntry("hvc1", info.width, info.height, box("hvcC", hvcC)), nil
+}
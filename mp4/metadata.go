@@ -0,0 +1,315 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// the data types of the metadata items
+const (
+	dataUTF8  = 1
+	coverJPEG = 13
+	coverPNG  = 14
+)
+
+// topBox is a top level box of a file.
+type topBox struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// EmbedCover sets the cover art of an MP4 file, the image must be a JPEG or PNG file.
+// The cover is stored in the covr atom of moov/udta/meta/ilst, the chunk offsets are shifted if moov comes before mdat.
+func EmbedCover(path string, image []byte) error {
+	var dataType uint32
+	switch http.DetectContentType(image) {
+	case "image/jpeg":
+		dataType = coverJPEG
+	case "image/png":
+		dataType = coverPNG
+	default:
+		return errors.New("the cover must be a JPEG or PNG image")
+	}
+	return setItems(path, [][]byte{metadataItem("covr", dataType, image)})
+}
+
+// Metadata are the text metadata of a file, the empty fields are left as is.
+type Metadata struct {
+	Title       string
+	Artist      string
+	Date        string
+	Description string
+	Comment     string
+}
+
+// EmbedMetadata sets the iTunes metadata of an MP4 file.
+func EmbedMetadata(path string, metadata Metadata) error {
+	var items [][]byte
+	for _, field := range []struct {
+		typ   string
+		value string
+	}{
+		{"\xa9nam", metadata.Title},
+		{"\xa9ART", metadata.Artist},
+		{"\xa9day", metadata.Date},
+		{"desc", metadata.Description},
+		{"\xa9cmt", metadata.Comment},
+	} {
+		if field.value != "" {
+			items = append(items, metadataItem(field.typ, dataUTF8, []byte(field.value)))
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return setItems(path, items)
+}
+
+// setItems replaces the metadata items of moov/udta/meta/ilst of an MP4 file with the given items of the same types.
+func setItems(path string, items [][]byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close() // nolint
+	boxes, err := readTopBoxes(file)
+	if err != nil {
+		return errors.WithMessagef(err, "read %s", path)
+	}
+
+	var moov *topBox
+	// shift is true if there are media data after moov
+	var shift bool
+	for i := range boxes {
+		switch boxes[i].typ {
+		case "moov":
+			moov = &boxes[i]
+		case "mdat":
+			shift = shift || moov != nil
+		case "moof":
+			if moov != nil {
+				// the track fragments may have absolute offsets
+				return errors.New("metadata can't be embedded into fragmented MP4 files")
+			}
+		}
+	}
+	if moov == nil {
+		return errors.Errorf("no moov box in %s", path)
+	}
+
+	payload := make([]byte, moov.size-8)
+	if _, err = file.ReadAt(payload, moov.offset+8); err != nil {
+		return errors.WithStack(err)
+	}
+	newMoov, err := replaceItems(payload, items)
+	if err != nil {
+		return err
+	}
+	if shift {
+		delta := int64(len(newMoov)) - moov.size
+		if err = shiftChunkOffsets(newMoov[8:], moov.offset+moov.size, delta); err != nil {
+			return err
+		}
+	}
+
+	// the file is replaced once the new one is complete
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.meta")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(temp.Name()) // nolint
+	_, err = io.Copy(temp, io.NewSectionReader(file, 0, moov.offset))
+	if err == nil {
+		_, err = temp.Write(newMoov)
+	}
+	if err == nil {
+		_, err = io.Copy(temp, io.NewSectionReader(file, moov.offset+moov.size, math.MaxInt64-moov.offset-moov.size))
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file.Close() // nolint
+	return errors.WithStack(os.Rename(temp.Name(), path))
+}
+
+// metadataItem returns an item of the ilst box with a data box of the given type.
+func metadataItem(typ string, dataType uint32, value []byte) []byte {
+	return box(typ, box("data", binary.BigEndian.AppendUint32(nil, dataType), make([]byte, 4), value))
+}
+
+// readTopBoxes returns the top level boxes of an MP4 file.
+func readTopBoxes(file *os.File) ([]topBox, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fileSize := info.Size()
+
+	var (
+		boxes  []topBox
+		offset int64
+		header [16]byte
+	)
+	for offset < fileSize {
+		if _, err = file.ReadAt(header[:8], offset); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err = file.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if offset == 0 && !topLevelBoxes[typ] {
+			return nil, errors.Wrap(ErrUnsupportedCodec, "not an MP4 file")
+		}
+		if size < headerSize || offset+size > fileSize {
+			return nil, errors.Errorf("invalid %s box size %d", typ, size)
+		}
+		if typ == "moov" && headerSize != 8 {
+			return nil, errors.New("moov box with a 64 bits size")
+		}
+		boxes = append(boxes, topBox{typ: typ, offset: offset, size: size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// replaceItems returns the moov box of the payload with the items in moov/udta/meta/ilst,
+// the other boxes and metadata items are kept.
+func replaceItems(moov []byte, newItems [][]byte) ([]byte, error) {
+	replaced := make(map[string]bool, len(newItems))
+	for _, item := range newItems {
+		replaced[string(item[4:8])] = true
+	}
+
+	var children [][]byte
+	var udta []byte
+	err := forEachBox(moov, func(typ string, payload []byte) error {
+		if typ == "udta" {
+			udta = payload
+			return nil
+		}
+		children = append(children, box(typ, payload))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var udtaChildren [][]byte
+	var meta []byte
+	if err = forEachBox(udta, func(typ string, payload []byte) error {
+		if typ == "meta" {
+			meta = payload
+			return nil
+		}
+		udtaChildren = append(udtaChildren, box(typ, payload))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// the meta of QuickTime files isn't a full box
+	metaHeader := []byte{0, 0, 0, 0}
+	if len(meta) >= 8 && string(meta[4:8]) == "hdlr" {
+		metaHeader = nil
+	} else if len(meta) >= 4 {
+		meta = meta[4:]
+	}
+	var metaChildren [][]byte
+	var ilst []byte
+	if err = forEachBox(meta, func(typ string, payload []byte) error {
+		if typ == "ilst" {
+			ilst = payload
+			return nil
+		}
+		metaChildren = append(metaChildren, box(typ, payload))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(metaChildren) == 0 {
+		// the handler of the iTunes metadata
+		metaChildren = append(metaChildren, fullBox("hdlr", 0, 0, make([]byte, 4), []byte("mdirappl"), make([]byte, 9)))
+	}
+
+	var items [][]byte
+	if err = forEachBox(ilst, func(typ string, payload []byte) error {
+		if !replaced[typ] {
+			items = append(items, box(typ, payload))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	items = append(items, newItems...)
+
+	metaChildren = append(metaChildren, box("ilst", items...))
+	udtaChildren = append(udtaChildren, box("meta", append([][]byte{metaHeader}, metaChildren...)...))
+	children = append(children, box("udta", udtaChildren...))
+	return box("moov", children...), nil
+}
+
+// shiftChunkOffsets adds delta to the chunk offsets in the stco and co64 boxes of the moov payload
+// which point at or after the end of the original moov box.
+func shiftChunkOffsets(moov []byte, end, delta int64) error {
+	var walk func(data []byte) error
+	walk = func(data []byte) error {
+		return forEachBox(data, func(typ string, payload []byte) error {
+			switch typ {
+			case "trak", "mdia", "minf", "stbl":
+				return walk(payload)
+			case "stco", "co64":
+				if len(payload) < 8 {
+					return errors.Errorf("invalid %s box", typ)
+				}
+				count := int(binary.BigEndian.Uint32(payload[4:]))
+				entries := payload[8:]
+				size := 4
+				if typ == "co64" {
+					size = 8
+				}
+				if len(entries) < count*size {
+					return errors.Errorf("truncated %s box", typ)
+				}
+				for i := 0; i < count; i++ {
+					entry := entries[i*size:]
+					if size == 8 {
+						if offset := int64(binary.BigEndian.Uint64(entry)); offset >= end {
+							binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+						}
+						continue
+					}
+					offset := int64(binary.BigEndian.Uint32(entry))
+					if offset < end {
+						continue
+					}
+					if offset+delta > math.MaxUint32 {
+						return errors.New("the chunk offsets overflow 32 bits")
+					}
+					binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+				}
+			}
+			return nil
+		})
+	}
+	return walk(moov)
+}
@@ -0,0 +1,115 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testJPEG = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+
+func TestEmbedCover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	writeTestVideo(t, path)
+
+	if err := EmbedCover(path, []byte("GIF89a")); err == nil {
+		t.Fatal("EmbedCover should fail with a GIF image")
+	}
+	// the cover is replaced if it's embedded twice
+	for i := 0; i < 2; i++ {
+		if err := EmbedCover(path, testJPEG); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := findBox(data, "moov", "udta", "meta")
+	if meta == nil {
+		t.Fatal("meta box not found")
+	}
+	if hdlr := findBox(meta[4:], "hdlr"); hdlr == nil || string(hdlr[8:12]) != "mdir" {
+		t.Errorf("unexpected meta handler %x", hdlr)
+	}
+	covers := findBoxes(findBox(meta[4:], "ilst"), "covr")
+	if len(covers) != 1 {
+		t.Fatalf("got %d covers, want 1", len(covers))
+	}
+	cover := findBox(covers[0], "data")
+	if binary.BigEndian.Uint32(cover) != coverJPEG || !bytes.Equal(cover[8:], testJPEG) {
+		t.Errorf("unexpected cover %x", cover)
+	}
+
+	in, err := openInput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close() // nolint
+	if len(in.tracks) != 1 || len(in.tracks[0].samples) != 10 {
+		t.Fatalf("unexpected tracks %+v", in.tracks)
+	}
+}
+
+func TestEmbedCoverShiftOffsets(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2"))
+	moov := func(offset uint32) []byte {
+		stco := fullBox("stco", 0, 0, u32(1, offset))
+		return box("moov", box("trak", box("mdia", box("minf", box("stbl", stco)))))
+	}
+	samples := []byte("sample data")
+	offset := uint32(len(ftyp) + len(moov(0)) + 8)
+	file := append(append(append([]byte{}, ftyp...), moov(offset)...), box("mdat", samples)...)
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedCover(path, testJPEG); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stco := findBox(data, "moov", "trak", "mdia", "minf", "stbl", "stco")
+	offset = binary.BigEndian.Uint32(stco[8:])
+	if int(offset) > len(data) || !bytes.HasPrefix(data[offset:], samples) {
+		t.Errorf("the chunk offset %d doesn't point at the samples", offset)
+	}
+}
+
+func TestEmbedMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	writeTestVideo(t, path)
+	if err := EmbedCover(path, testJPEG); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedMetadata(path, Metadata{Title: "old", Artist: "artist"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedMetadata(path, Metadata{Title: "标题", Date: "2024-01-02"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ilst := findBox(findBox(data, "moov", "udta", "meta")[4:], "ilst")
+	// the other items are kept
+	for typ, want := range map[string]string{"\xa9nam": "标题", "\xa9ART": "artist", "\xa9day": "2024-01-02", "covr": string(testJPEG)} {
+		items := findBoxes(ilst, typ)
+		if len(items) != 1 {
+			t.Errorf("got %d %q items, want 1", len(items), typ)
+			continue
+		}
+		if value := findBox(items[0], "data")[8:]; string(value) != want {
+			t.Errorf("%q = %q, want %q", typ, value, want)
+		}
+	}
+	if findBoxes(ilst, "desc") != nil {
+		t.Error("the empty fields should be skipped")
+	}
+}
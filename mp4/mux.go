@@ -0,0 +1,138 @@
+package mp4
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// muxInterleave is the duration of the samples of a track written in a row, in seconds.
+const muxInterleave = 0.5
+
+// muxTrack is an input track being copied to the output.
+type muxTrack struct {
+	in    *inputFile
+	src   *inputTrack
+	index int
+	// shift is added to the input timestamps, it aligns the start of the presentations at the edit list delays
+	shift int64
+	next  int
+}
+
+// time returns the decoding time of the next sample in seconds.
+func (t *muxTrack) time() float64 {
+	return float64(t.src.samples[t.next].dts+t.shift) / float64(t.src.timescale)
+}
+
+// Mux combines the video and audio tracks of MP4 files, eg: the separate video and audio of a DASH stream,
+// into an MP4 file without re-encoding. The inputs may be progressive or fragmented MP4 files,
+// ErrUnsupportedCodec is returned for other containers and for encrypted tracks.
+func Mux(paths []string, output string) error {
+	var inputs []*inputFile
+	defer func() {
+		for _, in := range inputs {
+			in.Close() // nolint
+		}
+	}()
+	for _, path := range paths {
+		in, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, in)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = mux(inputs, file)
+	if closeErr := file.Close(); err == nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err != nil {
+		os.Remove(output) // nolint
+	}
+	return err
+}
+
+func mux(inputs []*inputFile, w *os.File) error {
+	writer, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	var tracks []*muxTrack
+	for _, in := range inputs {
+		for _, src := range in.tracks {
+			if (src.handler != "vide" && src.handler != "soun") || len(src.samples) == 0 {
+				continue
+			}
+			if len(src.sampleEntry) < 8 {
+				return errors.Errorf("track %d has no sample entry", src.id)
+			}
+			if typ := string(src.sampleEntry[4:8]); typ == "encv" || typ == "enca" {
+				return errors.Wrap(ErrUnsupportedCodec, "encrypted track")
+			}
+
+			first := src.samples[0].dts
+			mediaTime := max(src.mediaTime-first, 0)
+			t := &muxTrack{
+				in:  in,
+				src: src,
+				index: writer.AddTrack(&Track{
+					Handler:     src.handler,
+					Timescale:   src.timescale,
+					Width:       src.width,
+					Height:      src.height,
+					SampleEntry: src.sampleEntry,
+					Language:    src.language,
+					MediaTime:   mediaTime,
+				}),
+				shift: -first - mediaTime,
+			}
+			if in.movieTimescale > 0 {
+				t.shift += int64(src.delay) * int64(src.timescale) / int64(in.movieTimescale)
+			}
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return errors.New("no video or audio track found")
+	}
+
+	var buf []byte
+	for {
+		// the track that is the most behind is written next
+		var current *muxTrack
+		for _, t := range tracks {
+			if t.next < len(t.src.samples) && (current == nil || t.time() < current.time()) {
+				current = t
+			}
+		}
+		if current == nil {
+			break
+		}
+		end := current.time() + muxInterleave
+		for current.next < len(current.src.samples) && current.time() < end {
+			s := current.src.samples[current.next]
+			if cap(buf) < int(s.size) {
+				buf = make([]byte, s.size)
+			}
+			data := buf[:s.size]
+			if _, err = current.in.file.ReadAt(data, s.offset); err != nil {
+				return errors.Wrapf(err, "read sample %d of track %d", current.next+1, current.src.id)
+			}
+			if err = writer.WriteSample(current.index, &Sample{
+				Data:      data,
+				DTS:       s.dts + current.shift,
+				CTSOffset: s.ctsOffset,
+				Sync:      s.sync,
+			}); err != nil {
+				return err
+			}
+			current.next++
+		}
+	}
+	return writer.Close()
+}
@@ -0,0 +1,169 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func u32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// writeTestVideo writes a progressive MP4 file with 10 H.264 frames of 25 fps.
+func writeTestVideo(t *testing.T, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close() // nolint
+	w, err := NewWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	track := w.AddTrack(&Track{
+		Handler:     "vide",
+		Timescale:   90000,
+		Width:       1280,
+		Height:      718,
+		SampleEntry: avc1Entry([][]byte{testSPS()}, [][]byte{pps}, 1280, 718),
+	})
+	for i := 0; i < 10; i++ {
+		if err = w.WriteSample(track, &Sample{
+			Data: []byte{0, 0, 0, 2, 0x65, 0xb0 + byte(i)},
+			DTS:  int64(i) * 3600,
+			Sync: i == 0,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestAudio writes a fragmented m4a file with 2 fragments of 5 AAC frames,
+// the edit list skips the first frame as the priming samples.
+func writeTestAudio(t *testing.T, path string) {
+	tkhd := append(u32(0, 0, 0, 1, 0, 0), make([]byte, 8+8+36+8)...)
+	elst := u32(0, 1, 0, 1024, 0x10000)
+	mdhd := append(u32(0, 0, 0, 48000, 0), 0x55, 0xc4, 0, 0) // und
+	hdlr := append(u32(0, 0), append([]byte("soun"), make([]byte, 13)...)...)
+	stsd := append(u32(0, 1), mp4aEntry([]byte{0x11, 0x90}, 2, 48000)...)
+	stbl := box("stbl",
+		box("stsd", stsd),
+		box("stts", u32(0, 0)),
+		box("stsc", u32(0, 0)),
+		box("stsz", u32(0, 0, 0)),
+		box("stco", u32(0, 0)),
+	)
+	moov := box("moov",
+		box("mvhd", u32(0, 0, 0, 1000, 0), make([]byte, 80)),
+		box("trak",
+			box("tkhd", tkhd),
+			box("edts", box("elst", elst)),
+			box("mdia", box("mdhd", mdhd), box("hdlr", hdlr), box("minf", stbl)),
+		),
+		box("mvex", box("trex", u32(0, 1, 1, 1024, 0, 0))),
+	)
+
+	data := append(box("ftyp", []byte("iso6"), u32(0), []byte("iso6dash")), moov...)
+	for fragment := 0; fragment < 2; fragment++ {
+		var samples []byte
+		sizes := u32()
+		for i := 0; i < 5; i++ {
+			sample := []byte{0xa0, byte(fragment*5 + i), 1, 2}
+			samples = append(samples, sample...)
+			sizes = append(sizes, u32(uint32(len(sample)))...)
+		}
+		moof := func(dataOffset uint32) []byte {
+			return box("moof",
+				box("mfhd", u32(0, uint32(fragment+1))),
+				box("traf",
+					box("tfhd", u32(0x20000, 1)),
+					box("tfdt", u32(0, uint32(fragment*5*1024))),
+					box("trun", u32(0x201, 5, dataOffset), sizes),
+				),
+			)
+		}
+		data = append(data, moof(uint32(len(moof(0))+8))...)
+		data = append(data, box("mdat", samples)...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMux(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "video.mp4")
+	audio := filepath.Join(dir, "audio.m4a")
+	writeTestVideo(t, video)
+	writeTestAudio(t, audio)
+
+	output := filepath.Join(dir, "out.mp4")
+	if err := Mux([]string{video, audio}, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := findBox(data, "moov")
+	traks := findBoxes(moov, "trak")
+	if len(traks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(traks))
+	}
+
+	if stsz := findBox(traks[0], "mdia", "minf", "stbl", "stsz"); binary.BigEndian.Uint32(stsz[8:]) != 10 {
+		t.Errorf("unexpected video stsz %x", stsz)
+	}
+	if avc1 := findBox(traks[0], "mdia", "minf", "stbl", "stsd"); avc1 == nil || string(avc1[12:16]) != "avc1" {
+		t.Error("avc1 sample entry not found")
+	}
+
+	audioTrak := traks[1]
+	if stsz := findBox(audioTrak, "mdia", "minf", "stbl", "stsz"); binary.BigEndian.Uint32(stsz[8:]) != 10 {
+		t.Errorf("unexpected audio stsz %x", stsz)
+	}
+	stts := findBox(audioTrak, "mdia", "minf", "stbl", "stts")
+	if !bytes.Equal(stts[4:], u32(1, 10, 1024)) {
+		t.Errorf("unexpected audio stts %x", stts)
+	}
+	// the priming samples are still skipped and the presentations start together
+	elst := findBox(audioTrak, "edts", "elst")
+	if elst == nil || binary.BigEndian.Uint32(elst[4:]) != 1 || binary.BigEndian.Uint32(elst[12:]) != 1024 {
+		t.Errorf("unexpected audio elst %x", elst)
+	}
+
+	mdat := findBox(data, "mdat")
+	for i := 0; i < 10; i++ {
+		if !bytes.Contains(mdat, []byte{0x65, 0xb0 + byte(i)}) || !bytes.Contains(mdat, []byte{0xa0, byte(i), 1, 2}) {
+			t.Fatalf("sample %d is missing", i)
+		}
+	}
+}
+
+func TestMuxUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	webm := filepath.Join(dir, "video.webm")
+	if err := os.WriteFile(webm, []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86, 0x81, 1, 0, 0, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.mp4")
+	if err := Mux([]string{webm}, output); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Fatalf("Mux() error = %v, want ErrUnsupportedCodec", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("no output should be created")
+	}
+}
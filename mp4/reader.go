@@ -0,0 +1,570 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// inputSample is a sample of an input file, the timestamps are in the timescale of its track.
+type inputSample struct {
+	offset    int64
+	size      uint32
+	dts       int64
+	ctsOffset int32
+	sync      bool
+}
+
+// inputTrack is a track of an input file.
+type inputTrack struct {
+	id          uint32
+	handler     string
+	timescale   uint32
+	width       int
+	height      int
+	language    string
+	sampleEntry []byte
+	// the edit list, mediaTime is in the media timescale and delay in the movie timescale
+	mediaTime int64
+	delay     uint64
+	samples   []*inputSample
+
+	// defaults of the track fragments, see trex
+	defaultDuration uint32
+	defaultSize     uint32
+	defaultFlags    uint32
+	// the decoding time of the next fragment if it has no tfdt
+	nextDTS int64
+}
+
+// inputFile is a progressive or fragmented MP4 file.
+type inputFile struct {
+	file           *os.File
+	movieTimescale uint32
+	tracks         []*inputTrack
+}
+
+// topLevelBoxes are the box types an MP4 file may start with.
+var topLevelBoxes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "moof": true, "sidx": true,
+	"mdat": true, "free": true, "skip": true, "wide": true, "pdin": true,
+}
+
+// openInput reads the tracks and the sample tables of an MP4 file.
+func openInput(path string) (*inputFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	in := &inputFile{file: file}
+	if err = in.parse(); err != nil {
+		file.Close() // nolint
+		return nil, errors.WithMessagef(err, "read %s", path)
+	}
+	return in, nil
+}
+
+func (in *inputFile) Close() error {
+	return in.file.Close()
+}
+
+func (in *inputFile) parse() error {
+	info, err := in.file.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fileSize := info.Size()
+
+	var (
+		offset int64
+		header [16]byte
+	)
+	for offset < fileSize {
+		if _, err = in.file.ReadAt(header[:8], offset); err != nil {
+			return errors.WithStack(err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err = in.file.ReadAt(header[8:16], offset+8); err != nil {
+				return errors.WithStack(err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if offset == 0 && !topLevelBoxes[typ] {
+			return errors.Wrap(ErrUnsupportedCodec, "not an MP4 file")
+		}
+		if size < headerSize || offset+size > fileSize {
+			// a truncated box at the end of the file, eg: an unfinished download
+			if typ == "mdat" {
+				break
+			}
+			return errors.Errorf("invalid %s box size %d", typ, size)
+		}
+
+		switch typ {
+		case "moov", "moof":
+			payload := make([]byte, size-headerSize)
+			if _, err = in.file.ReadAt(payload, offset+headerSize); err != nil {
+				return errors.WithStack(err)
+			}
+			if typ == "moov" {
+				err = in.parseMoov(payload)
+			} else {
+				err = in.parseMoof(payload, offset)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	if len(in.tracks) == 0 {
+		return errors.New("no tracks found")
+	}
+	return nil
+}
+
+// forEachBox calls fn with the type and payload of each box in data.
+func forEachBox(data []byte, fn func(typ string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errors.New("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return errors.New("truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return errors.Errorf("invalid %s box size %d", typ, size)
+		}
+		if err := fn(typ, data[header:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// payloadReader reads the fields of a box payload, reads past the end return zeros and set err.
+type payloadReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *payloadReader) next(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = errors.New("truncated box")
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *payloadReader) u8() uint8   { return r.next(1)[0] }
+func (r *payloadReader) u16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *payloadReader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *payloadReader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+// versionFlags reads the header of a full box.
+func (r *payloadReader) versionFlags() (byte, uint32) {
+	v := r.u32()
+	return byte(v >> 24), v & 0xffffff
+}
+
+// time reads a 32 or 64 bits field of a version 0 or 1 box.
+func (r *payloadReader) time(version byte) uint64 {
+	if version == 1 {
+		return r.u64()
+	}
+	return uint64(r.u32())
+}
+
+func (in *inputFile) parseMoov(data []byte) error {
+	return forEachBox(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			r := &payloadReader{data: payload}
+			version, _ := r.versionFlags()
+			r.time(version)
+			r.time(version)
+			in.movieTimescale = r.u32()
+			return r.err
+		case "trak":
+			track, err := in.parseTrak(payload)
+			if err != nil {
+				return err
+			}
+			in.tracks = append(in.tracks, track)
+		case "mvex":
+			return forEachBox(payload, func(typ string, payload []byte) error {
+				if typ != "trex" {
+					return nil
+				}
+				r := &payloadReader{data: payload}
+				r.versionFlags()
+				id := r.u32()
+				r.u32() // default_sample_description_index
+				duration, size, flags := r.u32(), r.u32(), r.u32()
+				if t := in.track(id); t != nil {
+					t.defaultDuration, t.defaultSize, t.defaultFlags = duration, size, flags
+				}
+				return r.err
+			})
+		}
+		return nil
+	})
+}
+
+func (in *inputFile) track(id uint32) *inputTrack {
+	for _, t := range in.tracks {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (in *inputFile) parseTrak(data []byte) (*inputTrack, error) {
+	t := new(inputTrack)
+	var stbl []byte
+	err := forEachBox(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "tkhd":
+			r := &payloadReader{data: payload}
+			version, _ := r.versionFlags()
+			r.time(version)
+			r.time(version)
+			t.id = r.u32()
+			r.u32()
+			r.time(version)
+			// reserved, layer, alternate group, volume, reserved and matrix
+			r.next(8 + 8 + 36)
+			t.width, t.height = int(r.u32()>>16), int(r.u32()>>16)
+			return r.err
+		case "edts":
+			return forEachBox(payload, func(typ string, payload []byte) error {
+				if typ == "elst" {
+					return t.parseElst(payload)
+				}
+				return nil
+			})
+		case "mdia":
+			return forEachBox(payload, func(typ string, payload []byte) error {
+				switch typ {
+				case "mdhd":
+					r := &payloadReader{data: payload}
+					version, _ := r.versionFlags()
+					r.time(version)
+					r.time(version)
+					t.timescale = r.u32()
+					r.time(version)
+					lang := r.u16()
+					t.language = string([]byte{byte(lang>>10&0x1f) + 0x60, byte(lang>>5&0x1f) + 0x60, byte(lang&0x1f) + 0x60})
+					return r.err
+				case "hdlr":
+					if len(payload) < 12 {
+						return errors.New("truncated hdlr box")
+					}
+					t.handler = string(payload[8:12])
+				case "minf":
+					return forEachBox(payload, func(typ string, payload []byte) error {
+						if typ == "stbl" {
+							stbl = payload
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.timescale == 0 {
+		return nil, errors.Errorf("track %d has no timescale", t.id)
+	}
+	if stbl != nil {
+		if err = t.parseStbl(stbl); err != nil {
+			return nil, errors.WithMessagef(err, "track %d", t.id)
+		}
+	}
+	return t, nil
+}
+
+// parseElst reads the delay and the start of the media of the edit list.
+func (t *inputTrack) parseElst(data []byte) error {
+	r := &payloadReader{data: data}
+	version, _ := r.versionFlags()
+	count := r.u32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		duration := r.time(version)
+		var mediaTime int64
+		if version == 1 {
+			mediaTime = int64(r.u64())
+		} else {
+			mediaTime = int64(int32(r.u32()))
+		}
+		r.u32() // media rate
+		if mediaTime == -1 {
+			t.delay += duration
+			continue
+		}
+		t.mediaTime = mediaTime
+		break
+	}
+	return r.err
+}
+
+func (t *inputTrack) parseStbl(data []byte) error {
+	var (
+		deltas       []uint32
+		ctsOffsets   []int32
+		syncs        map[uint32]bool
+		sizes        []uint32
+		chunkOffsets []int64
+		stsc         [][3]uint32
+	)
+	err := forEachBox(data, func(typ string, payload []byte) error {
+		r := &payloadReader{data: payload}
+		r.versionFlags()
+		switch typ {
+		case "stsd":
+			if r.u32() == 0 {
+				return nil
+			}
+			entry := payload[r.pos:]
+			if len(entry) < 8 {
+				return errors.New("truncated stsd box")
+			}
+			size := binary.BigEndian.Uint32(entry)
+			if size < 8 || int(size) > len(entry) {
+				return errors.New("invalid sample entry size")
+			}
+			t.sampleEntry = entry[:size]
+		case "stts":
+			count := r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				n, delta := r.u32(), r.u32()
+				for j := uint32(0); j < n; j++ {
+					deltas = append(deltas, delta)
+				}
+			}
+		case "ctts":
+			count := r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				n, offset := r.u32(), int32(r.u32())
+				for j := uint32(0); j < n; j++ {
+					ctsOffsets = append(ctsOffsets, offset)
+				}
+			}
+		case "stss":
+			count := r.u32()
+			syncs = make(map[uint32]bool, count)
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				syncs[r.u32()] = true
+			}
+		case "stsz":
+			size, count := r.u32(), r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				if size != 0 {
+					sizes = append(sizes, size)
+				} else {
+					sizes = append(sizes, r.u32())
+				}
+			}
+		case "stz2":
+			r.next(3)
+			field, count := r.u8(), r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				switch field {
+				case 4:
+					if i%2 == 0 {
+						b := r.u8()
+						sizes = append(sizes, uint32(b>>4), uint32(b&0x0f))
+					}
+				case 8:
+					sizes = append(sizes, uint32(r.u8()))
+				default:
+					sizes = append(sizes, uint32(r.u16()))
+				}
+			}
+		case "stsc":
+			count := r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				stsc = append(stsc, [3]uint32{r.u32(), r.u32(), r.u32()})
+			}
+		case "stco", "co64":
+			count := r.u32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				if typ == "co64" {
+					chunkOffsets = append(chunkOffsets, int64(r.u64()))
+				} else {
+					chunkOffsets = append(chunkOffsets, int64(r.u32()))
+				}
+			}
+		}
+		return r.err
+	})
+	if err != nil {
+		return err
+	}
+	if len(sizes) == 0 {
+		// a fragmented file, the samples are in the fragments
+		return nil
+	}
+	if len(deltas) < len(sizes) {
+		return errors.New("the sample tables are inconsistent")
+	}
+
+	t.samples = make([]*inputSample, 0, len(sizes))
+	var dts int64
+	sample := 0
+	for i := range stsc {
+		first := stsc[i][0]
+		last := uint32(len(chunkOffsets))
+		if i+1 < len(stsc) {
+			last = stsc[i+1][0] - 1
+		}
+		for chunk := first; chunk <= last && int(chunk) <= len(chunkOffsets); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for j := uint32(0); j < stsc[i][1] && sample < len(sizes); j++ {
+				s := &inputSample{
+					offset: offset,
+					size:   sizes[sample],
+					dts:    dts,
+					sync:   syncs == nil || syncs[uint32(sample+1)],
+				}
+				if sample < len(ctsOffsets) {
+					s.ctsOffset = ctsOffsets[sample]
+				}
+				t.samples = append(t.samples, s)
+				offset += int64(s.size)
+				dts += int64(deltas[sample])
+				sample++
+			}
+		}
+	}
+	if sample != len(sizes) {
+		return errors.New("the sample tables are inconsistent")
+	}
+	return nil
+}
+
+// sample flags of the track fragments
+const sampleIsNonSync = 0x10000
+
+func (in *inputFile) parseMoof(data []byte, moofOffset int64) error {
+	return forEachBox(data, func(typ string, payload []byte) error {
+		if typ != "traf" {
+			return nil
+		}
+		var (
+			t          *inputTrack
+			base       = moofOffset
+			duration   uint32
+			size       uint32
+			flags      uint32
+			decodeTime int64 = -1
+			dataEnd    int64 = -1
+		)
+		return forEachBox(payload, func(typ string, payload []byte) error {
+			r := &payloadReader{data: payload}
+			version, boxFlags := r.versionFlags()
+			switch typ {
+			case "tfhd":
+				t = in.track(r.u32())
+				if t == nil {
+					return errors.New("track fragment of an unknown track")
+				}
+				duration, size, flags = t.defaultDuration, t.defaultSize, t.defaultFlags
+				if boxFlags&0x01 != 0 {
+					base = int64(r.u64())
+				}
+				if boxFlags&0x02 != 0 {
+					r.u32() // sample_description_index
+				}
+				if boxFlags&0x08 != 0 {
+					duration = r.u32()
+				}
+				if boxFlags&0x10 != 0 {
+					size = r.u32()
+				}
+				if boxFlags&0x20 != 0 {
+					flags = r.u32()
+				}
+				return r.err
+			case "tfdt":
+				decodeTime = int64(r.time(version))
+				return r.err
+			case "trun":
+				if t == nil {
+					return errors.New("trun box without tfhd")
+				}
+				count := r.u32()
+				offset := dataEnd
+				if boxFlags&0x01 != 0 {
+					offset = base + int64(int32(r.u32()))
+				} else if offset < 0 {
+					offset = base
+				}
+				firstFlags, hasFirstFlags := uint32(0), boxFlags&0x04 != 0
+				if hasFirstFlags {
+					firstFlags = r.u32()
+				}
+				dts := t.nextDTS
+				if decodeTime >= 0 {
+					dts = decodeTime
+					decodeTime = -1
+				}
+				for i := uint32(0); i < count && r.err == nil; i++ {
+					s := &inputSample{offset: offset, dts: dts, size: size}
+					d, f := duration, flags
+					if boxFlags&0x100 != 0 {
+						d = r.u32()
+					}
+					if boxFlags&0x200 != 0 {
+						s.size = r.u32()
+					}
+					if boxFlags&0x400 != 0 {
+						f = r.u32()
+					}
+					if i == 0 && hasFirstFlags {
+						f = firstFlags
+					}
+					if boxFlags&0x800 != 0 {
+						// unsigned in version 0 and signed in version 1, the offsets never exceed 31 bits
+						s.ctsOffset = int32(r.u32())
+					}
+					s.sync = f&sampleIsNonSync == 0
+					t.samples = append(t.samples, s)
+					offset += int64(s.size)
+					dts += int64(d)
+				}
+				t.nextDTS = dts
+				dataEnd = offset
+				return r.err
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,323 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedCodec is returned when the input has a codec the remuxer can't handle.
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+const (
+	// tsTimescale is the 90 kHz clock of the MPEG-TS timestamps
+	tsTimescale = 90000
+	// maxTimestampGap is the largest jump of timestamps between two files that is not a discontinuity
+	maxTimestampGap = 10 * tsTimescale
+)
+
+// RemuxTS concatenates MPEG-TS files and remuxes them into an MP4 file without re-encoding,
+// the supported codecs are H.264, H.265 and AAC.
+func RemuxTS(paths []string, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = remuxTS(paths, file)
+	if closeErr := file.Close(); err == nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err != nil {
+		os.Remove(output) // nolint
+	}
+	return err
+}
+
+func remuxTS(paths []string, w io.WriteSeeker) error {
+	writer, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+	r := &tsRemuxer{writer: writer, video: -1, audio: -1}
+	for _, path := range paths {
+		if err = r.remuxFile(path); err != nil {
+			return errors.WithMessagef(err, "remux %s", path)
+		}
+	}
+	if err = r.finish(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// tsRemuxer turns the PES packets into MP4 samples.
+type tsRemuxer struct {
+	writer *Writer
+
+	// track indexes, -1 if there is no such track
+	video int
+	audio int
+
+	videoType byte
+	// parameter sets of the video, in the order they appear
+	vps, sps, pps [][]byte
+
+	audioHeader *adtsHeader
+	// the decoding timestamp of the next audio frame in the audio sample rate
+	audioDTS int64
+	// the data of an ADTS frame split across PES packets
+	audioRemain []byte
+
+	// offset is added to the timestamps to make them continuous across files
+	offset int64
+	// the end times of the video and audio samples written so far in the 90 kHz clock
+	videoEnd int64
+	audioEnd int64
+	// last is the last adjusted timestamp, used to detect a wrap around of the 33 bits timestamps
+	last      int64
+	fileStart bool
+	lastVideo int64
+}
+
+func (r *tsRemuxer) remuxFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close() // nolint
+
+	r.fileStart = true
+	demuxer := newTSDemuxer(file)
+	for {
+		pes, err := demuxer.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pes.pts < 0 {
+			// packets without timestamps are only expected for audio frames following the first one
+			if pes.streamType != tsStreamAAC || r.audioHeader == nil {
+				continue
+			}
+		}
+		switch pes.streamType {
+		case tsStreamH264, tsStreamH265:
+			err = r.writeVideo(pes)
+		case tsStreamAAC:
+			err = r.writeAudio(pes)
+		case 0x03, 0x04, 0x81:
+			// MP3 and AC-3 audio
+			err = errors.Wrapf(ErrUnsupportedCodec, "stream type 0x%02x", pes.streamType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// adjust unwraps a 90 kHz timestamp and makes it continuous with the previous files,
+// end is the end time of the track the timestamp belongs to.
+func (r *tsRemuxer) adjust(ts, end int64) int64 {
+	ts += r.offset
+	// the 33 bits timestamps wrap around after about 26.5 hours
+	for r.last > 0 && ts < r.last-1<<32 {
+		r.offset += 1 << 33
+		ts += 1 << 33
+	}
+	if r.fileStart {
+		r.fileStart = false
+		if end == 0 {
+			end = max(r.videoEnd, r.audioEnd)
+		}
+		if end > 0 && (ts < end-tsTimescale || ts > end+maxTimestampGap) {
+			// a discontinuity, eg: an inserted advertisement
+			r.offset += end - ts
+			ts = end
+		}
+	}
+	r.last = ts
+	return ts
+}
+
+func (r *tsRemuxer) writeVideo(pes *pesPacket) error {
+	if r.video < 0 {
+		r.videoType = pes.streamType
+		r.video = r.writer.AddTrack(&Track{Handler: "vide", Timescale: tsTimescale})
+	} else if pes.streamType != r.videoType {
+		return errors.Wrap(ErrUnsupportedCodec, "the video codec changes between the files")
+	}
+
+	dts := r.adjust(pes.dts, r.videoEnd)
+	pts := dts + pes.pts - pes.dts
+	if pes.pts < pes.dts-1<<32 {
+		pts += 1 << 33
+	}
+
+	var (
+		sample bytes.Buffer
+		sync   bool
+	)
+	for _, nal := range splitAnnexB(pes.data) {
+		if pes.streamType == tsStreamH264 {
+			switch typ := nal[0] & 0x1f; typ {
+			case h264NALAUD:
+				continue
+			case h264NALSPS:
+				r.sps = appendParameterSet(r.sps, nal)
+				continue
+			case h264NALPPS:
+				r.pps = appendParameterSet(r.pps, nal)
+				continue
+			case h264NALIDR:
+				sync = true
+			}
+		} else {
+			if len(nal) < 2 {
+				continue
+			}
+			switch typ := nal[0] >> 1 & 0x3f; {
+			case typ == h265NALAUD:
+				continue
+			case typ == h265NALVPS:
+				r.vps = appendParameterSet(r.vps, nal)
+				continue
+			case typ == h265NALSPS:
+				r.sps = appendParameterSet(r.sps, nal)
+				continue
+			case typ == h265NALPPS:
+				r.pps = appendParameterSet(r.pps, nal)
+				continue
+			case h265IsKeyFrame(typ):
+				sync = true
+			}
+		}
+		sample.Write(binary.BigEndian.AppendUint32(nil, uint32(len(nal))))
+		sample.Write(nal)
+	}
+	if sample.Len() == 0 {
+		return nil
+	}
+
+	if dts <= r.lastVideo && r.lastVideo > 0 {
+		// drop the frames with broken timestamps
+		return nil
+	}
+	if err := r.writer.WriteSample(r.video, &Sample{
+		Data:      sample.Bytes(),
+		DTS:       dts,
+		CTSOffset: int32(pts - dts),
+		Sync:      sync,
+	}); err != nil {
+		return err
+	}
+	duration := int64(tsTimescale / 25)
+	if r.lastVideo > 0 {
+		duration = dts - r.lastVideo
+	}
+	r.lastVideo = dts
+	r.videoEnd = dts + duration
+	return nil
+}
+
+func (r *tsRemuxer) writeAudio(pes *pesPacket) error {
+	data := pes.data
+	if len(r.audioRemain) > 0 {
+		data = append(r.audioRemain, data...)
+		r.audioRemain = nil
+	}
+	if r.audioHeader == nil {
+		header, err := parseADTSHeader(data)
+		if err != nil {
+			return err
+		}
+		r.audioHeader = header
+		r.audio = r.writer.AddTrack(&Track{Handler: "soun", Timescale: header.sampleRate()})
+	}
+	rate := int64(r.audioHeader.sampleRate())
+
+	if pes.pts >= 0 {
+		// resync with the timestamps of the packet if some audio is missing
+		dts := r.adjust(pes.pts, r.audioEnd) * rate / tsTimescale
+		if r.audioDTS == 0 || dts > r.audioDTS+rate/2 {
+			r.audioDTS = dts
+		}
+	}
+
+	for len(data) > 0 {
+		header, err := parseADTSHeader(data)
+		if err != nil {
+			return err
+		}
+		if header.rateIndex != r.audioHeader.rateIndex || header.channels != r.audioHeader.channels {
+			return errors.Wrap(ErrUnsupportedCodec, "the audio format changes between the files")
+		}
+		if header.frameLength > len(data) {
+			r.audioRemain = append([]byte{}, data...)
+			break
+		}
+		if err = r.writer.WriteSample(r.audio, &Sample{
+			Data: data[header.headerLength:header.frameLength],
+			DTS:  r.audioDTS,
+			Sync: true,
+		}); err != nil {
+			return err
+		}
+		r.audioDTS += aacSamplesPerFrame
+		r.audioEnd = r.audioDTS * tsTimescale / rate
+		data = data[header.frameLength:]
+	}
+	return nil
+}
+
+// finish sets the sample entries of the tracks.
+func (r *tsRemuxer) finish() error {
+	if r.video < 0 && r.audio < 0 {
+		return errors.New("no H.264, H.265 or AAC stream found")
+	}
+	if r.video >= 0 {
+		track := r.writer.tracks[r.video]
+		if len(r.sps) == 0 || len(r.pps) == 0 {
+			return errors.New("no parameter sets found in the video stream")
+		}
+		if r.videoType == tsStreamH264 {
+			width, height, err := h264Dimensions(r.sps[0])
+			if err != nil {
+				return err
+			}
+			track.Width, track.Height = width, height
+			track.SampleEntry = avc1Entry(r.sps, r.pps, width, height)
+		} else {
+			if len(r.vps) == 0 {
+				return errors.New("no VPS found in the video stream")
+			}
+			info, err := parseH265SPS(r.sps[0])
+			if err != nil {
+				return err
+			}
+			track.Width, track.Height = info.width, info.height
+			if track.SampleEntry, err = hvc1Entry(r.vps, r.sps, r.pps); err != nil {
+				return err
+			}
+		}
+	}
+	if r.audio >= 0 {
+		h := r.audioHeader
+		r.writer.tracks[r.audio].SampleEntry = mp4aEntry(h.audioSpecificConfig(), uint16(h.channels), h.sampleRate())
+	}
+	return nil
+}
+
+// appendParameterSet appends the parameter set if it isn't in the list yet.
+func appendParameterSet(sets [][]byte, nal []byte) [][]byte {
+	for _, s := range sets {
+		if bytes.Equal(s, nal) {
+			return sets
+		}
+	}
+	return append(sets, append([]byte{}, nal...))
+}
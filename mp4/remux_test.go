@@ -0,0 +1,336 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bitWriter writes the exp-Golomb codes of a test SPS.
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) bits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// testSPS returns a baseline H.264 SPS of 1280x720 with cropping to 1280x718.
+func testSPS() []byte {
+	w := &bitWriter{}
+	w.bits(0x67, 8) // NAL header
+	w.bits(66, 8)   // profile
+	w.bits(0, 8)
+	w.bits(31, 8) // level
+	w.ue(0)       // sps id
+	w.ue(0)       // log2_max_frame_num_minus4
+	w.ue(2)       // pic_order_cnt_type
+	w.ue(1)       // max_num_ref_frames
+	w.bits(0, 1)
+	w.ue(79) // width in macroblocks - 1
+	w.ue(44) // height in map units - 1
+	w.bits(1, 1)
+	w.bits(1, 1)
+	w.bits(1, 1) // frame cropping
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(1)
+	w.bits(0, 1) // vui
+	w.bits(1, 1) // rbsp stop bit
+	return w.data
+}
+
+func TestH264Dimensions(t *testing.T) {
+	width, height, err := h264Dimensions(testSPS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 1280 || height != 718 {
+		t.Errorf("h264Dimensions() = %dx%d, want 1280x718", width, height)
+	}
+}
+
+func TestSplitAnnexB(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 9, 0xf0, 0, 0, 1, 0x65, 1, 2, 0, 0, 0, 1, 0x41, 3}
+	nals := splitAnnexB(data)
+	want := [][]byte{{9, 0xf0}, {0x65, 1, 2}, {0x41, 3}}
+	if len(nals) != len(want) {
+		t.Fatalf("got %d NAL units, want %d", len(nals), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(nals[i], want[i]) {
+			t.Errorf("NAL %d = %x, want %x", i, nals[i], want[i])
+		}
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	got := unescapeRBSP([]byte{1, 0, 0, 3, 1, 0, 0, 3})
+	if want := []byte{1, 0, 0, 1, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("unescapeRBSP() = %x, want %x", got, want)
+	}
+}
+
+// adtsFrame returns an ADTS frame of AAC LC 48000 Hz stereo.
+func adtsFrame(payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{0xff, 0xf1, 1<<6 | 3<<2, 2<<6 | byte(length>>11), byte(length >> 3), byte(length<<5) | 0x1f, 0xfc}
+	return append(header, payload...)
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	h, err := parseADTSHeader(adtsFrame(make([]byte, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.objectType != 2 || h.sampleRate() != 48000 || h.channels != 2 || h.frameLength != 17 || h.headerLength != 7 {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if config := h.audioSpecificConfig(); !bytes.Equal(config, []byte{0x11, 0x90}) {
+		t.Errorf("audioSpecificConfig() = %x", config)
+	}
+}
+
+// tsMuxer writes the test MPEG-TS streams.
+type tsMuxer struct {
+	buf        bytes.Buffer
+	continuity map[uint16]byte
+}
+
+func (m *tsMuxer) packet(pid uint16, start bool, payload []byte) []byte {
+	p := make([]byte, 4, tsPacketSize)
+	p[0] = 0x47
+	p[1] = byte(pid >> 8)
+	if start {
+		p[1] |= 0x40
+	}
+	p[2] = byte(pid)
+	if m.continuity == nil {
+		m.continuity = make(map[uint16]byte)
+	}
+	p[3] = 0x10 | m.continuity[pid]&0x0f
+	m.continuity[pid]++
+
+	n := min(len(payload), tsPacketSize-4)
+	if n < tsPacketSize-4 {
+		// stuff with an adaptation field
+		p[3] |= 0x20
+		stuffing := tsPacketSize - 4 - n - 1
+		p = append(p, byte(stuffing))
+		if stuffing > 0 {
+			p = append(p, 0)
+			p = append(p, bytes.Repeat([]byte{0xff}, stuffing-1)...)
+		}
+	}
+	p = append(p, payload[:n]...)
+	m.buf.Write(p)
+	return payload[n:]
+}
+
+func (m *tsMuxer) tables() {
+	pat := []byte{0, 0, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xf0, 0x00, 0, 0, 0, 0}
+	m.packet(0, true, pat)
+	pmt := []byte{0, 2, 0xb0, 23, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0,
+		tsStreamH264, 0xe1, 0x00, 0xf0, 0,
+		tsStreamAAC, 0xe1, 0x01, 0xf0, 0,
+		0, 0, 0, 0}
+	m.packet(0x1000, true, pmt)
+}
+
+func timestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22), byte(ts>>14) | 1,
+		byte(ts >> 7), byte(ts<<1) | 1,
+	}
+}
+
+func (m *tsMuxer) pes(pid uint16, streamID byte, pts, dts int64, data []byte) {
+	header := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0xc0, 10}
+	header = append(header, timestamp(3, pts)...)
+	header = append(header, timestamp(1, dts)...)
+	payload := append(header, data...)
+	for start := true; len(payload) > 0; start = false {
+		payload = m.packet(pid, start, payload)
+	}
+}
+
+func annexB(nals ...[]byte) []byte {
+	var b []byte
+	for _, nal := range nals {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, nal...)
+	}
+	return b
+}
+
+// writeTestTS writes a TS file with 10 frames of video and AAC audio starting at the given timestamp,
+// each frame lasts as long as two audio frames.
+func writeTestTS(t *testing.T, path string, start int64) {
+	m := &tsMuxer{}
+	m.tables()
+	for i := int64(0); i < 10; i++ {
+		dts := start + i*3840
+		var frame []byte
+		if i == 0 {
+			frame = annexB([]byte{9, 0xf0}, testSPS(), []byte{0x68, 0xce, 0x38, 0x80}, append([]byte{0x65}, make([]byte, 300)...))
+		} else {
+			frame = annexB([]byte{9, 0xf0}, append([]byte{0x41}, bytes.Repeat([]byte{byte(i)}, 50)...))
+		}
+		// every frame is presented one frame later than it's decoded
+		m.pes(0x100, 0xe0, dts+3840, dts, frame)
+		m.pes(0x101, 0xc0, dts+3840, dts+3840, append(adtsFrame([]byte{1, 2, 3}), adtsFrame([]byte{4, 5, 6})...))
+	}
+	if err := os.WriteFile(path, m.buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findBox returns the payload of the first box in the path, eg: moov/trak/mdia
+func findBox(data []byte, path ...string) []byte {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		header := 8
+		if size == 1 {
+			size = int(binary.BigEndian.Uint64(data[8:]))
+			header = 16
+		}
+		if size < header || size > len(data) {
+			return nil
+		}
+		if string(data[4:8]) == path[0] {
+			if len(path) == 1 {
+				return data[header:size]
+			}
+			return findBox(data[header:size], path[1:]...)
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func TestRemuxTS(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "0.ts")
+	second := filepath.Join(dir, "1.ts")
+	writeTestTS(t, first, 900000)
+	// the second file has a discontinuity
+	writeTestTS(t, second, 100)
+
+	output := filepath.Join(dir, "out.mp4")
+	if err := RemuxTS([]string{first, second}, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[4:8]) != "ftyp" {
+		t.Fatal("the file should start with ftyp")
+	}
+	mdat := findBox(data, "mdat")
+	if mdat == nil {
+		t.Fatal("mdat box not found or has a wrong size")
+	}
+
+	moov := findBox(data, "moov")
+	video := findBox(moov, "trak")
+	avc1 := findBox(video, "mdia", "minf", "stbl", "stsd")
+	if avc1 == nil || string(avc1[12:16]) != "avc1" {
+		t.Fatalf("avc1 sample entry not found")
+	}
+	if w, h := binary.BigEndian.Uint16(avc1[16+24:]), binary.BigEndian.Uint16(avc1[16+26:]); w != 1280 || h != 718 {
+		t.Errorf("sample entry size = %dx%d", w, h)
+	}
+	stsz := findBox(video, "mdia", "minf", "stbl", "stsz")
+	if n := binary.BigEndian.Uint32(stsz[8:]); n != 20 {
+		t.Errorf("got %d video samples, want 20", n)
+	}
+	// a single run of 3840 as the second file continues the first one
+	stts := findBox(video, "mdia", "minf", "stbl", "stts")
+	if !bytes.Equal(stts[4:], []byte{0, 0, 0, 1, 0, 0, 0, 20, 0, 0, 0x0f, 0x00}) {
+		t.Errorf("unexpected stts %x", stts)
+	}
+	stss := findBox(video, "mdia", "minf", "stbl", "stss")
+	if !bytes.Equal(stss[4:], []byte{0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 11}) {
+		t.Errorf("unexpected stss %x", stss)
+	}
+	if findBox(video, "mdia", "minf", "stbl", "ctts") == nil {
+		t.Error("ctts box not found")
+	}
+	// the first frame is presented at 3840 of the media time
+	elst := findBox(video, "edts", "elst")
+	if elst == nil || binary.BigEndian.Uint32(elst[12:]) != 3840 {
+		t.Errorf("unexpected elst %x", elst)
+	}
+
+	audio := findBoxes(moov, "trak")[1]
+	mp4a := findBox(audio, "mdia", "minf", "stbl", "stsd")
+	if mp4a == nil || string(mp4a[12:16]) != "mp4a" {
+		t.Fatalf("mp4a sample entry not found")
+	}
+	stsz = findBox(audio, "mdia", "minf", "stbl", "stsz")
+	if n := binary.BigEndian.Uint32(stsz[8:]); n != 40 {
+		t.Errorf("got %d audio samples, want 40", n)
+	}
+	mdhd := findBox(audio, "mdia", "mdhd")
+	if rate := binary.BigEndian.Uint32(mdhd[12:]); rate != 48000 {
+		t.Errorf("audio timescale = %d", rate)
+	}
+	// the audio frames are the only samples of 3 bytes
+	if !bytes.Contains(mdat, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Error("the audio frames should be written without the ADTS headers")
+	}
+}
+
+// findBoxes returns the payloads of all boxes of the type at the top level.
+func findBoxes(data []byte, typ string) [][]byte {
+	var boxes [][]byte
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			break
+		}
+		if string(data[4:8]) == typ {
+			boxes = append(boxes, data[8:size])
+		}
+		data = data[size:]
+	}
+	return boxes
+}
+
+func TestRemuxTSNoStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.ts")
+	m := &tsMuxer{}
+	m.tables()
+	if err := os.WriteFile(path, m.buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := path + ".mp4"
+	if err := RemuxTS([]string{path}, output); err == nil {
+		t.Fatal("expected an error for a stream without media")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("the output should be removed on failure")
+	}
+}
@@ -0,0 +1,210 @@
+package mp4
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const tsPacketSize = 188
+
+// MPEG-TS stream types
+const (
+	tsStreamAAC  = 0x0f
+	tsStreamH264 = 0x1b
+	tsStreamH265 = 0x24
+)
+
+// pesPacket is a packetized elementary stream packet, the timestamps are -1 if they are absent.
+type pesPacket struct {
+	streamType byte
+	pts        int64
+	dts        int64
+	data       []byte
+}
+
+type tsStream struct {
+	streamType byte
+	data       []byte
+}
+
+// tsDemuxer reads the PES packets of the elementary streams of an MPEG-TS stream.
+type tsDemuxer struct {
+	r       *bufio.Reader
+	pmtPIDs map[uint16]bool
+	streams map[uint16]*tsStream
+	// the PIDs in the order of the PMT, used to flush the streams in a stable order
+	order  []uint16
+	packet [tsPacketSize]byte
+	eof    bool
+}
+
+func newTSDemuxer(r io.Reader) *tsDemuxer {
+	return &tsDemuxer{
+		r:       bufio.NewReaderSize(r, 64*1024),
+		pmtPIDs: make(map[uint16]bool),
+		streams: make(map[uint16]*tsStream),
+	}
+}
+
+// next returns the next complete PES packet, io.EOF is returned when there are no more packets.
+func (d *tsDemuxer) next() (*pesPacket, error) {
+	for !d.eof {
+		if _, err := io.ReadFull(d.r, d.packet[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				d.eof = true
+				break
+			}
+			return nil, errors.WithStack(err)
+		}
+		pes, err := d.parsePacket(d.packet[:])
+		if err != nil {
+			return nil, err
+		}
+		if pes != nil {
+			return pes, nil
+		}
+	}
+
+	// flush the unfinished packets at the end of the stream
+	for _, pid := range d.order {
+		s := d.streams[pid]
+		if len(s.data) == 0 {
+			continue
+		}
+		data := s.data
+		s.data = nil
+		return parsePES(s.streamType, data)
+	}
+	return nil, io.EOF
+}
+
+func (d *tsDemuxer) parsePacket(p []byte) (*pesPacket, error) {
+	if p[0] != 0x47 {
+		return nil, errors.New("invalid MPEG-TS packet: bad sync byte")
+	}
+	start := p[1]&0x40 != 0
+	pid := uint16(p[1]&0x1f)<<8 | uint16(p[2])
+	adaptation := p[3] >> 4 & 0x03
+	payload := p[4:]
+	if adaptation&0x02 != 0 {
+		length := int(payload[0])
+		if length >= len(payload) {
+			return nil, nil
+		}
+		payload = payload[1+length:]
+	}
+	if adaptation&0x01 == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case pid == 0:
+		if start {
+			d.parsePAT(payload)
+		}
+	case d.pmtPIDs[pid]:
+		if start {
+			d.parsePMT(payload)
+		}
+	default:
+		s, ok := d.streams[pid]
+		if !ok {
+			return nil, nil
+		}
+		var pes *pesPacket
+		if start && len(s.data) > 0 {
+			var err error
+			if pes, err = parsePES(s.streamType, s.data); err != nil {
+				return nil, err
+			}
+			s.data = nil
+		}
+		if start || len(s.data) > 0 {
+			s.data = append(s.data, payload...)
+		}
+		return pes, nil
+	}
+	return nil, nil
+}
+
+// section returns the payload of a PSI section without the pointer field and the CRC.
+func section(payload []byte) []byte {
+	pointer := int(payload[0])
+	if 1+pointer+3 > len(payload) {
+		return nil
+	}
+	payload = payload[1+pointer:]
+	length := int(payload[1]&0x0f)<<8 | int(payload[2])
+	if length < 4 || 3+length > len(payload) {
+		return nil
+	}
+	return payload[3 : 3+length-4]
+}
+
+func (d *tsDemuxer) parsePAT(payload []byte) {
+	s := section(payload)
+	if len(s) < 5 {
+		return
+	}
+	for i := 5; i+4 <= len(s); i += 4 {
+		program := uint16(s[i])<<8 | uint16(s[i+1])
+		if program == 0 {
+			continue
+		}
+		d.pmtPIDs[uint16(s[i+2]&0x1f)<<8|uint16(s[i+3])] = true
+	}
+}
+
+func (d *tsDemuxer) parsePMT(payload []byte) {
+	s := section(payload)
+	if len(s) < 9 {
+		return
+	}
+	infoLength := int(s[7]&0x0f)<<8 | int(s[8])
+	for i := 9 + infoLength; i+5 <= len(s); {
+		streamType := s[i]
+		pid := uint16(s[i+1]&0x1f)<<8 | uint16(s[i+2])
+		esInfoLength := int(s[i+3]&0x0f)<<8 | int(s[i+4])
+		if _, ok := d.streams[pid]; !ok {
+			d.streams[pid] = &tsStream{streamType: streamType}
+			d.order = append(d.order, pid)
+		}
+		i += 5 + esInfoLength
+	}
+}
+
+func parsePES(streamType byte, data []byte) (*pesPacket, error) {
+	if len(data) < 9 || data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return nil, errors.New("invalid PES packet: bad start code")
+	}
+	headerLength := int(data[8])
+	if 9+headerLength > len(data) {
+		return nil, errors.New("invalid PES packet: truncated header")
+	}
+	pes := &pesPacket{
+		streamType: streamType,
+		pts:        -1,
+		dts:        -1,
+		data:       data[9+headerLength:],
+	}
+	// the packet length is 0 for unbounded video packets
+	if length := int(data[4])<<8 | int(data[5]); length > 0 && 6+length < len(data) {
+		pes.data = data[9+headerLength : 6+length]
+	}
+	flags := data[7] >> 6
+	if flags&0x02 != 0 && headerLength >= 5 {
+		pes.pts = pesTimestamp(data[9:])
+		pes.dts = pes.pts
+	}
+	if flags == 0x03 && headerLength >= 10 {
+		pes.dts = pesTimestamp(data[14:])
+	}
+	return pes, nil
+}
+
+// pesTimestamp decodes a 33 bits PES timestamp.
+func pesTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
@@ -0,0 +1,439 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// movieTimescale is the timescale of the movie header and edit lists.
+const movieTimescale = 1000
+
+// Sample is a media sample, the timestamps are in the timescale of its track.
+type Sample struct {
+	Data []byte
+	// DTS is the decoding timestamp
+	DTS int64
+	// CTSOffset is the presentation timestamp minus the decoding timestamp
+	CTSOffset int32
+	// Sync indicates the sample is a key frame
+	Sync bool
+}
+
+// Track describes a track of the movie written by a Writer.
+type Track struct {
+	// Handler is the handler type, vide or soun
+	Handler   string
+	Timescale uint32
+	// Width and Height of a video track
+	Width  int
+	Height int
+	// SampleEntry is the sample description box, eg: an avc1 or mp4a box
+	SampleEntry []byte
+	// Language is the ISO 639-2 code of the track, eg: eng
+	Language string
+	// MediaTime is the media time where the presentation starts, eg: to skip the priming samples of AAC,
+	// it's derived from the composition offsets if it's zero.
+	MediaTime int64
+
+	sizes      []uint32
+	dts        []int64
+	ctsOffsets []int32
+	syncs      []uint32
+	chunks     []chunk
+}
+
+type chunk struct {
+	offset  uint64
+	samples uint32
+}
+
+// Writer writes a progressive MP4 file, the samples are written to the mdat box as they come
+// and the moov box is written at the end of the file.
+type Writer struct {
+	w      io.WriteSeeker
+	tracks []*Track
+	// offset of the mdat box and the current write position
+	mdatOffset int64
+	offset     int64
+	lastTrack  int
+	closed     bool
+}
+
+// NewWriter writes the file header to w and returns a Writer.
+func NewWriter(w io.WriteSeeker) (*Writer, error) {
+	ftyp := box("ftyp", []byte("isom"), binary.BigEndian.AppendUint32(nil, 0x200), []byte("isomiso2avc1mp41"))
+	// mdat with a 64 bits size which is filled in when closing
+	mdat := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := w.Write(append(ftyp, mdat...)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Writer{
+		w:          w,
+		mdatOffset: int64(len(ftyp)),
+		offset:     int64(len(ftyp) + len(mdat)),
+		lastTrack:  -1,
+	}, nil
+}
+
+// AddTrack adds a track to the movie and returns its index, the sample entry may be set until the writer is closed.
+func (w *Writer) AddTrack(t *Track) int {
+	w.tracks = append(w.tracks, t)
+	return len(w.tracks) - 1
+}
+
+// WriteSample appends a sample to the track, samples must be written in decoding order.
+func (w *Writer) WriteSample(track int, s *Sample) error {
+	if track < 0 || track >= len(w.tracks) {
+		return errors.Errorf("invalid track %d", track)
+	}
+	t := w.tracks[track]
+	if n := len(t.dts); n > 0 && s.DTS <= t.dts[n-1] {
+		return errors.Errorf("non monotonically increasing dts %d <= %d in track %d", s.DTS, t.dts[n-1], track)
+	}
+	if _, err := w.w.Write(s.Data); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// a new chunk starts whenever the samples of another track are written in between
+	if track != w.lastTrack || len(t.chunks) == 0 {
+		t.chunks = append(t.chunks, chunk{offset: uint64(w.offset)})
+		w.lastTrack = track
+	}
+	t.chunks[len(t.chunks)-1].samples++
+	t.sizes = append(t.sizes, uint32(len(s.Data)))
+	t.dts = append(t.dts, s.DTS)
+	t.ctsOffsets = append(t.ctsOffsets, s.CTSOffset)
+	if s.Sync {
+		t.syncs = append(t.syncs, uint32(len(t.sizes)))
+	}
+	w.offset += int64(len(s.Data))
+	return nil
+}
+
+// Close writes the moov box and fills in the size of the mdat box, it doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var tracks []*Track
+	for _, t := range w.tracks {
+		if len(t.sizes) > 0 {
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return errors.New("no samples to write")
+	}
+
+	if _, err := w.w.Write(w.moov(tracks)); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := w.w.Seek(w.mdatOffset+8, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+	size := binary.BigEndian.AppendUint64(nil, uint64(w.offset-w.mdatOffset))
+	if _, err := w.w.Write(size); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return errors.WithStack(err)
+}
+
+// duration returns the media duration of the track, the last sample lasts as long as the previous one.
+func (t *Track) duration() uint64 {
+	n := len(t.dts)
+	last := int64(1)
+	if n > 1 {
+		last = t.dts[n-1] - t.dts[n-2]
+	}
+	return uint64(t.dts[n-1] - t.dts[0] + last)
+}
+
+// presentation returns the media time where the presentation starts, relative to the first sample.
+func (t *Track) presentation() int64 {
+	if t.MediaTime > 0 {
+		return t.MediaTime
+	}
+	earliest := int64(math.MaxInt64)
+	for i, dts := range t.dts {
+		if pts := dts - t.dts[0] + int64(t.ctsOffsets[i]); pts < earliest {
+			earliest = pts
+		}
+	}
+	return earliest
+}
+
+func (w *Writer) moov(tracks []*Track) []byte {
+	// the tracks are aligned by the presentation time of their first samples
+	starts := make([]float64, len(tracks))
+	minStart := math.Inf(1)
+	for i, t := range tracks {
+		starts[i] = float64(t.dts[0]+t.presentation()) / float64(t.Timescale)
+		minStart = math.Min(minStart, starts[i])
+	}
+
+	var (
+		traks       [][]byte
+		movieLength uint64
+	)
+	for i, t := range tracks {
+		delay := uint64(math.Round((starts[i] - minStart) * movieTimescale))
+		trak, length := t.trak(uint32(i+1), delay)
+		traks = append(traks, trak)
+		if length > movieLength {
+			movieLength = length
+		}
+	}
+
+	version := timeVersion(movieLength)
+	mvhd := appendTime(nil, version, 0)
+	mvhd = appendTime(mvhd, version, 0)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, movieTimescale)
+	mvhd = appendTime(mvhd, version, movieLength)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, 0x00010000) // rate 1.0
+	mvhd = binary.BigEndian.AppendUint16(mvhd, 0x0100)     // volume 1.0
+	mvhd = append(mvhd, make([]byte, 10)...)
+	mvhd = appendMatrix(mvhd)
+	mvhd = append(mvhd, make([]byte, 24)...)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(len(tracks)+1))
+
+	return box("moov", append([][]byte{fullBox("mvhd", version, 0, mvhd)}, traks...)...)
+}
+
+// trak returns the trak box and its duration in the movie timescale including the delay.
+func (t *Track) trak(id uint32, delay uint64) ([]byte, uint64) {
+	mediaDuration := t.duration()
+	mediaStart := t.presentation()
+	if mediaStart < 0 {
+		mediaStart = 0
+	}
+	presentation := (mediaDuration - uint64(mediaStart)) * movieTimescale / uint64(t.Timescale)
+	length := delay + presentation
+
+	version := timeVersion(length)
+	tkhd := appendTime(nil, version, 0)
+	tkhd = appendTime(tkhd, version, 0)
+	tkhd = binary.BigEndian.AppendUint32(tkhd, id)
+	tkhd = binary.BigEndian.AppendUint32(tkhd, 0)
+	tkhd = appendTime(tkhd, version, length)
+	tkhd = append(tkhd, make([]byte, 8)...)
+	tkhd = binary.BigEndian.AppendUint16(tkhd, 0) // layer
+	tkhd = binary.BigEndian.AppendUint16(tkhd, 0) // alternate group
+	if t.Handler == "soun" {
+		tkhd = binary.BigEndian.AppendUint16(tkhd, 0x0100)
+	} else {
+		tkhd = binary.BigEndian.AppendUint16(tkhd, 0)
+	}
+	tkhd = binary.BigEndian.AppendUint16(tkhd, 0)
+	tkhd = appendMatrix(tkhd)
+	tkhd = binary.BigEndian.AppendUint32(tkhd, uint32(t.Width)<<16)
+	tkhd = binary.BigEndian.AppendUint32(tkhd, uint32(t.Height)<<16)
+	// track enabled and in movie
+	children := [][]byte{fullBox("tkhd", version, 3, tkhd)}
+
+	if delay > 0 || mediaStart > 0 {
+		children = append(children, box("edts", t.elst(delay, presentation, mediaStart)))
+	}
+	children = append(children, box("mdia", t.mdhd(mediaDuration), t.hdlr(), t.minf()))
+	return box("trak", children...), length
+}
+
+// elst returns the edit list which delays the track with an empty edit and skips the media before mediaStart.
+func (t *Track) elst(delay, presentation uint64, mediaStart int64) []byte {
+	version := timeVersion(delay, presentation, uint64(mediaStart))
+	var (
+		entries []byte
+		count   uint32
+	)
+	appendEntry := func(duration uint64, mediaTime int64) {
+		entries = appendTime(entries, version, duration)
+		if version == 1 {
+			entries = binary.BigEndian.AppendUint64(entries, uint64(mediaTime))
+		} else {
+			entries = binary.BigEndian.AppendUint32(entries, uint32(int32(mediaTime)))
+		}
+		entries = binary.BigEndian.AppendUint32(entries, 0x00010000) // media rate 1.0
+		count++
+	}
+	if delay > 0 {
+		appendEntry(delay, -1)
+	}
+	appendEntry(presentation, mediaStart)
+	return fullBox("elst", version, 0, binary.BigEndian.AppendUint32(nil, count), entries)
+}
+
+func (t *Track) mdhd(duration uint64) []byte {
+	version := timeVersion(duration)
+	mdhd := appendTime(nil, version, 0)
+	mdhd = appendTime(mdhd, version, 0)
+	mdhd = binary.BigEndian.AppendUint32(mdhd, t.Timescale)
+	mdhd = appendTime(mdhd, version, duration)
+	mdhd = binary.BigEndian.AppendUint16(mdhd, language(t.Language))
+	mdhd = binary.BigEndian.AppendUint16(mdhd, 0)
+	return fullBox("mdhd", version, 0, mdhd)
+}
+
+func (t *Track) hdlr() []byte {
+	name := "VideoHandler"
+	if t.Handler == "soun" {
+		name = "SoundHandler"
+	}
+	hdlr := binary.BigEndian.AppendUint32(nil, 0)
+	hdlr = append(hdlr, t.Handler...)
+	hdlr = append(hdlr, make([]byte, 12)...)
+	hdlr = append(hdlr, name...)
+	hdlr = append(hdlr, 0)
+	return fullBox("hdlr", 0, 0, hdlr)
+}
+
+func (t *Track) minf() []byte {
+	var header []byte
+	if t.Handler == "soun" {
+		header = fullBox("smhd", 0, 0, make([]byte, 4))
+	} else {
+		header = fullBox("vmhd", 0, 1, make([]byte, 8))
+	}
+	// the media data is in the same file
+	dref := fullBox("dref", 0, 0, binary.BigEndian.AppendUint32(nil, 1), fullBox("url ", 0, 1))
+	return box("minf", header, box("dinf", dref), t.stbl())
+}
+
+func (t *Track) stbl() []byte {
+	stsd := fullBox("stsd", 0, 0, binary.BigEndian.AppendUint32(nil, 1), t.SampleEntry)
+	children := [][]byte{stsd, t.stts()}
+	if ctts := t.ctts(); ctts != nil {
+		children = append(children, ctts)
+	}
+	// every sample is a sync sample if there is no stss
+	if len(t.syncs) < len(t.sizes) {
+		stss := binary.BigEndian.AppendUint32(nil, uint32(len(t.syncs)))
+		for _, n := range t.syncs {
+			stss = binary.BigEndian.AppendUint32(stss, n)
+		}
+		children = append(children, fullBox("stss", 0, 0, stss))
+	}
+	children = append(children, t.stsc(), t.stsz(), t.stco())
+	return box("stbl", children...)
+}
+
+func (t *Track) stts() []byte {
+	var (
+		entries []byte
+		count   uint32
+		run     uint32
+		delta   uint32
+	)
+	for i := range t.dts {
+		d := delta
+		if i+1 < len(t.dts) {
+			d = uint32(t.dts[i+1] - t.dts[i])
+		} else if i == 0 {
+			d = 1
+		}
+		if run > 0 && d == delta {
+			run++
+			continue
+		}
+		if run > 0 {
+			entries = binary.BigEndian.AppendUint32(entries, run)
+			entries = binary.BigEndian.AppendUint32(entries, delta)
+			count++
+		}
+		run, delta = 1, d
+	}
+	entries = binary.BigEndian.AppendUint32(entries, run)
+	entries = binary.BigEndian.AppendUint32(entries, delta)
+	count++
+	return fullBox("stts", 0, 0, binary.BigEndian.AppendUint32(nil, count), entries)
+}
+
+// ctts returns nil if the presentation order is the decoding order.
+func (t *Track) ctts() []byte {
+	var (
+		entries  []byte
+		count    uint32
+		run      uint32
+		offset   int32
+		reorder  bool
+		negative bool
+	)
+	for i, o := range t.ctsOffsets {
+		if o != 0 {
+			reorder = true
+		}
+		if o < 0 {
+			negative = true
+		}
+		if i > 0 && o == offset {
+			run++
+			continue
+		}
+		if run > 0 {
+			entries = binary.BigEndian.AppendUint32(entries, run)
+			entries = binary.BigEndian.AppendUint32(entries, uint32(offset))
+			count++
+		}
+		run, offset = 1, o
+	}
+	if !reorder {
+		return nil
+	}
+	entries = binary.BigEndian.AppendUint32(entries, run)
+	entries = binary.BigEndian.AppendUint32(entries, uint32(offset))
+	count++
+	var version byte
+	if negative {
+		version = 1
+	}
+	return fullBox("ctts", version, 0, binary.BigEndian.AppendUint32(nil, count), entries)
+}
+
+func (t *Track) stsc() []byte {
+	var (
+		entries []byte
+		count   uint32
+		last    uint32
+	)
+	for i, c := range t.chunks {
+		if i > 0 && c.samples == last {
+			continue
+		}
+		entries = binary.BigEndian.AppendUint32(entries, uint32(i+1))
+		entries = binary.BigEndian.AppendUint32(entries, c.samples)
+		entries = binary.BigEndian.AppendUint32(entries, 1)
+		count++
+		last = c.samples
+	}
+	return fullBox("stsc", 0, 0, binary.BigEndian.AppendUint32(nil, count), entries)
+}
+
+func (t *Track) stsz() []byte {
+	stsz := binary.BigEndian.AppendUint32(nil, 0)
+	stsz = binary.BigEndian.AppendUint32(stsz, uint32(len(t.sizes)))
+	for _, size := range t.sizes {
+		stsz = binary.BigEndian.AppendUint32(stsz, size)
+	}
+	return fullBox("stsz", 0, 0, stsz)
+}
+
+// stco returns a co64 box instead if the file is larger than 4GB.
+func (t *Track) stco() []byte {
+	large := t.chunks[len(t.chunks)-1].offset > math.MaxUint32
+	offsets := binary.BigEndian.AppendUint32(nil, uint32(len(t.chunks)))
+	for _, c := range t.chunks {
+		if large {
+			offsets = binary.BigEndian.AppendUint64(offsets, c.offset)
+		} else {
+			offsets = binary.BigEndian.AppendUint32(offsets, uint32(c.offset))
+		}
+	}
+	if large {
+		return fullBox("co64", 0, 0, offsets)
+	}
+	return fullBox("stco", 0, 0, offsets)
+}
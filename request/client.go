@@ -0,0 +1,208 @@
+package request
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTimeout             = 15 * time.Minute
+	defaultConnectTimeout      = 10 * time.Second
+	defaultMaxIdleConnsPerHost = 16
+)
+
+// Client sends the requests with its own options and cookie jar,
+// the clients of the same network options share their connections.
+// The methods of a nil Client use the default client.
+type Client struct {
+	options Options
+	http    *http.Client
+	jar     *Jar
+}
+
+// defaultClient is the client of the package-level functions
+var defaultClient atomic.Pointer[Client]
+
+// Default returns the client of the package-level functions.
+func Default() *Client {
+	if c := defaultClient.Load(); c != nil {
+		return c
+	}
+	defaultClient.CompareAndSwap(nil, NewClient(Options{}))
+	return defaultClient.Load()
+}
+
+// SetDefault sets the client of the package-level functions.
+func SetDefault(c *Client) {
+	defaultClient.Store(c)
+}
+
+// NewClient returns a client of the options with a new cookie jar.
+func NewClient(opt Options) *Client {
+	c := newClient(opt, NewJar())
+	c.jar.Add(c.fileCookies())
+	return c
+}
+
+func newClient(opt Options, jar *Jar) *Client {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	c := &Client{
+		options: opt,
+		http: &http.Client{
+			Transport: sharedTransport(opt),
+			Timeout:   timeout,
+			Jar:       jar,
+		},
+		jar: jar,
+	}
+	return c
+}
+
+// fileCookies returns the cookies of the Cookie option if it's a cookies.txt file.
+func (c *Client) fileCookies() []*http.Cookie {
+	if c.options.Cookie == "" {
+		return nil
+	}
+	cookies, _ := ParseCookieFile(strings.NewReader(c.options.Cookie))
+	return cookies
+}
+
+// With returns a client of the options of c overridden by the non-zero options of opt, it shares the cookie jar of c.
+func (c *Client) With(opt Options) *Client {
+	c = c.orDefault()
+	options := c.options
+	if opt.RetryTimes != 0 {
+		options.RetryTimes = opt.RetryTimes
+	}
+	if opt.Cookie != "" {
+		options.Cookie = opt.Cookie
+	}
+	if opt.UserAgent != "" {
+		options.UserAgent = opt.UserAgent
+	}
+	if opt.Refer != "" {
+		options.Refer = opt.Refer
+	}
+	if opt.Proxy != "" {
+		options.Proxy = opt.Proxy
+	}
+	if opt.Timeout != 0 {
+		options.Timeout = opt.Timeout
+	}
+	if opt.ConnectTimeout != 0 {
+		options.ConnectTimeout = opt.ConnectTimeout
+	}
+	if opt.MaxIdleConnsPerHost != 0 {
+		options.MaxIdleConnsPerHost = opt.MaxIdleConnsPerHost
+	}
+	if opt.Retry != (RetryPolicy{}) {
+		options.Retry = opt.Retry
+	}
+	if opt.HostRetry != nil {
+		options.HostRetry = opt.HostRetry
+	}
+	options.Debug = options.Debug || opt.Debug
+	options.Silent = options.Silent || opt.Silent
+	derived := newClient(options, c.jar)
+	if opt.Cookie != "" {
+		derived.jar.Add(derived.fileCookies())
+	}
+	return derived
+}
+
+// Options returns the options of the client.
+func (c *Client) Options() Options {
+	return c.orDefault().options
+}
+
+// Jar returns the cookie jar of the client, it's shared by the clients derived by With.
+func (c *Client) Jar() *Jar {
+	return c.orDefault().jar
+}
+
+// HTTPClient returns the HTTP client of the client, its connections and cookies are shared by the requests of the client.
+// Copy it to change its redirect policy or its timeout.
+func (c *Client) HTTPClient() *http.Client {
+	return c.orDefault().http
+}
+
+func (c *Client) orDefault() *Client {
+	if c == nil {
+		return Default()
+	}
+	return c
+}
+
+// transportOptions are the options of a shared transport, the zero values mean the defaults.
+type transportOptions struct {
+	connectTimeout      time.Duration
+	maxIdleConnsPerHost int
+	proxy               string
+}
+
+var (
+	transportsLock sync.Mutex
+	// transports are the shared transports by their options
+	transports = make(map[transportOptions]*http.Transport)
+)
+
+// sharedTransport returns the transport of the network options, it's created once for the same options.
+func sharedTransport(opt Options) *http.Transport {
+	opts := transportOptions{
+		connectTimeout:      opt.ConnectTimeout,
+		maxIdleConnsPerHost: opt.MaxIdleConnsPerHost,
+		proxy:               opt.Proxy,
+	}
+	if opts.connectTimeout == 0 {
+		opts.connectTimeout = defaultConnectTimeout
+	}
+	if opts.maxIdleConnsPerHost == 0 {
+		opts.maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+	if transport, ok := transports[opts]; ok {
+		return transport
+	}
+	transport := newTransport(opts)
+	transports[opts] = transport
+	return transport
+}
+
+func newTransport(opts transportOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opts.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: dialer.DialContext,
+		// the custom dialer and TLS config disable HTTP/2 unless it's forced
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: opts.maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		// the bodies are decompressed by GetByte, the downloader saves them as is
+		DisableCompression:    true,
+		TLSHandshakeTimeout:   opts.connectTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+	}
+	if opts.proxy != "" {
+		// an invalid proxy fails the requests
+		proxy, err := url.Parse(opts.proxy)
+		transport.Proxy = func(*http.Request) (*url.URL, error) {
+			return proxy, err
+		}
+	}
+	return transport
+}
@@ -0,0 +1,123 @@
+package request
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Query().Get("user")})
+			return
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(cookie.Value + " " + r.UserAgent())) // nolint
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(Options{RetryTimes: 1, UserAgent: "lux"})
+	if _, err := client.Get(server.URL+"/login?user=a", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// the cookie of the previous response is kept
+	for i := 0; i < 5; i++ {
+		if body, err := client.Get(server.URL+"/video", "", nil); err != nil || body != "a lux" {
+			t.Fatalf("Get() = %q, %v", body, err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections are opened, want 1", n)
+	}
+
+	// the clients don't share their cookies and options
+	other := NewClient(Options{RetryTimes: 1, UserAgent: "other"})
+	if _, err := other.Get(server.URL+"/video", "", nil); err == nil {
+		t.Error("the cookies of the other client are sent")
+	}
+	var wg sync.WaitGroup
+	for _, c := range []*Client{client, other} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			user := "a"
+			if c == other {
+				user = "b"
+				if _, err := c.Get(server.URL+"/login?user=b", "", nil); err != nil {
+					t.Error(err)
+				}
+			}
+			if body, _ := c.Get(server.URL+"/video", "", nil); body != user+" "+c.Options().UserAgent {
+				t.Errorf("Get() = %q with the cookie of %s", body, user)
+			}
+		}(c)
+	}
+	wg.Wait()
+	if client.HTTPClient().Transport != other.HTTPClient().Transport {
+		t.Error("the clients of the same network options don't share the transport")
+	}
+
+	// With keeps the cookies and the other options
+	derived := client.With(Options{UserAgent: "derived", ConnectTimeout: time.Second})
+	if body, err := derived.Get(server.URL+"/video", "", nil); err != nil || body != "a derived" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+	if derived.Options().RetryTimes != 1 || derived.HTTPClient().Transport == client.HTTPClient().Transport {
+		t.Errorf("unexpected options %+v", derived.Options())
+	}
+	header, err := derived.Header(server.URL+"/video", nil)
+	if err != nil || header.Get("Cookie") != "session=a" {
+		t.Errorf("Header() = %v, %v, want the cookie of the jar", header, err)
+	}
+
+	// the package-level functions use the default client
+	defer SetDefault(Default())
+	SetDefault(client)
+	if body, err := Get(server.URL+"/video", "", nil); err != nil || body != "a lux" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+	// a nil client is the default client
+	var nilClient *Client
+	if body, err := nilClient.Get(server.URL+"/video", "", nil); err != nil || body != "a lux" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+	SetOptions(Options{RetryTimes: 1, Timeout: time.Minute})
+	if HTTPClient().Timeout != time.Minute || HTTPClient().Transport != client.HTTPClient().Transport {
+		t.Error("the default client doesn't have the new timeout and the same transport")
+	}
+	if _, err := Get(server.URL+"/video", "", nil); err != nil {
+		t.Errorf("the cookies are lost by SetOptions: %v", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxy " + r.URL.String())) // nolint
+	}))
+	defer proxy.Close()
+
+	client := NewClient(Options{RetryTimes: 1, Proxy: proxy.URL})
+	if body, err := client.Get("http://example.com/video", "", nil); err != nil || body != "proxy http://example.com/video" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+	client = NewClient(Options{RetryTimes: 1, Proxy: "://invalid"})
+	if _, err := client.Get("http://example.com/video", "", nil); err == nil {
+		t.Error("Get() should fail with an invalid proxy")
+	}
+}
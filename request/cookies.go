@@ -0,0 +1,247 @@
+package request
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// httpOnlyPrefix marks the HttpOnly cookies of a cookies.txt file, the lines of the other comments start with #
+const httpOnlyPrefix = "#HttpOnly_"
+
+// Jar is a cookie jar which sends the cookies only to their domains and paths.
+// Unlike cookiejar.Jar, it keeps the attributes of its cookies so that they can be saved as a Netscape cookies.txt file.
+type Jar struct {
+	jar  *cookiejar.Jar
+	lock sync.Mutex
+	// cookies are the cookies of the jar by their domain, path and name,
+	// the domain has a leading dot if the cookie is sent to the subdomains
+	cookies map[cookieKey]*http.Cookie
+}
+
+type cookieKey struct {
+	domain, path, name string
+}
+
+// NewJar returns an empty cookie jar.
+func NewJar() *Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &Jar{jar: jar, cookies: make(map[cookieKey]*http.Cookie)}
+}
+
+// Cookies implements http.CookieJar.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar, it keeps the cookies which cookiejar.Jar accepts.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	host := strings.ToLower(u.Hostname())
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, cookie := range cookies {
+		domain, ok := cookieDomain(host, cookie.Domain)
+		if !ok {
+			continue
+		}
+		path := cookie.Path
+		if !strings.HasPrefix(path, "/") {
+			path = defaultCookiePath(u.Path)
+		}
+		key := cookieKey{domain, path, cookie.Name}
+		expires := cookie.Expires
+		if cookie.MaxAge > 0 {
+			expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		if cookie.MaxAge < 0 || (!expires.IsZero() && !expires.After(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = &http.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   domain,
+			Path:     path,
+			Expires:  expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+	}
+}
+
+// cookieDomain returns the domain of a cookie set by the host, like cookiejar.Jar does,
+// with a leading dot if the cookie is sent to the subdomains. It returns false if the domain isn't allowed.
+func cookieDomain(host, domain string) (string, bool) {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" {
+		return host, true
+	}
+	if net.ParseIP(host) != nil {
+		// an IP address only sets its own cookies
+		return host, host == domain
+	}
+	if host != domain && !strings.HasSuffix(host, "."+domain) {
+		return "", false
+	}
+	if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+		// a public suffix only sets its own cookies, eg: the cookies of github.io can't be sent to its subdomains
+		return host, host == domain
+	}
+	return "." + domain, true
+}
+
+// defaultCookiePath returns the path of a cookie without a Path attribute, see RFC 6265 section 5.1.4.
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Add adds the cookies whose Domain and Path are set, eg: by ParseCookieFile.
+// A cookie is sent to the subdomains of its domain if the domain has a leading dot.
+func (j *Jar) Add(cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		if cookie.Domain == "" {
+			continue
+		}
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		u := &url.URL{Scheme: "http", Host: host, Path: cookie.Path}
+		if cookie.Secure {
+			u.Scheme = "https"
+		}
+		c := *cookie
+		if !strings.HasPrefix(cookie.Domain, ".") {
+			// the cookies without a Domain attribute are only sent to the host
+			c.Domain = ""
+		}
+		j.SetCookies(u, []*http.Cookie{&c})
+	}
+}
+
+// SetHeader adds the cookies of a Cookie header, eg: "a=b; c=d", they are sent to the site of the URL and its subdomains.
+// The site is the domain under the public suffix, eg: the site of www.bilibili.com is bilibili.com.
+func (j *Jar) SetHeader(rawURL, header string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if u.Host == "" {
+		return errors.Errorf("the cookies of %q have no host", rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	// the cookies of an IP address or of a single label host, eg: localhost, are only sent to the host
+	domain := ""
+	if net.ParseIP(host) == nil {
+		if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			domain = site
+		}
+	}
+	cookies := (&http.Request{Header: http.Header{"Cookie": {header}}}).Cookies()
+	for _, cookie := range cookies {
+		cookie.Domain = domain
+		cookie.Path = "/"
+	}
+	j.SetCookies(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, cookies)
+	return nil
+}
+
+// Save writes the unexpired cookies of the jar in the Netscape cookies.txt format, the session cookies expire at 0.
+func (j *Jar) Save(w io.Writer) error {
+	now := time.Now()
+	j.lock.Lock()
+	lines := make([]string, 0, len(j.cookies))
+	for _, cookie := range j.cookies {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			continue
+		}
+		var expires int64
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Unix()
+		}
+		domain := cookie.Domain
+		if cookie.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		lines = append(lines, strings.Join([]string{
+			domain,
+			netscapeBool(strings.HasPrefix(cookie.Domain, ".")),
+			cookie.Path,
+			netscapeBool(cookie.Secure),
+			strconv.FormatInt(expires, 10),
+			cookie.Name,
+			cookie.Value,
+		}, "\t"))
+	}
+	j.lock.Unlock()
+	sort.Strings(lines)
+
+	if _, err := fmt.Fprintf(w, "# Netscape HTTP Cookie File\n\n%s\n", strings.Join(lines, "\n")); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// ParseCookieFile parses the cookies of a Netscape cookies.txt file, eg: exported by a browser extension.
+// The domain of a cookie has a leading dot if it's sent to the subdomains, the session cookies have no expiry time.
+// The lines which aren't cookies are skipped, so a Cookie header has no cookies.
+func ParseCookieFile(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 7)
+		if len(fields) < 7 {
+			continue
+		}
+		expires, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid expiry time of the cookie %q: %s", fields[5], fields[4])
+		}
+		domain := strings.ToLower(fields[0])
+		if strings.EqualFold(fields[1], "TRUE") && !strings.HasPrefix(domain, ".") {
+			domain = "." + domain
+		}
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   domain,
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(int64(expires), 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies, errors.WithStack(scanner.Err())
+}
@@ -0,0 +1,139 @@
+package request
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cookieFile = `# Netscape HTTP Cookie File
+# https://curl.se/docs/http-cookies.html
+
+.example.com	TRUE	/	FALSE	0	site	1
+www.example.com	FALSE	/video	TRUE	4102444800	video	2
+#HttpOnly_.example.com	TRUE	/	FALSE	0	session	3
+.example.com	TRUE	/	FALSE	946684800	expired	4
+`
+
+func cookieNames(jar *Jar, rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	var names []string
+	for _, cookie := range jar.Cookies(u) {
+		names = append(names, cookie.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCookieFile(t *testing.T) {
+	cookies, err := ParseCookieFile(strings.NewReader(cookieFile))
+	if err != nil || len(cookies) != 4 {
+		t.Fatalf("ParseCookieFile() = %v, %v", cookies, err)
+	}
+	if c := cookies[1]; c.Domain != "www.example.com" || c.Path != "/video" || !c.Secure || c.Expires.Unix() != 4102444800 {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+	if c := cookies[2]; c.Domain != ".example.com" || !c.HttpOnly || !c.Expires.IsZero() {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+	if cookies, _ := ParseCookieFile(strings.NewReader("a=b; c=d")); len(cookies) != 0 {
+		t.Errorf("a Cookie header has the cookies %v", cookies)
+	}
+	if _, err := ParseCookieFile(strings.NewReader(".example.com\tTRUE\t/\tFALSE\tsoon\ta\tb")); err == nil {
+		t.Error("ParseCookieFile() should fail with an invalid expiry time")
+	}
+
+	jar := NewJar()
+	jar.Add(cookies)
+	for rawURL, want := range map[string]string{
+		"https://www.example.com/video/1": "video,site,session",
+		"http://www.example.com/video/1":  "site,session",
+		"https://api.example.com/":        "site,session",
+		"https://cdn.example.net/":        "",
+	} {
+		if got := cookieNames(jar, rawURL); got != want {
+			t.Errorf("the cookies of %s are %q, want %q", rawURL, got, want)
+		}
+	}
+
+	var saved bytes.Buffer
+	if err := jar.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Netscape HTTP Cookie File\n\n" +
+		"#HttpOnly_.example.com\tTRUE\t/\tFALSE\t0\tsession\t3\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsite\t1\n" +
+		"www.example.com\tFALSE\t/video\tTRUE\t4102444800\tvideo\t2\n"
+	if saved.String() != want {
+		t.Errorf("Save() = %q, want %q", saved.String(), want)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	jar := NewJar()
+	if err := jar.SetHeader("https://www.bilibili.com/video/av20203945", "SESSDATA=a; bili_jct=b"); err != nil {
+		t.Fatal(err)
+	}
+	for rawURL, want := range map[string]string{
+		"https://api.bilibili.com/x/player": "SESSDATA,bili_jct",
+		"https://upos.bilivideo.com/1.m4s":  "",
+	} {
+		if got := cookieNames(jar, rawURL); got != want {
+			t.Errorf("the cookies of %s are %q, want %q", rawURL, got, want)
+		}
+	}
+	if err := jar.SetHeader("av20203945", "a=b"); err == nil {
+		t.Error("SetHeader() should fail without a host")
+	}
+
+	// the cookies set by the servers are kept with their attributes
+	u, _ := url.Parse("https://www.bilibili.com/video/av20203945")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "buvid", Value: "c", Domain: ".bilibili.com", Path: "/", MaxAge: 3600},
+		{Name: "SESSDATA", Value: "", Domain: "bilibili.com", Path: "/", MaxAge: -1},
+		{Name: "page", Value: "d"},
+		// a cookie of another site is rejected
+		{Name: "evil", Value: "e", Domain: "example.com"},
+		// a cookie of a public suffix is only sent to the host
+		{Name: "suffix", Value: "f", Domain: "com"},
+	})
+	var saved bytes.Buffer
+	jar.Save(&saved) // nolint
+	lines := strings.Split(strings.TrimSpace(saved.String()), "\n")[2:]
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], ".bilibili.com\tTRUE\t/\tFALSE\t") ||
+		!strings.HasSuffix(lines[0], "\tbili_jct\tb") || !strings.HasSuffix(lines[1], "\tbuvid\tc") ||
+		lines[2] != "www.bilibili.com\tFALSE\t/video\tFALSE\t0\tpage\td" {
+		t.Errorf("unexpected cookies %q", lines)
+	}
+	expires, _ := strconv.ParseInt(strings.Split(lines[1], "\t")[4], 10, 64)
+	if want := time.Now().Add(time.Hour).Unix(); expires < want-60 || expires > want {
+		t.Errorf("the cookie expires at %d, want %d", expires, want)
+	}
+}
+
+func TestClientCookieFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Cookie"))) // nolint
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{RetryTimes: 1, Cookie: "127.0.0.1\tFALSE\t/\tFALSE\t0\tlocal\t1\n.example.com\tTRUE\t/\tFALSE\t0\tremote\t2\n"})
+	if body, err := client.Get(server.URL, "", nil); err != nil || body != "local=1" {
+		t.Errorf("Get() = %q, %v, want only the cookie of the host", body, err)
+	}
+	// a Cookie header is only sent to the site it's added to
+	client = NewClient(Options{RetryTimes: 1, Cookie: "a=b"})
+	if body, err := client.Get(server.URL, "", nil); err != nil || body != "" {
+		t.Errorf("Get() = %q, %v, want no cookies", body, err)
+	}
+	if err := client.Jar().SetHeader(server.URL, "a=b"); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := client.Get(server.URL, "", nil); err != nil || body != "a=b" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+}
@@ -3,16 +3,14 @@ package request
 import (
 	"compress/flate"
 	"compress/gzip"
-	"crypto/tls"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"strconv"
 	"strings"
 	"time"
 
-	cookiemonster "github.com/MercuryEngineering/CookieMonster"
 	"github.com/fatih/color"
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
@@ -20,106 +18,111 @@ import (
 	"github.com/hydrz/lux/config"
 )
 
-var (
-	retryTimes int
-	rawCookie  string
-	userAgent  string
-	refer      string
-	debug      bool
-)
-
 // Options defines common request options.
 type Options struct {
 	RetryTimes int
-	Cookie     string
-	UserAgent  string
-	Refer      string
-	Debug      bool
-	Silent     bool
+	// Cookie is the content of a cookies.txt file whose cookies are added to the jar and only sent to their domains.
+	// The cookies of a Cookie header, eg: "a=b; c=d", don't know their site and aren't sent,
+	// add them to the jar with Jar().SetHeader to send them to a site and its subdomains.
+	Cookie    string
+	UserAgent string
+	Refer     string
+	Debug     bool
+	Silent    bool
+	// Proxy is the URL of the proxy, eg: http://127.0.0.1:8080, empty means the proxy of the environment
+	Proxy string
+	// Timeout is the timeout of a request including reading its body, 0 means 15 minutes
+	Timeout time.Duration
+	// ConnectTimeout is the timeout of dialing and of the TLS handshake, 0 means 10 seconds
+	ConnectTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of the idle connections kept for each host, 0 means 16
+	MaxIdleConnsPerHost int
+	// Retry is the retry policy of the requests
+	Retry RetryPolicy
+	// HostRetry are the retry policies by host, they override Retry for the hosts and their subdomains
+	HostRetry map[string]RetryPolicy
 }
 
-// SetOptions sets the common request option.
+// SetOptions replaces the default client with a client of the options, the cookie jar of the default client is kept.
+// The extractors and the downloaders should be given a Client instead.
 func SetOptions(opt Options) {
-	retryTimes = opt.RetryTimes
-	rawCookie = opt.Cookie
-	userAgent = opt.UserAgent
-	refer = opt.Refer
-	debug = opt.Debug
+	c := newClient(opt, Default().jar)
+	c.jar.Add(c.fileCookies())
+	SetDefault(c)
+}
+
+// HTTPClient returns the HTTP client of the default client.
+func HTTPClient() *http.Client {
+	return Default().HTTPClient()
 }
 
 // Request base request
 func Request(method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
-	transport := &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
-		DisableCompression:  true,
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-	}
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   15 * time.Minute,
-		Jar:       jar,
-	}
+	return Default().Request(method, url, body, headers)
+}
 
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	for k, v := range config.FakeHeaders {
-		req.Header.Set(k, v)
-	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-	if _, ok := headers["Referer"]; !ok {
-		req.Header.Set("Referer", url)
-	}
-	if rawCookie != "" {
-		// parse cookies in Netscape HTTP cookie format
-		cookies, _ := cookiemonster.ParseString(rawCookie)
-		if len(cookies) > 0 {
-			for _, c := range cookies {
-				req.AddCookie(c)
-			}
-		} else {
-			// cookie is not Netscape HTTP format, set it directly
-			// a=b; c=d
-			req.Header.Set("Cookie", rawCookie)
-		}
-	}
+// RequestWithContext is like Request but the request and its retries are canceled with ctx.
+func RequestWithContext(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	return Default().RequestWithContext(ctx, method, url, body, headers)
+}
 
-	if userAgent != "" {
-		req.Header.Set("User-Agent", userAgent)
-	}
+// Request sends a request with the options of the client, it's retried by the retry policy of the host if it fails.
+func (c *Client) Request(method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	return c.RequestWithContext(context.Background(), method, url, body, headers)
+}
 
-	if refer != "" {
-		req.Header.Set("Referer", refer)
+// RequestWithContext is like Request but the request and its retries are canceled with ctx.
+func (c *Client) RequestWithContext(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	c = c.orDefault()
+	return c.request(ctx, method, url, body, headers, c.RetryPolicy(url).MaxAttempts(c.options.RetryTimes))
+}
+
+// RequestOnceWithContext is like RequestWithContext but the request isn't retried, eg: for the callers which retry it themselves.
+// The error of a response whose status code is 400 or above is a *StatusError.
+func (c *Client) RequestOnceWithContext(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	return c.orDefault().request(ctx, method, url, body, headers, 1)
+}
+
+// request sends a request up to attempts times with the retry policy of the host.
+func (c *Client) request(ctx context.Context, method, url string, body io.Reader, headers map[string]string, attempts int) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, url, body, headers)
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		res          *http.Response
-		requestError error
-	)
-	for i := 0; ; i++ {
-		res, requestError = client.Do(req)
+	policy := c.RetryPolicy(url)
+	var res *http.Response
+	for i := 1; ; i++ {
+		var requestError error
+		res, requestError = c.http.Do(req)
 		if requestError == nil && res.StatusCode < 400 {
 			break
-		} else if i+1 >= retryTimes {
-			var err error
-			if requestError != nil {
-				err = errors.Errorf("request error: %v", requestError)
-			} else {
-				err = errors.Errorf("%s request error: HTTP %d", url, res.StatusCode)
+		} else if ctx.Err() != nil {
+			return nil, errors.WithStack(ctx.Err())
+		}
+		if requestError != nil {
+			requestError = errors.WithMessage(requestError, "request error")
+		} else {
+			requestError = newStatusError(url, res)
+			// the connection is reused if the body is drained
+			io.Copy(io.Discard, io.LimitReader(res.Body, 4096)) // nolint
+			res.Body.Close()                                    // nolint
+		}
+		if i >= attempts || !IsRetryable(requestError) {
+			return nil, errors.WithStack(requestError)
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, errors.WithStack(err)
 			}
-			return nil, errors.WithStack(err)
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(policy.Delay(i, requestError)):
+		}
 	}
-	if debug {
+	if c.options.Debug {
 		blue := color.New(color.FgBlue)
 		fmt.Println()
 		blue.Printf("URL:         ") // nolint
@@ -138,21 +141,95 @@ func Request(method, url string, body io.Reader, headers map[string]string) (*ht
 	return res, nil
 }
 
+// newRequest returns a request with the fake headers, the headers, the user agent and the referer of the options,
+// the cookies are added by the jar.
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range config.FakeHeaders {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if _, ok := headers["Referer"]; !ok {
+		req.Header.Set("Referer", url)
+	}
+	if c.options.UserAgent != "" {
+		req.Header.Set("User-Agent", c.options.UserAgent)
+	}
+
+	if c.options.Refer != "" {
+		req.Header.Set("Referer", c.options.Refer)
+	}
+	return req, nil
+}
+
+// Header returns the headers of a GET request of the URL with the default client.
+func Header(url string, headers map[string]string) (http.Header, error) {
+	return Default().Header(url, headers)
+}
+
+// Header returns the headers of a GET request of the URL including the cookies of the jar, eg: for external downloaders.
+func (c *Client) Header(url string, headers map[string]string) (http.Header, error) {
+	c = c.orDefault()
+	req, err := c.newRequest(context.Background(), http.MethodGet, url, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range c.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	return req.Header, nil
+}
+
 // Get get request
 func Get(url, refer string, headers map[string]string) (string, error) {
-	body, err := GetByte(url, refer, headers)
+	return Default().Get(url, refer, headers)
+}
+
+// Get get request with the client
+func (c *Client) Get(url, refer string, headers map[string]string) (string, error) {
+	return c.GetWithContext(context.Background(), url, refer, headers)
+}
+
+// GetWithContext is like Get but the request is canceled with ctx.
+func GetWithContext(ctx context.Context, url, refer string, headers map[string]string) (string, error) {
+	return Default().GetWithContext(ctx, url, refer, headers)
+}
+
+// GetWithContext is like Get but the request is canceled with ctx.
+func (c *Client) GetWithContext(ctx context.Context, url, refer string, headers map[string]string) (string, error) {
+	body, err := c.GetByteWithContext(ctx, url, refer, headers)
 	return string(body), err
 }
 
 // GetByte get request
 func GetByte(url, refer string, headers map[string]string) ([]byte, error) {
+	return Default().GetByte(url, refer, headers)
+}
+
+// GetByte get request with the client
+func (c *Client) GetByte(url, refer string, headers map[string]string) ([]byte, error) {
+	return c.GetByteWithContext(context.Background(), url, refer, headers)
+}
+
+// GetByteWithContext is like GetByte but the request is canceled with ctx.
+func GetByteWithContext(ctx context.Context, url, refer string, headers map[string]string) ([]byte, error) {
+	return Default().GetByteWithContext(ctx, url, refer, headers)
+}
+
+// GetByteWithContext is like GetByte but the request is canceled with ctx.
+func (c *Client) GetByteWithContext(ctx context.Context, url, refer string, headers map[string]string) ([]byte, error) {
 	if headers == nil {
 		headers = map[string]string{}
 	}
 	if refer != "" {
 		headers["Referer"] = refer
 	}
-	res, err := Request(http.MethodGet, url, nil, headers)
+	res, err := c.RequestWithContext(ctx, http.MethodGet, url, nil, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -178,10 +255,25 @@ func GetByte(url, refer string, headers map[string]string) ([]byte, error) {
 
 // Headers return the HTTP Headers of the url
 func Headers(url, refer string) (http.Header, error) {
+	return Default().Headers(url, refer)
+}
+
+// Headers return the HTTP Headers of the url with the client
+func (c *Client) Headers(url, refer string) (http.Header, error) {
+	return c.HeadersWithContext(context.Background(), url, refer)
+}
+
+// HeadersWithContext is like Headers but the request is canceled with ctx.
+func HeadersWithContext(ctx context.Context, url, refer string) (http.Header, error) {
+	return Default().HeadersWithContext(ctx, url, refer)
+}
+
+// HeadersWithContext is like Headers but the request is canceled with ctx.
+func (c *Client) HeadersWithContext(ctx context.Context, url, refer string) (http.Header, error) {
 	headers := map[string]string{
 		"Referer": refer,
 	}
-	res, err := Request(http.MethodGet, url, nil, headers)
+	res, err := c.RequestWithContext(ctx, http.MethodGet, url, nil, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -191,7 +283,22 @@ func Headers(url, refer string) (http.Header, error) {
 
 // Size get size of the url
 func Size(url, refer string) (int64, error) {
-	h, err := Headers(url, refer)
+	return Default().Size(url, refer)
+}
+
+// Size get size of the url with the client
+func (c *Client) Size(url, refer string) (int64, error) {
+	return c.SizeWithContext(context.Background(), url, refer)
+}
+
+// SizeWithContext is like Size but the request is canceled with ctx.
+func SizeWithContext(ctx context.Context, url, refer string) (int64, error) {
+	return Default().SizeWithContext(ctx, url, refer)
+}
+
+// SizeWithContext is like Size but the request is canceled with ctx.
+func (c *Client) SizeWithContext(ctx context.Context, url, refer string) (int64, error) {
+	h, err := c.HeadersWithContext(ctx, url, refer)
 	if err != nil {
 		return 0, err
 	}
@@ -208,7 +315,12 @@ func Size(url, refer string) (int64, error) {
 
 // ContentType get Content-Type of the url
 func ContentType(url, refer string) (string, error) {
-	h, err := Headers(url, refer)
+	return Default().ContentType(url, refer)
+}
+
+// ContentType get Content-Type of the url with the client
+func (c *Client) ContentType(url, refer string) (string, error) {
+	h, err := c.Headers(url, refer)
 	if err != nil {
 		return "", err
 	}
@@ -50,9 +50,8 @@ func TestGet(t *testing.T) {
 	}
 
 	// with config
-	debug = true
-	rawCookie = "name: value;"
-	_, err = Get("https://google.com", "", nil)
+	client := NewClient(Options{Debug: true, Cookie: "name: value;"})
+	_, err = client.Get("https://google.com", "", nil)
 	if err != nil {
 		t.Error()
 	}
@@ -0,0 +1,203 @@
+package request
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetryMinDelay = 1 * time.Second
+	defaultRetryMaxDelay = 1 * time.Minute
+)
+
+// RetryPolicy defines how the failed requests of a host are retried.
+// The delay before a retry is doubled for each attempt up to MaxDelay and randomized by up to half of it,
+// the Retry-After header of the 429 and 503 responses is used instead if it's present.
+type RetryPolicy struct {
+	// Attempts is the number of attempts of a request including the first one, 0 means Options.RetryTimes
+	Attempts int
+	// MinDelay is the delay before the first retry, 0 means 1 second
+	MinDelay time.Duration
+	// MaxDelay is the maximum delay before a retry, including the delays of Retry-After, 0 means 1 minute
+	MaxDelay time.Duration
+}
+
+// MaxAttempts returns the number of attempts of the policy, attempts is the number of the attempts if the policy doesn't set it.
+func (p RetryPolicy) MaxAttempts(attempts int) int {
+	if p.Attempts > 0 {
+		return p.Attempts
+	}
+	return attempts
+}
+
+// Delay returns the delay before retrying the attempt-th attempt which failed with err, attempt starts from 1.
+func (p RetryPolicy) Delay(attempt int, err error) time.Duration {
+	minDelay, maxDelay := p.MinDelay, p.MaxDelay
+	if minDelay <= 0 {
+		minDelay = defaultRetryMinDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.RetryAfter > 0 {
+		return min(statusError.RetryAfter, maxDelay)
+	}
+
+	delay := maxDelay
+	// the shift overflows after 62 attempts
+	if shift := attempt - 1; shift < 62 && minDelay <= maxDelay>>shift {
+		delay = minDelay << shift
+	}
+	// keep at least half of the delay so that the retries don't come too early
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// StatusError is the error of a response whose status code is 400 or above.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay of the Retry-After header of the 429 and 503 responses, 0 if it's absent
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s request error: HTTP %d", e.URL, e.StatusCode)
+}
+
+// newStatusError returns the error of the response.
+func newStatusError(url string, res *http.Response) *StatusError {
+	err := &StatusError{URL: url, StatusCode: res.StatusCode}
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, which is either seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// IsRetryable reports whether a request which failed with err may succeed if it's retried.
+// The network errors, the 408, 425, 429 responses and the 5xx responses except 501 and 505 are retryable,
+// the other client errors, the canceled requests, DNS misses and the invalid certificates are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		switch code := statusError.StatusCode; code {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+			return false
+		default:
+			return code >= 500
+		}
+	}
+	var (
+		dnsError        *net.DNSError
+		unknownAuth     x509.UnknownAuthorityError
+		hostnameError   x509.HostnameError
+		certificateErr  x509.CertificateInvalidError
+		invalidURLError *url.Error
+	)
+	switch {
+	case errors.As(err, &dnsError):
+		return !dnsError.IsNotFound
+	case errors.As(err, &unknownAuth), errors.As(err, &hostnameError), errors.As(err, &certificateErr):
+		return false
+	case errors.As(err, &invalidURLError) && strings.Contains(invalidURLError.Err.Error(), "unsupported protocol scheme"):
+		return false
+	}
+	return true
+}
+
+// RetryPolicy returns the retry policy of the host of the URL, the policy of a host applies to its subdomains.
+// The fields which the policy of the host doesn't set are those of Options.Retry.
+func (c *Client) RetryPolicy(rawURL string) RetryPolicy {
+	options := c.orDefault().options
+	u, err := url.Parse(rawURL)
+	if err != nil || len(options.HostRetry) == 0 {
+		return options.Retry
+	}
+	// the policy of the longest matching host wins
+	host := strings.ToLower(u.Hostname())
+	for host != "" {
+		if policy, ok := options.HostRetry[host]; ok {
+			if policy.Attempts == 0 {
+				policy.Attempts = options.Retry.Attempts
+			}
+			if policy.MinDelay == 0 {
+				policy.MinDelay = options.Retry.MinDelay
+			}
+			if policy.MaxDelay == 0 {
+				policy.MaxDelay = options.Retry.MaxDelay
+			}
+			return policy
+		}
+		_, host, _ = strings.Cut(host, ".")
+	}
+	return options.Retry
+}
+
+// ParseHostRetry parses the retry policies of the hosts, each one is "HOST=ATTEMPTS[,MIN_DELAY[,MAX_DELAY]]",
+// eg: "example.com=5,2s,30s". The delays which are left out are those of Options.Retry.
+func ParseHostRetry(specs []string) (map[string]RetryPolicy, error) {
+	policies := make(map[string]RetryPolicy, len(specs))
+	for _, spec := range specs {
+		host, value, ok := strings.Cut(spec, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" {
+			return nil, errors.Errorf("invalid retry policy %q, want HOST=ATTEMPTS[,MIN_DELAY[,MAX_DELAY]]", spec)
+		}
+		fields := strings.Split(value, ",")
+		if len(fields) > 3 {
+			return nil, errors.Errorf("invalid retry policy %q, want HOST=ATTEMPTS[,MIN_DELAY[,MAX_DELAY]]", spec)
+		}
+		var (
+			policy RetryPolicy
+			err    error
+		)
+		if policy.Attempts, err = strconv.Atoi(strings.TrimSpace(fields[0])); err != nil || policy.Attempts < 1 {
+			return nil, errors.Errorf("invalid attempts of the retry policy %q", spec)
+		}
+		if len(fields) > 1 {
+			if policy.MinDelay, err = time.ParseDuration(strings.TrimSpace(fields[1])); err != nil {
+				return nil, errors.WithMessagef(err, "invalid minimum delay of the retry policy %q", spec)
+			}
+		}
+		if len(fields) > 2 {
+			if policy.MaxDelay, err = time.ParseDuration(strings.TrimSpace(fields[2])); err != nil {
+				return nil, errors.WithMessagef(err, "invalid maximum delay of the retry policy %q", spec)
+			}
+		}
+		policies[host] = policy
+	}
+	return policies, nil
+}
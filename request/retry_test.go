@@ -0,0 +1,131 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/throttled":
+			if n == 1 {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("ok")) // nolint
+		case "/broken":
+			http.Error(w, "broken", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{RetryTimes: 5, Retry: RetryPolicy{MinDelay: time.Millisecond, MaxDelay: time.Millisecond}})
+	// a permanent error isn't retried
+	_, err := client.Get(server.URL+"/missing", "", nil)
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound || IsRetryable(err) {
+		t.Errorf("Get() error = %v, want a 404 status error", err)
+	}
+	if n := requests.Swap(0); n != 1 {
+		t.Errorf("the 404 response is requested %d times, want 1", n)
+	}
+
+	if body, err := client.Get(server.URL+"/throttled", "", nil); err != nil || body != "ok" {
+		t.Errorf("Get() = %q, %v", body, err)
+	}
+	requests.Store(0)
+
+	if _, err := client.Get(server.URL+"/broken", "", nil); !IsRetryable(err) {
+		t.Errorf("Get() error = %v, want a retryable error", err)
+	}
+	if n := requests.Swap(0); n != 5 {
+		t.Errorf("the 502 response is requested %d times, want 5", n)
+	}
+	if _, err := client.RequestOnceWithContext(context.Background(), http.MethodGet, server.URL+"/broken", nil, nil); !IsRetryable(err) {
+		t.Errorf("RequestOnceWithContext() error = %v, want a retryable error", err)
+	}
+	if n := requests.Swap(0); n != 1 {
+		t.Errorf("the 502 response is requested %d times, want 1", n)
+	}
+
+	// the policy of the host overrides the attempts
+	client = client.With(Options{HostRetry: map[string]RetryPolicy{"127.0.0.1": {Attempts: 2, MinDelay: time.Millisecond}}})
+	client.Get(server.URL+"/broken", "", nil) // nolint
+	if n := requests.Load(); n != 2 {
+		t.Errorf("the 502 response is requested %d times, want 2", n)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MinDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+		if delay := policy.Delay(attempt, nil); delay < want/2 || delay > want {
+			t.Errorf("Delay(%d) = %v, want between %v and %v", attempt, delay, want/2, want)
+		}
+	}
+	if delay := policy.Delay(1, &StatusError{StatusCode: 429, RetryAfter: 5 * time.Second}); delay != 5*time.Second {
+		t.Errorf("Delay() = %v, want the delay of Retry-After", delay)
+	}
+	if delay := policy.Delay(1, &StatusError{StatusCode: 503, RetryAfter: time.Hour}); delay != 10*time.Second {
+		t.Errorf("Delay() = %v, want the maximum delay", delay)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Mon, 01 Jan 2024 00:00:30 GMT": 30 * time.Second,
+		"Sun, 31 Dec 2023 00:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	client := NewClient(Options{
+		Retry:     RetryPolicy{Attempts: 3, MinDelay: 2 * time.Second, MaxDelay: time.Minute},
+		HostRetry: map[string]RetryPolicy{"example.com": {Attempts: 5}, "cdn.example.com": {Attempts: 7, MaxDelay: time.Hour}},
+	})
+	for rawURL, want := range map[string]int{
+		"https://example.com/a":        5,
+		"https://www.example.com/a":    5,
+		"https://a.cdn.example.com/a":  7,
+		"https://notexample.com/a":     3,
+		"https://EXAMPLE.com:8080/a":   5,
+		"https://example.org/a":        3,
+		"https://cdn.example.com.cn/a": 3,
+	} {
+		if got := client.RetryPolicy(rawURL).Attempts; got != want {
+			t.Errorf("RetryPolicy(%q).Attempts = %d, want %d", rawURL, got, want)
+		}
+	}
+	// the delays of a host policy default to the global ones
+	if got := client.RetryPolicy("https://example.com/a"); got != (RetryPolicy{5, 2 * time.Second, time.Minute}) {
+		t.Errorf("RetryPolicy() = %+v, want the global delays", got)
+	}
+	if got := client.RetryPolicy("https://cdn.example.com/a"); got != (RetryPolicy{7, 2 * time.Second, time.Hour}) {
+		t.Errorf("RetryPolicy() = %+v, want the maximum delay of the host", got)
+	}
+
+	policies, err := ParseHostRetry([]string{"Example.com=5,2s,30s", "cdn.example.org=3"})
+	if err != nil || policies["example.com"] != (RetryPolicy{5, 2 * time.Second, 30 * time.Second}) ||
+		policies["cdn.example.org"] != (RetryPolicy{Attempts: 3}) {
+		t.Errorf("ParseHostRetry() = %v, %v", policies, err)
+	}
+	for _, spec := range []string{"example.com", "=3", "example.com=0", "example.com=3,soon", "example.com=1,1s,1s,1s"} {
+		if _, err := ParseHostRetry([]string{spec}); err == nil {
+			t.Errorf("ParseHostRetry(%q) should fail", spec)
+		}
+	}
+}
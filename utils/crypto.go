@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// DecodeAESKey returns the 16 bytes AES-128 key of a key response,
+// the key can be raw bytes, a hex string or a base64 string.
+func DecodeAESKey(data []byte) ([]byte, error) {
+	if len(data) == aes.BlockSize {
+		return data, nil
+	}
+	text := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == aes.BlockSize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == aes.BlockSize {
+		return key, nil
+	}
+	return nil, errors.Errorf("invalid AES-128 key of %d bytes", len(data))
+}
+
+// AES128Decrypt decrypts AES-128-CBC data with PKCS7 padding.
+func AES128Decrypt(data, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.Errorf("invalid AES-128 IV of %d bytes", len(iv))
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.Errorf("encrypted data of %d bytes is not a multiple of the block size", len(data))
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// remove PKCS7 padding
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, errors.New("invalid PKCS7 padding, the key may be wrong")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("invalid PKCS7 padding, the key may be wrong")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func aes128Encrypt(t *testing.T, plain, key, iv []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data
+}
+
+func TestAES128Decrypt(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := make([]byte, aes.BlockSize)
+	iv[15] = 7
+	plain := []byte("segment data of an encrypted HLS stream")
+
+	got, err := AES128Decrypt(aes128Encrypt(t, plain, key, iv), key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("AES128Decrypt() = %q, want %q", got, plain)
+	}
+
+	if _, err := AES128Decrypt(aes128Encrypt(t, plain, key, iv), []byte("fedcba9876543210"), iv); err == nil {
+		t.Error("expected an error for a wrong key")
+	}
+	if _, err := AES128Decrypt(plain[:10], key, iv); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
+
+func TestDecodeAESKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "raw", data: key},
+		{name: "hex", data: []byte(hex.EncodeToString(key) + "\n")},
+		{name: "base64", data: []byte(base64.StdEncoding.EncodeToString(key))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAESKey(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Errorf("DecodeAESKey() = %x, want %x", got, key)
+			}
+		})
+	}
+	if _, err := DecodeAESKey([]byte("short")); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
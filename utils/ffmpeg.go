@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -27,11 +28,19 @@ func findFFmpegExecutable() string {
 	return ffmpegFileName
 }
 
-func runMergeCmd(cmd *exec.Cmd, paths []string, mergeFilePath string) error {
+func runMergeCmd(ctx context.Context, cmd *exec.Cmd, paths []string, mergeFilePath, mergedFilePath string) error {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	if err != nil {
+		if ctx.Err() != nil {
+			// ffmpeg is killed, the merged file is incomplete
+			os.Remove(mergedFilePath) // nolint
+			if mergeFilePath != "" {
+				os.Remove(mergeFilePath) // nolint
+			}
+			return errors.WithStack(ctx.Err())
+		}
 		return errors.Errorf("%s\n%s", err, stderr.String())
 	}
 
@@ -46,8 +55,8 @@ func runMergeCmd(cmd *exec.Cmd, paths []string, mergeFilePath string) error {
 }
 
 // MergeFilesWithSameExtension merges files that have the same extension into one.
-// Can also handle merging audio and video.
-func MergeFilesWithSameExtension(paths []string, mergedFilePath string) error {
+// Can also handle merging audio and video. ffmpeg is killed if ctx is canceled.
+func MergeFilesWithSameExtension(ctx context.Context, paths []string, mergedFilePath string) error {
 	cmds := []string{
 		"-y",
 	}
@@ -56,11 +65,11 @@ func MergeFilesWithSameExtension(paths []string, mergedFilePath string) error {
 	}
 	cmds = append(cmds, "-c:v", "copy", "-c:a", "copy", mergedFilePath)
 
-	return runMergeCmd(exec.Command(findFFmpegExecutable(), cmds...), paths, "")
+	return runMergeCmd(ctx, exec.CommandContext(ctx, findFFmpegExecutable(), cmds...), paths, "", mergedFilePath)
 }
 
-// MergeToMP4 merges video parts to an MP4 file.
-func MergeToMP4(paths []string, mergedFilePath string, filename string) error {
+// MergeToMP4 merges video parts to an MP4 file. ffmpeg is killed if ctx is canceled.
+func MergeToMP4(ctx context.Context, paths []string, mergedFilePath string, filename string) error {
 	mergeFilePath := filename + ".txt" // merge list file should be in the current directory
 
 	// write ffmpeg input file list
@@ -70,9 +79,23 @@ func MergeToMP4(paths []string, mergedFilePath string, filename string) error {
 	}
 	mergeFile.Close() // nolint
 
-	cmd := exec.Command(
-		findFFmpegExecutable(), "-y", "-f", "concat", "-safe", "0",
+	cmd := exec.CommandContext(
+		ctx, findFFmpegExecutable(), "-y", "-f", "concat", "-safe", "0",
 		"-i", mergeFilePath, "-c", "copy", "-bsf:a", "aac_adtstoasc", mergedFilePath,
 	)
-	return runMergeCmd(cmd, paths, mergeFilePath)
+	return runMergeCmd(ctx, cmd, paths, mergeFilePath, mergedFilePath)
+}
+
+// RunFFmpeg runs ffmpeg with the arguments, the error has the output of ffmpeg if it fails. ffmpeg is killed if ctx is canceled.
+func RunFFmpeg(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, findFFmpegExecutable(), args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return errors.WithStack(ctx.Err())
+		}
+		return errors.Errorf("%s\n%s", err, stderr.String())
+	}
+	return nil
 }
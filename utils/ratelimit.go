@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateRule limits the rate during a time of the day, eg: 23:00-07:00 unlimited.
+type RateRule struct {
+	// Start and End are the offsets from midnight, the rule spans midnight if End is before Start
+	Start time.Duration
+	End   time.Duration
+	// Rate is in bytes per second, 0 means unlimited
+	Rate int64
+}
+
+// contains reports whether the time of the day is within the rule.
+func (r RateRule) contains(t time.Time) bool {
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+	if r.Start <= r.End {
+		return offset >= r.Start && offset < r.End
+	}
+	return offset >= r.Start || offset < r.End
+}
+
+// RateLimiter is a token bucket of bytes shared by all the downloads using it.
+// The rate can be changed at any time, a rate of 0 means unlimited.
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     int64
+	schedule []RateRule
+	// tokens may be negative, the waiters have reserved the bytes they are going to read
+	tokens float64
+	last   time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter of the rate in bytes per second.
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{
+		rate: rate,
+		now:  time.Now,
+	}
+}
+
+// SetRate changes the rate in bytes per second used outside of the schedule.
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	l.rate = rate
+	l.mu.Unlock()
+}
+
+// SetSchedule changes the rates by the time of the day, the first matching rule wins.
+func (l *RateLimiter) SetSchedule(schedule []RateRule) {
+	l.mu.Lock()
+	l.schedule = schedule
+	l.mu.Unlock()
+}
+
+// Scheduled reports whether the rate changes by the time of the day.
+func (l *RateLimiter) Scheduled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.schedule) > 0
+}
+
+// Rate returns the current rate in bytes per second.
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.currentRate(l.now())
+}
+
+func (l *RateLimiter) currentRate(now time.Time) int64 {
+	for _, rule := range l.schedule {
+		if rule.contains(now) {
+			return rule.Rate
+		}
+	}
+	return l.rate
+}
+
+// WaitN blocks until n bytes may be transferred or ctx is canceled.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	rate := l.currentRate(now)
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.last.IsZero() {
+		// at most a second worth of bytes is saved up
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(rate), float64(rate))
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader returns a reader that reads from r within the rate.
+func (l *RateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// small reads make the throughput smoother at low rates
+	if rate := r.limiter.Rate(); rate > 0 && int64(len(p)) > rate/4+1 {
+		p = p[:rate/4+1]
+	}
+	n, err := r.r.Read(p)
+	if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// ParseRate parses a rate in bytes per second with an optional binary unit, eg: 500K, 2M, 1.5MiB
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	value := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "/S"), "B")
+	value = strings.TrimSuffix(value, "I")
+	unit := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0, errors.Errorf("invalid rate %q", s)
+	}
+	return int64(rate * float64(unit)), nil
+}
+
+// ParseRateSchedule parses comma separated rules like 23:00-07:00=0,09:00-18:00=1M
+func ParseRateSchedule(s string) ([]RateRule, error) {
+	var schedule []RateRule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		span, rate, ok := strings.Cut(item, "=")
+		start, end, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, errors.Errorf("invalid rate rule %q, eg: 23:00-07:00=0", item)
+		}
+		var (
+			rule RateRule
+			err  error
+		)
+		if rule.Start, err = parseTimeOfDay(start); err != nil {
+			return nil, err
+		}
+		if rule.End, err = parseTimeOfDay(end); err != nil {
+			return nil, err
+		}
+		if rule.Rate, err = ParseRate(rate); err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, nil
+}
+
+// parseTimeOfDay parses 15:04 as the offset from midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.Errorf("invalid time of the day %q, eg: 23:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1000", 1000},
+		{"500K", 500 << 10},
+		{"2M", 2 << 20},
+		{"1.5MiB", 3 << 19},
+		{"1g", 1 << 30},
+		{"100KB/s", 100 << 10},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "fast", "-1M"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseRateSchedule(t *testing.T) {
+	schedule, err := ParseRateSchedule("23:00-07:00=0, 09:00-18:30=1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 2 || schedule[1].End != 18*time.Hour+30*time.Minute || schedule[1].Rate != 1<<20 {
+		t.Fatalf("unexpected schedule %+v", schedule)
+	}
+	if _, err = ParseRateSchedule("23:00=0"); err == nil {
+		t.Error("a rule without an end should fail")
+	}
+
+	l := NewRateLimiter(100)
+	l.SetSchedule(schedule)
+	for clock, want := range map[string]int64{"23:30": 0, "06:59": 0, "08:00": 100, "12:00": 1 << 20, "18:30": 100} {
+		now, _ := time.Parse("15:04", clock)
+		l.now = func() time.Time { return now }
+		if got := l.Rate(); got != want {
+			t.Errorf("Rate() at %s = %d, want %d", clock, got, want)
+		}
+	}
+}
+
+func TestRateLimiterWaitN(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(1000)
+	l.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the first second worth of bytes is owed and must be waited for
+	if err := l.WaitN(ctx, 1000); err == nil {
+		t.Error("WaitN() should wait for the tokens")
+	}
+	// the bytes are available again a second later
+	now = now.Add(2 * time.Second)
+	if err := l.WaitN(ctx, 1000); err != nil {
+		t.Errorf("WaitN() = %v", err)
+	}
+
+	l.SetRate(0)
+	if err := l.WaitN(ctx, 1<<30); err != nil {
+		t.Errorf("an unlimited WaitN() = %v", err)
+	}
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.WaitN(ctx, 1); err != nil {
+		t.Errorf("a nil limiter shouldn't limit, got %v", err)
+	}
+}
+
+func TestRateLimiterReader(t *testing.T) {
+	l := NewRateLimiter(4 << 20)
+	data := bytes.Repeat([]byte{1}, 64<<10)
+	start := time.Now()
+	got, err := io.ReadAll(l.Reader(context.Background(), bytes.NewReader(data)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	// 64K at 4M/s
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond || elapsed > time.Second {
+		t.Errorf("reading took %v", elapsed)
+	}
+}
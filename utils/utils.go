@@ -214,7 +214,8 @@ func ParseInputFile(r io.Reader, items string, itemStart, itemEnd int) []string
 // GetNameAndExt return the name and ext of the URL
 // https://img9.bcyimg.com/drawer/15294/post/1799t/1f5a87801a0711e898b12b640777720f.jpg ->
 // 1f5a87801a0711e898b12b640777720f, jpg
-func GetNameAndExt(uri string) (string, string, error) {
+// The client requests the content type of the URLs without an extension.
+func GetNameAndExt(client *request.Client, uri string) (string, string, error) {
 	u, err := url.ParseRequestURI(uri)
 	if err != nil {
 		return "", "", err
@@ -227,7 +228,7 @@ func GetNameAndExt(uri string) (string, string, error) {
 	// Image url like this
 	// https://img9.bcyimg.com/drawer/15294/post/1799t/1f5a87801a0711e898b12b640777720f.jpg/w650
 	// has no suffix
-	contentType, err := request.ContentType(uri, uri)
+	contentType, err := client.ContentType(uri, uri)
 	if err != nil {
 		return "", "", err
 	}
@@ -242,17 +243,17 @@ func Md5(text string) string {
 }
 
 // M3u8URLs get all urls from m3u8 url
-func M3u8URLs(uri string) ([]string, error) {
-	return M3u8URLsWithHeaders(uri, nil)
+func M3u8URLs(client *request.Client, uri string) ([]string, error) {
+	return M3u8URLsWithHeaders(client, uri, nil)
 }
 
 // M3u8URLsWithHeaders get all urls from m3u8 url with custom headers
-func M3u8URLsWithHeaders(uri string, headers map[string]string) ([]string, error) {
+func M3u8URLsWithHeaders(client *request.Client, uri string, headers map[string]string) ([]string, error) {
 	if len(uri) == 0 {
 		return nil, errors.New("url is null")
 	}
 
-	html, err := request.Get(uri, "", headers)
+	html, err := client.Get(uri, "", headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -310,7 +310,7 @@ func TestGetNameAndExt(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, _ := GetNameAndExt(tt.args.uri)
+			got, got1, _ := GetNameAndExt(nil, tt.args.uri)
 			if got != tt.want {
 				t.Errorf("GetNameAndExt() got = %v, want %v", got, tt.want)
 			}
@@ -322,7 +322,7 @@ func TestGetNameAndExt(t *testing.T) {
 
 	// error test
 	for _, u := range []string{"https://a.com/a", "test"} {
-		_, _, err := GetNameAndExt(u)
+		_, _, err := GetNameAndExt(nil, u)
 		if err == nil {
 			t.Error()
 		}